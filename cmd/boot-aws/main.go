@@ -218,7 +218,26 @@ func doSetup(a *awscloud.AWS, filename string, flags *pflag.FlagSet, res *resour
 		return err
 	}
 
-	ami, snapshot, err := a.Register(imageName, bucketName, keyName, nil, arch, bootMode, importRole)
+	uefiData, err := getOptionalStringFlag(flags, "uefi-data")
+	if err != nil {
+		return err
+	}
+
+	tpmSupport, err := getOptionalStringFlag(flags, "tpm-support")
+	if err != nil {
+		return err
+	}
+
+	imdsSupport, err := getOptionalStringFlag(flags, "imds-support")
+	if err != nil {
+		return err
+	}
+
+	ami, snapshot, err := a.RegisterWithOptions(imageName, bucketName, keyName, nil, arch, bootMode, importRole, &awscloud.RegisterOptions{
+		UefiData:    uefiData,
+		TpmSupport:  tpmSupport,
+		ImdsSupport: imdsSupport,
+	})
 	if err != nil {
 		return fmt.Errorf("Register(): %s", err.Error())
 	}
@@ -490,6 +509,9 @@ func setupCLI() *cobra.Command {
 	rootFlags.String("ami-name", "", "AMI name")
 	rootFlags.String("arch", "", "arch (x86_64 or aarch64)")
 	rootFlags.String("boot-mode", "", "boot mode (legacy-bios, uefi, uefi-preferred)")
+	rootFlags.String("uefi-data", "", "base64 encoded UEFI variable store of the AMI (requires the uefi or uefi-preferred boot mode)")
+	rootFlags.String("tpm-support", "", "enable NitroTPM for the AMI (v2.0, requires the uefi or uefi-preferred boot mode)")
+	rootFlags.String("imds-support", "", "set to v2.0 to require IMDSv2 for instances of the AMI")
 	rootFlags.String("import-role", "", "name of the import role to be used (default is determined by the AWS API, it's usually 'vmimport')")
 	rootFlags.String("username", "", "name of the user to create on the system")
 	rootFlags.String("ssh-pubkey", "", "path to user's public ssh key")
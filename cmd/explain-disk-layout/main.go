@@ -0,0 +1,216 @@
+// Standalone executable that prints the partition table layouts of an image
+// type (the main disk and any additional disks) for a blueprint and image
+// options, including the offsets, sizes,
+// alignment padding, and the rules that created and resized each entity. This
+// is meant for debugging partition table layouts.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/blueprint"
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/distro"
+	"github.com/osbuild/images/pkg/distrofactory"
+)
+
+// layoutExplainer is implemented by image types that can explain their
+// partition table layout.
+type layoutExplainer interface {
+	ExplainPartitionTable(bp *blueprint.Blueprint, options distro.ImageOptions, rng *rand.Rand) ([]*disk.Layout, error)
+}
+
+func loadBlueprint(path string) (*blueprint.Blueprint, error) {
+	var bp blueprint.Blueprint
+	if path == "" {
+		return &bp, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) == ".toml" {
+		err = toml.Unmarshal(data, &bp)
+	} else {
+		err = json.Unmarshal(data, &bp)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse blueprint %q: %w", path, err)
+	}
+	return &bp, nil
+}
+
+// formatSize returns the size in bytes with a human readable size for
+// sizes of at least 1 KiB.
+func formatSize(size uint64) string {
+	units := []struct {
+		name string
+		size uint64
+	}{
+		{"TiB", datasizes.TiB},
+		{"GiB", datasizes.GiB},
+		{"MiB", datasizes.MiB},
+		{"KiB", datasizes.KiB},
+	}
+	for _, unit := range units {
+		if size >= unit.size {
+			return fmt.Sprintf("%d (%.2f %s)", size, float64(size)/float64(unit.size), unit.name)
+		}
+	}
+	return fmt.Sprintf("%d", size)
+}
+
+func printEntity(w io.Writer, ent disk.LayoutEntity, depth int) {
+	indent := strings.Repeat("  ", depth)
+
+	header := ent.Entity
+	if ent.Name != "" {
+		header += fmt.Sprintf(" %q", ent.Name)
+	}
+	if ent.Mountpoint != "" {
+		header += " " + ent.Mountpoint
+	}
+	fmt.Fprintf(w, "%s%s\n", indent, header)
+
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Fprintf(w, "%s    %-14s %s\n", indent, name+":", value)
+		}
+	}
+	if ent.Entity == "partition" {
+		field("start", formatSize(ent.Start))
+	}
+	if ent.Size > 0 {
+		field("size", formatSize(ent.Size))
+	}
+	if ent.Padding > 0 {
+		field("padding", formatSize(ent.Padding))
+	}
+	field("type", ent.PartType)
+	field("fs type", ent.FSType)
+	field("uuid", ent.UUID)
+	field("label", ent.Label)
+	field("fstab options", ent.FSTabOptions)
+	field("origin", ent.Origin)
+	for _, resize := range ent.Resizes {
+		field("resized", fmt.Sprintf("%s -> %s by %s", formatSize(resize.From), formatSize(resize.To), resize.Rule))
+	}
+
+	for _, child := range ent.Children {
+		printEntity(w, child, depth+1)
+	}
+}
+
+func printLayout(w io.Writer, layout *disk.Layout) {
+	if layout.Name != "" {
+		fmt.Fprintf(w, "%s partition table of additional disk %q\n", layout.Type, layout.Name)
+	} else {
+		fmt.Fprintf(w, "%s partition table\n", layout.Type)
+	}
+	fmt.Fprintf(w, "    %-14s %s\n", "size:", formatSize(layout.Size))
+	fmt.Fprintf(w, "    %-14s %d\n", "sector size:", layout.SectorSize)
+	if layout.UUID != "" {
+		fmt.Fprintf(w, "    %-14s %s\n", "uuid:", layout.UUID)
+	}
+	for _, ent := range layout.Entities {
+		printEntity(w, ent, 1)
+	}
+}
+
+func run() error {
+	var distroName, archName, imgTypeName, bpPath, size, mode string
+	var seed int64
+	var sectorSize uint64
+	var asJSON, deterministicUUIDs bool
+	flag.StringVar(&distroName, "distro", "", "distribution (required)")
+	flag.StringVar(&archName, "arch", arch.Current().String(), "architecture")
+	flag.StringVar(&imgTypeName, "type", "", "image type name (required)")
+	flag.StringVar(&bpPath, "blueprint", "", "blueprint file (json or toml)")
+	flag.StringVar(&size, "size", "", "image size, e.g. \"10 GiB\"")
+	flag.StringVar(&mode, "partitioning-mode", "", "partitioning mode (auto-lvm, lvm, raw, btrfs)")
+	flag.Uint64Var(&sectorSize, "sector-size", 0, "sector size of the disks in bytes (512 or 4096)")
+	flag.Int64Var(&seed, "seed", 0, "seed for the generated UUIDs")
+	flag.BoolVar(&deterministicUUIDs, "deterministic-uuids", false, "derive the UUIDs from the image type and the blueprint name and version")
+	flag.BoolVar(&asJSON, "json", false, "print the layout as json")
+	flag.Parse()
+
+	if distroName == "" || imgTypeName == "" {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	distribution := distrofactory.NewDefault().GetDistro(distroName)
+	if distribution == nil {
+		return fmt.Errorf("invalid or unsupported distribution: %q", distroName)
+	}
+	a, err := distribution.GetArch(archName)
+	if err != nil {
+		return fmt.Errorf("invalid arch name %q for distro %q: %w", archName, distroName, err)
+	}
+	imgType, err := a.GetImageType(imgTypeName)
+	if err != nil {
+		return fmt.Errorf("invalid image type %q for distro %q and arch %q: %w", imgTypeName, distroName, archName, err)
+	}
+	explainer, ok := imgType.(layoutExplainer)
+	if !ok {
+		return fmt.Errorf("image type %q does not support explaining its disk layout", imgTypeName)
+	}
+
+	bp, err := loadBlueprint(bpPath)
+	if err != nil {
+		return err
+	}
+	options := distro.ImageOptions{
+		PartitioningMode:   disk.PartitioningMode(mode),
+		SectorSize:         sectorSize,
+		DeterministicUUIDs: deterministicUUIDs,
+	}
+	if size != "" {
+		options.Size, err = datasizes.Parse(size)
+		if err != nil {
+			return fmt.Errorf("invalid image size %q: %w", size, err)
+		}
+	}
+
+	/* #nosec G404 */
+	rng := rand.New(rand.NewSource(seed))
+	layouts, err := explainer.ExplainPartitionTable(bp, options, rng)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		out, err := json.MarshalIndent(layouts, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+		return nil
+	}
+	for idx, layout := range layouts {
+		if idx > 0 {
+			fmt.Println()
+		}
+		printLayout(os.Stdout, layout)
+	}
+	return nil
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,79 @@
+// Standalone executable that reads the partition table of an existing disk
+// image or an `sfdisk --json` dump and prints it in the format of the
+// partition tables of the image definitions. The partitions have no payloads
+// and need to be completed before they can be used as a base partition table.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/osbuild/images/pkg/disk"
+)
+
+func importPartitionTable(imagePath, sfdiskPath string) (*disk.PartitionTable, error) {
+	if imagePath != "" {
+		f, err := os.Open(imagePath)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return disk.NewPartitionTableFromGPT(f)
+	}
+
+	var data []byte
+	var err error
+	if sfdiskPath == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(sfdiskPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return disk.NewPartitionTableFromSfdiskJSON(data)
+}
+
+func run() error {
+	var imagePath, sfdiskPath string
+	var asJSON bool
+	flag.StringVar(&imagePath, "image", "", "raw disk image with a gpt partition table")
+	flag.StringVar(&sfdiskPath, "sfdisk", "", "output of `sfdisk --json` (\"-\" for stdin)")
+	flag.BoolVar(&asJSON, "json", false, "print the partition table as json")
+	flag.Parse()
+
+	if (imagePath == "") == (sfdiskPath == "") {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	pt, err := importPartitionTable(imagePath, sfdiskPath)
+	if err != nil {
+		return err
+	}
+
+	var out []byte
+	if asJSON {
+		out, err = json.MarshalIndent(pt, "", "  ")
+		out = append(out, '\n')
+	} else {
+		out, err = yaml.Marshal(pt)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Print(string(out))
+	return nil
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 
 	"github.com/osbuild/images/pkg/upload/azure"
@@ -37,6 +39,27 @@ func (t *tags) Set(value string) error {
 	return nil
 }
 
+type targetRegions []azure.GalleryTargetRegion
+
+func (r *targetRegions) String() string {
+	return fmt.Sprintf("%+v", []azure.GalleryTargetRegion(*r))
+}
+
+func (r *targetRegions) Set(value string) error {
+	name, count, found := strings.Cut(value, ":")
+	region := azure.GalleryTargetRegion{Name: name}
+	if found {
+		replicaCount, err := strconv.ParseInt(count, 10, 32)
+		if err != nil {
+			return fmt.Errorf(`-target-region must be in format region[:replicas], "%s" is not valid`, value)
+		}
+		region.ReplicaCount = int32(replicaCount)
+	}
+	*r = append(*r, region)
+
+	return nil
+}
+
 func main() {
 	var storageAccount string
 	var storageAccessKey string
@@ -44,12 +67,44 @@ func main() {
 	var containerName string
 	var threads int
 	tagsArg := tags(make(map[string]string))
+	var tenantID string
+	var subscriptionID string
+	var clientID string
+	var clientSecret string
+	var credentialsPath string
+	var resourceGroup string
+	var location string
+	var galleryDef azure.GalleryImageDefinition
+	var hyperVGen string
+	var securityType string
+	var galleryVersion azure.GalleryImageVersion
+	var replicaCount int
+	var regions targetRegions
 	flag.StringVar(&storageAccount, "storage-account", "", "Azure storage account (mandatory)")
 	flag.StringVar(&storageAccessKey, "storage-access-key", "", "Azure storage access key (mandatory)")
 	flag.StringVar(&fileName, "image", "", "image to upload (mandatory)")
 	flag.StringVar(&containerName, "container", "", "name of storage container (see Azure docs for explanation, mandatory)")
 	flag.IntVar(&threads, "threads", 16, "number of threads for parallel upload")
 	flag.Var(&tagsArg, "tag", "blob tag formatted as key:value (first colon found is considered to be the delimiter), can be specified multiple times")
+	flag.StringVar(&tenantID, "tenant", "", "Azure tenant ID (mandatory for -gallery)")
+	flag.StringVar(&subscriptionID, "subscription", "", "Azure subscription ID (mandatory for -gallery)")
+	flag.StringVar(&clientID, "client-id", "", "Azure client ID of the application")
+	flag.StringVar(&clientSecret, "client-secret", "", "Azure client secret of the application")
+	flag.StringVar(&credentialsPath, "azure-creds", "", "path to a file with the Azure client ID and secret, used instead of -client-id and -client-secret")
+	flag.StringVar(&resourceGroup, "resource-group", "", "resource group of the storage account and the gallery (mandatory for -gallery)")
+	flag.StringVar(&location, "location", "", "location of the gallery, defaults to the location of the resource group")
+	flag.StringVar(&galleryDef.Gallery, "gallery", "", "if set, publish the image into this Azure Compute Gallery")
+	flag.StringVar(&galleryDef.Name, "gallery-image", "", "name of the gallery image definition, it is created if it does not exist")
+	flag.StringVar(&galleryDef.Publisher, "publisher", "", "publisher of the gallery image definition (mandatory if it does not exist yet)")
+	flag.StringVar(&galleryDef.Offer, "offer", "", "offer of the gallery image definition (mandatory if it does not exist yet)")
+	flag.StringVar(&galleryDef.SKU, "sku", "", "SKU of the gallery image definition (mandatory if it does not exist yet)")
+	flag.StringVar(&galleryDef.Architecture, "arch", "", "architecture of the gallery image, x64 (default) or Arm64")
+	flag.StringVar(&hyperVGen, "hyperv-gen", string(azure.HyperVGenV1), "hyper v generation of the gallery image, V1 or V2")
+	flag.StringVar(&securityType, "security-type", string(azure.SecurityTypeStandard), "security type of the gallery image, Standard, TrustedLaunch or ConfidentialVM")
+	flag.StringVar(&galleryVersion.Version, "gallery-image-version", "", "version of the gallery image in the MAJOR.MINOR.PATCH format")
+	flag.Var(&regions, "target-region", "region the gallery image version is replicated to formatted as region[:replicas], can be specified multiple times")
+	flag.IntVar(&replicaCount, "replica-count", 1, "default number of replicas of the gallery image version per region")
+	flag.BoolVar(&galleryVersion.ExcludeFromLatest, "exclude-from-latest", false, "exclude the gallery image version from the latest version")
 	flag.Parse()
 
 	checkStringNotEmpty(storageAccount, "You need to specify storage account")
@@ -57,6 +112,52 @@ func main() {
 	checkStringNotEmpty(fileName, "You need to specify image file")
 	checkStringNotEmpty(containerName, "You need to specify container name")
 
+	var client *azure.Client
+	if galleryDef.Gallery != "" {
+		checkStringNotEmpty(tenantID, "You need to specify the tenant for -gallery")
+		checkStringNotEmpty(subscriptionID, "You need to specify the subscription for -gallery")
+		checkStringNotEmpty(resourceGroup, "You need to specify the resource group for -gallery")
+		checkStringNotEmpty(galleryDef.Name, "You need to specify the gallery image for -gallery")
+		checkStringNotEmpty(galleryVersion.Version, "You need to specify the gallery image version for -gallery")
+
+		credentials := azure.NewCredentials(clientID, clientSecret)
+		if credentialsPath != "" {
+			creds, err := azure.ParseAzureCredentialsFile(credentialsPath)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			credentials = *creds
+		}
+
+		galleryDef.HyperVGeneration = azure.HyperVGenerationType(hyperVGen)
+		galleryDef.SecurityType = azure.SecurityType(securityType)
+		galleryVersion.ReplicaCount = int32(replicaCount) // #nosec G115
+		galleryVersion.TargetRegions = regions
+
+		var err error
+		client, err = azure.NewClient(credentials, tenantID, subscriptionID)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
+	if client != nil {
+		// the definition is ensured before the upload, so that missing
+		// flags are reported early
+		fmt.Printf("Ensuring gallery image definition %s/%s\n", galleryDef.Gallery, galleryDef.Name)
+		err := client.EnsureGalleryImageDefinition(context.Background(), resourceGroup, location, &galleryDef)
+		if errors.Is(err, azure.ErrGalleryImageIdentifierRequired) {
+			fmt.Printf("You need to specify -publisher, -offer and -sku to create the gallery image definition %s\n", galleryDef.Name)
+			os.Exit(1)
+		}
+		if err != nil {
+			fmt.Println("Gallery image definition error: ", err)
+			os.Exit(1)
+		}
+	}
+
 	fmt.Println("Image to upload is:", fileName)
 
 	c, err := azure.NewStorageClient(storageAccount, storageAccessKey)
@@ -86,4 +187,17 @@ func main() {
 		fmt.Println("Tagging error: ", err)
 		os.Exit(1)
 	}
+
+	if client == nil {
+		return
+	}
+
+	ctx := context.Background()
+	fmt.Printf("Publishing image version %s/%s/%s\n", galleryDef.Gallery, galleryDef.Name, galleryVersion.Version)
+	id, err := client.CreateGalleryImageVersion(ctx, resourceGroup, storageAccount, containerName, blobName, location, &galleryDef, &galleryVersion)
+	if err != nil {
+		fmt.Println("Publishing error: ", err)
+		os.Exit(1)
+	}
+	fmt.Println("Image version published:", id)
 }
@@ -33,6 +33,10 @@ func main() {
 	var imageName string
 	var imageFile string
 	var shareWith strArrayFlag
+	var guestOSFeatureTypes strArrayFlag
+	var extraGuestOSFeatureTypes strArrayFlag
+	var family string
+	var deprecatePrevious bool
 
 	var skipUpload bool
 	var skipImport bool
@@ -45,19 +49,40 @@ func main() {
 	flag.StringVar(&imageName, "image-name", "", "Image name after import to Compute Engine")
 	flag.StringVar(&imageFile, "image", "", "Image file to upload")
 	flag.Var(&shareWith, "share-with", "Accounts to share the image with. Can be set multiple times. Allowed values are 'user:{emailid}' / 'serviceAccount:{emailid}' / 'group:{emailid}' / 'domain:{domain}'.")
+	flag.Var(&guestOSFeatureTypes, "guest-os-feature", "Guest OS feature of the image, overrides the features of -os-family. Can be set multiple times.")
+	flag.Var(&extraGuestOSFeatureTypes, "extra-guest-os-feature", "Guest OS feature added to the features of the image, e.g. 'SEV_SNP_CAPABLE' or 'TDX_CAPABLE'. Can be set multiple times.")
+	flag.StringVar(&family, "family", "", "Image family to insert the image into")
+	flag.BoolVar(&deprecatePrevious, "deprecate-previous", false, "Deprecate the previous latest image of the -family")
 	flag.BoolVar(&skipUpload, "skip-upload", false, "Use to skip Image Upload step")
 	flag.BoolVar(&skipImport, "skip-import", false, "Use to skip Image Import step")
 	flag.Parse()
 
 	var guestOSFeatures []*computepb.GuestOsFeature
 
-	switch osFamily {
-	case "rhel-8":
-		guestOSFeatures = gcp.GuestOsFeaturesRHEL8
-	case "rhel-9":
-		guestOSFeatures = gcp.GuestOsFeaturesRHEL9
-	default:
-		olog.Fatalf("[GCP] Unknown OS Family %q. Use one of: 'rhel-8', 'rhel-9'.", osFamily)
+	if len(guestOSFeatureTypes) > 0 {
+		var err error
+		guestOSFeatures, err = gcp.GuestOsFeatures(guestOSFeatureTypes...)
+		if err != nil {
+			olog.Fatalf("[GCP] %v", err)
+		}
+	} else {
+		switch osFamily {
+		case "rhel-8":
+			guestOSFeatures = gcp.GuestOsFeaturesRHEL8
+		case "rhel-9":
+			guestOSFeatures = gcp.GuestOsFeaturesRHEL9
+		default:
+			olog.Fatalf("[GCP] Unknown OS Family %q. Use one of: 'rhel-8', 'rhel-9'.", osFamily)
+		}
+	}
+	extraGuestOSFeatures, err := gcp.GuestOsFeatures(extraGuestOSFeatureTypes...)
+	if err != nil {
+		olog.Fatalf("[GCP] %v", err)
+	}
+	guestOSFeatures = gcp.AppendGuestOsFeatures(guestOSFeatures, extraGuestOSFeatures...)
+
+	if deprecatePrevious && family == "" {
+		olog.Fatalf("[GCP] -deprecate-previous requires -family")
 	}
 
 	var credentials []byte
@@ -88,8 +113,19 @@ func main() {
 
 	// Import Image to Compute Engine
 	if !skipImport {
+		var previous *computepb.Image
+		if deprecatePrevious {
+			previous, err = g.ComputeImageFromFamily(ctx, family)
+			if err != nil {
+				olog.Fatalf("[GCP] Getting the latest image of family %q failed: %v", family, err)
+			}
+		}
+
 		olog.Printf("[GCP] 📥 Importing image into Compute Engine as '%s'", imageName)
-		_, importErr := g.ComputeImageInsert(ctx, bucketName, objectName, imageName, regions, guestOSFeatures)
+		image, importErr := g.ComputeImageInsertWithOptions(ctx, bucketName, objectName, imageName, regions, &gcp.ComputeImageInsertOptions{
+			GuestOsFeatures: guestOSFeatures,
+			Family:          family,
+		})
 
 		// Cleanup storage before checking for errors
 		olog.Printf("[GCP] 🧹 Deleting uploaded image file: %s/%s", bucketName, objectName)
@@ -102,6 +138,14 @@ func main() {
 			olog.Fatalf("[GCP] Importing image failed: %v", importErr)
 		}
 		olog.Printf("[GCP] 💿 Image URL: %s", g.ComputeImageURL(imageName))
+
+		if previous != nil && previous.GetName() != imageName {
+			olog.Printf("[GCP] 🗄️ Deprecating previous image '%s' of family '%s'", previous.GetName(), family)
+			err = g.ComputeImageDeprecate(ctx, previous.GetName(), computepb.DeprecationStatus_DEPRECATED.String(), image.GetSelfLink())
+			if err != nil {
+				olog.Fatalf("[GCP] Deprecating image failed: %v", err)
+			}
+		}
 	}
 
 	// Share the imported Image with specified accounts using IAM policy
@@ -4,12 +4,28 @@ import (
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-
-	"github.com/osbuild/images/pkg/cloud/awscloud"
+	"github.com/osbuild/images/pkg/cloud/s3"
 )
 
+type tags map[string]string
+
+func (t *tags) String() string {
+	return ""
+}
+
+func (t *tags) Set(value string) error {
+	splitValue := strings.SplitN(value, "=", 2)
+	if len(splitValue) < 2 {
+		return fmt.Errorf(`-tag must be in format key=value, "%s" is not valid`, value)
+	}
+	(*t)[splitValue[0]] = splitValue[1]
+
+	return nil
+}
+
 func main() {
 	var accessKeyID string
 	var secretAccessKey string
@@ -22,10 +38,14 @@ func main() {
 	var keyName string
 	var filename string
 	var public bool
+	var presign time.Duration
+	var partSize int64
+	var concurrency int
+	tagsArg := tags(make(map[string]string))
 	flag.StringVar(&accessKeyID, "access-key-id", "", "access key ID")
 	flag.StringVar(&secretAccessKey, "secret-access-key", "", "secret access key")
 	flag.StringVar(&sessionToken, "session-token", "", "session token")
-	flag.StringVar(&region, "region", "", "target region")
+	flag.StringVar(&region, "region", "us-east-1", "target region")
 	flag.StringVar(&endpoint, "endpoint", "", "target endpoint")
 	flag.StringVar(&caBundle, "ca-bundle", "", "path to CA bundle for the S3 server")
 	flag.BoolVar(&skipSSLVerification, "skip-ssl-verification", false, "Skip the verification of the server SSL certificate")
@@ -33,27 +53,40 @@ func main() {
 	flag.StringVar(&keyName, "key", "", "target S3 key name")
 	flag.StringVar(&filename, "image", "", "image file to upload")
 	flag.BoolVar(&public, "public", false, "if set, the S3 object is marked as public (default: false)")
+	flag.Var(&tagsArg, "tag", "object tag formatted as key=value, can be specified multiple times")
+	flag.DurationVar(&presign, "presign", 0, "if set, print a presigned URL of the S3 object that is valid for the given duration")
+	flag.Int64Var(&partSize, "part-size", s3.DefaultPartSize, "size of the parts of multipart uploads in bytes")
+	flag.IntVar(&concurrency, "concurrency", 0, "number of parts that are uploaded in parallel")
 	flag.Parse()
 
-	a, err := awscloud.NewForEndpoint(endpoint, region, accessKeyID, secretAccessKey, sessionToken, caBundle, skipSSLVerification)
+	uploader, err := s3.NewUploader(bucketName, keyName, &s3.UploaderOptions{
+		Endpoint:            endpoint,
+		Region:              region,
+		AccessKeyID:         accessKeyID,
+		SecretAccessKey:     secretAccessKey,
+		SessionToken:        sessionToken,
+		CABundle:            caBundle,
+		SkipSSLVerification: skipSSLVerification,
+		Tags:                tagsArg,
+		Public:              public,
+		PresignExpiry:       presign,
+		PartSize:            partSize,
+		Concurrency:         concurrency,
+	})
 	if err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
 
-	uploadOutput, err := a.Upload(filename, bucketName, keyName)
+	f, err := os.Open(filename)
 	if err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
+	defer f.Close()
 
-	if public {
-		err := a.MarkS3ObjectAsPublic(bucketName, keyName)
-		if err != nil {
-			fmt.Println(err.Error())
-			os.Exit(1)
-		}
+	if err := uploader.UploadAndRegister(f, os.Stdout); err != nil {
+		fmt.Println(err.Error())
+		os.Exit(1)
 	}
-
-	fmt.Printf("file uploaded to %s\n", aws.StringValue(&uploadOutput.Location))
 }
@@ -4,6 +4,8 @@ type Artifact struct {
 	export   string
 	filename string
 	mimeType string
+
+	additionalFilenames []string
 }
 
 func New(export, filename string, mimeType *string) *Artifact {
@@ -29,3 +31,15 @@ func (a *Artifact) Filename() string {
 func (a *Artifact) MIMEType() string {
 	return a.mimeType
 }
+
+// AdditionalFilenames returns the names of the files that are exported next
+// to the main file of the artifact, e.g. the image files of additional disks.
+func (a *Artifact) AdditionalFilenames() []string {
+	return a.additionalFilenames
+}
+
+// AddAdditionalFilename adds a file that is exported next to the main file of
+// the artifact, see AdditionalFilenames.
+func (a *Artifact) AddAdditionalFilename(filename string) {
+	a.additionalFilenames = append(a.additionalFilenames, filename)
+}
@@ -0,0 +1,114 @@
+package blueprint
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// CryptoPolicyCustomization selects the system-wide cryptographic policy,
+// see update-crypto-policies(8).
+type CryptoPolicyCustomization struct {
+	// Name of the base policy, e.g. "DEFAULT" or "FUTURE". Subpolicy
+	// modules can be appended with colons, e.g. "DEFAULT:NO-SHA1". Defaults
+	// to "FIPS" if the FIPS customization is enabled and to "DEFAULT"
+	// otherwise.
+	Policy string `json:"policy,omitempty" toml:"policy,omitempty"`
+	// Subpolicy modules applied on top of the base policy
+	Modules []string `json:"modules,omitempty" toml:"modules,omitempty"`
+	// Subpolicy modules to create in the image, they are applied when they
+	// are listed in the policy or the modules
+	CustomModules []CryptoPolicyModuleCustomization `json:"custom_modules,omitempty" toml:"custom_modules,omitempty"`
+}
+
+// CryptoPolicyModuleCustomization is the content of a subpolicy module
+// file (.pmod), see crypto-policies(7).
+type CryptoPolicyModuleCustomization struct {
+	Name     string `json:"name" toml:"name"`
+	Contents string `json:"contents" toml:"contents"`
+}
+
+var cryptoPolicyNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// GetBasePolicy returns the name of the base policy, without the modules,
+// or an empty string if it is not set.
+func (cp *CryptoPolicyCustomization) GetBasePolicy() string {
+	if cp == nil {
+		return ""
+	}
+	base, _, _ := strings.Cut(cp.Policy, ":")
+	return base
+}
+
+// GetModules returns the subpolicy modules appended to the policy followed
+// by the modules.
+func (cp *CryptoPolicyCustomization) GetModules() []string {
+	if cp == nil {
+		return nil
+	}
+	var modules []string
+	if _, policyModules, found := strings.Cut(cp.Policy, ":"); found {
+		modules = strings.Split(policyModules, ":")
+	}
+	return append(modules, cp.Modules...)
+}
+
+// Validate checks the names of the policy and the modules and the syntax of
+// the custom modules.
+func (cp *CryptoPolicyCustomization) Validate() error {
+	if cp == nil {
+		return nil
+	}
+
+	if base := cp.GetBasePolicy(); cp.Policy != "" && !cryptoPolicyNameRegex.MatchString(base) {
+		return fmt.Errorf("crypto policy: policy name %q is invalid", base)
+	}
+
+	modules := cp.GetModules()
+	for i, module := range modules {
+		if !cryptoPolicyNameRegex.MatchString(module) {
+			return fmt.Errorf("crypto policy: module name %q is invalid", module)
+		}
+		if slices.Contains(modules[:i], module) {
+			return fmt.Errorf("crypto policy: module %q is applied more than once", module)
+		}
+	}
+
+	customModules := make(map[string]bool, len(cp.CustomModules))
+	for _, cm := range cp.CustomModules {
+		if !cryptoPolicyNameRegex.MatchString(cm.Name) {
+			return fmt.Errorf("crypto policy: custom module name %q is invalid", cm.Name)
+		}
+		if customModules[cm.Name] {
+			return fmt.Errorf("crypto policy: custom module %q is defined more than once", cm.Name)
+		}
+		customModules[cm.Name] = true
+		if !slices.Contains(modules, cm.Name) {
+			return fmt.Errorf("crypto policy: custom module %q is not applied, add it to the modules", cm.Name)
+		}
+		if err := validateCryptoPolicyModule(cm.Contents); err != nil {
+			return fmt.Errorf("crypto policy: custom module %q: %w", cm.Name, err)
+		}
+	}
+	return nil
+}
+
+// validateCryptoPolicyModule checks that every line of a module is a
+// comment or a "key = value" directive.
+func validateCryptoPolicyModule(contents string) error {
+	if strings.TrimSpace(contents) == "" {
+		return fmt.Errorf("contents are empty")
+	}
+	for i, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, _, found := strings.Cut(line, "=")
+		if !found || strings.TrimSpace(key) == "" {
+			return fmt.Errorf("line %d: expected a \"key = value\" directive: %q", i+1, line)
+		}
+	}
+	return nil
+}
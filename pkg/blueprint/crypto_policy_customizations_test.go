@@ -0,0 +1,96 @@
+package blueprint
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCryptoPolicyCustomizationTOML(t *testing.T) {
+	input := `
+[customizations.crypto_policy]
+policy = "DEFAULT:NO-SHA1"
+modules = ["NO-CAMELLIA-CBC"]
+
+[[customizations.crypto_policy.custom_modules]]
+name = "NO-CAMELLIA-CBC"
+contents = """
+# disable the CAMELLIA ciphers in CBC mode
+cipher = -CAMELLIA-*-CBC
+"""
+`
+	var bp Blueprint
+	_, err := toml.Decode(input, &bp)
+	require.NoError(t, err)
+
+	cp, err := bp.Customizations.GetCryptoPolicy()
+	require.NoError(t, err)
+	assert.Equal(t, "DEFAULT", cp.GetBasePolicy())
+	assert.Equal(t, []string{"NO-SHA1", "NO-CAMELLIA-CBC"}, cp.GetModules())
+	assert.Equal(t, []CryptoPolicyModuleCustomization{
+		{Name: "NO-CAMELLIA-CBC", Contents: "# disable the CAMELLIA ciphers in CBC mode\ncipher = -CAMELLIA-*-CBC\n"},
+	}, cp.CustomModules)
+
+	cp = &CryptoPolicyCustomization{Modules: []string{"OSPP"}}
+	assert.Equal(t, "", cp.GetBasePolicy())
+	assert.Equal(t, []string{"OSPP"}, cp.GetModules())
+}
+
+func TestCryptoPolicyCustomizationValidate(t *testing.T) {
+	testCases := map[string]struct {
+		cp  *CryptoPolicyCustomization
+		err string
+	}{
+		"policy": {
+			cp:  &CryptoPolicyCustomization{Policy: "DEFAULT FUTURE"},
+			err: `crypto policy: policy name "DEFAULT FUTURE" is invalid`,
+		},
+		"policy-empty": {
+			cp:  &CryptoPolicyCustomization{Policy: ":NO-SHA1"},
+			err: `crypto policy: policy name "" is invalid`,
+		},
+		"module": {
+			cp:  &CryptoPolicyCustomization{Policy: "DEFAULT:"},
+			err: `crypto policy: module name "" is invalid`,
+		},
+		"module-duplicate": {
+			cp:  &CryptoPolicyCustomization{Policy: "DEFAULT:NO-SHA1", Modules: []string{"NO-SHA1"}},
+			err: `crypto policy: module "NO-SHA1" is applied more than once`,
+		},
+		"custom-module-name": {
+			cp:  &CryptoPolicyCustomization{CustomModules: []CryptoPolicyModuleCustomization{{Name: "../NO-SHA1", Contents: "hash = -SHA1"}}},
+			err: `crypto policy: custom module name "../NO-SHA1" is invalid`,
+		},
+		"custom-module-duplicate": {
+			cp: &CryptoPolicyCustomization{
+				Modules: []string{"LOCAL"},
+				CustomModules: []CryptoPolicyModuleCustomization{
+					{Name: "LOCAL", Contents: "hash = -SHA1"},
+					{Name: "LOCAL", Contents: "cipher = -CAMELLIA-*"},
+				},
+			},
+			err: `crypto policy: custom module "LOCAL" is defined more than once`,
+		},
+		"custom-module-unused": {
+			cp:  &CryptoPolicyCustomization{CustomModules: []CryptoPolicyModuleCustomization{{Name: "LOCAL", Contents: "hash = -SHA1"}}},
+			err: `crypto policy: custom module "LOCAL" is not applied, add it to the modules`,
+		},
+		"custom-module-empty": {
+			cp:  &CryptoPolicyCustomization{Modules: []string{"LOCAL"}, CustomModules: []CryptoPolicyModuleCustomization{{Name: "LOCAL", Contents: "\n"}}},
+			err: `crypto policy: custom module "LOCAL": contents are empty`,
+		},
+		"custom-module-syntax": {
+			cp:  &CryptoPolicyCustomization{Modules: []string{"LOCAL"}, CustomModules: []CryptoPolicyModuleCustomization{{Name: "LOCAL", Contents: "# comment\nhash -SHA1\n"}}},
+			err: `crypto policy: custom module "LOCAL": line 2: expected a "key = value" directive: "hash -SHA1"`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := (&Customizations{CryptoPolicy: tc.cp}).GetCryptoPolicy()
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
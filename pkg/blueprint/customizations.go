@@ -34,6 +34,15 @@ type Customizations struct {
 	RPM                *RPMCustomization              `json:"rpm,omitempty" toml:"rpm,omitempty"`
 	RHSM               *RHSMCustomization             `json:"rhsm,omitempty" toml:"rhsm,omitempty"`
 	CACerts            *CACustomization               `json:"cacerts,omitempty" toml:"cacerts,omitempty"`
+	Network            *NetworkCustomization          `json:"network,omitempty" toml:"network,omitempty"`
+	Sysctl             []SysctlCustomization          `json:"sysctl,omitempty" toml:"sysctl,omitempty"`
+	Modprobe           *ModprobeCustomization         `json:"modprobe,omitempty" toml:"modprobe,omitempty"`
+	Dracut             *DracutCustomization           `json:"dracut,omitempty" toml:"dracut,omitempty"`
+	SSHServer          *SSHServerCustomization        `json:"sshd,omitempty" toml:"sshd,omitempty"`
+	PasswordQuality    *PasswordQualityCustomization  `json:"pwquality,omitempty" toml:"pwquality,omitempty"`
+	Limits             []LimitCustomization           `json:"limits,omitempty" toml:"limits,omitempty"`
+	CryptoPolicy       *CryptoPolicyCustomization     `json:"crypto_policy,omitempty" toml:"crypto_policy,omitempty"`
+	Sudoers            *SudoersCustomization          `json:"sudoers,omitempty" toml:"sudoers,omitempty"`
 }
 
 type IgnitionCustomization struct {
@@ -469,3 +478,111 @@ func (c *Customizations) GetCACerts() (*CACustomization, error) {
 
 	return c.CACerts, nil
 }
+
+func (c *Customizations) GetNetwork() (*NetworkCustomization, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	if err := c.Network.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c.Network, nil
+}
+
+func (c *Customizations) GetSysctl() ([]SysctlCustomization, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	if err := validateSysctl(c.Sysctl); err != nil {
+		return nil, err
+	}
+
+	return c.Sysctl, nil
+}
+
+func (c *Customizations) GetModprobe() (*ModprobeCustomization, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	if err := c.Modprobe.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c.Modprobe, nil
+}
+
+func (c *Customizations) GetDracut() (*DracutCustomization, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	if err := c.Dracut.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c.Dracut, nil
+}
+
+func (c *Customizations) GetSSHServer() (*SSHServerCustomization, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	if err := c.SSHServer.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c.SSHServer, nil
+}
+
+func (c *Customizations) GetPasswordQuality() (*PasswordQualityCustomization, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	if err := c.PasswordQuality.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c.PasswordQuality, nil
+}
+
+func (c *Customizations) GetLimits() ([]LimitCustomization, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	if err := validateLimits(c.Limits); err != nil {
+		return nil, err
+	}
+
+	return c.Limits, nil
+}
+
+func (c *Customizations) GetCryptoPolicy() (*CryptoPolicyCustomization, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	if err := c.CryptoPolicy.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c.CryptoPolicy, nil
+}
+
+func (c *Customizations) GetSudoers() (*SudoersCustomization, error) {
+	if c == nil {
+		return nil, nil
+	}
+
+	if err := c.Sudoers.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c.Sudoers, nil
+}
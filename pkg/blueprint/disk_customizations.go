@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"maps"
 	"path/filepath"
 	"regexp"
 	"slices"
@@ -17,17 +18,28 @@ import (
 )
 
 type DiskCustomization struct {
+	// Name of the disk. Required for additional disks, where it is used to
+	// name the image file of the disk, and must be empty for the main disk.
+	Name string
 	// Type of the partition table: gpt or dos.
 	// Optional, the default depends on the distro and image type.
 	Type       string
 	MinSize    uint64
 	Partitions []PartitionCustomization
+
+	// Disks of the image in addition to the main disk, which holds the
+	// operating system. Each additional disk is created as its own image
+	// file. Filesystems on additional disks are mounted via /etc/fstab (or
+	// mount units) and cannot hold the root filesystem or /boot.
+	AdditionalDisks []DiskCustomization
 }
 
 type diskCustomizationMarshaler struct {
-	Type       string                   `json:"type,omitempty" toml:"type,omitempty"`
-	MinSize    datasizes.Size           `json:"minsize,omitempty" toml:"minsize,omitempty"`
-	Partitions []PartitionCustomization `json:"partitions,omitempty" toml:"partitions,omitempty"`
+	Name            string                   `json:"name,omitempty" toml:"name,omitempty"`
+	Type            string                   `json:"type,omitempty" toml:"type,omitempty"`
+	MinSize         datasizes.Size           `json:"minsize,omitempty" toml:"minsize,omitempty"`
+	Partitions      []PartitionCustomization `json:"partitions,omitempty" toml:"partitions,omitempty"`
+	AdditionalDisks []DiskCustomization      `json:"additional_disks,omitempty" toml:"additional_disks,omitempty"`
 }
 
 func (dc *DiskCustomization) UnmarshalJSON(data []byte) error {
@@ -35,9 +47,11 @@ func (dc *DiskCustomization) UnmarshalJSON(data []byte) error {
 	if err := json.Unmarshal(data, &dcm); err != nil {
 		return err
 	}
+	dc.Name = dcm.Name
 	dc.Type = dcm.Type
 	dc.MinSize = dcm.MinSize.Uint64()
 	dc.Partitions = dcm.Partitions
+	dc.AdditionalDisks = dcm.AdditionalDisks
 
 	return nil
 }
@@ -54,6 +68,8 @@ func (dc *DiskCustomization) UnmarshalTOML(data any) error {
 //     extra fields
 //   - btrfs: the payload will be a btrfs volume. See
 //     [BtrfsVolumeCustomization] for extra fields.
+//
+// Any payload can be encrypted with LUKS, see [EncryptionCustomization].
 type PartitionCustomization struct {
 	// The type of payload for the partition (optional, defaults to "plain").
 	Type string `json:"type" toml:"type"`
@@ -81,6 +97,14 @@ type PartitionCustomization struct {
 	// Note: This is the unique uuid, not the type guid, that is PartType
 	PartUUID string `json:"part_uuid,omitempty" toml:"part_uuid,omitempty"`
 
+	// Encrypt the payload of the partition (optional).
+	Encryption *EncryptionCustomization `json:"encryption,omitempty" toml:"encryption,omitempty"`
+
+	// Grow the partition to fill the remaining space of the disk (optional).
+	// By default, the partition of the root filesystem grows. Only one
+	// partition or logical volume per disk can be marked to grow.
+	Grow bool `json:"grow,omitempty" toml:"grow,omitempty"`
+
 	BtrfsVolumeCustomization
 
 	VGCustomization
@@ -88,6 +112,54 @@ type PartitionCustomization struct {
 	FilesystemTypedCustomization
 }
 
+// EncryptionCustomization wraps the payload of a partition (a filesystem,
+// LVM volume group, or btrfs volume) in a LUKS2 container.
+type EncryptionCustomization struct {
+	// Passphrase to unlock the container (required). It can be
+	// removed at the end of the build if the container is bound with
+	// clevis, see [ClevisCustomization].
+	Passphrase string `json:"passphrase" toml:"passphrase"`
+
+	// Label of the LUKS container (optional).
+	Label string `json:"label,omitempty" toml:"label,omitempty"`
+
+	// Cipher used for the encryption (optional, defaults to the
+	// default of cryptsetup).
+	Cipher string `json:"cipher,omitempty" toml:"cipher,omitempty"`
+
+	// Bind the container to a clevis policy so that it can be unlocked
+	// automatically (optional).
+	Clevis *ClevisCustomization `json:"clevis,omitempty" toml:"clevis,omitempty"`
+}
+
+// ClevisCustomization binds a LUKS container to a clevis pin.
+// See clevis-luks-bind(1).
+type ClevisCustomization struct {
+	// The clevis pin: "null", "tang", or "sss". The container is bound
+	// when the image is built, so the "tpm2" pin is not supported: it
+	// would bind the container to the TPM of the build host. Containers
+	// that are unlocked with a TPM must be bound on the first boot, e.g.
+	// by replacing a "null" binding.
+	Pin string `json:"pin" toml:"pin"`
+
+	// The JSON configuration of the pin, e.g.
+	// {"url":"http://tang.example.com","adv":{...}} for tang (required for
+	// tang and sss, defaults to "{}" for null). Tang policies must contain
+	// the advertisement of the server ("adv") as the build has no access
+	// to the server.
+	Policy string `json:"policy,omitempty" toml:"policy,omitempty"`
+
+	// Remove the passphrase at the end of the build so that the
+	// container can only be unlocked with the clevis pin.
+	RemovePassphrase bool `json:"remove_passphrase,omitempty" toml:"remove_passphrase,omitempty"`
+}
+
+var validClevisPins = []string{
+	"null",
+	"sss",
+	"tang",
+}
+
 // A filesystem on a plain partition or LVM logical volume.
 // Note the differences from [FilesystemCustomization]:
 //   - Adds a label.
@@ -97,7 +169,9 @@ type PartitionCustomization struct {
 //     ([LVCustomization]).
 //
 // Setting the FSType to "swap" creates a swap area (and the Mountpoint must be
-// empty).
+// empty). The read-only "erofs" FSType is only supported for the root
+// filesystem on a plain partition, it is created from the content of the
+// image and cannot have a label.
 type FilesystemTypedCustomization struct {
 	Mountpoint string `json:"mountpoint" toml:"mountpoint"`
 	Label      string `json:"label,omitempty" toml:"label,omitempty"`
@@ -118,6 +192,10 @@ type LVCustomization struct {
 	// Minimum size of the logical volume
 	MinSize uint64 `json:"minsize,omitempty" toml:"minsize,omitempty"`
 
+	// Grow the logical volume to fill the remaining space of the disk
+	// (optional). The partition of the volume group grows with it.
+	Grow bool `json:"grow,omitempty" toml:"grow,omitempty"`
+
 	FilesystemTypedCustomization
 }
 
@@ -127,6 +205,7 @@ func (lv *LVCustomization) UnmarshalJSON(data []byte) error {
 	var lvAnySize struct {
 		Name    string `json:"name,omitempty" toml:"name,omitempty"`
 		MinSize any    `json:"minsize,omitempty" toml:"minsize,omitempty"`
+		Grow    bool   `json:"grow,omitempty" toml:"grow,omitempty"`
 		FilesystemTypedCustomization
 	}
 	if err := json.Unmarshal(data, &lvAnySize); err != nil {
@@ -134,6 +213,7 @@ func (lv *LVCustomization) UnmarshalJSON(data []byte) error {
 	}
 
 	lv.Name = lvAnySize.Name
+	lv.Grow = lvAnySize.Grow
 	lv.FilesystemTypedCustomization = lvAnySize.FilesystemTypedCustomization
 
 	if lvAnySize.MinSize == nil {
@@ -176,6 +256,7 @@ func (v *PartitionCustomization) UnmarshalJSON(data []byte) error {
 		PartType  string `json:"part_type"`
 		PartLabel string `json:"part_label"`
 		PartUUID  string `json:"part_uuid"`
+		Grow      bool   `json:"grow"`
 	}
 	if err := json.Unmarshal(data, &typeSniffer); err != nil {
 		return fmt.Errorf("%s %w", errPrefix, err)
@@ -207,6 +288,7 @@ func (v *PartitionCustomization) UnmarshalJSON(data []byte) error {
 	v.PartType = typeSniffer.PartType
 	v.PartLabel = typeSniffer.PartLabel
 	v.PartUUID = typeSniffer.PartUUID
+	v.Grow = typeSniffer.Grow
 
 	if typeSniffer.MinSize == nil {
 		return fmt.Errorf("minsize is required")
@@ -226,13 +308,15 @@ func (v *PartitionCustomization) UnmarshalJSON(data []byte) error {
 // the type is "plain", none of the fields for btrfs or lvm are used.
 func decodePlain(v *PartitionCustomization, data []byte) error {
 	var plain struct {
-		// Type, minsize, and part_* are handled by the caller. These are added here to
+		// Type, minsize, part_*, and grow are handled by the caller. These are added here to
 		// satisfy "DisallowUnknownFields" when decoding.
-		Type      string `json:"type"`
-		MinSize   any    `json:"minsize"`
-		PartType  string `json:"part_type"`
-		PartLabel string `json:"part_label"`
-		PartUUID  string `json:"part_uuid"`
+		Type       string                   `json:"type"`
+		MinSize    any                      `json:"minsize"`
+		PartType   string                   `json:"part_type"`
+		PartLabel  string                   `json:"part_label"`
+		PartUUID   string                   `json:"part_uuid"`
+		Grow       bool                     `json:"grow"`
+		Encryption *EncryptionCustomization `json:"encryption"`
 		FilesystemTypedCustomization
 	}
 
@@ -244,6 +328,7 @@ func decodePlain(v *PartitionCustomization, data []byte) error {
 	}
 
 	v.FilesystemTypedCustomization = plain.FilesystemTypedCustomization
+	v.Encryption = plain.Encryption
 	return nil
 }
 
@@ -252,13 +337,15 @@ func decodePlain(v *PartitionCustomization, data []byte) error {
 // the type is btrfs, none of the fields for plain or lvm are used.
 func decodeBtrfs(v *PartitionCustomization, data []byte) error {
 	var btrfs struct {
-		// Type, minsize, and part_* are handled by the caller. These are added here to
+		// Type, minsize, part_*, and grow are handled by the caller. These are added here to
 		// satisfy "DisallowUnknownFields" when decoding.
-		Type      string `json:"type"`
-		MinSize   any    `json:"minsize"`
-		PartType  string `json:"part_type"`
-		PartLabel string `json:"part_label"`
-		PartUUID  string `json:"part_uuid"`
+		Type       string                   `json:"type"`
+		MinSize    any                      `json:"minsize"`
+		PartType   string                   `json:"part_type"`
+		PartLabel  string                   `json:"part_label"`
+		PartUUID   string                   `json:"part_uuid"`
+		Grow       bool                     `json:"grow"`
+		Encryption *EncryptionCustomization `json:"encryption"`
 		BtrfsVolumeCustomization
 	}
 
@@ -270,6 +357,7 @@ func decodeBtrfs(v *PartitionCustomization, data []byte) error {
 	}
 
 	v.BtrfsVolumeCustomization = btrfs.BtrfsVolumeCustomization
+	v.Encryption = btrfs.Encryption
 	return nil
 }
 
@@ -278,13 +366,15 @@ func decodeBtrfs(v *PartitionCustomization, data []byte) error {
 // is lvm, none of the fields for plain or btrfs are used.
 func decodeLVM(v *PartitionCustomization, data []byte) error {
 	var vg struct {
-		// Type, minsize, and part_* are handled by the caller. These are added here to
+		// Type, minsize, part_*, and grow are handled by the caller. These are added here to
 		// satisfy "DisallowUnknownFields" when decoding.
-		Type      string `json:"type"`
-		MinSize   any    `json:"minsize"`
-		PartType  string `json:"part_type"`
-		PartLabel string `json:"part_label"`
-		PartUUID  string `json:"part_uuid"`
+		Type       string                   `json:"type"`
+		MinSize    any                      `json:"minsize"`
+		PartType   string                   `json:"part_type"`
+		PartLabel  string                   `json:"part_label"`
+		PartUUID   string                   `json:"part_uuid"`
+		Grow       bool                     `json:"grow"`
+		Encryption *EncryptionCustomization `json:"encryption"`
 		VGCustomization
 	}
 
@@ -295,6 +385,7 @@ func decodeLVM(v *PartitionCustomization, data []byte) error {
 	}
 
 	v.VGCustomization = vg.VGCustomization
+	v.Encryption = vg.Encryption
 	return nil
 }
 
@@ -343,6 +434,14 @@ func (v *PartitionCustomization) UnmarshalTOML(data any) error {
 
 	v.Type = partType
 
+	if growField, ok := d["grow"]; ok {
+		grow, ok := growField.(bool)
+		if !ok {
+			return fmt.Errorf("%s grow must be a boolean, got \"%v\" of type %T", errPrefix, growField, growField)
+		}
+		v.Grow = grow
+	}
+
 	minsizeField, ok := d["minsize"]
 	if !ok {
 		return fmt.Errorf("minsize is required")
@@ -365,12 +464,19 @@ func (v *PartitionCustomization) UnmarshalTOML(data any) error {
 //   - All LVM logical volume names are unique within a given volume group
 //   - All btrfs subvolume names are unique within a given btrfs volume
 //   - All btrfs subvolume names are valid and non-empty
-//   - All filesystems are valid for their mountpoints (e.g. xfs or ext4 for /boot)
+//   - All filesystems are valid for their mountpoints (e.g. xfs or ext4 for
+//     /boot, erofs only for / on an unencrypted plain partition)
 //   - No LVM logical volume has an invalid mountpoint (/boot or /boot/efi)
 //   - Plain filesystem types are valid for the partition type
 //   - All non-empty properties are valid for the partition type (e.g.
 //     LogicalVolumes is empty when the type is "plain" or "btrfs")
 //   - Filesystems with FSType set to "swap" do not specify a mountpoint.
+//   - Encrypted partitions have a passphrase and a valid clevis pin and
+//     policy, and do not contain /boot or /boot/efi.
+//   - At most one partition or logical volume per disk is marked to grow.
+//   - Additional disks have unique, valid names and do not contain /, /usr,
+//     /boot, or /boot/efi. Mountpoints and LVM volume group names are unique
+//     across all disks.
 //
 // Note that in *addition* consumers should also call
 // ValidateLayoutConstraints() to validate that the policy for disk
@@ -380,6 +486,71 @@ func (p *DiskCustomization) Validate() error {
 		return nil
 	}
 
+	if p.Name != "" {
+		return fmt.Errorf("invalid partitioning customizations: the main disk cannot have a name")
+	}
+
+	mountpoints := make(map[string]bool)
+	vgnames := make(map[string]bool)
+	if err := p.validateDisk(mountpoints, vgnames); err != nil {
+		return err
+	}
+
+	disknames := make(map[string]bool)
+	for _, disk := range p.AdditionalDisks {
+		if err := disk.validateAdditionalDisk(disknames); err != nil {
+			return err
+		}
+		if err := disk.validateDisk(mountpoints, vgnames); err != nil {
+			return fmt.Errorf("additional disk %q: %w", disk.Name, err)
+		}
+	}
+	return nil
+}
+
+// Additional disks are named after their image file, the name must be safe
+// to use in a filename.
+var diskNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// These mountpoints are needed to boot the system and must be on the main
+// disk.
+var mainDiskOnlyMountpoints = []string{
+	"/",
+	"/usr",
+	"/boot",
+	"/boot/efi",
+}
+
+// validateAdditionalDisk checks the properties that are specific to
+// additional disks: a valid and unique name, no further additional disks,
+// and no mountpoints that must be on the main disk.
+func (p *DiskCustomization) validateAdditionalDisk(disknames map[string]bool) error {
+	if p.Name == "" {
+		return fmt.Errorf("invalid partitioning customizations: additional disks require a name")
+	}
+	if !diskNameRegex.MatchString(p.Name) {
+		return fmt.Errorf("invalid partitioning customizations: invalid additional disk name %q (must match %s)", p.Name, diskNameRegex)
+	}
+	if disknames[p.Name] {
+		return fmt.Errorf("invalid partitioning customizations: duplicate additional disk name %q", p.Name)
+	}
+	disknames[p.Name] = true
+
+	if len(p.AdditionalDisks) > 0 {
+		return fmt.Errorf("invalid partitioning customizations: additional disk %q cannot define additional disks", p.Name)
+	}
+	for _, mp := range p.mountpoints() {
+		if slices.Contains(mainDiskOnlyMountpoints, mp) {
+			return fmt.Errorf("invalid partitioning customizations: mountpoint %q must be on the main disk (found on additional disk %q)", mp, p.Name)
+		}
+	}
+	return nil
+}
+
+// validateDisk validates the partitions of a single disk. The mountpoints
+// and volume group names are shared between all disks of an image and must
+// be unique across them.
+func (p *DiskCustomization) validateDisk(mountpoints, vgnames map[string]bool) error {
 	switch p.Type {
 	case "gpt", "":
 	case "dos":
@@ -395,8 +566,6 @@ func (p *DiskCustomization) Validate() error {
 		return fmt.Errorf("unknown partition table type: %s (valid: gpt, dos)", p.Type)
 	}
 
-	mountpoints := make(map[string]bool)
-	vgnames := make(map[string]bool)
 	var errs []error
 	for _, part := range p.Partitions {
 		if err := part.ValidatePartitionTypeID(p.Type); err != nil {
@@ -408,6 +577,9 @@ func (p *DiskCustomization) Validate() error {
 		if err := part.ValidatePartitionLabel(p.Type); err != nil {
 			errs = append(errs, err)
 		}
+		if err := part.validateEncryption(); err != nil {
+			errs = append(errs, err)
+		}
 		switch part.Type {
 		case "plain", "":
 			errs = append(errs, part.validatePlain(mountpoints))
@@ -420,6 +592,8 @@ func (p *DiskCustomization) Validate() error {
 		}
 	}
 
+	errs = append(errs, p.validateGrow())
+
 	// will discard all nil errors
 	if err := errors.Join(errs...); err != nil {
 		return fmt.Errorf("invalid partitioning customizations:\n%w", err)
@@ -427,6 +601,31 @@ func (p *DiskCustomization) Validate() error {
 	return nil
 }
 
+// validateGrow checks that at most one partition of the disk grows, either
+// because it is marked to grow or because one of its logical volumes is.
+func (p *DiskCustomization) validateGrow() error {
+	var growing uint
+	for _, part := range p.Partitions {
+		var growingLVs uint
+		for _, lv := range part.LogicalVolumes {
+			if lv.Grow {
+				growingLVs++
+			}
+		}
+		if growingLVs > 1 {
+			return fmt.Errorf("only one logical volume in volume group %q can be marked to grow", part.Name)
+		}
+		if !part.Grow && growingLVs == 0 {
+			continue
+		}
+		growing++
+	}
+	if growing > 1 {
+		return fmt.Errorf("only one partition or logical volume can be marked to grow (got %d)", growing)
+	}
+	return nil
+}
+
 func validateMountpoint(path string) error {
 	if path == "" {
 		return fmt.Errorf("mountpoint is empty")
@@ -444,8 +643,8 @@ func validateMountpoint(path string) error {
 }
 
 // ValidateLayoutConstraints checks that at most one LVM Volume Group or btrfs
-// volume is defined. Returns an error if both LVM and btrfs are set and if
-// either has more than one element.
+// volume is defined on each disk. Returns an error if both LVM and btrfs are
+// set on a disk and if either has more than one element.
 //
 // Note that this is a *policy* validation, in theory the "disk" code
 // does support the constraints but we choose not to allow them for
@@ -456,6 +655,18 @@ func (p *DiskCustomization) ValidateLayoutConstraints() error {
 		return nil
 	}
 
+	if err := p.validateDiskLayoutConstraints(); err != nil {
+		return err
+	}
+	for _, disk := range p.AdditionalDisks {
+		if err := disk.validateDiskLayoutConstraints(); err != nil {
+			return fmt.Errorf("additional disk %q: %w", disk.Name, err)
+		}
+	}
+	return nil
+}
+
+func (p *DiskCustomization) validateDiskLayoutConstraints() error {
 	var btrfsVols, lvmVGs uint
 	for _, part := range p.Partitions {
 		switch part.Type {
@@ -496,6 +707,12 @@ func validateFilesystemType(path, fstype string) error {
 		default:
 			return fmt.Errorf(badfsMsgFmt, path, fstype)
 		}
+	case "/":
+	default:
+		// erofs is read-only and created from the whole tree
+		if fstype == "erofs" {
+			return fmt.Errorf(badfsMsgFmt, path, fstype)
+		}
 	}
 	return nil
 }
@@ -507,6 +724,7 @@ var plainOnlyMountpoints = []string{
 }
 
 var validPlainFSTypes = []string{
+	"erofs",
 	"ext4",
 	"vfat",
 	"xfs",
@@ -592,6 +810,85 @@ func (p *PartitionCustomization) ValidatePartitionLabel(ptType string) error {
 	return nil
 }
 
+func (p *PartitionCustomization) validateEncryption() error {
+	enc := p.Encryption
+	if enc == nil {
+		return nil
+	}
+
+	if slices.Contains(plainOnlyMountpoints, p.Mountpoint) {
+		return fmt.Errorf("encrypted partition cannot contain %q", p.Mountpoint)
+	}
+	if enc.Passphrase == "" {
+		return fmt.Errorf("encrypted partition requires a passphrase")
+	}
+
+	clevis := enc.Clevis
+	if clevis == nil {
+		return nil
+	}
+	if clevis.Pin == "tpm2" {
+		return fmt.Errorf("clevis pin \"tpm2\" is not supported for encrypted partitions: it would bind the container to the TPM of the build host")
+	}
+	if !slices.Contains(validClevisPins, clevis.Pin) {
+		return fmt.Errorf("unknown clevis pin %q for encrypted partition (valid: %s)", clevis.Pin, strings.Join(validClevisPins, ", "))
+	}
+	if clevis.Policy == "" {
+		if clevis.Pin != "null" {
+			return fmt.Errorf("clevis pin %q requires a policy", clevis.Pin)
+		}
+		return nil
+	}
+	var policy map[string]any
+	if err := json.Unmarshal([]byte(clevis.Policy), &policy); err != nil {
+		return fmt.Errorf("clevis policy for pin %q is not a JSON object: %w", clevis.Pin, err)
+	}
+	return validateClevisPolicy(clevis.Pin, policy)
+}
+
+// validateClevisPolicy checks that the policy of the pin can be bound
+// without access to the machine that boots the image: tang policies must
+// contain the advertisement of the server and tpm2 pins are rejected, also
+// when they are part of an sss policy.
+func validateClevisPolicy(pin string, policy map[string]any) error {
+	switch pin {
+	case "tang":
+		if url, ok := policy["url"].(string); !ok || url == "" {
+			return fmt.Errorf("clevis policy for pin \"tang\" requires a \"url\"")
+		}
+		if _, ok := policy["adv"].(map[string]any); !ok {
+			return fmt.Errorf("clevis policy for pin \"tang\" requires the advertisement of the server (\"adv\")")
+		}
+	case "sss":
+		pins, ok := policy["pins"].(map[string]any)
+		if !ok {
+			return fmt.Errorf("clevis policy for pin \"sss\" requires \"pins\"")
+		}
+		for _, name := range slices.Sorted(maps.Keys(pins)) {
+			if name == "tpm2" {
+				return fmt.Errorf("clevis pin \"tpm2\" is not supported for encrypted partitions: it would bind the container to the TPM of the build host")
+			}
+			if !slices.Contains(validClevisPins, name) {
+				return fmt.Errorf("unknown clevis pin %q in the policy for pin \"sss\" (valid: %s)", name, strings.Join(validClevisPins, ", "))
+			}
+			policies, ok := pins[name].([]any)
+			if !ok {
+				return fmt.Errorf("clevis policies of pin %q in the policy for pin \"sss\" are not a list", name)
+			}
+			for _, p := range policies {
+				nested, ok := p.(map[string]any)
+				if !ok {
+					return fmt.Errorf("clevis policy of pin %q in the policy for pin \"sss\" is not a JSON object", name)
+				}
+				if err := validateClevisPolicy(name, nested); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
 func (p *PartitionCustomization) validatePlain(mountpoints map[string]bool) error {
 	if p.FSType == "swap" {
 		// make sure the mountpoint is empty and return
@@ -614,6 +911,17 @@ func (p *PartitionCustomization) validatePlain(mountpoints map[string]bool) erro
 	if err := validateFilesystemType(p.Mountpoint, p.FSType); err != nil {
 		return err
 	}
+	if p.FSType == "erofs" {
+		// the image of the filesystem is written into the partition
+		// without a label and cannot be written into an encrypted
+		// container
+		if p.Label != "" {
+			return fmt.Errorf("label %q defined for erofs filesystem with mountpoint %q", p.Label, p.Mountpoint)
+		}
+		if p.Encryption != nil {
+			return fmt.Errorf("encrypted partition cannot contain an erofs filesystem")
+		}
+	}
 
 	mountpoints[p.Mountpoint] = true
 	return nil
@@ -661,7 +969,7 @@ func (p *PartitionCustomization) validateLVM(mountpoints, vgnames map[string]boo
 		}
 
 		// TODO: allow empty fstype with default from distro
-		if !slices.Contains(validPlainFSTypes, lv.FSType) {
+		if !slices.Contains(validPlainFSTypes, lv.FSType) || lv.FSType == "erofs" {
 			return fmt.Errorf("unknown or invalid filesystem type (fs_type) for logical volume with mountpoint %q: %s", lv.Mountpoint, lv.FSType)
 		}
 	}
@@ -712,19 +1020,9 @@ func CheckDiskMountpointsPolicy(partitioning *DiskCustomization, mountpointAllow
 	}
 
 	// collect all mountpoints
-	var mountpoints []string
-	for _, part := range partitioning.Partitions {
-		if part.Mountpoint != "" {
-			mountpoints = append(mountpoints, part.Mountpoint)
-		}
-		for _, lv := range part.LogicalVolumes {
-			if lv.Mountpoint != "" {
-				mountpoints = append(mountpoints, lv.Mountpoint)
-			}
-		}
-		for _, subvol := range part.Subvolumes {
-			mountpoints = append(mountpoints, subvol.Mountpoint)
-		}
+	mountpoints := partitioning.mountpoints()
+	for _, disk := range partitioning.AdditionalDisks {
+		mountpoints = append(mountpoints, disk.mountpoints()...)
 	}
 
 	var errs []error
@@ -740,3 +1038,23 @@ func CheckDiskMountpointsPolicy(partitioning *DiskCustomization, mountpointAllow
 
 	return nil
 }
+
+// mountpoints returns all mountpoints of the partitions of the disk (without
+// the ones of additional disks).
+func (p *DiskCustomization) mountpoints() []string {
+	var mountpoints []string
+	for _, part := range p.Partitions {
+		if part.Mountpoint != "" {
+			mountpoints = append(mountpoints, part.Mountpoint)
+		}
+		for _, lv := range part.LogicalVolumes {
+			if lv.Mountpoint != "" {
+				mountpoints = append(mountpoints, lv.Mountpoint)
+			}
+		}
+		for _, subvol := range part.Subvolumes {
+			mountpoints = append(mountpoints, subvol.Mountpoint)
+		}
+	}
+	return mountpoints
+}
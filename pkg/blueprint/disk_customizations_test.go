@@ -1152,6 +1152,627 @@ func TestPartitioningValidation(t *testing.T) {
 			},
 			expectedMsg: "invalid partitioning customizations:\npart_label is not a valid GPT label, it is too long",
 		},
+		"happy-encrypted-lvm+tang": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Type: "lvm",
+						Encryption: &blueprint.EncryptionCustomization{
+							Passphrase: "secret",
+							Clevis: &blueprint.ClevisCustomization{
+								Pin:              "tang",
+								Policy:           `{"url":"http://tang.example.com","adv":{"payload":"eyJrZXlzIjpbXX0","protected":"e30","signature":"c2ln"}}`,
+								RemovePassphrase: true,
+							},
+						},
+						VGCustomization: blueprint.VGCustomization{
+							LogicalVolumes: []blueprint.LVCustomization{
+								{
+									MinSize: 1 * datasizes.GiB,
+									FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+										Mountpoint: "/",
+										FSType:     "xfs",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"happy-encrypted-plain+null": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Encryption: &blueprint.EncryptionCustomization{
+							Passphrase: "secret",
+							Clevis: &blueprint.ClevisCustomization{
+								Pin: "null",
+							},
+						},
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/",
+							FSType:     "ext4",
+						},
+					},
+				},
+			},
+		},
+		"unhappy-encrypted-tpm2": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Encryption: &blueprint.EncryptionCustomization{
+							Passphrase: "secret",
+							Clevis: &blueprint.ClevisCustomization{
+								Pin: "tpm2",
+							},
+						},
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/",
+							FSType:     "ext4",
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations:\nclevis pin \"tpm2\" is not supported for encrypted partitions: it would bind the container to the TPM of the build host",
+		},
+		"unhappy-encrypted-sss+tpm2": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Encryption: &blueprint.EncryptionCustomization{
+							Passphrase: "secret",
+							Clevis: &blueprint.ClevisCustomization{
+								Pin:    "sss",
+								Policy: `{"t":1,"pins":{"tpm2":[{}]}}`,
+							},
+						},
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/",
+							FSType:     "ext4",
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations:\nclevis pin \"tpm2\" is not supported for encrypted partitions: it would bind the container to the TPM of the build host",
+		},
+		"unhappy-encrypted-tang-no-adv": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Encryption: &blueprint.EncryptionCustomization{
+							Passphrase: "secret",
+							Clevis: &blueprint.ClevisCustomization{
+								Pin:    "sss",
+								Policy: `{"t":1,"pins":{"tang":[{"url":"http://tang.example.com"}]}}`,
+							},
+						},
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/",
+							FSType:     "ext4",
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations:\nclevis policy for pin \"tang\" requires the advertisement of the server (\"adv\")",
+		},
+		"unhappy-encrypted-boot": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Encryption: &blueprint.EncryptionCustomization{
+							Passphrase: "secret",
+						},
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/boot",
+							FSType:     "ext4",
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations:\nencrypted partition cannot contain \"/boot\"",
+		},
+		"unhappy-encrypted-no-passphrase": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Encryption: &blueprint.EncryptionCustomization{},
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/",
+							FSType:     "ext4",
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations:\nencrypted partition requires a passphrase",
+		},
+		"unhappy-encrypted-bad-pin": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Encryption: &blueprint.EncryptionCustomization{
+							Passphrase: "secret",
+							Clevis: &blueprint.ClevisCustomization{
+								Pin: "yubikey",
+							},
+						},
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/",
+							FSType:     "ext4",
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations:\nunknown clevis pin \"yubikey\" for encrypted partition (valid: null, sss, tang)",
+		},
+		"unhappy-encrypted-tang-no-url": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Encryption: &blueprint.EncryptionCustomization{
+							Passphrase: "secret",
+							Clevis: &blueprint.ClevisCustomization{
+								Pin:    "tang",
+								Policy: `{"thp":"abc"}`,
+							},
+						},
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/",
+							FSType:     "ext4",
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations:\nclevis policy for pin \"tang\" requires a \"url\"",
+		},
+		"unhappy-encrypted-bad-policy": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Encryption: &blueprint.EncryptionCustomization{
+							Passphrase: "secret",
+							Clevis: &blueprint.ClevisCustomization{
+								Pin:    "sss",
+								Policy: "t=1",
+							},
+						},
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/",
+							FSType:     "ext4",
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations:\nclevis policy for pin \"sss\" is not a JSON object: invalid character '=' in literal true (expecting 'r')",
+		},
+		"happy-additional-disks": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/home",
+							FSType:     "xfs",
+						},
+					},
+				},
+				AdditionalDisks: []blueprint.DiskCustomization{
+					{
+						Name: "data",
+						Partitions: []blueprint.PartitionCustomization{
+							{
+								FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+									Mountpoint: "/var/lib/containers",
+									FSType:     "xfs",
+								},
+							},
+						},
+					},
+					{
+						Name: "scratch_2",
+						Partitions: []blueprint.PartitionCustomization{
+							{
+								FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+									Mountpoint: "/scratch",
+									FSType:     "xfs",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"unhappy-main-disk-name": {
+			partitioning: &blueprint.DiskCustomization{
+				Name: "main",
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/home",
+							FSType:     "xfs",
+						},
+					},
+				},
+				AdditionalDisks: []blueprint.DiskCustomization{
+					{
+						Name: "data",
+						Partitions: []blueprint.PartitionCustomization{
+							{
+								FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+									Mountpoint: "/data",
+									FSType:     "xfs",
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations: the main disk cannot have a name",
+		},
+		"unhappy-additional-disk-no-name": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/home",
+							FSType:     "xfs",
+						},
+					},
+				},
+				AdditionalDisks: []blueprint.DiskCustomization{
+					{
+						Name: "",
+						Partitions: []blueprint.PartitionCustomization{
+							{
+								FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+									Mountpoint: "/data",
+									FSType:     "xfs",
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations: additional disks require a name",
+		},
+		"unhappy-additional-disk-bad-name": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/home",
+							FSType:     "xfs",
+						},
+					},
+				},
+				AdditionalDisks: []blueprint.DiskCustomization{
+					{
+						Name: "../data",
+						Partitions: []blueprint.PartitionCustomization{
+							{
+								FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+									Mountpoint: "/data",
+									FSType:     "xfs",
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations: invalid additional disk name \"../data\" (must match ^[a-z0-9][a-z0-9_-]*$)",
+		},
+		"unhappy-additional-disk-duplicate-name": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/home",
+							FSType:     "xfs",
+						},
+					},
+				},
+				AdditionalDisks: []blueprint.DiskCustomization{
+					{
+						Name: "data",
+						Partitions: []blueprint.PartitionCustomization{
+							{
+								FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+									Mountpoint: "/data",
+									FSType:     "xfs",
+								},
+							},
+						},
+					},
+					{
+						Name: "data",
+						Partitions: []blueprint.PartitionCustomization{
+							{
+								FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+									Mountpoint: "/data2",
+									FSType:     "xfs",
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations: duplicate additional disk name \"data\"",
+		},
+		"unhappy-f2fs": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/var",
+							FSType:     "f2fs",
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations:\nunknown or invalid filesystem type (fs_type) for mountpoint \"/var\": f2fs",
+		},
+		"happy-grow-lv": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Type: "lvm",
+						Grow: true,
+						VGCustomization: blueprint.VGCustomization{
+							LogicalVolumes: []blueprint.LVCustomization{
+								{
+									Grow: true,
+									FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+										Mountpoint: "/var",
+										FSType:     "xfs",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"unhappy-grow-multiple-partitions": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Grow: true,
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/var",
+							FSType:     "xfs",
+						},
+					},
+					{
+						Type: "lvm",
+						VGCustomization: blueprint.VGCustomization{
+							LogicalVolumes: []blueprint.LVCustomization{
+								{
+									Grow: true,
+									FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+										Mountpoint: "/home",
+										FSType:     "xfs",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations:\nonly one partition or logical volume can be marked to grow (got 2)",
+		},
+		"unhappy-grow-multiple-lvs": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Type: "lvm",
+						VGCustomization: blueprint.VGCustomization{
+							Name: "vg",
+							LogicalVolumes: []blueprint.LVCustomization{
+								{
+									Grow: true,
+									FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+										Mountpoint: "/var",
+										FSType:     "xfs",
+									},
+								},
+								{
+									Grow: true,
+									FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+										Mountpoint: "/home",
+										FSType:     "xfs",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations:\nonly one logical volume in volume group \"vg\" can be marked to grow",
+		},
+		"happy-erofs-root": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/",
+							FSType:     "erofs",
+						},
+					},
+				},
+			},
+		},
+		"unhappy-erofs-not-root": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/opt",
+							FSType:     "erofs",
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations:\nunsupported filesystem type for \"/opt\": erofs",
+		},
+		"unhappy-erofs-lv": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Type: "lvm",
+						VGCustomization: blueprint.VGCustomization{
+							LogicalVolumes: []blueprint.LVCustomization{
+								{
+									FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+										Mountpoint: "/",
+										FSType:     "erofs",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations:\nunknown or invalid filesystem type (fs_type) for logical volume with mountpoint \"/\": erofs",
+		},
+		"unhappy-erofs-label": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/",
+							Label:      "root",
+							FSType:     "erofs",
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations:\nlabel \"root\" defined for erofs filesystem with mountpoint \"/\"",
+		},
+		"unhappy-erofs-encrypted": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Encryption: &blueprint.EncryptionCustomization{
+							Passphrase: "secret",
+						},
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/",
+							FSType:     "erofs",
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations:\nencrypted partition cannot contain an erofs filesystem",
+		},
+		"unhappy-additional-disk-root": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/home",
+							FSType:     "xfs",
+						},
+					},
+				},
+				AdditionalDisks: []blueprint.DiskCustomization{
+					{
+						Name: "data",
+						Partitions: []blueprint.PartitionCustomization{
+							{
+								FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+									Mountpoint: "/",
+									FSType:     "xfs",
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations: mountpoint \"/\" must be on the main disk (found on additional disk \"data\")",
+		},
+		"unhappy-additional-disk-boot": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/home",
+							FSType:     "xfs",
+						},
+					},
+				},
+				AdditionalDisks: []blueprint.DiskCustomization{
+					{
+						Name: "data",
+						Partitions: []blueprint.PartitionCustomization{
+							{
+								FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+									Mountpoint: "/boot",
+									FSType:     "xfs",
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations: mountpoint \"/boot\" must be on the main disk (found on additional disk \"data\")",
+		},
+		"unhappy-additional-disk-duplicate-mountpoint": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/home",
+							FSType:     "xfs",
+						},
+					},
+				},
+				AdditionalDisks: []blueprint.DiskCustomization{
+					{
+						Name: "data",
+						Partitions: []blueprint.PartitionCustomization{
+							{
+								FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+									Mountpoint: "/home",
+									FSType:     "xfs",
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedMsg: "additional disk \"data\": invalid partitioning customizations:\nduplicate mountpoint \"/home\" in partitioning customizations",
+		},
+		"unhappy-additional-disk-nested": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/home",
+							FSType:     "xfs",
+						},
+					},
+				},
+				AdditionalDisks: []blueprint.DiskCustomization{
+					{
+						Name: "data",
+						Partitions: []blueprint.PartitionCustomization{
+							{
+								FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+									Mountpoint: "/data",
+									FSType:     "xfs",
+								},
+							},
+						},
+						AdditionalDisks: []blueprint.DiskCustomization{
+							{
+								Name: "nested",
+							},
+						},
+					},
+				},
+			},
+			expectedMsg: "invalid partitioning customizations: additional disk \"data\" cannot define additional disks",
+		},
 	}
 
 	for name := range testCases {
@@ -1269,6 +1890,71 @@ func TestPartitioningLayoutConstraints(t *testing.T) {
 			},
 			expectedMsg: `multiple LVM volume groups are not yet supported`,
 		},
+		"happy-lvm-on-each-disk": {
+			partitioning: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Type: "lvm",
+						VGCustomization: blueprint.VGCustomization{
+							LogicalVolumes: []blueprint.LVCustomization{
+								{
+									FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{Mountpoint: "/"},
+								},
+							},
+						},
+					},
+				},
+				AdditionalDisks: []blueprint.DiskCustomization{
+					{
+						Name: "data",
+						Partitions: []blueprint.PartitionCustomization{
+							{
+								Type: "lvm",
+								VGCustomization: blueprint.VGCustomization{
+									LogicalVolumes: []blueprint.LVCustomization{
+										{
+											FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{Mountpoint: "/data"},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"unhappy-additional-disk-multiple-vgs": {
+			partitioning: &blueprint.DiskCustomization{
+				AdditionalDisks: []blueprint.DiskCustomization{
+					{
+						Name: "data",
+						Partitions: []blueprint.PartitionCustomization{
+							{
+								Type: "lvm",
+								VGCustomization: blueprint.VGCustomization{
+									LogicalVolumes: []blueprint.LVCustomization{
+										{
+											FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{Mountpoint: "/data"},
+										},
+									},
+								},
+							},
+							{
+								Type: "lvm",
+								VGCustomization: blueprint.VGCustomization{
+									LogicalVolumes: []blueprint.LVCustomization{
+										{
+											FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{Mountpoint: "/scratch"},
+										},
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			expectedMsg: `additional disk "data": multiple LVM volume groups are not yet supported`,
+		},
 	}
 
 	for name := range testCases {
@@ -1353,6 +2039,31 @@ path "/etc" is not allowed`
 	assert.EqualError(t, err, noEtcErr)
 }
 
+func TestCheckDiskMountpointsPolicyAdditionalDisks(t *testing.T) {
+	noEtc := pathpolicy.NewPathPolicies(map[string]pathpolicy.PathPolicy{
+		"/etc": {Deny: true},
+	})
+
+	disk := blueprint.DiskCustomization{
+		AdditionalDisks: []blueprint.DiskCustomization{
+			{
+				Name: "data",
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/etc/data",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	err := blueprint.CheckDiskMountpointsPolicy(&disk, noEtc)
+	assert.EqualError(t, err, `The following errors occurred while setting up custom mountpoints:
+path "/etc/data" is not allowed`)
+}
+
 func TestPartitionCustomizationUnmarshalJSON(t *testing.T) {
 	type testCase struct {
 		input    string
@@ -1651,6 +2362,75 @@ func TestPartitionCustomizationUnmarshalJSON(t *testing.T) {
 			}`,
 			errorMsg: `JSON unmarshal: error decoding partition with type "plain": json: unknown field "subvolumes"`,
 		},
+		"encrypted-lvm": {
+			input: `{
+				"type": "lvm",
+				"minsize": "10 GiB",
+				"encryption": {
+					"passphrase": "secret",
+					"label": "crypt",
+					"clevis": {
+						"pin": "tang",
+						"policy": "{\"url\":\"http://tang.example.com\"}",
+						"remove_passphrase": true
+					}
+				},
+				"logical_volumes": [
+					{
+						"minsize": "2 GiB",
+						"mountpoint": "/",
+						"fs_type": "xfs"
+					}
+				]
+			}`,
+			expected: &blueprint.PartitionCustomization{
+				Type:    "lvm",
+				MinSize: 10 * datasizes.GiB,
+				Encryption: &blueprint.EncryptionCustomization{
+					Passphrase: "secret",
+					Label:      "crypt",
+					Clevis: &blueprint.ClevisCustomization{
+						Pin:              "tang",
+						Policy:           `{"url":"http://tang.example.com"}`,
+						RemovePassphrase: true,
+					},
+				},
+				VGCustomization: blueprint.VGCustomization{
+					LogicalVolumes: []blueprint.LVCustomization{
+						{
+							MinSize: 2 * datasizes.GiB,
+							FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+								Mountpoint: "/",
+								FSType:     "xfs",
+							},
+						},
+					},
+				},
+			},
+		},
+		"encrypted-plain": {
+			input: `{
+				"minsize": "1 GiB",
+				"mountpoint": "/home",
+				"fs_type": "ext4",
+				"encryption": {
+					"passphrase": "secret",
+					"cipher": "aes-xts-plain64"
+				}
+			}`,
+			expected: &blueprint.PartitionCustomization{
+				Type:    "plain",
+				MinSize: 1 * datasizes.GiB,
+				Encryption: &blueprint.EncryptionCustomization{
+					Passphrase: "secret",
+					Cipher:     "aes-xts-plain64",
+				},
+				FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+					Mountpoint: "/home",
+					FSType:     "ext4",
+				},
+			},
+		},
 	}
 
 	for name := range testCases {
@@ -2008,6 +2788,122 @@ func TestDiskCustomizationUnmarshalJSON(t *testing.T) {
 				Type: "gpt",
 			},
 		},
+		"grow": {
+			inputJSON: `{
+				"partitions": [
+					{
+						"minsize": "1 GiB",
+						"mountpoint": "/var",
+						"fs_type": "xfs",
+						"grow": true
+					},
+					{
+						"type": "lvm",
+						"minsize": "10 GiB",
+						"logical_volumes": [
+							{
+								"minsize": "2 GiB",
+								"mountpoint": "/home",
+								"fs_type": "ext4",
+								"grow": true
+							}
+						]
+					}
+				]
+			}`,
+			inputTOML: `[[partitions]]
+						minsize = "1 GiB"
+						mountpoint = "/var"
+						fs_type = "xfs"
+						grow = true
+
+						[[partitions]]
+						type = "lvm"
+						minsize = "10 GiB"
+
+						[[partitions.logical_volumes]]
+						minsize = "2 GiB"
+						mountpoint = "/home"
+						fs_type = "ext4"
+						grow = true
+						`,
+			expected: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Type:    "plain",
+						MinSize: 1 * datasizes.GiB,
+						Grow:    true,
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/var",
+							FSType:     "xfs",
+						},
+					},
+					{
+						Type:    "lvm",
+						MinSize: 10 * datasizes.GiB,
+						VGCustomization: blueprint.VGCustomization{
+							LogicalVolumes: []blueprint.LVCustomization{
+								{
+									MinSize: 2 * datasizes.GiB,
+									Grow:    true,
+									FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+										Mountpoint: "/home",
+										FSType:     "ext4",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"additional-disks": {
+			inputJSON: `{
+				"additional_disks": [
+					{
+						"name": "data",
+						"type": "dos",
+						"minsize": "20 GiB",
+						"partitions": [
+							{
+								"minsize": "10 GiB",
+								"mountpoint": "/var/lib/containers",
+								"fs_type": "xfs"
+							}
+						]
+					}
+				]
+			}`,
+			inputTOML: `[[additional_disks]]
+						name = "data"
+						type = "dos"
+						minsize = "20 GiB"
+
+						[[additional_disks.partitions]]
+						minsize = "10 GiB"
+						mountpoint = "/var/lib/containers"
+						fs_type = "xfs"
+						`,
+			expected: &blueprint.DiskCustomization{
+				AdditionalDisks: []blueprint.DiskCustomization{
+					{
+						Name:    "data",
+						Type:    "dos",
+						MinSize: 20 * datasizes.GiB,
+						Partitions: []blueprint.PartitionCustomization{
+							{
+								Type:    "plain",
+								MinSize: 10 * datasizes.GiB,
+								FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+									Mountpoint: "/var/lib/containers",
+									FSType:     "xfs",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for name := range testCases {
@@ -0,0 +1,166 @@
+package blueprint
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+)
+
+// SSHServerCustomization configures the OpenSSH server (sshd).
+type SSHServerCustomization struct {
+	PasswordAuthentication          *bool `json:"password_authentication,omitempty" toml:"password_authentication,omitempty"`
+	ChallengeResponseAuthentication *bool `json:"challenge_response_authentication,omitempty" toml:"challenge_response_authentication,omitempty"`
+	// One of "yes", "no", "prohibit-password" or "forced-commands-only"
+	PermitRootLogin string `json:"permit_root_login,omitempty" toml:"permit_root_login,omitempty"`
+	// Interval in seconds after which sshd checks an idle client, 0
+	// disables the check
+	ClientAliveInterval *int `json:"client_alive_interval,omitempty" toml:"client_alive_interval,omitempty"`
+
+	// Algorithms allowed by sshd. They take precedence over the system-wide
+	// crypto policy.
+	Ciphers       []string `json:"ciphers,omitempty" toml:"ciphers,omitempty"`
+	MACs          []string `json:"macs,omitempty" toml:"macs,omitempty"`
+	KexAlgorithms []string `json:"kex_algorithms,omitempty" toml:"kex_algorithms,omitempty"`
+}
+
+// HasOptions returns true if the customization sets any of the options of
+// sshd other than the algorithms.
+func (sc *SSHServerCustomization) HasOptions() bool {
+	return sc != nil && (sc.PasswordAuthentication != nil || sc.ChallengeResponseAuthentication != nil || sc.PermitRootLogin != "" || sc.ClientAliveInterval != nil)
+}
+
+// HasAlgorithms returns true if the customization restricts the algorithms
+// of sshd.
+func (sc *SSHServerCustomization) HasAlgorithms() bool {
+	return sc != nil && len(sc.Ciphers)+len(sc.MACs)+len(sc.KexAlgorithms) > 0
+}
+
+// PasswordQualityCustomization sets the password quality requirements of
+// pam_pwquality, see pwquality.conf(5).
+type PasswordQualityCustomization struct {
+	MinLen   *int `json:"minlen,omitempty" toml:"minlen,omitempty"`
+	DCredit  *int `json:"dcredit,omitempty" toml:"dcredit,omitempty"`
+	UCredit  *int `json:"ucredit,omitempty" toml:"ucredit,omitempty"`
+	LCredit  *int `json:"lcredit,omitempty" toml:"lcredit,omitempty"`
+	OCredit  *int `json:"ocredit,omitempty" toml:"ocredit,omitempty"`
+	MinClass *int `json:"minclass,omitempty" toml:"minclass,omitempty"`
+}
+
+// LimitCustomization sets a resource limit of pam_limits, see
+// limits.conf(5).
+type LimitCustomization struct {
+	// User name, @group name, wildcard (*) or uid/gid range
+	Domain string `json:"domain" toml:"domain"`
+	// "soft", "hard" or "-" for both. Defaults to "-".
+	Type string `json:"type,omitempty" toml:"type,omitempty"`
+	Item string `json:"item" toml:"item"`
+	// An integer, "unlimited" or "infinity"
+	Value string `json:"value" toml:"value"`
+}
+
+// GetType returns the type of the limit, "-" if it is not set.
+func (lc LimitCustomization) GetType() string {
+	if lc.Type == "" {
+		return "-"
+	}
+	return lc.Type
+}
+
+var (
+	sshAlgorithmRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9@._-]*$`)
+	limitDomainRegex  = regexp.MustCompile(`^[^\s#]+$`)
+
+	permitRootLoginValues = []string{"yes", "no", "prohibit-password", "forced-commands-only"}
+	limitTypes            = []string{"soft", "hard", "-"}
+	limitItems            = []string{
+		"core", "data", "fsize", "memlock", "nofile", "rss", "stack", "cpu",
+		"nproc", "as", "maxlogins", "maxsyslogins", "nonewprivs", "priority",
+		"locks", "sigpending", "msgqueue", "nice", "rtprio",
+	}
+)
+
+// Validate checks the sshd options and the names of the algorithms.
+func (sc *SSHServerCustomization) Validate() error {
+	if sc == nil {
+		return nil
+	}
+
+	if sc.PermitRootLogin != "" && !slices.Contains(permitRootLoginValues, sc.PermitRootLogin) {
+		return fmt.Errorf("sshd: invalid permit_root_login %q (must be one of %v)", sc.PermitRootLogin, permitRootLoginValues)
+	}
+	if sc.ClientAliveInterval != nil && *sc.ClientAliveInterval < 0 {
+		return fmt.Errorf("sshd: client_alive_interval must not be negative")
+	}
+
+	for _, list := range []struct {
+		name       string
+		algorithms []string
+	}{
+		{"ciphers", sc.Ciphers},
+		{"macs", sc.MACs},
+		{"kex_algorithms", sc.KexAlgorithms},
+	} {
+		for _, algorithm := range list.algorithms {
+			if !sshAlgorithmRegex.MatchString(algorithm) {
+				return fmt.Errorf("sshd: %s: algorithm name %q is invalid", list.name, algorithm)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks that the password quality settings are accepted by
+// pam_pwquality.
+func (pc *PasswordQualityCustomization) Validate() error {
+	if pc == nil {
+		return nil
+	}
+
+	// pam_pwquality does not accept a minimum length below 6
+	if pc.MinLen != nil && *pc.MinLen < 6 {
+		return fmt.Errorf("pwquality: minlen must be at least 6")
+	}
+	if pc.MinClass != nil && (*pc.MinClass < 0 || *pc.MinClass > 4) {
+		return fmt.Errorf("pwquality: minclass must be between 0 and 4")
+	}
+	return nil
+}
+
+func validateLimits(limits []LimitCustomization) error {
+	type limitKey struct {
+		domain, item, limitType string
+	}
+	seen := make(map[limitKey]bool, len(limits))
+
+	for _, l := range limits {
+		if !limitDomainRegex.MatchString(l.Domain) {
+			return fmt.Errorf("limits: domain %q is invalid", l.Domain)
+		}
+		if !slices.Contains(limitTypes, l.GetType()) {
+			return fmt.Errorf("limits: invalid type %q for domain %q (must be one of %v)", l.Type, l.Domain, limitTypes)
+		}
+		if !slices.Contains(limitItems, l.Item) {
+			return fmt.Errorf("limits: invalid item %q for domain %q", l.Item, l.Domain)
+		}
+		if l.Value != "unlimited" && l.Value != "infinity" {
+			if _, err := strconv.Atoi(l.Value); err != nil {
+				return fmt.Errorf("limits: invalid value %q for %s of domain %q", l.Value, l.Item, l.Domain)
+			}
+		}
+
+		// "-" sets both the soft and the hard limit
+		types := []string{l.GetType()}
+		if l.GetType() == "-" {
+			types = []string{"soft", "hard"}
+		}
+		for _, t := range types {
+			key := limitKey{l.Domain, l.Item, t}
+			if seen[key] {
+				return fmt.Errorf("limits: %s limit %s of domain %q is set more than once", t, l.Item, l.Domain)
+			}
+			seen[key] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package blueprint
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/common"
+)
+
+func TestHardeningCustomizationsTOML(t *testing.T) {
+	input := `
+[customizations.sshd]
+password_authentication = false
+permit_root_login = "prohibit-password"
+client_alive_interval = 300
+ciphers = ["aes256-gcm@openssh.com", "aes256-ctr"]
+macs = ["hmac-sha2-512-etm@openssh.com"]
+
+[customizations.pwquality]
+minlen = 14
+dcredit = -1
+minclass = 4
+
+[[customizations.limits]]
+domain = "*"
+item = "nofile"
+value = "65536"
+
+[[customizations.limits]]
+domain = "@wheel"
+type = "hard"
+item = "core"
+value = "0"
+`
+	var bp Blueprint
+	_, err := toml.Decode(input, &bp)
+	require.NoError(t, err)
+
+	sshd, err := bp.Customizations.GetSSHServer()
+	require.NoError(t, err)
+	assert.Equal(t, &SSHServerCustomization{
+		PasswordAuthentication: common.ToPtr(false),
+		PermitRootLogin:        "prohibit-password",
+		ClientAliveInterval:    common.ToPtr(300),
+		Ciphers:                []string{"aes256-gcm@openssh.com", "aes256-ctr"},
+		MACs:                   []string{"hmac-sha2-512-etm@openssh.com"},
+	}, sshd)
+	assert.True(t, sshd.HasAlgorithms())
+
+	pwquality, err := bp.Customizations.GetPasswordQuality()
+	require.NoError(t, err)
+	assert.Equal(t, &PasswordQualityCustomization{
+		MinLen:   common.ToPtr(14),
+		DCredit:  common.ToPtr(-1),
+		MinClass: common.ToPtr(4),
+	}, pwquality)
+
+	limits, err := bp.Customizations.GetLimits()
+	require.NoError(t, err)
+	assert.Equal(t, []LimitCustomization{
+		{Domain: "*", Item: "nofile", Value: "65536"},
+		{Domain: "@wheel", Type: "hard", Item: "core", Value: "0"},
+	}, limits)
+	assert.Equal(t, "-", limits[0].GetType())
+}
+
+func TestHardeningCustomizationsValidate(t *testing.T) {
+	testCases := map[string]struct {
+		customizations *Customizations
+		err            string
+	}{
+		"sshd-permit-root-login": {
+			customizations: &Customizations{SSHServer: &SSHServerCustomization{PermitRootLogin: "without-password"}},
+			err:            `sshd: invalid permit_root_login "without-password" (must be one of [yes no prohibit-password forced-commands-only])`,
+		},
+		"sshd-client-alive-interval": {
+			customizations: &Customizations{SSHServer: &SSHServerCustomization{ClientAliveInterval: common.ToPtr(-1)}},
+			err:            `sshd: client_alive_interval must not be negative`,
+		},
+		"sshd-cipher": {
+			customizations: &Customizations{SSHServer: &SSHServerCustomization{Ciphers: []string{"aes256-ctr,3des-cbc"}}},
+			err:            `sshd: ciphers: algorithm name "aes256-ctr,3des-cbc" is invalid`,
+		},
+		"sshd-kex": {
+			customizations: &Customizations{SSHServer: &SSHServerCustomization{KexAlgorithms: []string{"-diffie-hellman-group1-sha1"}}},
+			err:            `sshd: kex_algorithms: algorithm name "-diffie-hellman-group1-sha1" is invalid`,
+		},
+		"pwquality-minlen": {
+			customizations: &Customizations{PasswordQuality: &PasswordQualityCustomization{MinLen: common.ToPtr(5)}},
+			err:            `pwquality: minlen must be at least 6`,
+		},
+		"pwquality-minclass": {
+			customizations: &Customizations{PasswordQuality: &PasswordQualityCustomization{MinClass: common.ToPtr(5)}},
+			err:            `pwquality: minclass must be between 0 and 4`,
+		},
+		"limits-domain": {
+			customizations: &Customizations{Limits: []LimitCustomization{{Domain: "", Item: "nofile", Value: "1024"}}},
+			err:            `limits: domain "" is invalid`,
+		},
+		"limits-type": {
+			customizations: &Customizations{Limits: []LimitCustomization{{Domain: "*", Type: "both", Item: "nofile", Value: "1024"}}},
+			err:            `limits: invalid type "both" for domain "*" (must be one of [soft hard -])`,
+		},
+		"limits-item": {
+			customizations: &Customizations{Limits: []LimitCustomization{{Domain: "*", Item: "files", Value: "1024"}}},
+			err:            `limits: invalid item "files" for domain "*"`,
+		},
+		"limits-value": {
+			customizations: &Customizations{Limits: []LimitCustomization{{Domain: "*", Item: "nofile", Value: "lots"}}},
+			err:            `limits: invalid value "lots" for nofile of domain "*"`,
+		},
+		"limits-duplicate": {
+			customizations: &Customizations{Limits: []LimitCustomization{
+				{Domain: "*", Type: "soft", Item: "nofile", Value: "1024"},
+				{Domain: "*", Item: "nofile", Value: "4096"},
+			}},
+			err: `limits: soft limit nofile of domain "*" is set more than once`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, sshdErr := tc.customizations.GetSSHServer()
+			_, pwqualityErr := tc.customizations.GetPasswordQuality()
+			_, limitsErr := tc.customizations.GetLimits()
+			var errs []string
+			for _, err := range []error{sshdErr, pwqualityErr, limitsErr} {
+				if err != nil {
+					errs = append(errs, err.Error())
+				}
+			}
+			assert.Equal(t, []string{tc.err}, errs)
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package blueprint
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SysctlCustomization sets a kernel parameter at boot, e.g.
+// vm.swappiness = 10.
+type SysctlCustomization struct {
+	Key   string `json:"key" toml:"key"`
+	Value string `json:"value" toml:"value"`
+}
+
+// ModprobeCustomization configures the loading of kernel modules.
+type ModprobeCustomization struct {
+	// Modules that are not loaded automatically
+	Blacklist []string `json:"blacklist,omitempty" toml:"blacklist,omitempty"`
+	// Parameters of modules, applied whenever they are loaded
+	Options []ModuleOptionsCustomization `json:"options,omitempty" toml:"options,omitempty"`
+}
+
+type ModuleOptionsCustomization struct {
+	Module string `json:"module" toml:"module"`
+	// Space separated module parameters, e.g. "nohwcrypt=1 11n_disable=8"
+	Options string `json:"options" toml:"options"`
+}
+
+// DracutCustomization adds dracut modules and kernel drivers to the
+// initramfs.
+type DracutCustomization struct {
+	AddModules []string `json:"add_modules,omitempty" toml:"add_modules,omitempty"`
+	AddDrivers []string `json:"add_drivers,omitempty" toml:"add_drivers,omitempty"`
+}
+
+var (
+	sysctlKeyRegex  = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.*/-]*$`)
+	moduleNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+// NormalizeSysctlKey returns the sysctl key with dots as separators. As
+// described in sysctl.d(5), slashes and dots are swapped if the first
+// separator is a slash, so that dots in names, e.g. in the name of the VLAN
+// interface in "net/ipv4/conf/eth0.100/forwarding", are kept.
+func NormalizeSysctlKey(key string) string {
+	idx := strings.IndexAny(key, "./")
+	if idx < 0 || key[idx] == '.' {
+		return key
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '/':
+			return '.'
+		case '.':
+			return '/'
+		}
+		return r
+	}, key)
+}
+
+func validateSysctl(sysctl []SysctlCustomization) error {
+	keys := make(map[string]bool, len(sysctl))
+	for _, s := range sysctl {
+		if !sysctlKeyRegex.MatchString(s.Key) {
+			return fmt.Errorf("sysctl key %q is invalid", s.Key)
+		}
+		// keys can be written with slashes or dots as separators
+		key := NormalizeSysctlKey(s.Key)
+		if keys[key] {
+			return fmt.Errorf("sysctl key %q is set more than once", s.Key)
+		}
+		keys[key] = true
+		if s.Value == "" || strings.ContainsAny(s.Value, "\n") {
+			return fmt.Errorf("sysctl key %q: invalid value %q", s.Key, s.Value)
+		}
+	}
+	return nil
+}
+
+// Validate checks that the module names and options are valid and that the
+// options of every module are set only once.
+func (mc *ModprobeCustomization) Validate() error {
+	if mc == nil {
+		return nil
+	}
+
+	for _, module := range mc.Blacklist {
+		if !moduleNameRegex.MatchString(module) {
+			return fmt.Errorf("modprobe blacklist: kernel module name %q is invalid", module)
+		}
+	}
+
+	modules := make(map[string]bool, len(mc.Options))
+	for _, mo := range mc.Options {
+		if !moduleNameRegex.MatchString(mo.Module) {
+			return fmt.Errorf("modprobe options: kernel module name %q is invalid", mo.Module)
+		}
+		if modules[mo.Module] {
+			return fmt.Errorf("modprobe options: options for kernel module %q are set more than once", mo.Module)
+		}
+		modules[mo.Module] = true
+		if strings.TrimSpace(mo.Options) == "" || strings.ContainsAny(mo.Options, "\n") {
+			return fmt.Errorf("modprobe options: invalid options %q for kernel module %q", mo.Options, mo.Module)
+		}
+	}
+	return nil
+}
+
+// Validate checks the names of the dracut modules and drivers.
+func (dc *DracutCustomization) Validate() error {
+	if dc == nil {
+		return nil
+	}
+
+	for _, module := range dc.AddModules {
+		if !moduleNameRegex.MatchString(module) {
+			return fmt.Errorf("dracut: module name %q is invalid", module)
+		}
+	}
+	for _, driver := range dc.AddDrivers {
+		if !moduleNameRegex.MatchString(driver) {
+			return fmt.Errorf("dracut: driver name %q is invalid", driver)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package blueprint
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKernelTuningCustomizationsTOML(t *testing.T) {
+	input := `
+[[customizations.sysctl]]
+key = "vm.swappiness"
+value = "10"
+
+[[customizations.sysctl]]
+key = "net/ipv4/ip_forward"
+value = "1"
+
+[customizations.modprobe]
+blacklist = ["nouveau", "floppy"]
+
+[[customizations.modprobe.options]]
+module = "iwlwifi"
+options = "11n_disable=8 power_save=0"
+
+[customizations.dracut]
+add_modules = ["nfs"]
+add_drivers = ["nvme"]
+`
+	var bp Blueprint
+	_, err := toml.Decode(input, &bp)
+	require.NoError(t, err)
+
+	sysctl, err := bp.Customizations.GetSysctl()
+	require.NoError(t, err)
+	assert.Equal(t, []SysctlCustomization{
+		{Key: "vm.swappiness", Value: "10"},
+		{Key: "net/ipv4/ip_forward", Value: "1"},
+	}, sysctl)
+
+	modprobe, err := bp.Customizations.GetModprobe()
+	require.NoError(t, err)
+	assert.Equal(t, &ModprobeCustomization{
+		Blacklist: []string{"nouveau", "floppy"},
+		Options: []ModuleOptionsCustomization{
+			{Module: "iwlwifi", Options: "11n_disable=8 power_save=0"},
+		},
+	}, modprobe)
+
+	dracut, err := bp.Customizations.GetDracut()
+	require.NoError(t, err)
+	assert.Equal(t, &DracutCustomization{
+		AddModules: []string{"nfs"},
+		AddDrivers: []string{"nvme"},
+	}, dracut)
+}
+
+func TestKernelTuningCustomizationsValidate(t *testing.T) {
+	testCases := map[string]struct {
+		customizations *Customizations
+		err            string
+	}{
+		"sysctl-key": {
+			customizations: &Customizations{Sysctl: []SysctlCustomization{{Key: "-vm.swappiness", Value: "10"}}},
+			err:            `sysctl key "-vm.swappiness" is invalid`,
+		},
+		"sysctl-key-space": {
+			customizations: &Customizations{Sysctl: []SysctlCustomization{{Key: "vm.swappiness = 10", Value: "10"}}},
+			err:            `sysctl key "vm.swappiness = 10" is invalid`,
+		},
+		"sysctl-duplicate": {
+			customizations: &Customizations{Sysctl: []SysctlCustomization{{Key: "net.ipv4.ip_forward", Value: "1"}, {Key: "net/ipv4/ip_forward", Value: "0"}}},
+			err:            `sysctl key "net/ipv4/ip_forward" is set more than once`,
+		},
+		"sysctl-duplicate-vlan": {
+			customizations: &Customizations{Sysctl: []SysctlCustomization{{Key: "net.ipv4.conf.eth0/100.forwarding", Value: "1"}, {Key: "net/ipv4/conf/eth0.100/forwarding", Value: "0"}}},
+			err:            `sysctl key "net/ipv4/conf/eth0.100/forwarding" is set more than once`,
+		},
+		"sysctl-value": {
+			customizations: &Customizations{Sysctl: []SysctlCustomization{{Key: "vm.swappiness"}}},
+			err:            `sysctl key "vm.swappiness": invalid value ""`,
+		},
+		"modprobe-blacklist": {
+			customizations: &Customizations{Modprobe: &ModprobeCustomization{Blacklist: []string{"nouveau amdgpu"}}},
+			err:            `modprobe blacklist: kernel module name "nouveau amdgpu" is invalid`,
+		},
+		"modprobe-options-module": {
+			customizations: &Customizations{Modprobe: &ModprobeCustomization{Options: []ModuleOptionsCustomization{{Module: "../iwlwifi", Options: "power_save=0"}}}},
+			err:            `modprobe options: kernel module name "../iwlwifi" is invalid`,
+		},
+		"modprobe-options-duplicate": {
+			customizations: &Customizations{Modprobe: &ModprobeCustomization{Options: []ModuleOptionsCustomization{{Module: "iwlwifi", Options: "power_save=0"}, {Module: "iwlwifi", Options: "11n_disable=8"}}}},
+			err:            `modprobe options: options for kernel module "iwlwifi" are set more than once`,
+		},
+		"modprobe-options-empty": {
+			customizations: &Customizations{Modprobe: &ModprobeCustomization{Options: []ModuleOptionsCustomization{{Module: "iwlwifi", Options: " "}}}},
+			err:            `modprobe options: invalid options " " for kernel module "iwlwifi"`,
+		},
+		"dracut-module": {
+			customizations: &Customizations{Dracut: &DracutCustomization{AddModules: []string{"nfs/"}}},
+			err:            `dracut: module name "nfs/" is invalid`,
+		},
+		"dracut-driver": {
+			customizations: &Customizations{Dracut: &DracutCustomization{AddDrivers: []string{""}}},
+			err:            `dracut: driver name "" is invalid`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, sysctlErr := tc.customizations.GetSysctl()
+			_, modprobeErr := tc.customizations.GetModprobe()
+			_, dracutErr := tc.customizations.GetDracut()
+			var errs []string
+			for _, err := range []error{sysctlErr, modprobeErr, dracutErr} {
+				if err != nil {
+					errs = append(errs, err.Error())
+				}
+			}
+			assert.Equal(t, []string{tc.err}, errs)
+		})
+	}
+}
+
+func TestNormalizeSysctlKey(t *testing.T) {
+	testCases := map[string]string{
+		"vm.swappiness":                     "vm.swappiness",
+		"vm/swappiness":                     "vm.swappiness",
+		"net.ipv4.conf.eth0/100.forwarding": "net.ipv4.conf.eth0/100.forwarding",
+		"net/ipv4/conf/eth0.100/forwarding": "net.ipv4.conf.eth0/100.forwarding",
+		"kernel":                            "kernel",
+	}
+	for key, expected := range testCases {
+		assert.Equal(t, expected, NormalizeSysctlKey(key), key)
+	}
+}
+
+func TestKernelTuningCustomizationsVLANKeys(t *testing.T) {
+	// the keys differ in the VLAN interface name: eth0.100 and eth0/100
+	c := &Customizations{Sysctl: []SysctlCustomization{
+		{Key: "net/ipv4/conf/eth0.100/forwarding", Value: "1"},
+		{Key: "net.ipv4.conf.eth0.100.forwarding", Value: "0"},
+	}}
+	_, err := c.GetSysctl()
+	assert.NoError(t, err)
+}
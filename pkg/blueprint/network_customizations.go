@@ -0,0 +1,297 @@
+package blueprint
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+)
+
+// NetworkCustomization configures the network connections of the image. The
+// connections are written as NetworkManager keyfiles.
+type NetworkCustomization struct {
+	Interfaces []NetworkInterfaceCustomization `json:"interfaces,omitempty" toml:"interfaces,omitempty"`
+}
+
+type NetworkInterfaceCustomization struct {
+	// Name of the interface, also used as the name of the connection
+	Name string `json:"name" toml:"name"`
+	// Type of the interface: ethernet (default), bond, vlan, or bridge
+	Type       string `json:"type,omitempty" toml:"type,omitempty"`
+	MACAddress string `json:"mac_address,omitempty" toml:"mac_address,omitempty"`
+	MTU        uint32 `json:"mtu,omitempty" toml:"mtu,omitempty"`
+	// Name of the bond or bridge this interface is a port of. Ports have no
+	// IP configuration of their own.
+	Controller string `json:"controller,omitempty" toml:"controller,omitempty"`
+
+	IPv4 *NetworkIPCustomization `json:"ipv4,omitempty" toml:"ipv4,omitempty"`
+	IPv6 *NetworkIPCustomization `json:"ipv6,omitempty" toml:"ipv6,omitempty"`
+
+	Bond   *NetworkBondCustomization   `json:"bond,omitempty" toml:"bond,omitempty"`
+	VLAN   *NetworkVLANCustomization   `json:"vlan,omitempty" toml:"vlan,omitempty"`
+	Bridge *NetworkBridgeCustomization `json:"bridge,omitempty" toml:"bridge,omitempty"`
+}
+
+type NetworkIPCustomization struct {
+	// Method is one of auto, manual, or disabled. Defaults to manual if
+	// addresses are set and to auto otherwise.
+	Method string `json:"method,omitempty" toml:"method,omitempty"`
+	// Addresses in CIDR notation, e.g. 192.168.1.10/24
+	Addresses []string                    `json:"addresses,omitempty" toml:"addresses,omitempty"`
+	Gateway   string                      `json:"gateway,omitempty" toml:"gateway,omitempty"`
+	DNS       []string                    `json:"dns,omitempty" toml:"dns,omitempty"`
+	DNSSearch []string                    `json:"dns_search,omitempty" toml:"dns_search,omitempty"`
+	Routes    []NetworkRouteCustomization `json:"routes,omitempty" toml:"routes,omitempty"`
+}
+
+type NetworkRouteCustomization struct {
+	// Destination in CIDR notation, e.g. 10.0.0.0/8
+	Destination string  `json:"destination" toml:"destination"`
+	Gateway     string  `json:"gateway,omitempty" toml:"gateway,omitempty"`
+	Metric      *uint32 `json:"metric,omitempty" toml:"metric,omitempty"`
+}
+
+type NetworkBondCustomization struct {
+	// Bonding mode, e.g. active-backup or 802.3ad. Defaults to balance-rr.
+	Mode string `json:"mode,omitempty" toml:"mode,omitempty"`
+	// Additional bonding options, e.g. miimon
+	Options map[string]string `json:"options,omitempty" toml:"options,omitempty"`
+}
+
+type NetworkVLANCustomization struct {
+	ID     uint32 `json:"id" toml:"id"`
+	Parent string `json:"parent" toml:"parent"`
+}
+
+type NetworkBridgeCustomization struct {
+	STP *bool `json:"stp,omitempty" toml:"stp,omitempty"`
+}
+
+const (
+	NetworkInterfaceTypeEthernet = "ethernet"
+	NetworkInterfaceTypeBond     = "bond"
+	NetworkInterfaceTypeVLAN     = "vlan"
+	NetworkInterfaceTypeBridge   = "bridge"
+
+	NetworkIPMethodAuto     = "auto"
+	NetworkIPMethodManual   = "manual"
+	NetworkIPMethodDisabled = "disabled"
+)
+
+var networkBondModes = []string{
+	"balance-rr",
+	"active-backup",
+	"balance-xor",
+	"broadcast",
+	"802.3ad",
+	"balance-tlb",
+	"balance-alb",
+}
+
+// GetType returns the type of the interface, ethernet if unset.
+func (ni *NetworkInterfaceCustomization) GetType() string {
+	if ni.Type == "" {
+		return NetworkInterfaceTypeEthernet
+	}
+	return ni.Type
+}
+
+// GetMethod returns the configuration method: the method if set, otherwise
+// manual if addresses are set and auto if not.
+func (ip *NetworkIPCustomization) GetMethod() string {
+	if ip == nil {
+		return NetworkIPMethodAuto
+	}
+	if ip.Method != "" {
+		return ip.Method
+	}
+	if len(ip.Addresses) > 0 {
+		return NetworkIPMethodManual
+	}
+	return NetworkIPMethodAuto
+}
+
+// Validate checks that all interfaces, addresses, routes, and DNS servers of
+// the network customization are valid and that the references between the
+// interfaces (controllers) can be resolved.
+func (nc *NetworkCustomization) Validate() error {
+	if nc == nil {
+		return nil
+	}
+
+	types := make(map[string]string, len(nc.Interfaces))
+	for _, iface := range nc.Interfaces {
+		if err := validateNetworkInterfaceName(iface.Name); err != nil {
+			return err
+		}
+		if _, exists := types[iface.Name]; exists {
+			return fmt.Errorf("network interface %q is defined more than once", iface.Name)
+		}
+		types[iface.Name] = iface.GetType()
+	}
+
+	for _, iface := range nc.Interfaces {
+		if err := iface.validate(); err != nil {
+			return fmt.Errorf("network interface %q: %w", iface.Name, err)
+		}
+		if iface.Controller != "" {
+			switch types[iface.Controller] {
+			case NetworkInterfaceTypeBond, NetworkInterfaceTypeBridge:
+			case "":
+				return fmt.Errorf("network interface %q: controller %q is not defined", iface.Name, iface.Controller)
+			default:
+				return fmt.Errorf("network interface %q: controller %q is not a bond or bridge", iface.Name, iface.Controller)
+			}
+		}
+	}
+	return nil
+}
+
+func validateNetworkInterfaceName(name string) error {
+	if name == "" {
+		return fmt.Errorf("network interface name is required")
+	}
+	// see dev_valid_name() in the kernel
+	if len(name) > 15 || name == "." || name == ".." || strings.ContainsAny(name, "/: \t\n") {
+		return fmt.Errorf("network interface name %q is invalid", name)
+	}
+	return nil
+}
+
+func (ni *NetworkInterfaceCustomization) validate() error {
+	ifaceType := ni.GetType()
+	switch ifaceType {
+	case NetworkInterfaceTypeEthernet, NetworkInterfaceTypeBond, NetworkInterfaceTypeVLAN, NetworkInterfaceTypeBridge:
+	default:
+		return fmt.Errorf("unsupported type %q", ni.Type)
+	}
+
+	if ni.MACAddress != "" {
+		if _, err := net.ParseMAC(ni.MACAddress); err != nil {
+			return fmt.Errorf("invalid mac address %q", ni.MACAddress)
+		}
+	}
+
+	if ni.Bond != nil && ifaceType != NetworkInterfaceTypeBond {
+		return fmt.Errorf("bond options are only supported for bond interfaces")
+	}
+	if ni.VLAN != nil && ifaceType != NetworkInterfaceTypeVLAN {
+		return fmt.Errorf("vlan options are only supported for vlan interfaces")
+	}
+	if ni.Bridge != nil && ifaceType != NetworkInterfaceTypeBridge {
+		return fmt.Errorf("bridge options are only supported for bridge interfaces")
+	}
+
+	switch ifaceType {
+	case NetworkInterfaceTypeBond:
+		if ni.Bond != nil && ni.Bond.Mode != "" && !slices.Contains(networkBondModes, ni.Bond.Mode) {
+			return fmt.Errorf("unsupported bond mode %q (must be one of %s)", ni.Bond.Mode, strings.Join(networkBondModes, ", "))
+		}
+		if ni.Bond != nil {
+			for key, value := range ni.Bond.Options {
+				if key == "" || key == "mode" || strings.ContainsAny(key, "= \t\n") || strings.ContainsAny(value, "\n") {
+					return fmt.Errorf("invalid bond option %q", key)
+				}
+			}
+		}
+	case NetworkInterfaceTypeVLAN:
+		if ni.VLAN == nil || ni.VLAN.Parent == "" {
+			return fmt.Errorf("vlan interfaces require a parent interface")
+		}
+		if ni.VLAN.ID < 1 || ni.VLAN.ID > 4094 {
+			return fmt.Errorf("invalid vlan id %d (must be between 1 and 4094)", ni.VLAN.ID)
+		}
+		if ni.VLAN.Parent == ni.Name {
+			return fmt.Errorf("vlan interface cannot be its own parent")
+		}
+	}
+
+	if ni.Controller != "" {
+		if ni.Controller == ni.Name {
+			return fmt.Errorf("interface cannot be its own controller")
+		}
+		if ni.IPv4 != nil || ni.IPv6 != nil {
+			return fmt.Errorf("ports of a bond or bridge cannot have an ip configuration")
+		}
+	}
+
+	if err := ni.IPv4.validate(false); err != nil {
+		return fmt.Errorf("ipv4: %w", err)
+	}
+	if err := ni.IPv6.validate(true); err != nil {
+		return fmt.Errorf("ipv6: %w", err)
+	}
+	return nil
+}
+
+func parseNetworkAddr(s string, ipv6 bool) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil || addr.Is6() != ipv6 {
+		return netip.Addr{}, fmt.Errorf("invalid address %q", s)
+	}
+	return addr, nil
+}
+
+func parseNetworkPrefix(s string, ipv6 bool) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil || prefix.Addr().Is6() != ipv6 {
+		return netip.Prefix{}, fmt.Errorf("invalid address %q (must be in CIDR notation)", s)
+	}
+	return prefix, nil
+}
+
+func (ip *NetworkIPCustomization) validate(ipv6 bool) error {
+	if ip == nil {
+		return nil
+	}
+
+	method := ip.GetMethod()
+	switch method {
+	case NetworkIPMethodAuto, NetworkIPMethodDisabled:
+		if len(ip.Addresses) > 0 || ip.Gateway != "" {
+			return fmt.Errorf("addresses and gateway require the manual method")
+		}
+		if method == NetworkIPMethodDisabled && (len(ip.DNS) > 0 || len(ip.DNSSearch) > 0 || len(ip.Routes) > 0) {
+			return fmt.Errorf("dns and routes cannot be set when the method is disabled")
+		}
+	case NetworkIPMethodManual:
+		if len(ip.Addresses) == 0 {
+			return fmt.Errorf("the manual method requires at least one address")
+		}
+	default:
+		return fmt.Errorf("unsupported method %q", ip.Method)
+	}
+
+	for _, addr := range ip.Addresses {
+		if _, err := parseNetworkPrefix(addr, ipv6); err != nil {
+			return err
+		}
+	}
+	if ip.Gateway != "" {
+		if _, err := parseNetworkAddr(ip.Gateway, ipv6); err != nil {
+			return fmt.Errorf("gateway: %w", err)
+		}
+	}
+	for _, dns := range ip.DNS {
+		if _, err := parseNetworkAddr(dns, ipv6); err != nil {
+			return fmt.Errorf("dns: %w", err)
+		}
+	}
+	for _, domain := range ip.DNSSearch {
+		if domain == "" || strings.ContainsAny(domain, ",; \t\n") {
+			return fmt.Errorf("invalid dns search domain %q", domain)
+		}
+	}
+	for _, route := range ip.Routes {
+		if _, err := parseNetworkPrefix(route.Destination, ipv6); err != nil {
+			return fmt.Errorf("route: %w", err)
+		}
+		if route.Gateway != "" {
+			if _, err := parseNetworkAddr(route.Gateway, ipv6); err != nil {
+				return fmt.Errorf("route gateway: %w", err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package blueprint
+
+import (
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/common"
+)
+
+func TestNetworkCustomizationTOML(t *testing.T) {
+	input := `
+[[customizations.network.interfaces]]
+name = "eth0"
+mac_address = "52:54:00:12:34:56"
+controller = "bond0"
+
+[[customizations.network.interfaces]]
+name = "bond0"
+type = "bond"
+[customizations.network.interfaces.bond]
+mode = "active-backup"
+options = { miimon = "100" }
+
+[[customizations.network.interfaces]]
+name = "bond0.100"
+type = "vlan"
+vlan = { id = 100, parent = "bond0" }
+[customizations.network.interfaces.ipv4]
+addresses = ["192.168.100.10/24"]
+gateway = "192.168.100.1"
+dns = ["192.168.100.1"]
+dns_search = ["example.com"]
+routes = [{ destination = "10.0.0.0/8", gateway = "192.168.100.254", metric = 100 }]
+[customizations.network.interfaces.ipv6]
+method = "disabled"
+`
+	var bp Blueprint
+	_, err := toml.Decode(input, &bp)
+	require.NoError(t, err)
+
+	expected := &NetworkCustomization{
+		Interfaces: []NetworkInterfaceCustomization{
+			{
+				Name:       "eth0",
+				MACAddress: "52:54:00:12:34:56",
+				Controller: "bond0",
+			},
+			{
+				Name: "bond0",
+				Type: "bond",
+				Bond: &NetworkBondCustomization{
+					Mode:    "active-backup",
+					Options: map[string]string{"miimon": "100"},
+				},
+			},
+			{
+				Name: "bond0.100",
+				Type: "vlan",
+				VLAN: &NetworkVLANCustomization{ID: 100, Parent: "bond0"},
+				IPv4: &NetworkIPCustomization{
+					Addresses: []string{"192.168.100.10/24"},
+					Gateway:   "192.168.100.1",
+					DNS:       []string{"192.168.100.1"},
+					DNSSearch: []string{"example.com"},
+					Routes: []NetworkRouteCustomization{
+						{Destination: "10.0.0.0/8", Gateway: "192.168.100.254", Metric: common.ToPtr(uint32(100))},
+					},
+				},
+				IPv6: &NetworkIPCustomization{
+					Method: "disabled",
+				},
+			},
+		},
+	}
+	nc, err := bp.Customizations.GetNetwork()
+	require.NoError(t, err)
+	assert.Equal(t, expected, nc)
+	assert.Equal(t, NetworkIPMethodManual, nc.Interfaces[2].IPv4.GetMethod())
+}
+
+func TestNetworkCustomizationValidate(t *testing.T) {
+	testCases := map[string]struct {
+		interfaces []NetworkInterfaceCustomization
+		err        string
+	}{
+		"no-name": {
+			interfaces: []NetworkInterfaceCustomization{{}},
+			err:        "network interface name is required",
+		},
+		"long-name": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "averyveryverylongname"}},
+			err:        `network interface name "averyveryverylongname" is invalid`,
+		},
+		"slash-name": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "eth/0"}},
+			err:        `network interface name "eth/0" is invalid`,
+		},
+		"duplicate": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "eth0"}, {Name: "eth0"}},
+			err:        `network interface "eth0" is defined more than once`,
+		},
+		"type": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "wlan0", Type: "wifi"}},
+			err:        `network interface "wlan0": unsupported type "wifi"`,
+		},
+		"mac": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "eth0", MACAddress: "52:54:00"}},
+			err:        `network interface "eth0": invalid mac address "52:54:00"`,
+		},
+		"bond-options-on-ethernet": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "eth0", Bond: &NetworkBondCustomization{}}},
+			err:        `network interface "eth0": bond options are only supported for bond interfaces`,
+		},
+		"bond-mode": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "bond0", Type: "bond", Bond: &NetworkBondCustomization{Mode: "fastest"}}},
+			err:        `network interface "bond0": unsupported bond mode "fastest" (must be one of balance-rr, active-backup, balance-xor, broadcast, 802.3ad, balance-tlb, balance-alb)`,
+		},
+		"bond-option-mode": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "bond0", Type: "bond", Bond: &NetworkBondCustomization{Options: map[string]string{"mode": "802.3ad"}}}},
+			err:        `network interface "bond0": invalid bond option "mode"`,
+		},
+		"vlan-no-parent": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "vlan10", Type: "vlan"}},
+			err:        `network interface "vlan10": vlan interfaces require a parent interface`,
+		},
+		"vlan-id": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "vlan10", Type: "vlan", VLAN: &NetworkVLANCustomization{ID: 4095, Parent: "eth0"}}},
+			err:        `network interface "vlan10": invalid vlan id 4095 (must be between 1 and 4094)`,
+		},
+		"controller-undefined": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "eth0", Controller: "bond0"}},
+			err:        `network interface "eth0": controller "bond0" is not defined`,
+		},
+		"controller-not-bond": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "eth0", Controller: "eth1"}, {Name: "eth1"}},
+			err:        `network interface "eth0": controller "eth1" is not a bond or bridge`,
+		},
+		"port-with-ip": {
+			interfaces: []NetworkInterfaceCustomization{
+				{Name: "eth0", Controller: "br0", IPv4: &NetworkIPCustomization{Method: "auto"}},
+				{Name: "br0", Type: "bridge"},
+			},
+			err: `network interface "eth0": ports of a bond or bridge cannot have an ip configuration`,
+		},
+		"method": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "eth0", IPv4: &NetworkIPCustomization{Method: "shared"}}},
+			err:        `network interface "eth0": ipv4: unsupported method "shared"`,
+		},
+		"manual-no-address": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "eth0", IPv4: &NetworkIPCustomization{Method: "manual"}}},
+			err:        `network interface "eth0": ipv4: the manual method requires at least one address`,
+		},
+		"auto-with-address": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "eth0", IPv4: &NetworkIPCustomization{Method: "auto", Addresses: []string{"192.168.1.10/24"}}}},
+			err:        `network interface "eth0": ipv4: addresses and gateway require the manual method`,
+		},
+		"disabled-with-dns": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "eth0", IPv6: &NetworkIPCustomization{Method: "disabled", DNS: []string{"::1"}}}},
+			err:        `network interface "eth0": ipv6: dns and routes cannot be set when the method is disabled`,
+		},
+		"address-no-prefix": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "eth0", IPv4: &NetworkIPCustomization{Addresses: []string{"192.168.1.10"}}}},
+			err:        `network interface "eth0": ipv4: invalid address "192.168.1.10" (must be in CIDR notation)`,
+		},
+		"address-family": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "eth0", IPv6: &NetworkIPCustomization{Addresses: []string{"192.168.1.10/24"}}}},
+			err:        `network interface "eth0": ipv6: invalid address "192.168.1.10/24" (must be in CIDR notation)`,
+		},
+		"gateway": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "eth0", IPv4: &NetworkIPCustomization{Addresses: []string{"192.168.1.10/24"}, Gateway: "fe80::1"}}},
+			err:        `network interface "eth0": ipv4: gateway: invalid address "fe80::1"`,
+		},
+		"dns": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "eth0", IPv4: &NetworkIPCustomization{DNS: []string{"dns.example.com"}}}},
+			err:        `network interface "eth0": ipv4: dns: invalid address "dns.example.com"`,
+		},
+		"dns-search": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "eth0", IPv4: &NetworkIPCustomization{DNSSearch: []string{"example.com;evil"}}}},
+			err:        `network interface "eth0": ipv4: invalid dns search domain "example.com;evil"`,
+		},
+		"route": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "eth0", IPv4: &NetworkIPCustomization{Routes: []NetworkRouteCustomization{{Destination: "default"}}}}},
+			err:        `network interface "eth0": ipv4: route: invalid address "default" (must be in CIDR notation)`,
+		},
+		"route-gateway": {
+			interfaces: []NetworkInterfaceCustomization{{Name: "eth0", IPv4: &NetworkIPCustomization{Routes: []NetworkRouteCustomization{{Destination: "10.0.0.0/8", Gateway: "10.0.0.0/8"}}}}},
+			err:        `network interface "eth0": ipv4: route gateway: invalid address "10.0.0.0/8"`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			c := &Customizations{
+				Network: &NetworkCustomization{Interfaces: tc.interfaces},
+			}
+			_, err := c.GetNetwork()
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package blueprint
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// SudoersCustomization creates sudo rules in /etc/sudoers.d, see
+// sudoers(5).
+type SudoersCustomization struct {
+	CommandAliases []SudoCommandAliasCustomization `json:"command_aliases,omitempty" toml:"command_aliases,omitempty"`
+	Rules          []SudoRuleCustomization         `json:"rules,omitempty" toml:"rules,omitempty"`
+}
+
+// SudoCommandAliasCustomization defines a named list of commands
+// (Cmnd_Alias) that rules and later aliases can refer to.
+type SudoCommandAliasCustomization struct {
+	// Upper case name, e.g. "SERVICES"
+	Name     string   `json:"name" toml:"name"`
+	Commands []string `json:"commands" toml:"commands"`
+}
+
+// SudoRuleCustomization allows a user or the members of a group to run
+// commands with sudo. Exactly one of User and Group must be set.
+type SudoRuleCustomization struct {
+	User  string `json:"user,omitempty" toml:"user,omitempty"`
+	Group string `json:"group,omitempty" toml:"group,omitempty"`
+	// Host on which the rule applies. Defaults to "ALL".
+	Host string `json:"host,omitempty" toml:"host,omitempty"`
+	// User, optionally followed by a colon and a group, that the commands
+	// run as, e.g. "root" or "ALL:ALL". Defaults to "ALL".
+	RunAs string `json:"runas,omitempty" toml:"runas,omitempty"`
+	// Absolute paths of commands with optional arguments, names of command
+	// aliases, or "ALL". Commands prefixed with "!" are denied.
+	Commands []string `json:"commands" toml:"commands"`
+	// Run the commands without asking for the password of the user
+	NoPasswd bool `json:"nopasswd,omitempty" toml:"nopasswd,omitempty"`
+}
+
+// GetHost returns the host of the rule, "ALL" if it is not set.
+func (r SudoRuleCustomization) GetHost() string {
+	if r.Host == "" {
+		return "ALL"
+	}
+	return r.Host
+}
+
+// GetRunAs returns the user (and group) that the commands of the rule run
+// as, "ALL" if it is not set.
+func (r SudoRuleCustomization) GetRunAs() string {
+	if r.RunAs == "" {
+		return "ALL"
+	}
+	return r.RunAs
+}
+
+var (
+	sudoNameRegex      = regexp.MustCompile(`^[a-z_][a-z0-9_.-]{0,31}$`)
+	sudoRunAsRegex     = regexp.MustCompile(`^(ALL|[a-z_][a-z0-9_.-]{0,31})(:(ALL|[a-z_][a-z0-9_.-]{0,31}))?$`)
+	sudoHostRegex      = regexp.MustCompile(`^(ALL|[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?)$`)
+	sudoAliasNameRegex = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+	sudoCommandRegex   = regexp.MustCompile(`^/[^\s,:=\\#]*$`)
+)
+
+// validateSudoCommand checks a command of a rule or an alias: "ALL", the
+// name of a command alias in aliases, or an absolute path with optional
+// arguments, optionally negated with a leading '!'. Characters with a
+// special meaning in sudoers are escaped when the arguments are written,
+// except for '#' which starts a comment.
+func validateSudoCommand(command string, aliases map[string]bool) error {
+	// all of them can be negated, including "ALL"
+	command = strings.TrimPrefix(command, "!")
+	if command == "ALL" {
+		return nil
+	}
+	if sudoAliasNameRegex.MatchString(command) {
+		if !aliases[command] {
+			return fmt.Errorf("command alias %q is not defined", command)
+		}
+		return nil
+	}
+
+	path, args, _ := strings.Cut(command, " ")
+	if path != "sudoedit" && !sudoCommandRegex.MatchString(path) {
+		return fmt.Errorf("command %q must be an absolute path", path)
+	}
+	if strings.ContainsAny(args, "\n#") {
+		return fmt.Errorf("arguments of command %q must not contain newlines or '#'", path)
+	}
+	return nil
+}
+
+// Validate checks the syntax of the aliases and the rules, so that the
+// sudoers file created from them is accepted by sudo.
+func (sc *SudoersCustomization) Validate() error {
+	if sc == nil {
+		return nil
+	}
+
+	if len(sc.Rules) == 0 {
+		return fmt.Errorf("sudoers: at least one rule is required")
+	}
+
+	aliases := make(map[string]bool, len(sc.CommandAliases))
+	for _, alias := range sc.CommandAliases {
+		if !sudoAliasNameRegex.MatchString(alias.Name) || alias.Name == "ALL" {
+			return fmt.Errorf("sudoers: command alias name %q is invalid (must be upper case)", alias.Name)
+		}
+		if aliases[alias.Name] {
+			return fmt.Errorf("sudoers: command alias %q is defined more than once", alias.Name)
+		}
+		if len(alias.Commands) == 0 {
+			return fmt.Errorf("sudoers: command alias %q has no commands", alias.Name)
+		}
+		// aliases can only refer to the aliases that are defined before
+		for _, command := range alias.Commands {
+			if err := validateSudoCommand(command, aliases); err != nil {
+				return fmt.Errorf("sudoers: command alias %q: %w", alias.Name, err)
+			}
+		}
+		aliases[alias.Name] = true
+	}
+
+	for _, rule := range sc.Rules {
+		var who string
+		switch {
+		case rule.User != "" && rule.Group != "":
+			return fmt.Errorf("sudoers: rule for user %q and group %q, only one of them can be set", rule.User, rule.Group)
+		case rule.User != "":
+			who = fmt.Sprintf("user %q", rule.User)
+			if !sudoNameRegex.MatchString(rule.User) {
+				return fmt.Errorf("sudoers: user name %q is invalid", rule.User)
+			}
+		case rule.Group != "":
+			who = fmt.Sprintf("group %q", rule.Group)
+			if !sudoNameRegex.MatchString(rule.Group) {
+				return fmt.Errorf("sudoers: group name %q is invalid", rule.Group)
+			}
+		default:
+			return fmt.Errorf("sudoers: rule without user or group")
+		}
+
+		if !sudoHostRegex.MatchString(rule.GetHost()) {
+			return fmt.Errorf("sudoers: rule for %s: host %q is invalid", who, rule.Host)
+		}
+		if !sudoRunAsRegex.MatchString(rule.GetRunAs()) {
+			return fmt.Errorf("sudoers: rule for %s: runas %q is invalid", who, rule.RunAs)
+		}
+		if len(rule.Commands) == 0 {
+			return fmt.Errorf("sudoers: rule for %s has no commands", who)
+		}
+		for _, command := range rule.Commands {
+			if err := validateSudoCommand(command, aliases); err != nil {
+				return fmt.Errorf("sudoers: rule for %s: %w", who, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package blueprint
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSudoersCustomizationTOML(t *testing.T) {
+	input := `
+[[customizations.sudoers.command_aliases]]
+name = "SERVICES"
+commands = ["/usr/bin/systemctl restart httpd", "/usr/bin/systemctl reload httpd"]
+
+[[customizations.sudoers.rules]]
+group = "webadmins"
+commands = ["SERVICES"]
+nopasswd = true
+
+[[customizations.sudoers.rules]]
+user = "operator"
+runas = "root:wheel"
+commands = ["ALL", "!/usr/bin/su"]
+`
+	var bp Blueprint
+	_, err := toml.Decode(input, &bp)
+	require.NoError(t, err)
+
+	sc, err := bp.Customizations.GetSudoers()
+	require.NoError(t, err)
+	assert.Equal(t, &SudoersCustomization{
+		CommandAliases: []SudoCommandAliasCustomization{
+			{Name: "SERVICES", Commands: []string{"/usr/bin/systemctl restart httpd", "/usr/bin/systemctl reload httpd"}},
+		},
+		Rules: []SudoRuleCustomization{
+			{Group: "webadmins", Commands: []string{"SERVICES"}, NoPasswd: true},
+			{User: "operator", RunAs: "root:wheel", Commands: []string{"ALL", "!/usr/bin/su"}},
+		},
+	}, sc)
+	assert.Equal(t, "ALL", sc.Rules[0].GetHost())
+	assert.Equal(t, "ALL", sc.Rules[0].GetRunAs())
+	assert.Equal(t, "root:wheel", sc.Rules[1].GetRunAs())
+}
+
+func TestSudoersCustomizationValidate(t *testing.T) {
+	testCases := map[string]struct {
+		sc  *SudoersCustomization
+		err string
+	}{
+		"no-rules": {
+			sc:  &SudoersCustomization{},
+			err: "sudoers: at least one rule is required",
+		},
+		"alias-name": {
+			sc: &SudoersCustomization{
+				CommandAliases: []SudoCommandAliasCustomization{{Name: "services", Commands: []string{"/usr/bin/systemctl"}}},
+				Rules:          []SudoRuleCustomization{{User: "admin", Commands: []string{"ALL"}}},
+			},
+			err: `sudoers: command alias name "services" is invalid (must be upper case)`,
+		},
+		"alias-duplicate": {
+			sc: &SudoersCustomization{
+				CommandAliases: []SudoCommandAliasCustomization{
+					{Name: "SERVICES", Commands: []string{"/usr/bin/systemctl"}},
+					{Name: "SERVICES", Commands: []string{"/usr/sbin/service"}},
+				},
+				Rules: []SudoRuleCustomization{{User: "admin", Commands: []string{"SERVICES"}}},
+			},
+			err: `sudoers: command alias "SERVICES" is defined more than once`,
+		},
+		"alias-empty": {
+			sc: &SudoersCustomization{
+				CommandAliases: []SudoCommandAliasCustomization{{Name: "SERVICES"}},
+				Rules:          []SudoRuleCustomization{{User: "admin", Commands: []string{"SERVICES"}}},
+			},
+			err: `sudoers: command alias "SERVICES" has no commands`,
+		},
+		"alias-forward-reference": {
+			sc: &SudoersCustomization{
+				CommandAliases: []SudoCommandAliasCustomization{
+					{Name: "ADMIN", Commands: []string{"SERVICES"}},
+					{Name: "SERVICES", Commands: []string{"/usr/bin/systemctl"}},
+				},
+				Rules: []SudoRuleCustomization{{User: "admin", Commands: []string{"ADMIN"}}},
+			},
+			err: `sudoers: command alias "ADMIN": command alias "SERVICES" is not defined`,
+		},
+		"user-and-group": {
+			sc:  &SudoersCustomization{Rules: []SudoRuleCustomization{{User: "admin", Group: "wheel", Commands: []string{"ALL"}}}},
+			err: `sudoers: rule for user "admin" and group "wheel", only one of them can be set`,
+		},
+		"user-name": {
+			sc:  &SudoersCustomization{Rules: []SudoRuleCustomization{{User: "admin ALL", Commands: []string{"ALL"}}}},
+			err: `sudoers: user name "admin ALL" is invalid`,
+		},
+		"group-name": {
+			sc:  &SudoersCustomization{Rules: []SudoRuleCustomization{{Group: "%wheel", Commands: []string{"ALL"}}}},
+			err: `sudoers: group name "%wheel" is invalid`,
+		},
+		"no-user-or-group": {
+			sc:  &SudoersCustomization{Rules: []SudoRuleCustomization{{Commands: []string{"ALL"}}}},
+			err: "sudoers: rule without user or group",
+		},
+		"host": {
+			sc:  &SudoersCustomization{Rules: []SudoRuleCustomization{{User: "admin", Host: "host=ALL", Commands: []string{"ALL"}}}},
+			err: `sudoers: rule for user "admin": host "host=ALL" is invalid`,
+		},
+		"runas": {
+			sc:  &SudoersCustomization{Rules: []SudoRuleCustomization{{User: "admin", RunAs: "(root)", Commands: []string{"ALL"}}}},
+			err: `sudoers: rule for user "admin": runas "(root)" is invalid`,
+		},
+		"no-commands": {
+			sc:  &SudoersCustomization{Rules: []SudoRuleCustomization{{Group: "wheel"}}},
+			err: `sudoers: rule for group "wheel" has no commands`,
+		},
+		"relative-command": {
+			sc:  &SudoersCustomization{Rules: []SudoRuleCustomization{{User: "admin", Commands: []string{"systemctl restart httpd"}}}},
+			err: `sudoers: rule for user "admin": command "systemctl" must be an absolute path`,
+		},
+		"command-comment": {
+			sc:  &SudoersCustomization{Rules: []SudoRuleCustomization{{User: "admin", Commands: []string{"/usr/bin/systemctl restart #1"}}}},
+			err: `sudoers: rule for user "admin": arguments of command "/usr/bin/systemctl" must not contain newlines or '#'`,
+		},
+		"undefined-alias": {
+			sc:  &SudoersCustomization{Rules: []SudoRuleCustomization{{User: "admin", Commands: []string{"!SHELLS"}}}},
+			err: `sudoers: rule for user "admin": command alias "SHELLS" is not defined`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := (&Customizations{Sudoers: tc.sc}).GetSudoers()
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+func TestSudoersCustomizationValidateNegated(t *testing.T) {
+	for _, commands := range [][]string{
+		{"ALL", "!ALL"},
+		{"ALL", "!/usr/bin/su"},
+		{"ALL", "!/usr/bin/passwd root"},
+		{"ALL", "!sudoedit /etc/sudoers"},
+		{"ALL", "!SHELLS"},
+	} {
+		t.Run(strings.Join(commands, ","), func(t *testing.T) {
+			sc := &SudoersCustomization{
+				CommandAliases: []SudoCommandAliasCustomization{
+					{Name: "SHELLS", Commands: []string{"/usr/bin/bash", "!/usr/bin/zsh"}},
+				},
+				Rules: []SudoRuleCustomization{{User: "admin", Commands: commands}},
+			}
+			assert.NoError(t, sc.Validate())
+		})
+	}
+}
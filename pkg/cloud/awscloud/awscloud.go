@@ -17,6 +17,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/osbuild/images/pkg/olog"
 )
@@ -24,7 +25,8 @@ import (
 type AWS struct {
 	uploader *s3manager.Uploader
 	ec2      *ec2.EC2
-	s3       *s3.S3
+	s3       s3iface.S3API
+	sess     *session.Session
 }
 
 // S3Permission Implementing an "enum type" for aws-sdk-go permission constants
@@ -62,8 +64,9 @@ func newAwsFromCreds(creds *credentials.Credentials, region string) (*AWS, error
 		uploader: s3manager.NewUploader(sess, func(u *s3manager.Uploader) {
 			u.PartSize = 64 * 1024 * 1024 // 64MB per part
 		}),
-		ec2: ec2.New(sess),
-		s3:  s3.New(sess),
+		ec2:  ec2.New(sess),
+		s3:   s3.New(sess),
+		sess: sess,
 	}, nil
 }
 
@@ -91,23 +94,28 @@ func NewDefault(region string) (*AWS, error) {
 	return newAwsFromCreds(nil, region)
 }
 
-// Create a new session from the credentials and the region and returns an *AWS object initialized with it.
-func newAwsFromCredsWithEndpoint(creds *credentials.Credentials, region, endpoint, caBundle string, skipSSLVerification bool) (*AWS, error) {
-	// Create a Session with a custom region
-	s3ForcePathStyle := true
+// NewSession creates a session from the credentials and the region for the
+// given S3 compatible endpoint, the AWS endpoint of the region is used if it
+// is empty. The server certificate is verified with the certificates of the
+// PEM file caBundle if it is set, or not at all if skipSSLVerification is
+// set. Path-style bucket addressing is used for custom endpoints as S3
+// compatible services usually do not support virtual hosted-style buckets.
+func NewSession(creds *credentials.Credentials, region, endpoint, caBundle string, skipSSLVerification bool) (*session.Session, error) {
 	sessionOptions := session.Options{
 		Config: aws.Config{
-			Credentials:      creds,
-			Region:           aws.String(region),
-			Endpoint:         &endpoint,
-			S3ForcePathStyle: &s3ForcePathStyle,
+			Credentials: creds,
+			Region:      aws.String(region),
 		},
 	}
+	if endpoint != "" {
+		sessionOptions.Config.Endpoint = aws.String(endpoint)
+		sessionOptions.Config.S3ForcePathStyle = aws.Bool(true)
+	}
 
 	if caBundle != "" {
 		caBundleReader, err := os.Open(caBundle)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("cannot open the CA bundle: %w", err)
 		}
 		defer caBundleReader.Close()
 		sessionOptions.CustomCABundle = caBundleReader
@@ -121,7 +129,12 @@ func newAwsFromCredsWithEndpoint(creds *credentials.Credentials, region, endpoin
 		}
 	}
 
-	sess, err := session.NewSessionWithOptions(sessionOptions)
+	return session.NewSessionWithOptions(sessionOptions)
+}
+
+// Create a new session from the credentials and the region and returns an *AWS object initialized with it.
+func newAwsFromCredsWithEndpoint(creds *credentials.Credentials, region, endpoint, caBundle string, skipSSLVerification bool) (*AWS, error) {
+	sess, err := NewSession(creds, region, endpoint, caBundle, skipSSLVerification)
 	if err != nil {
 		return nil, err
 	}
@@ -130,6 +143,7 @@ func newAwsFromCredsWithEndpoint(creds *credentials.Credentials, region, endpoin
 		uploader: s3manager.NewUploader(sess),
 		ec2:      ec2.New(sess),
 		s3:       s3.New(sess),
+		sess:     sess,
 	}, nil
 }
 
@@ -234,6 +248,45 @@ func WaitUntilImportSnapshotTaskCompletedWithContext(c *ec2.EC2, ctx aws.Context
 	return w.WaitWithContext(ctx)
 }
 
+// RegisterOptions contains the optional settings of AMIs that are
+// registered with RegisterWithOptions.
+type RegisterOptions struct {
+	// UefiData is the base64 encoded UEFI variable store of the AMI,
+	// e.g. with custom secure boot db and KEK keys, as generated by
+	// "uefivars -o aws". It requires the uefi or uefi-preferred boot
+	// mode.
+	UefiData *string
+	// TpmSupport enables NitroTPM for the instances of the AMI, the
+	// only supported value is ec2.TpmSupportValuesV20. It requires
+	// the uefi or uefi-preferred boot mode.
+	TpmSupport *string
+	// ImdsSupport set to ec2.ImdsSupportValuesV20 requires IMDSv2 for
+	// the instances launched from the AMI.
+	ImdsSupport *string
+}
+
+func (ro *RegisterOptions) validate(bootMode *string) error {
+	if ro == nil {
+		return nil
+	}
+	uefi := bootMode != nil && (*bootMode == ec2.BootModeValuesUefi || *bootMode == ec2.BootModeValuesUefiPreferred)
+	if ro.UefiData != nil && !uefi {
+		return fmt.Errorf("UEFI data requires the %s or %s boot mode", ec2.BootModeValuesUefi, ec2.BootModeValuesUefiPreferred)
+	}
+	if ro.TpmSupport != nil {
+		if !slices.Contains(ec2.TpmSupportValues_Values(), *ro.TpmSupport) {
+			return fmt.Errorf("ec2 doesn't support the following TPM support value: %s", *ro.TpmSupport)
+		}
+		if !uefi {
+			return fmt.Errorf("TPM support requires the %s or %s boot mode", ec2.BootModeValuesUefi, ec2.BootModeValuesUefiPreferred)
+		}
+	}
+	if ro.ImdsSupport != nil && !slices.Contains(ec2.ImdsSupportValues_Values(), *ro.ImdsSupport) {
+		return fmt.Errorf("ec2 doesn't support the following IMDS support value: %s", *ro.ImdsSupport)
+	}
+	return nil
+}
+
 // Register is a function that imports a snapshot, waits for the snapshot to
 // fully import, tags the snapshot, cleans up the image in S3, and registers
 // an AMI in AWS.
@@ -246,6 +299,12 @@ func WaitUntilImportSnapshotTaskCompletedWithContext(c *ec2.EC2, ctx aws.Context
 //
 // XXX: make this return (string, string, error) instead of pointers
 func (a *AWS) Register(name, bucket, key string, shareWith []string, rpmArch string, bootMode, importRole *string) (*string, *string, error) {
+	return a.RegisterWithOptions(name, bucket, key, shareWith, rpmArch, bootMode, importRole, nil)
+}
+
+// RegisterWithOptions works like Register but allows to set the optional
+// UEFI, TPM and IMDS settings of the AMI.
+func (a *AWS) RegisterWithOptions(name, bucket, key string, shareWith []string, rpmArch string, bootMode, importRole *string, opts *RegisterOptions) (*string, *string, error) {
 	rpmArchToEC2Arch := map[string]string{
 		"x86_64":  "x86_64",
 		"aarch64": "arm64",
@@ -261,6 +320,12 @@ func (a *AWS) Register(name, bucket, key string, shareWith []string, rpmArch str
 			return nil, nil, fmt.Errorf("ec2 doesn't support the following boot mode: %s", *bootMode)
 		}
 	}
+	if err := opts.validate(bootMode); err != nil {
+		return nil, nil, err
+	}
+	if opts == nil {
+		opts = &RegisterOptions{}
+	}
 
 	olog.Printf("[AWS] 📥 Importing snapshot from image: %s/%s", bucket, key)
 	snapshotDescription := fmt.Sprintf("Image Builder AWS Import of %s", name)
@@ -335,6 +400,9 @@ func (a *AWS) Register(name, bucket, key string, shareWith []string, rpmArch str
 		&ec2.RegisterImageInput{
 			Architecture:       aws.String(ec2Arch),
 			BootMode:           bootMode,
+			UefiData:           opts.UefiData,
+			TpmSupport:         opts.TpmSupport,
+			ImdsSupport:        opts.ImdsSupport,
 			VirtualizationType: aws.String("hvm"),
 			Name:               aws.String(name),
 			RootDeviceName:     aws.String("/dev/sda1"),
@@ -574,6 +642,10 @@ func (a *AWS) RemoveSnapshotAndDeregisterImage(image *ec2.Image) error {
 
 	var snapshots []*string
 	for _, bdm := range image.BlockDeviceMappings {
+		// copies that failed partway may have no snapshots yet
+		if bdm.Ebs == nil || bdm.Ebs.SnapshotId == nil {
+			continue
+		}
 		snapshots = append(snapshots, bdm.Ebs.SnapshotId)
 	}
 
@@ -614,7 +686,10 @@ func (a *AWS) DescribeImagesByTag(tagKey, tagValue string) ([]*ec2.Image, error)
 			},
 		},
 	)
-	return imgs.Images, err
+	if err != nil {
+		return nil, err
+	}
+	return imgs.Images, nil
 }
 
 func (a *AWS) S3ObjectPresignedURL(bucket, objectKey string) (string, error) {
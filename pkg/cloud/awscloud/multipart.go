@@ -0,0 +1,144 @@
+package awscloud
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/osbuild/images/pkg/cloud"
+	"github.com/osbuild/images/pkg/datasizes"
+)
+
+const (
+	// multipartMinPartSize is the part size of multipart uploads,
+	// it is increased for big images to stay within the limit of
+	// multipartMaxParts.
+	multipartMinPartSize = 64 * datasizes.MiB
+	multipartMaxParts    = 10000
+)
+
+// multipartPartSize returns the part size for a multipart upload of the
+// given size. It only depends on the size so that resumed uploads use
+// the same parts.
+func multipartPartSize(size int64) int64 {
+	partSize := int64(multipartMinPartSize)
+	if minSize := (size + multipartMaxParts - 1) / multipartMaxParts; minSize > partSize {
+		partSize = minSize
+	}
+	return partSize
+}
+
+// MultipartUploadFromReaderAt uploads size bytes from r into the given
+// bucket and key using an S3 multipart upload with SHA-256 checksums.
+// If uploadID is not empty the given multipart upload is resumed and
+// parts that were already uploaded with matching checksums are skipped.
+// The ID of the multipart upload is passed to onUploadID as soon as it
+// is known. A failed upload is not aborted so that it can be resumed.
+//
+// The composite checksum that S3 computed for the object is compared to
+// the local data, the hex encoded SHA-256 of the data is returned.
+func (a *AWS) MultipartUploadFromReaderAt(r io.ReaderAt, size int64, bucket, key, uploadID string, onUploadID func(string)) (string, error) {
+	uploadedParts := map[int64]*s3.Part{}
+	if uploadID == "" {
+		res, err := a.s3.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+			Bucket:            aws.String(bucket),
+			Key:               aws.String(key),
+			ChecksumAlgorithm: aws.String(s3.ChecksumAlgorithmSha256),
+		})
+		if err != nil {
+			return "", fmt.Errorf("cannot create multipart upload for %s:%s: %w", bucket, key, err)
+		}
+		uploadID = aws.StringValue(res.UploadId)
+	} else {
+		err := a.s3.ListPartsPages(&s3.ListPartsInput{
+			Bucket:   aws.String(bucket),
+			Key:      aws.String(key),
+			UploadId: aws.String(uploadID),
+		}, func(page *s3.ListPartsOutput, lastPage bool) bool {
+			for _, part := range page.Parts {
+				uploadedParts[aws.Int64Value(part.PartNumber)] = part
+			}
+			return true
+		})
+		if err != nil {
+			return "", fmt.Errorf("cannot list parts of multipart upload %s: %w", uploadID, err)
+		}
+	}
+	if onUploadID != nil {
+		onUploadID(uploadID)
+	}
+
+	partSize := multipartPartSize(size)
+	imageHash := sha256.New()
+	// S3 computes the checksum of multipart objects as the checksum
+	// of the concatenated checksums of the parts
+	compositeHash := sha256.New()
+	var completedParts []*s3.CompletedPart
+	buf := make([]byte, partSize)
+	for partNumber, offset := int64(1), int64(0); offset < size || partNumber == 1; partNumber, offset = partNumber+1, offset+partSize {
+		n := min(partSize, size-offset)
+		partBuf := buf[:n]
+		if _, err := io.ReadFull(io.NewSectionReader(r, offset, n), partBuf); err != nil {
+			return "", fmt.Errorf("cannot read part %d of the image: %w", partNumber, err)
+		}
+		partChecksum := sha256Sum(imageHash, compositeHash, partBuf)
+
+		part := uploadedParts[partNumber]
+		if part == nil || aws.StringValue(part.ChecksumSHA256) != partChecksum || aws.Int64Value(part.Size) != n {
+			res, err := a.s3.UploadPart(&s3.UploadPartInput{
+				Bucket:            aws.String(bucket),
+				Key:               aws.String(key),
+				UploadId:          aws.String(uploadID),
+				PartNumber:        aws.Int64(partNumber),
+				Body:              bytes.NewReader(partBuf),
+				ChecksumAlgorithm: aws.String(s3.ChecksumAlgorithmSha256),
+				ChecksumSHA256:    aws.String(partChecksum),
+			})
+			if err != nil {
+				return "", fmt.Errorf("cannot upload part %d: %w", partNumber, err)
+			}
+			part = &s3.Part{ETag: res.ETag, ChecksumSHA256: res.ChecksumSHA256}
+		}
+		completedParts = append(completedParts, &s3.CompletedPart{
+			ETag:           part.ETag,
+			PartNumber:     aws.Int64(partNumber),
+			ChecksumSHA256: part.ChecksumSHA256,
+		})
+	}
+
+	res, err := a.s3.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{
+			Parts: completedParts,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("cannot complete multipart upload %s: %w", uploadID, err)
+	}
+
+	expected := fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(compositeHash.Sum(nil)), len(completedParts))
+	if actual := aws.StringValue(res.ChecksumSHA256); actual != expected {
+		return "", &cloud.ChecksumMismatchError{Algorithm: "SHA-256 (composite)", Expected: expected, Actual: actual}
+	}
+
+	return hex.EncodeToString(imageHash.Sum(nil)), nil
+}
+
+// sha256Sum returns the base64 encoded SHA-256 of the given part and
+// feeds the data to the hash of the image and the raw part checksum to
+// the composite hash.
+func sha256Sum(imageHash, compositeHash hash.Hash, part []byte) string {
+	imageHash.Write(part)
+	sum := sha256.Sum256(part)
+	compositeHash.Write(sum[:])
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,131 @@
+package awscloud
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/cloud"
+	"github.com/osbuild/images/pkg/datasizes"
+)
+
+// fakeS3 implements the parts of the S3 API that are used by
+// multipart uploads, it computes checksums the same way S3 does
+type fakeS3 struct {
+	s3iface.S3API
+
+	parts       map[int64]*s3.Part
+	uploadCalls []int64
+	corrupt     bool
+}
+
+func (f *fakeS3) CreateMultipartUpload(in *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	f.parts = map[int64]*s3.Part{}
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-id")}, nil
+}
+
+func (f *fakeS3) ListPartsPages(in *s3.ListPartsInput, fn func(*s3.ListPartsOutput, bool) bool) error {
+	if aws.StringValue(in.UploadId) != "upload-id" {
+		return fmt.Errorf("unknown upload %s", aws.StringValue(in.UploadId))
+	}
+	var parts []*s3.Part
+	for _, part := range f.parts {
+		parts = append(parts, part)
+	}
+	fn(&s3.ListPartsOutput{Parts: parts}, true)
+	return nil
+}
+
+func (f *fakeS3) UploadPart(in *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	data, err := io.ReadAll(in.Body)
+	if err != nil {
+		return nil, err
+	}
+	if f.corrupt {
+		data = append(data, 0)
+	}
+	sum := sha256.Sum256(data)
+	checksum := base64.StdEncoding.EncodeToString(sum[:])
+	if !f.corrupt && checksum != aws.StringValue(in.ChecksumSHA256) {
+		return nil, fmt.Errorf("bad digest")
+	}
+	partNumber := aws.Int64Value(in.PartNumber)
+	f.uploadCalls = append(f.uploadCalls, partNumber)
+	etag := aws.String(fmt.Sprintf("etag-%d", partNumber))
+	f.parts[partNumber] = &s3.Part{
+		PartNumber:     in.PartNumber,
+		ETag:           etag,
+		ChecksumSHA256: aws.String(checksum),
+		Size:           aws.Int64(int64(len(data))),
+	}
+	return &s3.UploadPartOutput{ETag: etag, ChecksumSHA256: aws.String(checksum)}, nil
+}
+
+func (f *fakeS3) CompleteMultipartUpload(in *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
+	h := sha256.New()
+	for _, part := range in.MultipartUpload.Parts {
+		sum, err := base64.StdEncoding.DecodeString(aws.StringValue(f.parts[aws.Int64Value(part.PartNumber)].ChecksumSHA256))
+		if err != nil {
+			return nil, err
+		}
+		h.Write(sum)
+	}
+	checksum := fmt.Sprintf("%s-%d", base64.StdEncoding.EncodeToString(h.Sum(nil)), len(in.MultipartUpload.Parts))
+	return &s3.CompleteMultipartUploadOutput{ChecksumSHA256: aws.String(checksum)}, nil
+}
+
+func TestMultipartPartSize(t *testing.T) {
+	assert.Equal(t, int64(64*datasizes.MiB), multipartPartSize(0))
+	assert.Equal(t, int64(64*datasizes.MiB), multipartPartSize(10*datasizes.GiB))
+	assert.Equal(t, int64(107374183), multipartPartSize(1000*datasizes.GiB))
+}
+
+func TestMultipartUploadFromReaderAt(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 2*multipartMinPartSize+10)
+	sum := sha256.Sum256(data)
+
+	fs3 := &fakeS3{}
+	a := &AWS{s3: fs3}
+	var uploadIDs []string
+	res, err := a.MultipartUploadFromReaderAt(bytes.NewReader(data), int64(len(data)), "bucket", "key", "", func(id string) {
+		uploadIDs = append(uploadIDs, id)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(sum[:]), res)
+	assert.Equal(t, []string{"upload-id"}, uploadIDs)
+	assert.Equal(t, []int64{1, 2, 3}, fs3.uploadCalls)
+
+	// resuming only uploads the missing and the mismatching parts
+	fs3.uploadCalls = nil
+	delete(fs3.parts, 2)
+	fs3.parts[3].ChecksumSHA256 = aws.String("bad")
+	res, err = a.MultipartUploadFromReaderAt(bytes.NewReader(data), int64(len(data)), "bucket", "key", "upload-id", nil)
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(sum[:]), res)
+	assert.Equal(t, []int64{2, 3}, fs3.uploadCalls)
+}
+
+func TestMultipartUploadFromReaderAtChecksumMismatch(t *testing.T) {
+	data := []byte("fake-aws-image")
+
+	a := &AWS{s3: &fakeS3{corrupt: true}}
+	_, err := a.MultipartUploadFromReaderAt(bytes.NewReader(data), int64(len(data)), "bucket", "key", "", nil)
+	var mismatch *cloud.ChecksumMismatchError
+	assert.ErrorAs(t, err, &mismatch)
+}
+
+func TestMultipartUploadFromReaderAtBadResume(t *testing.T) {
+	a := &AWS{s3: &fakeS3{}}
+	_, err := a.MultipartUploadFromReaderAt(bytes.NewReader(nil), 0, "bucket", "key", "other-id", nil)
+	assert.EqualError(t, err, "cannot list parts of multipart upload other-id: unknown upload other-id")
+}
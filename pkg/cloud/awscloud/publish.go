@@ -0,0 +1,412 @@
+package awscloud
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"github.com/osbuild/images/pkg/olog"
+)
+
+// ShareTargets are the principals an AMI is shared with.
+type ShareTargets struct {
+	// Accounts are AWS account IDs, the snapshots of the AMI are
+	// shared with them too so that the AMI can be copied.
+	Accounts []string
+	// Organizations are ARNs of AWS organizations.
+	Organizations []string
+	// OrganizationalUnits are ARNs of organizational units.
+	OrganizationalUnits []string
+}
+
+func (st *ShareTargets) empty() bool {
+	return st == nil || len(st.Accounts)+len(st.Organizations)+len(st.OrganizationalUnits) == 0
+}
+
+// PublishOptions contains the settings of PublishImage.
+type PublishOptions struct {
+	// Regions to copy the AMI to, the region of the source AMI is
+	// skipped if it is listed.
+	Regions []string
+	// Tags are applied to the AMI and its snapshots in all regions,
+	// including the source region.
+	Tags map[string]string
+	// ShareWith are the principals the AMI is shared with in all
+	// regions, including the source region.
+	ShareWith *ShareTargets
+	// Parallelism is the number of regions the AMI is copied to at
+	// the same time, all regions are processed at once if zero.
+	Parallelism int
+}
+
+// PublishedImage is an AMI in a single region.
+type PublishedImage struct {
+	Region      string
+	ImageID     string
+	SnapshotIDs []string
+}
+
+// testing support
+type amiClient interface {
+	CopyImage(name, ami, sourceRegion string) (string, error)
+	DescribeImage(ami string) (*ec2.Image, error)
+	TagImageAndSnapshots(image *ec2.Image, tags map[string]string) error
+	UntagImageAndSnapshots(image *ec2.Image, tags map[string]string) error
+	ShareImageWith(image *ec2.Image, targets *ShareTargets) error
+	UnshareImageWith(image *ec2.Image, targets *ShareTargets) error
+	DescribeImagesByTag(tagKey, tagValue string) ([]*ec2.Image, error)
+	RemoveSnapshotAndDeregisterImage(image *ec2.Image) error
+}
+
+// ForRegion returns a client for the given region that uses the same
+// credentials and settings as a.
+func (a *AWS) ForRegion(region string) (*AWS, error) {
+	if a.sess == nil {
+		return nil, fmt.Errorf("cannot create a client for region %s without a session", region)
+	}
+	sess := a.sess.Copy(aws.NewConfig().WithRegion(region))
+	return &AWS{
+		uploader: s3manager.NewUploader(sess),
+		ec2:      ec2.New(sess),
+		s3:       s3.New(sess),
+		sess:     sess,
+	}, nil
+}
+
+// DescribeImage returns the AMI with the given ID.
+func (a *AWS) DescribeImage(ami string) (*ec2.Image, error) {
+	imgs, err := a.ec2.DescribeImages(&ec2.DescribeImagesInput{
+		ImageIds: []*string{aws.String(ami)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(imgs.Images) == 0 {
+		return nil, fmt.Errorf("Unable to find image with id: %v", ami)
+	}
+	return imgs.Images[0], nil
+}
+
+// TagImageAndSnapshots applies the tags to the image and all of its EBS
+// snapshots.
+func (a *AWS) TagImageAndSnapshots(image *ec2.Image, tags map[string]string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	resources := []*string{image.ImageId}
+	for _, bdm := range image.BlockDeviceMappings {
+		if bdm.Ebs != nil && bdm.Ebs.SnapshotId != nil {
+			resources = append(resources, bdm.Ebs.SnapshotId)
+		}
+	}
+	var ec2Tags []*ec2.Tag
+	for _, key := range sortedKeys(tags) {
+		ec2Tags = append(ec2Tags, &ec2.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(tags[key]),
+		})
+	}
+	_, err := a.ec2.CreateTags(&ec2.CreateTagsInput{
+		Resources: resources,
+		Tags:      ec2Tags,
+	})
+	return err
+}
+
+// UntagImageAndSnapshots removes the tags from the image and all of its
+// EBS snapshots, tags whose value was changed since are kept.
+func (a *AWS) UntagImageAndSnapshots(image *ec2.Image, tags map[string]string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	resources := []*string{image.ImageId}
+	for _, bdm := range image.BlockDeviceMappings {
+		if bdm.Ebs != nil && bdm.Ebs.SnapshotId != nil {
+			resources = append(resources, bdm.Ebs.SnapshotId)
+		}
+	}
+	var ec2Tags []*ec2.Tag
+	for _, key := range sortedKeys(tags) {
+		ec2Tags = append(ec2Tags, &ec2.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(tags[key]),
+		})
+	}
+	_, err := a.ec2.DeleteTags(&ec2.DeleteTagsInput{
+		Resources: resources,
+		Tags:      ec2Tags,
+	})
+	return err
+}
+
+// ShareImageWith adds launch permissions for the targets to the image. The
+// EBS snapshots of the image are shared with the target accounts, AWS
+// does not support sharing snapshots with organizations.
+func (a *AWS) ShareImageWith(image *ec2.Image, targets *ShareTargets) error {
+	if targets.empty() {
+		return nil
+	}
+	if len(targets.Accounts) > 0 {
+		for _, bdm := range image.BlockDeviceMappings {
+			if bdm.Ebs == nil || bdm.Ebs.SnapshotId == nil {
+				continue
+			}
+			if err := a.shareSnapshot(bdm.Ebs.SnapshotId, targets.Accounts); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := a.ec2.ModifyImageAttribute(&ec2.ModifyImageAttributeInput{
+		ImageId: image.ImageId,
+		LaunchPermission: &ec2.LaunchPermissionModifications{
+			Add: targets.launchPermissions(),
+		},
+	})
+	return err
+}
+
+// UnshareImageWith removes the launch permissions of the targets from the
+// image and stops sharing its EBS snapshots with the target accounts, see
+// ShareImageWith.
+func (a *AWS) UnshareImageWith(image *ec2.Image, targets *ShareTargets) error {
+	if targets.empty() {
+		return nil
+	}
+	_, err := a.ec2.ModifyImageAttribute(&ec2.ModifyImageAttributeInput{
+		ImageId: image.ImageId,
+		LaunchPermission: &ec2.LaunchPermissionModifications{
+			Remove: targets.launchPermissions(),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(targets.Accounts) == 0 {
+		return nil
+	}
+	var userIds []*string
+	for _, id := range targets.Accounts {
+		userIds = append(userIds, aws.String(id))
+	}
+	for _, bdm := range image.BlockDeviceMappings {
+		if bdm.Ebs == nil || bdm.Ebs.SnapshotId == nil {
+			continue
+		}
+		_, err := a.ec2.ModifySnapshotAttribute(&ec2.ModifySnapshotAttributeInput{
+			Attribute:     aws.String(ec2.SnapshotAttributeNameCreateVolumePermission),
+			OperationType: aws.String("remove"),
+			SnapshotId:    bdm.Ebs.SnapshotId,
+			UserIds:       userIds,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (st *ShareTargets) launchPermissions() []*ec2.LaunchPermission {
+	var launchPerms []*ec2.LaunchPermission
+	for _, id := range st.Accounts {
+		launchPerms = append(launchPerms, &ec2.LaunchPermission{UserId: aws.String(id)})
+	}
+	for _, arn := range st.Organizations {
+		launchPerms = append(launchPerms, &ec2.LaunchPermission{OrganizationArn: aws.String(arn)})
+	}
+	for _, arn := range st.OrganizationalUnits {
+		launchPerms = append(launchPerms, &ec2.LaunchPermission{OrganizationalUnitArn: aws.String(arn)})
+	}
+	return launchPerms
+}
+
+// PublishImage copies the AMI from the region of the client to all the
+// given regions in parallel and waits until the copies are available. The
+// tags are applied to the AMI and all its copies and they are shared with
+// the given principals. If any step fails all copies are removed again,
+// the source AMI is kept but its tags and shares are removed.
+//
+// The source AMI is returned first followed by the copies in the order of
+// opts.Regions.
+func (a *AWS) PublishImage(name, ami string, opts *PublishOptions) ([]PublishedImage, error) {
+	return publishImage(a, aws.StringValue(a.ec2.Config.Region), func(region string) (amiClient, error) {
+		return a.ForRegion(region)
+	}, name, ami, opts)
+}
+
+func publishImage(src amiClient, srcRegion string, regionClient func(string) (amiClient, error), name, ami string, opts *PublishOptions) ([]PublishedImage, error) {
+	if opts == nil {
+		opts = &PublishOptions{}
+	}
+	var regions []string
+	for _, region := range opts.Regions {
+		if region != srcRegion && !slices.Contains(regions, region) {
+			regions = append(regions, region)
+		}
+	}
+	parallelism := opts.Parallelism
+	if parallelism <= 0 {
+		parallelism = max(len(regions), 1)
+	}
+
+	// finish publishes the given image in its region
+	finish := func(c amiClient, region, imageID string) (PublishedImage, error) {
+		image, err := c.DescribeImage(imageID)
+		if err != nil {
+			return PublishedImage{}, err
+		}
+		if err := c.TagImageAndSnapshots(image, opts.Tags); err != nil {
+			return PublishedImage{}, fmt.Errorf("cannot tag %s in %s: %w", imageID, region, err)
+		}
+		if err := c.ShareImageWith(image, opts.ShareWith); err != nil {
+			return PublishedImage{}, fmt.Errorf("cannot share %s in %s: %w", imageID, region, err)
+		}
+		published := PublishedImage{Region: region, ImageID: imageID}
+		for _, bdm := range image.BlockDeviceMappings {
+			if bdm.Ebs != nil && bdm.Ebs.SnapshotId != nil {
+				published.SnapshotIDs = append(published.SnapshotIDs, *bdm.Ebs.SnapshotId)
+			}
+		}
+		return published, nil
+	}
+
+	type copyResult struct {
+		client    amiClient
+		imageID   string
+		published PublishedImage
+		err       error
+	}
+	results := make([]copyResult, len(regions))
+	semaphore := make(chan int, parallelism)
+	var wg sync.WaitGroup
+	for i, region := range regions {
+		wg.Add(1)
+		go func(i int, region string) {
+			defer wg.Done()
+			semaphore <- 1
+			defer func() { <-semaphore }()
+
+			res := &results[i]
+			res.client, res.err = regionClient(region)
+			if res.err != nil {
+				return
+			}
+			olog.Printf("[AWS] 📋 Copying AMI %s to %s", ami, region)
+			// the ID is returned if the copy failed after it was
+			// started so that it can be cleaned up
+			res.imageID, res.err = res.client.CopyImage(name, ami, srcRegion)
+			if res.err != nil {
+				res.err = fmt.Errorf("cannot copy %s to %s: %w", ami, region, res.err)
+				return
+			}
+			res.published, res.err = finish(res.client, region, res.imageID)
+		}(i, region)
+	}
+	wg.Wait()
+
+	published := []PublishedImage{}
+	var errs []error
+	srcPublished, err := finish(src, srcRegion, ami)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	published = append(published, srcPublished)
+	for _, res := range results {
+		if res.err != nil {
+			errs = append(errs, res.err)
+		}
+		published = append(published, res.published)
+	}
+	if len(errs) == 0 {
+		return published, nil
+	}
+
+	// roll back the tags and shares of the source AMI and all the copies
+	olog.Printf("[AWS] 🧹 Removing the tags and shares of %s in %s", ami, srcRegion)
+	if err := rollbackSource(src, ami, opts); err != nil {
+		errs = append(errs, fmt.Errorf("cannot remove the tags and shares of %s in %s: %w", ami, srcRegion, err))
+	}
+	for i, res := range results {
+		if res.imageID == "" {
+			continue
+		}
+		olog.Printf("[AWS] 🧹 Removing copy %s in %s", res.imageID, regions[i])
+		image, err := res.client.DescribeImage(res.imageID)
+		if err == nil {
+			err = res.client.RemoveSnapshotAndDeregisterImage(image)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("cannot remove copy %s in %s: %w", res.imageID, regions[i], err))
+		}
+	}
+	return nil, errors.Join(errs...)
+}
+
+// rollbackSource removes the tags and shares that publishImage added to
+// the source AMI.
+func rollbackSource(src amiClient, ami string, opts *PublishOptions) error {
+	image, err := src.DescribeImage(ami)
+	if err != nil {
+		return err
+	}
+	if err := src.UnshareImageWith(image, opts.ShareWith); err != nil {
+		return err
+	}
+	return src.UntagImageAndSnapshots(image, opts.Tags)
+}
+
+// DeregisterOldImages keeps the newest `keep` AMIs that have the given tag
+// and deregisters all older ones together with their snapshots, see
+// DescribeImagesByTag. The AMIs are ordered by their creation date. The
+// deregistered AMIs are returned.
+func (a *AWS) DeregisterOldImages(tagKey, tagValue string, keep int) ([]*ec2.Image, error) {
+	return deregisterOldImages(a, tagKey, tagValue, keep)
+}
+
+func deregisterOldImages(c amiClient, tagKey, tagValue string, keep int) ([]*ec2.Image, error) {
+	if keep < 0 {
+		return nil, fmt.Errorf("cannot keep a negative number of images: %d", keep)
+	}
+	images, err := c.DescribeImagesByTag(tagKey, tagValue)
+	if err != nil {
+		return nil, err
+	}
+	if len(images) <= keep {
+		return nil, nil
+	}
+
+	// newest first, the creation date is in the ISO 8601 format
+	slices.SortFunc(images, func(a, b *ec2.Image) int {
+		if c := strings.Compare(aws.StringValue(b.CreationDate), aws.StringValue(a.CreationDate)); c != 0 {
+			return c
+		}
+		return strings.Compare(aws.StringValue(a.ImageId), aws.StringValue(b.ImageId))
+	})
+
+	var removed []*ec2.Image
+	for _, image := range images[keep:] {
+		olog.Printf("[AWS] 🧹 Deregistering old AMI %s (created %s)", aws.StringValue(image.ImageId), aws.StringValue(image.CreationDate))
+		if err := c.RemoveSnapshotAndDeregisterImage(image); err != nil {
+			return removed, fmt.Errorf("cannot deregister %s: %w", aws.StringValue(image.ImageId), err)
+		}
+		removed = append(removed, image)
+	}
+	return removed, nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,229 @@
+package awscloud
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAMIs is the state of all regions, it is shared by the fakeAMIClients
+type fakeAMIs struct {
+	mu sync.Mutex
+
+	images  map[string]*ec2.Image
+	tags    map[string]map[string]string
+	shared  map[string]*ShareTargets
+	removed []string
+
+	failCopy  map[string]error
+	failShare map[string]error
+}
+
+func newFakeAMIs() *fakeAMIs {
+	return &fakeAMIs{
+		images:    map[string]*ec2.Image{},
+		tags:      map[string]map[string]string{},
+		shared:    map[string]*ShareTargets{},
+		failCopy:  map[string]error{},
+		failShare: map[string]error{},
+	}
+}
+
+func (f *fakeAMIs) addImage(id, created string) {
+	f.images[id] = &ec2.Image{
+		ImageId:      aws.String(id),
+		CreationDate: aws.String(created),
+		BlockDeviceMappings: []*ec2.BlockDeviceMapping{
+			{Ebs: &ec2.EbsBlockDevice{SnapshotId: aws.String("snap-" + id)}},
+		},
+	}
+}
+
+type fakeAMIClient struct {
+	*fakeAMIs
+	region string
+}
+
+func (c *fakeAMIClient) CopyImage(name, ami, sourceRegion string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	id := fmt.Sprintf("%s-%s", ami, c.region)
+	c.addImage(id, "2024-01-01T00:00:00.000Z")
+	return id, c.failCopy[c.region]
+}
+
+func (c *fakeAMIClient) DescribeImage(ami string) (*ec2.Image, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	image, ok := c.images[ami]
+	if !ok {
+		return nil, fmt.Errorf("Unable to find image with id: %v", ami)
+	}
+	return image, nil
+}
+
+func (c *fakeAMIClient) TagImageAndSnapshots(image *ec2.Image, tags map[string]string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.tags[*image.ImageId] = tags
+	for _, bdm := range image.BlockDeviceMappings {
+		c.tags[*bdm.Ebs.SnapshotId] = tags
+	}
+	return nil
+}
+
+func (c *fakeAMIClient) UntagImageAndSnapshots(image *ec2.Image, tags map[string]string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.tags, *image.ImageId)
+	for _, bdm := range image.BlockDeviceMappings {
+		delete(c.tags, *bdm.Ebs.SnapshotId)
+	}
+	return nil
+}
+
+func (c *fakeAMIClient) ShareImageWith(image *ec2.Image, targets *ShareTargets) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.failShare[c.region]; err != nil {
+		return err
+	}
+	c.shared[*image.ImageId] = targets
+	return nil
+}
+
+func (c *fakeAMIClient) UnshareImageWith(image *ec2.Image, targets *ShareTargets) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.shared, *image.ImageId)
+	return nil
+}
+
+func (c *fakeAMIClient) DescribeImagesByTag(tagKey, tagValue string) ([]*ec2.Image, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var images []*ec2.Image
+	for id, image := range c.images {
+		if c.tags[id][tagKey] == tagValue {
+			images = append(images, image)
+		}
+	}
+	return images, nil
+}
+
+func (c *fakeAMIClient) RemoveSnapshotAndDeregisterImage(image *ec2.Image) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.images, *image.ImageId)
+	c.removed = append(c.removed, *image.ImageId)
+	return nil
+}
+
+func (f *fakeAMIs) regionClient(region string) (amiClient, error) {
+	return &fakeAMIClient{fakeAMIs: f, region: region}, nil
+}
+
+func TestPublishImage(t *testing.T) {
+	fake := newFakeAMIs()
+	fake.addImage("ami-1", "2024-01-01T00:00:00.000Z")
+	src, _ := fake.regionClient("us-east-1")
+
+	share := &ShareTargets{
+		Accounts:      []string{"123456789012"},
+		Organizations: []string{"arn:aws:organizations::123456789012:organization/o-1"},
+	}
+	tags := map[string]string{"build": "42", "distro": "fedora-41"}
+	published, err := publishImage(src, "us-east-1", fake.regionClient, "image", "ami-1", &PublishOptions{
+		Regions:     []string{"eu-west-1", "us-east-1", "ap-south-1", "eu-west-1"},
+		Tags:        tags,
+		ShareWith:   share,
+		Parallelism: 1,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []PublishedImage{
+		{Region: "us-east-1", ImageID: "ami-1", SnapshotIDs: []string{"snap-ami-1"}},
+		{Region: "eu-west-1", ImageID: "ami-1-eu-west-1", SnapshotIDs: []string{"snap-ami-1-eu-west-1"}},
+		{Region: "ap-south-1", ImageID: "ami-1-ap-south-1", SnapshotIDs: []string{"snap-ami-1-ap-south-1"}},
+	}, published)
+
+	for _, p := range published {
+		assert.Equal(t, tags, fake.tags[p.ImageID])
+		assert.Equal(t, tags, fake.tags[p.SnapshotIDs[0]])
+		assert.Equal(t, share, fake.shared[p.ImageID])
+	}
+	assert.Empty(t, fake.removed)
+}
+
+func TestPublishImageRollback(t *testing.T) {
+	fake := newFakeAMIs()
+	fake.addImage("ami-1", "2024-01-01T00:00:00.000Z")
+	fake.failCopy["ap-south-1"] = fmt.Errorf("copy failed")
+	fake.failShare["eu-west-1"] = fmt.Errorf("share failed")
+	src, _ := fake.regionClient("us-east-1")
+
+	published, err := publishImage(src, "us-east-1", fake.regionClient, "image", "ami-1", &PublishOptions{
+		Regions:   []string{"eu-west-1", "ap-south-1", "eu-central-1"},
+		Tags:      map[string]string{"build": "42"},
+		ShareWith: &ShareTargets{Accounts: []string{"123456789012"}},
+	})
+	assert.ErrorContains(t, err, "cannot share ami-1-eu-west-1 in eu-west-1: share failed")
+	assert.ErrorContains(t, err, "cannot copy ami-1 to ap-south-1: copy failed")
+	assert.Nil(t, published)
+
+	// the failed copy is removed too, the source image is kept
+	sort.Strings(fake.removed)
+	assert.Equal(t, []string{"ami-1-ap-south-1", "ami-1-eu-central-1", "ami-1-eu-west-1"}, fake.removed)
+	assert.Contains(t, fake.images, "ami-1")
+	assert.Len(t, fake.images, 1)
+	// the source image is neither tagged nor shared anymore
+	assert.NotContains(t, fake.tags, "ami-1")
+	assert.NotContains(t, fake.tags, "snap-ami-1")
+	assert.NotContains(t, fake.shared, "ami-1")
+}
+
+func TestDeregisterOldImages(t *testing.T) {
+	fake := newFakeAMIs()
+	for i, created := range []string{
+		"2024-03-01T00:00:00.000Z",
+		"2024-01-01T00:00:00.000Z",
+		"2024-04-01T00:00:00.000Z",
+		"2024-02-01T00:00:00.000Z",
+	} {
+		id := fmt.Sprintf("ami-%d", i)
+		fake.addImage(id, created)
+		fake.tags[id] = map[string]string{"pipeline": "nightly"}
+	}
+	fake.addImage("ami-other", "2023-01-01T00:00:00.000Z")
+	fake.tags["ami-other"] = map[string]string{"pipeline": "release"}
+	c, _ := fake.regionClient("us-east-1")
+
+	removed, err := deregisterOldImages(c, "pipeline", "nightly", 2)
+	require.NoError(t, err)
+	var removedIDs []string
+	for _, image := range removed {
+		removedIDs = append(removedIDs, *image.ImageId)
+	}
+	assert.Equal(t, []string{"ami-3", "ami-1"}, removedIDs)
+	assert.Equal(t, []string{"ami-3", "ami-1"}, fake.removed)
+
+	removed, err = deregisterOldImages(c, "pipeline", "nightly", 2)
+	require.NoError(t, err)
+	assert.Empty(t, removed)
+
+	_, err = deregisterOldImages(c, "pipeline", "nightly", -1)
+	assert.EqualError(t, err, "cannot keep a negative number of images: -1")
+}
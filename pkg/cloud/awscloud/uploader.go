@@ -25,12 +25,42 @@ type awsUploader struct {
 	imageName  string
 	targetArch string
 	bootMode   *string
+	regOpts    *RegisterOptions
+
+	progress *cloud.ProgressReporter
 }
 
 type UploaderOptions struct {
 	TargetArch string
 	// BootMode to set for the AMI. If nil, no explicit boot mode will be set.
 	BootMode *platform.BootMode
+	// UefiData is the base64 encoded UEFI variable store of the AMI,
+	// see RegisterOptions. It requires the BOOT_UEFI or BOOT_HYBRID
+	// boot mode.
+	UefiData string
+	// TPMSupport enables NitroTPM v2.0 for the AMI. It requires the
+	// BOOT_UEFI or BOOT_HYBRID boot mode.
+	TPMSupport bool
+	// IMDSv2Required makes IMDSv2 mandatory for instances launched
+	// from the AMI.
+	IMDSv2Required bool
+	// Progress receives the structured progress of the upload in
+	// addition to the free-form text written to the status writer.
+	Progress cloud.ProgressFunc
+}
+
+func (ou *UploaderOptions) ec2RegisterOptions() *RegisterOptions {
+	ro := &RegisterOptions{}
+	if ou.UefiData != "" {
+		ro.UefiData = common.ToPtr(ou.UefiData)
+	}
+	if ou.TPMSupport {
+		ro.TpmSupport = common.ToPtr(ec2.TpmSupportValuesV20)
+	}
+	if ou.IMDSv2Required {
+		ro.ImdsSupport = common.ToPtr(ec2.ImdsSupportValuesV20)
+	}
+	return ro
 }
 
 func (ou *UploaderOptions) ec2BootMode() (*string, error) {
@@ -56,7 +86,8 @@ type awsClient interface {
 	Buckets() ([]string, error)
 	CheckBucketPermission(string, S3Permission) (bool, error)
 	UploadFromReader(io.Reader, string, string) (*s3manager.UploadOutput, error)
-	Register(name, bucket, key string, shareWith []string, rpmArch string, bootMode, importRole *string) (*string, *string, error)
+	MultipartUploadFromReaderAt(r io.ReaderAt, size int64, bucket, key, uploadID string, onUploadID func(string)) (string, error)
+	RegisterWithOptions(name, bucket, key string, shareWith []string, rpmArch string, bootMode, importRole *string, opts *RegisterOptions) (*string, *string, error)
 	DeleteObject(string, string) error
 }
 
@@ -72,6 +103,10 @@ func NewUploader(region, bucketName, imageName string, opts *UploaderOptions) (c
 	if err != nil {
 		return nil, err
 	}
+	regOpts := opts.ec2RegisterOptions()
+	if err := regOpts.validate(bootMode); err != nil {
+		return nil, err
+	}
 	client, err := newAwsClient(region)
 	if err != nil {
 		return nil, err
@@ -84,10 +119,12 @@ func NewUploader(region, bucketName, imageName string, opts *UploaderOptions) (c
 		imageName:  imageName,
 		targetArch: opts.TargetArch,
 		bootMode:   bootMode,
+		regOpts:    regOpts,
+		progress:   cloud.NewProgressReporter(opts.Progress),
 	}, nil
 }
 
-var _ cloud.Uploader = &awsUploader{}
+var _ cloud.ResumableUploader = &awsUploader{}
 
 func (au *awsUploader) Check(status io.Writer) error {
 	fmt.Fprintf(status, "Checking AWS region access...\n")
@@ -125,7 +162,7 @@ func (au *awsUploader) UploadAndRegister(r io.Reader, status io.Writer) (err err
 	keyName := fmt.Sprintf("%s-%s", uuid.New().String(), au.imageName)
 	fmt.Fprintf(status, "Uploading %s to %s:%s\n", au.imageName, au.bucketName, keyName)
 
-	res, err := au.client.UploadFromReader(r, au.bucketName, keyName)
+	res, err := au.client.UploadFromReader(au.progress.Reader(r, 0), au.bucketName, keyName)
 	if err != nil {
 		return err
 	}
@@ -137,24 +174,70 @@ func (au *awsUploader) UploadAndRegister(r io.Reader, status io.Writer) (err err
 		}
 	}()
 	fmt.Fprintf(status, "File uploaded to %s\n", aws.StringValue(&res.Location))
+
+	return au.register(keyName, status)
+}
+
+// UploadAndRegisterAt uploads the image using an S3 multipart upload
+// that can be resumed. The state passed to the StateCallback contains
+// the S3 key and the ID of the multipart upload.
+func (au *awsUploader) UploadAndRegisterAt(r io.ReaderAt, size int64, opts *cloud.UploadAtOptions, status io.Writer) (res *cloud.UploadResult, err error) {
+	if opts == nil {
+		opts = &cloud.UploadAtOptions{}
+	}
+	var keyName, uploadID string
+	if opts.Resume != nil {
+		keyName = opts.Resume.Object
+		uploadID = opts.Resume.Session
+		fmt.Fprintf(status, "Resuming upload of %s to %s:%s\n", au.imageName, au.bucketName, keyName)
+	} else {
+		keyName = fmt.Sprintf("%s-%s", uuid.New().String(), au.imageName)
+		fmt.Fprintf(status, "Uploading %s to %s:%s\n", au.imageName, au.bucketName, keyName)
+	}
+
+	sha256sum, err := au.client.MultipartUploadFromReaderAt(au.progress.ReaderAt(r, size), size, au.bucketName, keyName, uploadID, func(uploadID string) {
+		if opts.StateCallback != nil {
+			opts.StateCallback(cloud.UploadState{Object: keyName, Session: uploadID})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			aErr := au.client.DeleteObject(au.bucketName, keyName)
+			fmt.Fprintf(status, "Deleted S3 object %s:%s\n", au.bucketName, keyName)
+			err = errors.Join(err, aErr)
+		}
+	}()
+	fmt.Fprintf(status, "File uploaded to %s:%s (sha256:%s)\n", au.bucketName, keyName, sha256sum)
+
+	if err := au.register(keyName, status); err != nil {
+		return nil, err
+	}
+	return &cloud.UploadResult{SHA256: sha256sum}, nil
+}
+
+// register registers the AMI from the uploaded S3 object and deletes
+// the object afterwards.
+func (au *awsUploader) register(keyName string, status io.Writer) error {
 	if au.targetArch == "" {
 		au.targetArch = arch.Current().String()
 	}
 
 	fmt.Fprintf(status, "Registering AMI %s\n", au.imageName)
-	ami, snapshot, err := au.client.Register(au.imageName, au.bucketName, keyName, nil, au.targetArch, au.bootMode, nil)
+	au.progress.Report(cloud.UploadPhaseRegister, 0, 1)
+	ami, snapshot, err := au.client.RegisterWithOptions(au.imageName, au.bucketName, keyName, nil, au.targetArch, au.bootMode, nil, au.regOpts)
 	if err != nil {
 		return err
 	}
+	au.progress.Report(cloud.UploadPhaseRegister, 1, 1)
 
 	fmt.Fprintf(status, "Deleted S3 object %s:%s\n", au.bucketName, keyName)
 	if err := au.client.DeleteObject(au.bucketName, keyName); err != nil {
 		return err
 	}
 	fmt.Fprintf(status, "AMI registered: %s\nSnapshot ID: %s\n", aws.StringValue(ami), aws.StringValue(snapshot))
-	if err != nil {
-		return err
-	}
 
 	return nil
 }
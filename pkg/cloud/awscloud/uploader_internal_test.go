@@ -76,3 +76,63 @@ func TestUploaderOptionsEc2BootMode(t *testing.T) {
 		})
 	}
 }
+
+func TestRegisterOptionsValidate(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     *RegisterOptions
+		bootMode *string
+		err      string
+	}{
+		{
+			name: "nil",
+		},
+		{
+			name:     "uefi-data-uefi",
+			opts:     &RegisterOptions{UefiData: common.ToPtr("data")},
+			bootMode: common.ToPtr(ec2.BootModeValuesUefi),
+		},
+		{
+			name: "uefi-data-no-boot-mode",
+			opts: &RegisterOptions{UefiData: common.ToPtr("data")},
+			err:  "UEFI data requires the uefi or uefi-preferred boot mode",
+		},
+		{
+			name:     "tpm-hybrid",
+			opts:     &RegisterOptions{TpmSupport: common.ToPtr(ec2.TpmSupportValuesV20)},
+			bootMode: common.ToPtr(ec2.BootModeValuesUefiPreferred),
+		},
+		{
+			name:     "tpm-legacy",
+			opts:     &RegisterOptions{TpmSupport: common.ToPtr(ec2.TpmSupportValuesV20)},
+			bootMode: common.ToPtr(ec2.BootModeValuesLegacyBios),
+			err:      "TPM support requires the uefi or uefi-preferred boot mode",
+		},
+		{
+			name:     "tpm-invalid",
+			opts:     &RegisterOptions{TpmSupport: common.ToPtr("v1.2")},
+			bootMode: common.ToPtr(ec2.BootModeValuesUefi),
+			err:      "ec2 doesn't support the following TPM support value: v1.2",
+		},
+		{
+			name: "imds-v2",
+			opts: &RegisterOptions{ImdsSupport: common.ToPtr(ec2.ImdsSupportValuesV20)},
+		},
+		{
+			name: "imds-invalid",
+			opts: &RegisterOptions{ImdsSupport: common.ToPtr("v1.0")},
+			err:  "ec2 doesn't support the following IMDS support value: v1.0",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.opts.validate(tc.bootMode)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
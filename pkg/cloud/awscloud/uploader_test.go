@@ -12,6 +12,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/cloud"
 	"github.com/osbuild/images/pkg/cloud/awscloud"
 	"github.com/osbuild/images/pkg/platform"
 )
@@ -34,10 +35,16 @@ type fakeAWSClient struct {
 	uploadFromReaderErr   error
 	uploadFromReaderCalls int
 
+	multipartUploadSHA256 string
+	multipartUploadErr    error
+	multipartUploadIDs    []string
+	multipartUploadCalls  int
+
 	registerErr        error
 	registerImageId    string
 	registerSnapshotId string
 	registerBootMode   *string
+	registerOpts       *awscloud.RegisterOptions
 	registerCalls      int
 
 	deleteObjectErr   error
@@ -64,9 +71,20 @@ func (fa *fakeAWSClient) UploadFromReader(io.Reader, string, string) (*s3manager
 	return fa.uploadFromReader, fa.uploadFromReaderErr
 }
 
-func (fa *fakeAWSClient) Register(name, bucket, key string, shareWith []string, rpmArch string, bootMode, importRole *string) (*string, *string, error) {
+func (fa *fakeAWSClient) MultipartUploadFromReaderAt(r io.ReaderAt, size int64, bucket, key, uploadID string, onUploadID func(string)) (string, error) {
+	fa.multipartUploadCalls++
+	fa.multipartUploadIDs = append(fa.multipartUploadIDs, uploadID)
+	if uploadID == "" {
+		uploadID = "upload-id"
+	}
+	onUploadID(uploadID)
+	return fa.multipartUploadSHA256, fa.multipartUploadErr
+}
+
+func (fa *fakeAWSClient) RegisterWithOptions(name, bucket, key string, shareWith []string, rpmArch string, bootMode, importRole *string, opts *awscloud.RegisterOptions) (*string, *string, error) {
 	fa.registerCalls++
 	fa.registerBootMode = bootMode
+	fa.registerOpts = opts
 	return &fa.registerImageId, &fa.registerSnapshotId, fa.registerErr
 }
 
@@ -132,6 +150,24 @@ func TestUploaderUploadHappy(t *testing.T) {
 			check_fn: func(t *testing.T, fa *fakeAWSClient) {
 				assert.NotNil(t, fa.registerBootMode)
 				assert.Equal(t, ec2.BootModeValuesUefi, *fa.registerBootMode)
+				assert.Equal(t, &awscloud.RegisterOptions{}, fa.registerOpts)
+			},
+		},
+		{
+			name: "ec2-uefi-data-tpm-imdsv2",
+			opts: &awscloud.UploaderOptions{
+				BootMode:       common.ToPtr(platform.BOOT_HYBRID),
+				UefiData:       "uefi-data",
+				TPMSupport:     true,
+				IMDSv2Required: true,
+			},
+			check_fn: func(t *testing.T, fa *fakeAWSClient) {
+				assert.Equal(t, ec2.BootModeValuesUefiPreferred, *fa.registerBootMode)
+				assert.Equal(t, &awscloud.RegisterOptions{
+					UefiData:    common.ToPtr("uefi-data"),
+					TpmSupport:  common.ToPtr(ec2.TpmSupportValuesV20),
+					ImdsSupport: common.ToPtr(ec2.ImdsSupportValuesV20),
+				}, fa.registerOpts)
 			},
 		},
 	}
@@ -226,3 +262,68 @@ func TestUploaderUploadButRegisterErrorAndDeleteError(t *testing.T) {
 	// XXX: this should probably have a context
 	assert.EqualError(t, err, "fake-register-err\nfake-delete-object-err")
 }
+
+func TestUploaderUploadAtResume(t *testing.T) {
+	uuid.SetRand(&repeatReader{})
+
+	fa := &fakeAWSClient{
+		multipartUploadErr: fmt.Errorf("fake-upload-err"),
+		registerImageId:    "image-id",
+		registerSnapshotId: "snapshot-id",
+	}
+	restore := awscloud.MockNewAwsClient(func(string) (awscloud.AwsClient, error) {
+		return fa, nil
+	})
+	defer restore()
+
+	fakeImage := bytes.NewReader([]byte("fake-aws-image"))
+	uploader, err := awscloud.NewUploader("region", "bucket", "ami", nil)
+	assert.NoError(t, err)
+	resumable, ok := uploader.(cloud.ResumableUploader)
+	assert.True(t, ok)
+
+	var state cloud.UploadState
+	opts := &cloud.UploadAtOptions{
+		StateCallback: func(s cloud.UploadState) {
+			state = s
+		},
+	}
+	var uploadLog bytes.Buffer
+	_, err = resumable.UploadAndRegisterAt(fakeImage, fakeImage.Size(), opts, &uploadLog)
+	assert.EqualError(t, err, "fake-upload-err")
+	// failed uploads are kept so that they can be resumed
+	assert.Equal(t, 0, fa.deleteObjectCalls)
+	assert.Equal(t, cloud.UploadState{Object: "01010101-0101-4101-8101-010101010101-ami", Session: "upload-id"}, state)
+
+	fa.multipartUploadErr = nil
+	fa.multipartUploadSHA256 = "sha256sum"
+	opts.Resume = &state
+	uploadLog.Reset()
+	res, err := resumable.UploadAndRegisterAt(fakeImage, fakeImage.Size(), opts, &uploadLog)
+	assert.NoError(t, err)
+	assert.Equal(t, &cloud.UploadResult{SHA256: "sha256sum"}, res)
+	assert.Equal(t, []string{"", "upload-id"}, fa.multipartUploadIDs)
+	assert.Equal(t, 1, fa.registerCalls)
+	assert.Equal(t, 1, fa.deleteObjectCalls)
+	expectedUploadLog := `Resuming upload of ami to bucket:01010101-0101-4101-8101-010101010101-ami
+File uploaded to bucket:01010101-0101-4101-8101-010101010101-ami (sha256:sha256sum)
+Registering AMI ami
+Deleted S3 object bucket:01010101-0101-4101-8101-010101010101-ami
+AMI registered: image-id
+Snapshot ID: snapshot-id
+`
+	assert.Equal(t, expectedUploadLog, uploadLog.String())
+}
+
+func TestNewUploaderTPMNeedsUEFI(t *testing.T) {
+	restore := awscloud.MockNewAwsClient(func(string) (awscloud.AwsClient, error) {
+		return &fakeAWSClient{}, nil
+	})
+	defer restore()
+
+	_, err := awscloud.NewUploader("region", "bucket", "ami", &awscloud.UploaderOptions{
+		BootMode:   common.ToPtr(platform.BOOT_LEGACY),
+		TPMSupport: true,
+	})
+	assert.EqualError(t, err, "TPM support requires the uefi or uefi-preferred boot mode")
+}
@@ -2,11 +2,15 @@ package gcp
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"slices"
 	"strings"
 
 	compute "cloud.google.com/go/compute/apiv1"
 	"cloud.google.com/go/compute/apiv1/computepb"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/option"
 
 	"github.com/osbuild/images/internal/common"
@@ -72,6 +76,43 @@ func GuestOsFeaturesByDistro(distroName string) []*computepb.GuestOsFeature {
 	}
 }
 
+// GuestOsFeatures returns the Guest OS Features with the given types, e.g.
+// "SEV_SNP_CAPABLE" or "TDX_CAPABLE". An error is returned for unknown
+// types.
+func GuestOsFeatures(types ...string) ([]*computepb.GuestOsFeature, error) {
+	var features []*computepb.GuestOsFeature
+	for _, t := range types {
+		if v, ok := computepb.GuestOsFeature_Type_value[t]; !ok || v == int32(computepb.GuestOsFeature_UNDEFINED_TYPE) {
+			return nil, fmt.Errorf("unknown Guest OS Feature %q", t)
+		}
+		features = append(features, &computepb.GuestOsFeature{Type: common.ToPtr(t)})
+	}
+	return features, nil
+}
+
+// AppendGuestOsFeatures returns a new list with the features of base
+// followed by all the features of extra that are not in base yet.
+func AppendGuestOsFeatures(base []*computepb.GuestOsFeature, extra ...*computepb.GuestOsFeature) []*computepb.GuestOsFeature {
+	features := slices.Clone(base)
+	for _, f := range extra {
+		if !slices.ContainsFunc(features, func(e *computepb.GuestOsFeature) bool { return e.GetType() == f.GetType() }) {
+			features = append(features, f)
+		}
+	}
+	return features
+}
+
+// ComputeImageInsertOptions contains the optional settings of
+// ComputeImageInsertWithOptions.
+type ComputeImageInsertOptions struct {
+	// GuestOsFeatures is a list of features supported by the Guest OS
+	// on the imported image.
+	GuestOsFeatures []*computepb.GuestOsFeature
+	// Family is the image family the imported image is part of, see
+	// https://cloud.google.com/compute/docs/images/image-families-best-practices
+	Family string
+}
+
 // ComputeImageInsert imports a previously uploaded archive with raw image into Compute Engine.
 //
 // The image must be RAW image named 'disk.raw' inside a gzip-ed tarball.
@@ -96,6 +137,24 @@ func (g *GCP) ComputeImageInsert(
 	bucket, object, imageName string,
 	regions []string,
 	guestOsFeatures []*computepb.GuestOsFeature) (*computepb.Image, error) {
+	return g.ComputeImageInsertWithOptions(ctx, bucket, object, imageName, regions, &ComputeImageInsertOptions{
+		GuestOsFeatures: guestOsFeatures,
+	})
+}
+
+// ComputeImageInsertWithOptions works like ComputeImageInsert but allows
+// to set further properties of the imported image, e.g. its family.
+//
+// Uses:
+//   - Compute Engine API
+func (g *GCP) ComputeImageInsertWithOptions(
+	ctx context.Context,
+	bucket, object, imageName string,
+	regions []string,
+	opts *ComputeImageInsertOptions) (*computepb.Image, error) {
+	if opts == nil {
+		opts = &ComputeImageInsertOptions{}
+	}
 	imagesClient, err := compute.NewImagesRESTClient(ctx, option.WithCredentials(g.creds))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get Compute Engine Images client: %v", err)
@@ -113,7 +172,7 @@ func (g *GCP) ComputeImageInsert(
 		ImageResource: &computepb.Image{
 			Name:             &imageName,
 			StorageLocations: regions,
-			GuestOsFeatures:  guestOsFeatures,
+			GuestOsFeatures:  opts.GuestOsFeatures,
 			RawDisk: &computepb.RawDisk{
 				ContainerType: common.ToPtr(computepb.RawDisk_TAR.String()),
 				Source:        common.ToPtr(fmt.Sprintf("https://storage.googleapis.com/%s/%s", bucket, object)),
@@ -121,6 +180,10 @@ func (g *GCP) ComputeImageInsert(
 		},
 	}
 
+	if opts.Family != "" {
+		imgInsertReq.ImageResource.Family = &opts.Family
+	}
+
 	operation, err := imagesClient.Insert(ctx, imgInsertReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to insert provided image into GCE: %v", err)
@@ -275,6 +338,73 @@ func (g *GCP) ComputeImageDelete(ctx context.Context, name string) error {
 	return err
 }
 
+// ComputeImageFromFamily returns the latest image of the given image family
+// that is not deprecated. If the family has no such image, nil is returned.
+//
+// Uses:
+//   - Compute Engine API
+func (g *GCP) ComputeImageFromFamily(ctx context.Context, family string) (*computepb.Image, error) {
+	imagesClient, err := compute.NewImagesRESTClient(ctx, option.WithCredentials(g.creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Compute Engine Images client: %v", err)
+	}
+	defer imagesClient.Close()
+
+	req := &computepb.GetFromFamilyImageRequest{
+		Project: g.GetProjectID(),
+		Family:  family,
+	}
+	image, err := imagesClient.GetFromFamily(ctx, req)
+	if err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get the image of family %q: %v", family, err)
+	}
+	return image, nil
+}
+
+// ComputeImageDeprecate sets the deprecation state of a Compute Engine
+// image. The state must be one of "DEPRECATED", "OBSOLETE", "DELETED" or
+// "ACTIVE", the latter removes the deprecation. The replacement is the
+// URL of the image that should be used instead, see Image.GetSelfLink(),
+// it may be empty.
+//
+// Uses:
+//   - Compute Engine API
+func (g *GCP) ComputeImageDeprecate(ctx context.Context, imageName, state, replacement string) error {
+	if v, ok := computepb.DeprecationStatus_State_value[state]; !ok || v == int32(computepb.DeprecationStatus_UNDEFINED_STATE) {
+		return fmt.Errorf("unknown deprecation state %q", state)
+	}
+
+	imagesClient, err := compute.NewImagesRESTClient(ctx, option.WithCredentials(g.creds))
+	if err != nil {
+		return fmt.Errorf("failed to get Compute Engine Images client: %v", err)
+	}
+	defer imagesClient.Close()
+
+	status := &computepb.DeprecationStatus{
+		State: &state,
+	}
+	if replacement != "" {
+		status.Replacement = &replacement
+	}
+	req := &computepb.DeprecateImageRequest{
+		Project:                   g.GetProjectID(),
+		Image:                     imageName,
+		DeprecationStatusResource: status,
+	}
+	operation, err := imagesClient.Deprecate(ctx, req)
+	if err != nil {
+		return fmt.Errorf("failed to deprecate image %s: %v", imageName, err)
+	}
+	if err := operation.Wait(ctx); err != nil {
+		return fmt.Errorf("failed to wait for the deprecation of image %s: %v", imageName, err)
+	}
+	return nil
+}
+
 // ComputeExecuteFunctionForImages will pass all the compute images in the account to a function,
 // which is able to iterate over the images. Useful if something needs to be execute for each image.
 // Uses:
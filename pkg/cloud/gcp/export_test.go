@@ -0,0 +1,28 @@
+package gcp
+
+import (
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+type GcpClient = gcpClient
+
+func MockNewGcpClient(f func([]byte) (gcpClient, error)) (restore func()) {
+	saved := newGcpClient
+	newGcpClient = f
+	return func() {
+		newGcpClient = saved
+	}
+}
+
+func MockStorageAPIURL(url string) (restore func()) {
+	saved := storageAPIURL
+	storageAPIURL = url
+	return func() {
+		storageAPIURL = saved
+	}
+}
+
+func NewWithTokenSource(ts oauth2.TokenSource) *GCP {
+	return &GCP{creds: &google.Credentials{TokenSource: ts}}
+}
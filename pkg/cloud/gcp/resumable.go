@@ -0,0 +1,227 @@
+package gcp
+
+import (
+	"bytes"
+	"context"
+	// gcp uses MD5 hashes
+	/* #nosec G501 */
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/oauth2"
+
+	"github.com/osbuild/images/pkg/cloud"
+	"github.com/osbuild/images/pkg/datasizes"
+)
+
+// storageAPIURL is the base URL of the Cloud Storage JSON API
+var storageAPIURL = "https://storage.googleapis.com"
+
+// resumableChunkSize is the size of the chunks of resumable uploads, it
+// must be a multiple of 256 KiB
+const resumableChunkSize = 16 * datasizes.MiB
+
+// statusResumeIncomplete is returned by Cloud Storage for chunks of
+// resumable uploads that are not the last one
+const statusResumeIncomplete = 308
+
+// StorageObjectUploadAt uploads `size` bytes of the image from the given
+// reader to the specified Cloud Storage bucket and object using a resumable
+// upload session. If sessionURI is not empty the given session is resumed
+// from the offset that Cloud Storage has persisted. The URI of the session
+// is passed to onSession as soon as it is known.
+//
+// The MD5 sum of the image and the uploaded object is compared after the
+// upload and the object is deleted if they differ. The hex encoded SHA-256
+// sum of the image is returned.
+//
+// Uses:
+//   - Storage API
+func (g *GCP) StorageObjectUploadAt(ctx context.Context, r io.ReaderAt, size int64, bucket, object string, metadata map[string]string, sessionURI string, onSession func(string)) (string, error) {
+	client := oauth2.NewClient(ctx, g.creds.TokenSource)
+
+	// resp is the response of the request that completed the upload
+	var resp *http.Response
+	var offset int64
+	if sessionURI == "" {
+		var err error
+		sessionURI, err = startResumableUpload(ctx, client, size, bucket, object, metadata)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		var err error
+		resp, offset, err = putResumableChunk(ctx, client, sessionURI, nil, 0, size)
+		if err != nil {
+			return "", err
+		}
+	}
+	if onSession != nil {
+		onSession(sessionURI)
+	}
+
+	// gcp uses MD5 hashes
+	/* #nosec G401 */
+	imageMD5 := md5.New()
+	imageSHA256 := sha256.New()
+	hashes := io.MultiWriter(imageMD5, imageSHA256)
+	if _, err := io.Copy(hashes, io.NewSectionReader(r, 0, min(offset, size))); err != nil {
+		return "", fmt.Errorf("reading the image failed: %w", err)
+	}
+	hashed := offset
+
+	buf := make([]byte, resumableChunkSize)
+	for resp == nil {
+		n := min(resumableChunkSize, size-offset)
+		chunk := buf[:n]
+		if _, err := io.ReadFull(io.NewSectionReader(r, offset, n), chunk); err != nil {
+			return "", fmt.Errorf("reading the image failed: %w", err)
+		}
+		// chunks that were not fully persisted are sent again
+		if offset+n > hashed {
+			hashes.Write(chunk[hashed-offset:])
+			hashed = offset + n
+		}
+
+		var err error
+		resp, offset, err = putResumableChunk(ctx, client, sessionURI, chunk, offset, size)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var attrs struct {
+		MD5Hash string `json:"md5Hash"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&attrs); err != nil {
+		return "", fmt.Errorf("cannot decode the uploaded object: %w", err)
+	}
+	expected := base64.StdEncoding.EncodeToString(imageMD5.Sum(nil))
+	if attrs.MD5Hash != expected {
+		if err := deleteStorageObject(ctx, client, bucket, object); err != nil {
+			return "", fmt.Errorf("MD5 sum of the uploaded object does not match and deleting it failed: %w", err)
+		}
+		return "", &cloud.ChecksumMismatchError{Algorithm: "MD5", Expected: expected, Actual: attrs.MD5Hash}
+	}
+
+	return hex.EncodeToString(imageSHA256.Sum(nil)), nil
+}
+
+// startResumableUpload starts a resumable upload session and returns its URI
+func startResumableUpload(ctx context.Context, client *http.Client, size int64, bucket, object string, metadata map[string]string) (string, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"name":     object,
+		"metadata": metadata,
+	})
+	if err != nil {
+		return "", err
+	}
+	u := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=resumable&name=%s", storageAPIURL, url.PathEscape(bucket), url.QueryEscape(object))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("cannot start a resumable upload: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cannot start a resumable upload: %w", responseError(resp))
+	}
+	sessionURI := resp.Header.Get("Location")
+	if sessionURI == "" {
+		return "", errors.New("cannot start a resumable upload: no session URI returned")
+	}
+	return sessionURI, nil
+}
+
+// putResumableChunk sends the chunk at the given offset to the upload
+// session, an empty chunk queries the status of the session. The number of
+// bytes persisted by Cloud Storage is returned. If the upload is complete
+// the response is returned too, its body is read into memory so it can be
+// used after the call.
+func putResumableChunk(ctx context.Context, client *http.Client, sessionURI string, chunk []byte, offset, size int64) (*http.Response, int64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, sessionURI, bytes.NewReader(chunk))
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(chunk) == 0 {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+	} else {
+		req.Header.Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", offset, offset+int64(len(chunk))-1, size))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("uploading the image failed: %w", err)
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case statusResumeIncomplete:
+		persisted, err := persistedOffset(resp)
+		return nil, persisted, err
+	case http.StatusOK, http.StatusCreated:
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, 0, fmt.Errorf("uploading the image failed: %w", err)
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return resp, size, nil
+	default:
+		return nil, 0, fmt.Errorf("uploading the image failed: %w", responseError(resp))
+	}
+}
+
+// persistedOffset returns the number of bytes that Cloud Storage has
+// persisted according to the Range header of an incomplete upload.
+func persistedOffset(resp *http.Response) (int64, error) {
+	rng := resp.Header.Get("Range")
+	if rng == "" {
+		return 0, nil
+	}
+	_, end, ok := strings.Cut(strings.TrimPrefix(rng, "bytes="), "-")
+	if !ok {
+		return 0, fmt.Errorf("invalid range of the upload session: %q", rng)
+	}
+	last, err := strconv.ParseInt(end, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid range of the upload session: %q", rng)
+	}
+	return last + 1, nil
+}
+
+func deleteStorageObject(ctx context.Context, client *http.Client, bucket, object string) error {
+	u := fmt.Sprintf("%s/storage/v1/b/%s/o/%s", storageAPIURL, url.PathEscape(bucket), url.PathEscape(object))
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return nil
+}
+
+func responseError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+}
@@ -0,0 +1,152 @@
+package gcp_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"github.com/osbuild/images/pkg/cloud"
+	"github.com/osbuild/images/pkg/cloud/gcp"
+)
+
+// fakeGCS implements the resumable uploads of the Cloud Storage JSON API
+type fakeGCS struct {
+	t *testing.T
+
+	data     []byte
+	size     int64
+	name     string
+	metadata map[string]string
+
+	// the number of bytes of the next chunk that are persisted, all of
+	// them if zero
+	persistPartially int
+	// the number of the chunk request that fails
+	failRequest int
+	requests    int
+	// the MD5 sum of the stored object is wrong
+	corrupt bool
+	deleted bool
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	assert.Equal(f.t, "Bearer token", r.Header.Get("Authorization"))
+
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/upload/storage/v1/b/bucket/o":
+		assert.Equal(f.t, "resumable", r.URL.Query().Get("uploadType"))
+		var obj struct {
+			Name     string            `json:"name"`
+			Metadata map[string]string `json:"metadata"`
+		}
+		require.NoError(f.t, json.NewDecoder(r.Body).Decode(&obj))
+		f.name = obj.Name
+		f.metadata = obj.Metadata
+		size, err := strconv.ParseInt(r.Header.Get("X-Upload-Content-Length"), 10, 64)
+		require.NoError(f.t, err)
+		f.size = size
+		w.Header().Set("Location", "http://"+r.Host+"/session")
+	case r.Method == http.MethodPut && r.URL.Path == "/session":
+		f.requests++
+		if f.requests == f.failRequest {
+			http.Error(w, "fake-chunk-err", http.StatusServiceUnavailable)
+			return
+		}
+		chunk, err := io.ReadAll(r.Body)
+		require.NoError(f.t, err)
+		rng := strings.TrimPrefix(r.Header.Get("Content-Range"), "bytes ")
+		if !strings.HasPrefix(rng, "*/") {
+			var start, end, size int64
+			_, err = fmt.Sscanf(rng, "%d-%d/%d", &start, &end, &size)
+			require.NoError(f.t, err)
+			require.Equal(f.t, int64(len(f.data)), start)
+			if f.persistPartially > 0 {
+				chunk = chunk[:f.persistPartially]
+				f.persistPartially = 0
+			}
+			f.data = append(f.data, chunk...)
+		}
+		if int64(len(f.data)) < f.size {
+			if len(f.data) > 0 {
+				w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(f.data)-1))
+			}
+			w.WriteHeader(308)
+			return
+		}
+		sum := md5.Sum(f.data)
+		if f.corrupt {
+			sum[0]++
+		}
+		err = json.NewEncoder(w).Encode(map[string]string{
+			"name":    f.name,
+			"md5Hash": base64.StdEncoding.EncodeToString(sum[:]),
+		})
+		require.NoError(f.t, err)
+	case r.Method == http.MethodDelete && r.URL.Path == "/storage/v1/b/bucket/o/object":
+		f.deleted = true
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func newFakeGCS(t *testing.T) (*fakeGCS, *gcp.GCP) {
+	fake := &fakeGCS{t: t}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	t.Cleanup(gcp.MockStorageAPIURL(srv.URL))
+	return fake, gcp.NewWithTokenSource(oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "token"}))
+}
+
+func TestStorageObjectUploadAt(t *testing.T) {
+	fake, g := newFakeGCS(t)
+	image := bytes.Repeat([]byte("abcd"), 5*1024*1024)
+	sum := sha256.Sum256(image)
+
+	// only a part of the first chunk is persisted so it is sent
+	// again, then the third request fails
+	fake.persistPartially = 256 * 1024
+	fake.failRequest = 3
+	var sessions []string
+	_, err := g.StorageObjectUploadAt(context.Background(), bytes.NewReader(image), int64(len(image)), "bucket", "object", map[string]string{"key": "value"}, "", func(s string) {
+		sessions = append(sessions, s)
+	})
+	assert.ErrorContains(t, err, "fake-chunk-err")
+	require.Len(t, sessions, 1)
+	assert.Len(t, fake.data, 16*1024*1024+256*1024)
+	assert.Equal(t, "object", fake.name)
+	assert.Equal(t, map[string]string{"key": "value"}, fake.metadata)
+
+	// resuming queries the persisted offset and sends the rest
+	res, err := g.StorageObjectUploadAt(context.Background(), bytes.NewReader(image), int64(len(image)), "bucket", "object", nil, sessions[0], nil)
+	require.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(sum[:]), res)
+	assert.Equal(t, image, fake.data)
+	assert.False(t, fake.deleted)
+}
+
+func TestStorageObjectUploadAtChecksumMismatch(t *testing.T) {
+	fake, g := newFakeGCS(t)
+	fake.corrupt = true
+
+	image := []byte("fake-gcp-image")
+	_, err := g.StorageObjectUploadAt(context.Background(), bytes.NewReader(image), int64(len(image)), "bucket", "object", nil, "", nil)
+	var mismatch *cloud.ChecksumMismatchError
+	assert.ErrorAs(t, err, &mismatch)
+	assert.True(t, fake.deleted)
+}
@@ -1,6 +1,7 @@
 package gcp
 
 import (
+	"bytes"
 	"context"
 	// gcp uses MD5 hashes
 	/* #nosec G501 */
@@ -79,6 +80,77 @@ func (g *GCP) StorageObjectUpload(ctx context.Context, filename, bucket, object
 	return wc.Attrs(), nil
 }
 
+// StorageObjectUploadFromReader uploads an OS image from the given reader
+// to specified Cloud Storage bucket and object. The bucket must exist.
+// Because the MD5 sum cannot be known in advance for a stream, it is
+// computed while uploading and compared to the MD5 sum of the stored
+// object. On mismatch the object is deleted and an error is returned.
+//
+// The ObjectAttrs is returned if the object has been created.
+//
+// Uses:
+//   - Storage API
+func (g *GCP) StorageObjectUploadFromReader(ctx context.Context, r io.Reader, bucket, object string, metadata map[string]string) (*storage.ObjectAttrs, error) {
+	storageClient, err := storage.NewClient(ctx, option.WithCredentials(g.creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Storage client: %v", err)
+	}
+	defer storageClient.Close()
+
+	// gcp uses MD5 hashes
+	/* #nosec G401 */
+	imageHash := md5.New()
+
+	// cancelling the context of the writer aborts the upload
+	uploadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	obj := storageClient.Bucket(bucket).Object(object)
+	wc := obj.NewWriter(uploadCtx)
+	if metadata != nil {
+		wc.ObjectAttrs.Metadata = metadata
+	}
+
+	if _, err = io.Copy(wc, io.TeeReader(r, imageHash)); err != nil {
+		return nil, fmt.Errorf("uploading the image failed: %v", err)
+	}
+
+	// The object will not be available until Close has been called.
+	if err := wc.Close(); err != nil {
+		return nil, fmt.Errorf("Writer.Close: %v", err)
+	}
+
+	attrs := wc.Attrs()
+	if !bytes.Equal(attrs.MD5, imageHash.Sum(nil)) {
+		if err := obj.Delete(ctx); err != nil {
+			return nil, fmt.Errorf("MD5 sum of the uploaded object does not match and deleting it failed: %v", err)
+		}
+		return nil, fmt.Errorf("MD5 sum of the uploaded object %x does not match the image %x", attrs.MD5, imageHash.Sum(nil))
+	}
+
+	return attrs, nil
+}
+
+// StorageBucketTestPermissions returns the subset of the given
+// permissions that the used credentials have on the given bucket.
+//
+// Uses:
+//   - Storage API
+func (g *GCP) StorageBucketTestPermissions(ctx context.Context, bucket string, permissions []string) ([]string, error) {
+	storageClient, err := storage.NewClient(ctx, option.WithCredentials(g.creds))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Storage client: %v", err)
+	}
+	defer storageClient.Close()
+
+	granted, err := storageClient.Bucket(bucket).IAM().TestPermissions(ctx, permissions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to test permissions of bucket %q: %v", bucket, err)
+	}
+
+	return granted, nil
+}
+
 // StorageObjectDelete deletes the given object from a bucket.
 //
 // Uses:
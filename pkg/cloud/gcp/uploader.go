@@ -0,0 +1,248 @@
+package gcp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"cloud.google.com/go/compute/apiv1/computepb"
+	"cloud.google.com/go/storage"
+	"github.com/google/uuid"
+
+	"github.com/osbuild/images/pkg/cloud"
+)
+
+// storagePermissionsForUpload are the bucket permissions needed to
+// upload the image and to clean it up after the import
+var storagePermissionsForUpload = []string{
+	"storage.objects.create",
+	"storage.objects.delete",
+	"storage.objects.get",
+}
+
+type gcpUploader struct {
+	client gcpClient
+
+	bucketName      string
+	imageName       string
+	regions         []string
+	guestOsFeatures []*computepb.GuestOsFeature
+	shareWith       []string
+
+	family            string
+	deprecatePrevious bool
+
+	progress *cloud.ProgressReporter
+}
+
+type UploaderOptions struct {
+	// Credentials in the JSON format, if nil the default credentials
+	// are used, see New()
+	Credentials []byte
+	// Regions where the resulting image should be located. If
+	// empty the region of the bucket is used.
+	Regions []string
+	// DistroName is used to select the Guest OS Features of the
+	// image, see GuestOsFeaturesByDistro()
+	DistroName string
+	// GuestOsFeatures overrides the Guest OS Features that are
+	// selected by DistroName, e.g. "UEFI_COMPATIBLE".
+	GuestOsFeatures []string
+	// ExtraGuestOsFeatures are added to the Guest OS Features of the
+	// image, e.g. "SEV_SNP_CAPABLE" or "TDX_CAPABLE".
+	ExtraGuestOsFeatures []string
+	// Family is the image family the image is inserted into.
+	Family string
+	// DeprecatePrevious marks the image that was the latest one of
+	// the Family before the upload as deprecated, with the uploaded
+	// image as its replacement.
+	DeprecatePrevious bool
+	// ShareWith is a list of accounts to share the image with, see
+	// ComputeImageShare()
+	ShareWith []string
+	// Progress receives the structured progress of the upload in
+	// addition to the free-form text written to the status writer.
+	Progress cloud.ProgressFunc
+}
+
+// testing support
+type gcpClient interface {
+	StorageBucketTestPermissions(ctx context.Context, bucket string, permissions []string) ([]string, error)
+	StorageObjectUploadFromReader(ctx context.Context, r io.Reader, bucket, object string, metadata map[string]string) (*storage.ObjectAttrs, error)
+	StorageObjectUploadAt(ctx context.Context, r io.ReaderAt, size int64, bucket, object string, metadata map[string]string, sessionURI string, onSession func(string)) (string, error)
+	StorageObjectDelete(ctx context.Context, bucket, object string) error
+	ComputeImageInsertWithOptions(ctx context.Context, bucket, object, imageName string, regions []string, opts *ComputeImageInsertOptions) (*computepb.Image, error)
+	ComputeImageFromFamily(ctx context.Context, family string) (*computepb.Image, error)
+	ComputeImageDeprecate(ctx context.Context, imageName, state, replacement string) error
+	ComputeImageShare(ctx context.Context, imageName string, shareWith []string) error
+	ComputeImageURL(imageName string) string
+}
+
+var newGcpClient = func(credentials []byte) (gcpClient, error) {
+	return New(credentials)
+}
+
+// NewUploader returns a cloud.Uploader that uploads the image to the
+// given Cloud Storage bucket and imports it into Compute Engine as
+// imageName. The uploaded image must be a gzip-ed tarball containing a
+// "disk.raw" file.
+func NewUploader(bucketName, imageName string, opts *UploaderOptions) (cloud.Uploader, error) {
+	if opts == nil {
+		opts = &UploaderOptions{}
+	}
+	if opts.DeprecatePrevious && opts.Family == "" {
+		return nil, fmt.Errorf("deprecating the previous image requires an image family")
+	}
+	guestOsFeatures := GuestOsFeaturesByDistro(opts.DistroName)
+	if len(opts.GuestOsFeatures) > 0 {
+		features, err := GuestOsFeatures(opts.GuestOsFeatures...)
+		if err != nil {
+			return nil, err
+		}
+		guestOsFeatures = features
+	}
+	extraFeatures, err := GuestOsFeatures(opts.ExtraGuestOsFeatures...)
+	if err != nil {
+		return nil, err
+	}
+	guestOsFeatures = AppendGuestOsFeatures(guestOsFeatures, extraFeatures...)
+
+	client, err := newGcpClient(opts.Credentials)
+	if err != nil {
+		return nil, err
+	}
+
+	return &gcpUploader{
+		client:            client,
+		bucketName:        bucketName,
+		imageName:         imageName,
+		regions:           opts.Regions,
+		guestOsFeatures:   guestOsFeatures,
+		shareWith:         opts.ShareWith,
+		family:            opts.Family,
+		deprecatePrevious: opts.DeprecatePrevious,
+		progress:          cloud.NewProgressReporter(opts.Progress),
+	}, nil
+}
+
+var _ cloud.ResumableUploader = &gcpUploader{}
+
+func (gu *gcpUploader) Check(status io.Writer) error {
+	fmt.Fprintf(status, "Checking GCP bucket permissions...\n")
+	granted, err := gu.client.StorageBucketTestPermissions(context.Background(), gu.bucketName, storagePermissionsForUpload)
+	if err != nil {
+		return err
+	}
+	for _, perm := range storagePermissionsForUpload {
+		if !slices.Contains(granted, perm) {
+			return fmt.Errorf("missing permission %q for bucket '%s' with the given GCP account", perm, gu.bucketName)
+		}
+	}
+	fmt.Fprintf(status, "Upload conditions met.\n")
+	return nil
+}
+
+func (gu *gcpUploader) UploadAndRegister(r io.Reader, status io.Writer) (err error) {
+	ctx := context.Background()
+
+	objectName := fmt.Sprintf("%s-%s.tar.gz", uuid.New().String(), gu.imageName)
+	fmt.Fprintf(status, "Uploading %s to %s/%s\n", gu.imageName, gu.bucketName, objectName)
+	_, err = gu.client.StorageObjectUploadFromReader(ctx, gu.progress.Reader(r, 0), gu.bucketName, objectName, map[string]string{MetadataKeyImageName: gu.imageName})
+	if err != nil {
+		return err
+	}
+	// the storage object is only needed for the import
+	defer func() {
+		fmt.Fprintf(status, "Deleting storage object %s/%s\n", gu.bucketName, objectName)
+		err = errors.Join(err, gu.client.StorageObjectDelete(ctx, gu.bucketName, objectName))
+	}()
+
+	return gu.importImage(ctx, objectName, status)
+}
+
+// UploadAndRegisterAt uploads the image using a resumable upload session.
+// The state passed to the StateCallback contains the name of the storage
+// object and the URI of the upload session.
+func (gu *gcpUploader) UploadAndRegisterAt(r io.ReaderAt, size int64, opts *cloud.UploadAtOptions, status io.Writer) (res *cloud.UploadResult, err error) {
+	ctx := context.Background()
+
+	if opts == nil {
+		opts = &cloud.UploadAtOptions{}
+	}
+	var objectName, sessionURI string
+	if opts.Resume != nil {
+		objectName = opts.Resume.Object
+		sessionURI = opts.Resume.Session
+		fmt.Fprintf(status, "Resuming upload of %s to %s/%s\n", gu.imageName, gu.bucketName, objectName)
+	} else {
+		objectName = fmt.Sprintf("%s-%s.tar.gz", uuid.New().String(), gu.imageName)
+		fmt.Fprintf(status, "Uploading %s to %s/%s\n", gu.imageName, gu.bucketName, objectName)
+	}
+	sha256sum, err := gu.client.StorageObjectUploadAt(ctx, gu.progress.ReaderAt(r, size), size, gu.bucketName, objectName, map[string]string{MetadataKeyImageName: gu.imageName}, sessionURI, func(sessionURI string) {
+		if opts.StateCallback != nil {
+			opts.StateCallback(cloud.UploadState{Object: objectName, Session: sessionURI})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the storage object is only needed for the import
+	defer func() {
+		fmt.Fprintf(status, "Deleting storage object %s/%s\n", gu.bucketName, objectName)
+		err = errors.Join(err, gu.client.StorageObjectDelete(ctx, gu.bucketName, objectName))
+	}()
+	fmt.Fprintf(status, "Storage object uploaded (sha256:%s)\n", sha256sum)
+
+	if err := gu.importImage(ctx, objectName, status); err != nil {
+		return nil, err
+	}
+	return &cloud.UploadResult{SHA256: sha256sum}, nil
+}
+
+// importImage imports the uploaded storage object into Compute Engine,
+// deprecates the previous image of the family and shares the image if
+// requested.
+func (gu *gcpUploader) importImage(ctx context.Context, objectName string, status io.Writer) error {
+	// the previous image must be looked up before the new one
+	// becomes the latest image of the family
+	var previous *computepb.Image
+	if gu.deprecatePrevious {
+		var err error
+		previous, err = gu.client.ComputeImageFromFamily(ctx, gu.family)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(status, "Importing image %s into Compute Engine\n", gu.imageName)
+	gu.progress.Report(cloud.UploadPhaseImport, 0, 1)
+	image, err := gu.client.ComputeImageInsertWithOptions(ctx, gu.bucketName, objectName, gu.imageName, gu.regions, &ComputeImageInsertOptions{
+		GuestOsFeatures: gu.guestOsFeatures,
+		Family:          gu.family,
+	})
+	if err != nil {
+		return err
+	}
+	gu.progress.Report(cloud.UploadPhaseImport, 1, 1)
+	fmt.Fprintf(status, "Image URL: %s\n", gu.client.ComputeImageURL(gu.imageName))
+
+	if previous != nil && previous.GetName() != gu.imageName {
+		fmt.Fprintf(status, "Deprecating previous image %s of family %s\n", previous.GetName(), gu.family)
+		if err := gu.client.ComputeImageDeprecate(ctx, previous.GetName(), computepb.DeprecationStatus_DEPRECATED.String(), image.GetSelfLink()); err != nil {
+			return err
+		}
+	}
+
+	if len(gu.shareWith) > 0 {
+		fmt.Fprintf(status, "Sharing image with: %v\n", gu.shareWith)
+		gu.progress.Report(cloud.UploadPhaseShare, 0, 1)
+		if err := gu.client.ComputeImageShare(ctx, gu.imageName, gu.shareWith); err != nil {
+			return err
+		}
+		gu.progress.Report(cloud.UploadPhaseShare, 1, 1)
+	}
+
+	return nil
+}
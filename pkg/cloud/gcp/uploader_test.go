@@ -0,0 +1,393 @@
+package gcp_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/compute/apiv1/computepb"
+	"cloud.google.com/go/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/cloud"
+	"github.com/osbuild/images/pkg/cloud/gcp"
+)
+
+type fakeGCPClient struct {
+	grantedPermissions []string
+	testPermissionsErr error
+
+	uploaded  []byte
+	uploadErr error
+
+	uploadSessions []string
+
+	deleteErr   error
+	deleteCalls int
+
+	insertErr             error
+	insertRegions         []string
+	insertGuestOsFeatures []*computepb.GuestOsFeature
+	insertFamily          string
+	insertCalls           int
+
+	familyImage    *computepb.Image
+	deprecated     []string
+	deprecateState string
+	replacement    string
+
+	shareWith []string
+	shareErr  error
+}
+
+func (fg *fakeGCPClient) StorageBucketTestPermissions(ctx context.Context, bucket string, permissions []string) ([]string, error) {
+	return fg.grantedPermissions, fg.testPermissionsErr
+}
+
+func (fg *fakeGCPClient) StorageObjectUploadFromReader(ctx context.Context, r io.Reader, bucket, object string, metadata map[string]string) (*storage.ObjectAttrs, error) {
+	if fg.uploadErr != nil {
+		return nil, fg.uploadErr
+	}
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	fg.uploaded = b
+	return &storage.ObjectAttrs{Bucket: bucket, Name: object, Metadata: metadata}, nil
+}
+
+func (fg *fakeGCPClient) StorageObjectUploadAt(ctx context.Context, r io.ReaderAt, size int64, bucket, object string, metadata map[string]string, sessionURI string, onSession func(string)) (string, error) {
+	fg.uploadSessions = append(fg.uploadSessions, sessionURI)
+	onSession("https://example.com/session")
+	if fg.uploadErr != nil {
+		return "", fg.uploadErr
+	}
+	b, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+	if err != nil {
+		return "", err
+	}
+	fg.uploaded = b
+	return "sha256sum", nil
+}
+
+func (fg *fakeGCPClient) StorageObjectDelete(ctx context.Context, bucket, object string) error {
+	fg.deleteCalls++
+	return fg.deleteErr
+}
+
+func (fg *fakeGCPClient) ComputeImageInsertWithOptions(ctx context.Context, bucket, object, imageName string, regions []string, opts *gcp.ComputeImageInsertOptions) (*computepb.Image, error) {
+	fg.insertCalls++
+	fg.insertRegions = regions
+	fg.insertGuestOsFeatures = opts.GuestOsFeatures
+	fg.insertFamily = opts.Family
+	selfLink := "https://example.com/projects/p/global/images/" + imageName
+	return &computepb.Image{Name: &imageName, SelfLink: &selfLink}, fg.insertErr
+}
+
+func (fg *fakeGCPClient) ComputeImageFromFamily(ctx context.Context, family string) (*computepb.Image, error) {
+	return fg.familyImage, nil
+}
+
+func (fg *fakeGCPClient) ComputeImageDeprecate(ctx context.Context, imageName, state, replacement string) error {
+	fg.deprecated = append(fg.deprecated, imageName)
+	fg.deprecateState = state
+	fg.replacement = replacement
+	return nil
+}
+
+func (fg *fakeGCPClient) ComputeImageShare(ctx context.Context, imageName string, shareWith []string) error {
+	fg.shareWith = shareWith
+	return fg.shareErr
+}
+
+func (fg *fakeGCPClient) ComputeImageURL(imageName string) string {
+	return "https://example.com/" + imageName
+}
+
+func mockGcpClient(t *testing.T, fg *fakeGCPClient) {
+	restore := gcp.MockNewGcpClient(func([]byte) (gcp.GcpClient, error) {
+		return fg, nil
+	})
+	t.Cleanup(restore)
+}
+
+type repeatReader struct{}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0x1
+	}
+	return len(p), nil
+}
+
+func TestUploaderCheckHappy(t *testing.T) {
+	fg := &fakeGCPClient{
+		grantedPermissions: []string{"storage.objects.create", "storage.objects.delete", "storage.objects.get"},
+	}
+	mockGcpClient(t, fg)
+
+	uploader, err := gcp.NewUploader("bucket", "image", nil)
+	require.NoError(t, err)
+	var statusLog bytes.Buffer
+	err = uploader.Check(&statusLog)
+	assert.NoError(t, err)
+	assert.Equal(t, "Checking GCP bucket permissions...\nUpload conditions met.\n", statusLog.String())
+}
+
+func TestUploaderCheckMissingPermission(t *testing.T) {
+	fg := &fakeGCPClient{
+		grantedPermissions: []string{"storage.objects.create"},
+	}
+	mockGcpClient(t, fg)
+
+	uploader, err := gcp.NewUploader("bucket", "image", nil)
+	require.NoError(t, err)
+	err = uploader.Check(io.Discard)
+	assert.EqualError(t, err, `missing permission "storage.objects.delete" for bucket 'bucket' with the given GCP account`)
+}
+
+func TestUploaderUploadHappy(t *testing.T) {
+	uuid.SetRand(&repeatReader{})
+	defer uuid.SetRand(nil)
+
+	fg := &fakeGCPClient{}
+	mockGcpClient(t, fg)
+
+	uploader, err := gcp.NewUploader("bucket", "image", &gcp.UploaderOptions{
+		Regions:    []string{"us-east1"},
+		DistroName: "rhel-9.6",
+		ShareWith:  []string{"user:alice@example.com"},
+	})
+	require.NoError(t, err)
+	var uploadLog bytes.Buffer
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-gcp-image"), &uploadLog)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("fake-gcp-image"), fg.uploaded)
+	assert.Equal(t, 1, fg.insertCalls)
+	assert.Equal(t, []string{"us-east1"}, fg.insertRegions)
+	assert.Equal(t, gcp.GuestOsFeaturesRHEL9, fg.insertGuestOsFeatures)
+	assert.Equal(t, []string{"user:alice@example.com"}, fg.shareWith)
+	assert.Equal(t, 1, fg.deleteCalls)
+	expectedUploadLog := `Uploading image to bucket/01010101-0101-4101-8101-010101010101-image.tar.gz
+Importing image image into Compute Engine
+Image URL: https://example.com/image
+Sharing image with: [user:alice@example.com]
+Deleting storage object bucket/01010101-0101-4101-8101-010101010101-image.tar.gz
+`
+	assert.Equal(t, expectedUploadLog, uploadLog.String())
+}
+
+// lineWriter passes every line written to it to the function
+type lineWriter func(string)
+
+func (w lineWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimSuffix(string(p), "\n"), "\n") {
+		w(line)
+	}
+	return len(p), nil
+}
+
+func TestUploaderUploadStructuredStatus(t *testing.T) {
+	uuid.SetRand(&repeatReader{})
+	defer uuid.SetRand(nil)
+
+	fg := &fakeGCPClient{}
+	mockGcpClient(t, fg)
+
+	var events []string
+	uploader, err := gcp.NewUploader("bucket", "image", &gcp.UploaderOptions{
+		ShareWith: []string{"user:alice@example.com"},
+		Progress: func(st *cloud.Status) {
+			events = append(events, fmt.Sprintf("%s %d/%d", st.Progress.Phase, st.Progress.Done, st.Progress.Total))
+		},
+	})
+	require.NoError(t, err)
+	// the messages written to the status writer are interleaved with the
+	// progress
+	status := lineWriter(func(line string) {
+		events = append(events, line)
+	})
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-gcp-image"), status)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"Uploading image to bucket/01010101-0101-4101-8101-010101010101-image.tar.gz",
+		"upload 14/0",
+		"Importing image image into Compute Engine",
+		"import 0/1",
+		"import 1/1",
+		"Image URL: https://example.com/image",
+		"Sharing image with: [user:alice@example.com]",
+		"share 0/1",
+		"share 1/1",
+		"Deleting storage object bucket/01010101-0101-4101-8101-010101010101-image.tar.gz",
+	}, events)
+}
+
+func TestUploaderUploadButImportErrorAndDeleteError(t *testing.T) {
+	fg := &fakeGCPClient{
+		insertErr: fmt.Errorf("fake-insert-err"),
+		deleteErr: fmt.Errorf("fake-delete-err"),
+	}
+	mockGcpClient(t, fg)
+
+	uploader, err := gcp.NewUploader("bucket", "image", nil)
+	require.NoError(t, err)
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-gcp-image"), io.Discard)
+	assert.EqualError(t, err, "fake-insert-err\nfake-delete-err")
+	assert.Equal(t, 1, fg.deleteCalls)
+}
+
+func TestUploaderUploadError(t *testing.T) {
+	fg := &fakeGCPClient{
+		uploadErr: fmt.Errorf("fake-upload-err"),
+	}
+	mockGcpClient(t, fg)
+
+	uploader, err := gcp.NewUploader("bucket", "image", nil)
+	require.NoError(t, err)
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-gcp-image"), io.Discard)
+	assert.EqualError(t, err, "fake-upload-err")
+	assert.Equal(t, 0, fg.insertCalls)
+	assert.Equal(t, 0, fg.deleteCalls)
+}
+
+func TestUploaderUploadAtResume(t *testing.T) {
+	uuid.SetRand(&repeatReader{})
+	fg := &fakeGCPClient{
+		uploadErr: fmt.Errorf("fake-upload-err"),
+	}
+	mockGcpClient(t, fg)
+
+	uploader, err := gcp.NewUploader("bucket", "image", nil)
+	require.NoError(t, err)
+	resumable, ok := uploader.(cloud.ResumableUploader)
+	require.True(t, ok)
+
+	var state cloud.UploadState
+	opts := &cloud.UploadAtOptions{
+		StateCallback: func(s cloud.UploadState) {
+			state = s
+		},
+	}
+	fakeImage := bytes.NewReader([]byte("fake-gcp-image"))
+	_, err = resumable.UploadAndRegisterAt(fakeImage, fakeImage.Size(), opts, io.Discard)
+	assert.EqualError(t, err, "fake-upload-err")
+	assert.Equal(t, 0, fg.deleteCalls)
+	assert.Equal(t, cloud.UploadState{
+		Object:  "01010101-0101-4101-8101-010101010101-image.tar.gz",
+		Session: "https://example.com/session",
+	}, state)
+
+	fg.uploadErr = nil
+	opts.Resume = &state
+	var uploadLog bytes.Buffer
+	res, err := resumable.UploadAndRegisterAt(fakeImage, fakeImage.Size(), opts, &uploadLog)
+	require.NoError(t, err)
+	assert.Equal(t, &cloud.UploadResult{SHA256: "sha256sum"}, res)
+	assert.Equal(t, []string{"", "https://example.com/session"}, fg.uploadSessions)
+	assert.Equal(t, []byte("fake-gcp-image"), fg.uploaded)
+	assert.Equal(t, 1, fg.insertCalls)
+	assert.Equal(t, 1, fg.deleteCalls)
+	expectedUploadLog := `Resuming upload of image to bucket/01010101-0101-4101-8101-010101010101-image.tar.gz
+Storage object uploaded (sha256:sha256sum)
+Importing image image into Compute Engine
+Image URL: https://example.com/image
+Deleting storage object bucket/01010101-0101-4101-8101-010101010101-image.tar.gz
+`
+	assert.Equal(t, expectedUploadLog, uploadLog.String())
+}
+
+func TestUploaderUploadFamilyDeprecatePrevious(t *testing.T) {
+	uuid.SetRand(&repeatReader{})
+	defer uuid.SetRand(nil)
+
+	fg := &fakeGCPClient{
+		familyImage: &computepb.Image{Name: common.ToPtr("image-1")},
+	}
+	mockGcpClient(t, fg)
+
+	uploader, err := gcp.NewUploader("bucket", "image-2", &gcp.UploaderOptions{
+		DistroName:        "rhel-9.6",
+		Family:            "rhel-9",
+		DeprecatePrevious: true,
+	})
+	require.NoError(t, err)
+	var uploadLog bytes.Buffer
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-gcp-image"), &uploadLog)
+	require.NoError(t, err)
+	assert.Equal(t, "rhel-9", fg.insertFamily)
+	assert.Equal(t, []string{"image-1"}, fg.deprecated)
+	assert.Equal(t, "DEPRECATED", fg.deprecateState)
+	assert.Equal(t, "https://example.com/projects/p/global/images/image-2", fg.replacement)
+	expectedUploadLog := `Uploading image-2 to bucket/01010101-0101-4101-8101-010101010101-image-2.tar.gz
+Importing image image-2 into Compute Engine
+Image URL: https://example.com/image-2
+Deprecating previous image image-1 of family rhel-9
+Deleting storage object bucket/01010101-0101-4101-8101-010101010101-image-2.tar.gz
+`
+	assert.Equal(t, expectedUploadLog, uploadLog.String())
+}
+
+func TestUploaderUploadFamilyEmpty(t *testing.T) {
+	fg := &fakeGCPClient{}
+	mockGcpClient(t, fg)
+
+	uploader, err := gcp.NewUploader("bucket", "image", &gcp.UploaderOptions{
+		Family:            "rhel-9",
+		DeprecatePrevious: true,
+	})
+	require.NoError(t, err)
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-gcp-image"), io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, "rhel-9", fg.insertFamily)
+	assert.Empty(t, fg.deprecated)
+}
+
+func TestUploaderGuestOsFeatures(t *testing.T) {
+	fg := &fakeGCPClient{}
+	mockGcpClient(t, fg)
+
+	uploader, err := gcp.NewUploader("bucket", "image", &gcp.UploaderOptions{
+		DistroName:           "rhel-9.6",
+		ExtraGuestOsFeatures: []string{"TDX_CAPABLE", "GVNIC"},
+	})
+	require.NoError(t, err)
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-gcp-image"), io.Discard)
+	require.NoError(t, err)
+	expected := append(slices.Clone(gcp.GuestOsFeaturesRHEL9), &computepb.GuestOsFeature{Type: common.ToPtr("TDX_CAPABLE")})
+	assert.Equal(t, expected, fg.insertGuestOsFeatures)
+
+	uploader, err = gcp.NewUploader("bucket", "image", &gcp.UploaderOptions{
+		DistroName:           "rhel-9.6",
+		GuestOsFeatures:      []string{"UEFI_COMPATIBLE"},
+		ExtraGuestOsFeatures: []string{"SEV_SNP_CAPABLE"},
+	})
+	require.NoError(t, err)
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-gcp-image"), io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, []*computepb.GuestOsFeature{
+		{Type: common.ToPtr("UEFI_COMPATIBLE")},
+		{Type: common.ToPtr("SEV_SNP_CAPABLE")},
+	}, fg.insertGuestOsFeatures)
+}
+
+func TestNewUploaderErrors(t *testing.T) {
+	mockGcpClient(t, &fakeGCPClient{})
+
+	_, err := gcp.NewUploader("bucket", "image", &gcp.UploaderOptions{
+		ExtraGuestOsFeatures: []string{"FLUX_CAPACITOR"},
+	})
+	assert.EqualError(t, err, `unknown Guest OS Feature "FLUX_CAPACITOR"`)
+
+	_, err = gcp.NewUploader("bucket", "image", &gcp.UploaderOptions{
+		DeprecatePrevious: true,
+	})
+	assert.EqualError(t, err, "deprecating the previous image requires an image family")
+}
@@ -0,0 +1,179 @@
+package cloud
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/osbuild/images/pkg/datasizes"
+)
+
+// UploadPhase is the phase of an upload that a Progress refers to.
+type UploadPhase string
+
+const (
+	// UploadPhaseUpload is the transfer of the image data, the
+	// progress is in bytes.
+	UploadPhaseUpload UploadPhase = "upload"
+	// UploadPhaseImport is the import of the uploaded image by the
+	// cloud, e.g. creating a GCP image from a storage object.
+	UploadPhaseImport UploadPhase = "import"
+	// UploadPhaseRegister is the registration of the uploaded image,
+	// e.g. an AMI.
+	UploadPhaseRegister UploadPhase = "register"
+	// UploadPhaseShare is the sharing of the image with other
+	// accounts.
+	UploadPhaseShare UploadPhase = "share"
+)
+
+// Progress contains the progress of a single phase of an upload, it is
+// modelled after osbuild.Progress.
+type Progress struct {
+	Phase UploadPhase
+	// The amount of work already done, in bytes for
+	// UploadPhaseUpload
+	Done int64
+	// The total amount of work for this phase, zero if it is not
+	// known
+	Total int64
+}
+
+// Status is a single structured status update of an upload, it is
+// modelled after osbuild.Status so that frontends can render the
+// progress of builds and uploads the same way.
+type Status struct {
+	// Progress contains the current progress
+	Progress *Progress
+
+	// Timestamp contains the time the status was generated
+	Timestamp time.Time
+}
+
+// ProgressFunc receives the structured status updates of an upload. It
+// can be set in the options of the uploaders, the free-form text is still
+// written to the status io.Writer.
+type ProgressFunc func(*Status)
+
+// ProgressReporter passes the progress of an upload to a ProgressFunc. It
+// is safe for concurrent use, the ProgressFunc is never called
+// concurrently. A nil ProgressReporter discards the progress.
+type ProgressReporter struct {
+	mu sync.Mutex
+	fn ProgressFunc
+}
+
+// NewProgressReporter returns a ProgressReporter that passes all updates
+// to fn, or nil if fn is nil.
+func NewProgressReporter(fn ProgressFunc) *ProgressReporter {
+	if fn == nil {
+		return nil
+	}
+	return &ProgressReporter{fn: fn}
+}
+
+// Report reports the progress of the given phase.
+func (pr *ProgressReporter) Report(phase UploadPhase, done, total int64) {
+	if pr == nil {
+		return
+	}
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	pr.report(phase, done, total)
+}
+
+// report is Report for callers that hold pr.mu.
+func (pr *ProgressReporter) report(phase UploadPhase, done, total int64) {
+	pr.fn(&Status{
+		Progress: &Progress{
+			Phase: phase,
+			Done:  done,
+			Total: total,
+		},
+		Timestamp: time.Now(),
+	})
+}
+
+// progressMinStep is the minimal amount of bytes between two reported
+// upload progress updates
+const progressMinStep = 4 * datasizes.MiB
+
+type progressCounter struct {
+	pr    *ProgressReporter
+	total int64
+	step  int64
+
+	done atomic.Int64
+	// reported is guarded by pr.mu, so that concurrent readers report
+	// in order and the final update is never lost
+	reported int64
+}
+
+func newProgressCounter(pr *ProgressReporter, total int64) *progressCounter {
+	return &progressCounter{
+		pr:    pr,
+		total: total,
+		step:  max(total/100, progressMinStep),
+	}
+}
+
+func (pc *progressCounter) add(n int, eof bool) {
+	done := pc.done.Add(int64(n))
+	if pc.total > 0 {
+		// data that is read more than once, e.g. when retrying,
+		// does not count twice
+		done = min(done, pc.total)
+	}
+	pc.pr.mu.Lock()
+	defer pc.pr.mu.Unlock()
+	if done <= pc.reported {
+		return
+	}
+	if done-pc.reported < pc.step && done != pc.total && !eof {
+		return
+	}
+	pc.reported = done
+	pc.pr.report(UploadPhaseUpload, done, pc.total)
+}
+
+type progressReader struct {
+	r  io.Reader
+	pc *progressCounter
+}
+
+// Reader returns a reader that reports the progress of reading the total
+// bytes from r as UploadPhaseUpload. The total may be zero if it is not
+// known.
+func (pr *ProgressReporter) Reader(r io.Reader, total int64) io.Reader {
+	if pr == nil {
+		return r
+	}
+	return &progressReader{r: r, pc: newProgressCounter(pr, total)}
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	pr.pc.add(n, err == io.EOF)
+	return n, err
+}
+
+type progressReaderAt struct {
+	r  io.ReaderAt
+	pc *progressCounter
+}
+
+// ReaderAt returns a reader that reports the amount of bytes read from r
+// as UploadPhaseUpload, see Reader. Uploaders are expected to read every
+// byte once.
+func (pr *ProgressReporter) ReaderAt(r io.ReaderAt, total int64) io.ReaderAt {
+	if pr == nil {
+		return r
+	}
+	return &progressReaderAt{r: r, pc: newProgressCounter(pr, total)}
+}
+
+func (pr *progressReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := pr.r.ReadAt(p, off)
+	pr.pc.add(n, false)
+	return n, err
+}
@@ -0,0 +1,110 @@
+package cloud_test
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/cloud"
+	"github.com/osbuild/images/pkg/datasizes"
+)
+
+func collectStatus(t *testing.T, statuses *[]*cloud.Status) *cloud.ProgressReporter {
+	return cloud.NewProgressReporter(func(st *cloud.Status) {
+		assert.False(t, st.Timestamp.IsZero())
+		*statuses = append(*statuses, st)
+	})
+}
+
+func TestProgressReporterReport(t *testing.T) {
+	var statuses []*cloud.Status
+	pr := collectStatus(t, &statuses)
+
+	pr.Report(cloud.UploadPhaseRegister, 0, 1)
+	pr.Report(cloud.UploadPhaseRegister, 1, 1)
+
+	require.Len(t, statuses, 2)
+	assert.Equal(t, &cloud.Progress{Phase: cloud.UploadPhaseRegister, Done: 0, Total: 1}, statuses[0].Progress)
+	assert.Equal(t, &cloud.Progress{Phase: cloud.UploadPhaseRegister, Done: 1, Total: 1}, statuses[1].Progress)
+}
+
+func TestProgressReporterNil(t *testing.T) {
+	pr := cloud.NewProgressReporter(nil)
+	assert.Nil(t, pr)
+	// a nil reporter discards the progress
+	pr.Report(cloud.UploadPhaseUpload, 1, 2)
+
+	r := bytes.NewReader(nil)
+	assert.Same(t, r, pr.Reader(r, 0))
+	assert.Same(t, r, pr.ReaderAt(r, 0))
+}
+
+func progressOf(statuses []*cloud.Status) (res []int64) {
+	for _, st := range statuses {
+		if st.Progress != nil && st.Progress.Phase == cloud.UploadPhaseUpload {
+			res = append(res, st.Progress.Done)
+		}
+	}
+	return res
+}
+
+func TestProgressReader(t *testing.T) {
+	size := int64(10 * datasizes.MiB)
+	var statuses []*cloud.Status
+	r := collectStatus(t, &statuses).Reader(bytes.NewReader(make([]byte, size)), 0)
+	_, err := io.CopyBuffer(io.Discard, r, make([]byte, datasizes.MiB))
+	require.NoError(t, err)
+	// the progress of unknown sizes is reported every 4 MiB and
+	// at the end
+	assert.Equal(t, []int64{4 * datasizes.MiB, 8 * datasizes.MiB, size}, progressOf(statuses))
+	assert.Equal(t, int64(0), statuses[0].Progress.Total)
+}
+
+func TestProgressReaderAt(t *testing.T) {
+	size := int64(1000 * datasizes.MiB)
+	var statuses []*cloud.Status
+	r := collectStatus(t, &statuses).ReaderAt(bytes.NewReader(make([]byte, size)), size)
+	buf := make([]byte, 5*datasizes.MiB)
+	for off := int64(0); off < size; off += int64(len(buf)) {
+		_, err := r.ReadAt(buf, off)
+		require.NoError(t, err)
+	}
+	// reading again does not go past the total
+	_, err := r.ReadAt(buf, 0)
+	require.NoError(t, err)
+
+	progress := progressOf(statuses)
+	// the progress of known sizes is reported in steps of 1%
+	assert.Len(t, progress, 100)
+	assert.Equal(t, size, progress[len(progress)-1])
+	assert.Equal(t, size, statuses[0].Progress.Total)
+}
+
+func TestProgressReaderAtConcurrent(t *testing.T) {
+	size := int64(100 * datasizes.MiB)
+	var statuses []*cloud.Status
+	r := collectStatus(t, &statuses).ReaderAt(bytes.NewReader(make([]byte, size)), size)
+
+	chunk := int64(datasizes.MiB)
+	var wg sync.WaitGroup
+	for off := int64(0); off < size; off += chunk {
+		wg.Add(1)
+		go func(off int64) {
+			defer wg.Done()
+			_, err := r.ReadAt(make([]byte, chunk), off)
+			assert.NoError(t, err)
+		}(off)
+	}
+	wg.Wait()
+
+	// the updates are in order and the last one is complete
+	progress := progressOf(statuses)
+	require.NotEmpty(t, progress)
+	assert.True(t, slices.IsSorted(progress))
+	assert.Equal(t, size, progress[len(progress)-1])
+}
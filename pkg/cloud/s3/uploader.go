@@ -0,0 +1,202 @@
+// Package s3 implements a cloud.Uploader for generic S3 compatible object
+// storage like MinIO or Ceph RGW. Unlike the uploader of the awscloud
+// package it only uploads the image, it does not import or register it.
+package s3
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	awss3 "github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"github.com/osbuild/images/pkg/cloud"
+	"github.com/osbuild/images/pkg/cloud/awscloud"
+)
+
+type s3Uploader struct {
+	client s3iface.S3API
+
+	bucketName    string
+	keyName       string
+	tags          map[string]string
+	public        bool
+	presignExpiry time.Duration
+	partSize      int64
+	concurrency   int
+
+	progress *cloud.ProgressReporter
+}
+
+type UploaderOptions struct {
+	// Endpoint of the S3 service, e.g. "https://minio.example.com:9000".
+	// If empty the AWS endpoint of the region is used.
+	Endpoint string
+	// Region of the bucket, most S3 compatible services ignore it
+	// but it must not be empty.
+	Region string
+
+	// AccessKeyID, SecretAccessKey and the optional SessionToken
+	// are the static credentials to use. If AccessKeyID is empty
+	// the default credentials are used, i.e. the AWS_* environment
+	// variables or the shared credentials file.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+
+	// CABundle is the path to a PEM file with the certificates that
+	// are used to verify the server certificate.
+	CABundle string
+	// SkipSSLVerification disables the verification of the server
+	// certificate.
+	SkipSSLVerification bool
+
+	// Tags are set on the uploaded object.
+	Tags map[string]string
+	// Public makes the uploaded object publicly readable.
+	Public bool
+	// PresignExpiry is the validity of a presigned GET URL of the
+	// uploaded object which is written to the status. No URL is
+	// generated if it is zero.
+	PresignExpiry time.Duration
+
+	// PartSize is the size of the parts of multipart uploads, it
+	// defaults to DefaultPartSize and must be at least
+	// s3manager.MinUploadPartSize (5 MiB).
+	PartSize int64
+	// Concurrency is the number of parts that are uploaded in
+	// parallel, it defaults to s3manager.DefaultUploadConcurrency.
+	Concurrency int
+	// Progress receives the structured progress of the upload in
+	// addition to the free-form text written to the status writer.
+	Progress cloud.ProgressFunc
+}
+
+// DefaultPartSize is the default size of the parts of multipart uploads
+const DefaultPartSize = 64 * 1024 * 1024
+
+// s3MaxPresignExpiry is the longest validity of presigned URLs that S3
+// accepts
+const s3MaxPresignExpiry = 7 * 24 * time.Hour
+
+func newS3Client(opts *UploaderOptions) (s3iface.S3API, error) {
+	var creds *credentials.Credentials
+	if opts.AccessKeyID != "" {
+		creds = credentials.NewStaticCredentials(opts.AccessKeyID, opts.SecretAccessKey, opts.SessionToken)
+	}
+	sess, err := awscloud.NewSession(creds, opts.Region, opts.Endpoint, opts.CABundle, opts.SkipSSLVerification)
+	if err != nil {
+		return nil, err
+	}
+	return awss3.New(sess), nil
+}
+
+// NewUploader returns a cloud.Uploader that uploads the image into the
+// given bucket and key of an S3 compatible object storage.
+func NewUploader(bucketName, keyName string, opts *UploaderOptions) (cloud.Uploader, error) {
+	if opts == nil {
+		opts = &UploaderOptions{}
+	}
+	if bucketName == "" || keyName == "" {
+		return nil, fmt.Errorf("bucket and key must be set")
+	}
+	if opts.Region == "" {
+		return nil, fmt.Errorf("region must be set")
+	}
+	partSize := opts.PartSize
+	if partSize == 0 {
+		partSize = DefaultPartSize
+	}
+	if partSize < s3manager.MinUploadPartSize {
+		return nil, fmt.Errorf("part size %d is smaller than the minimum of %d bytes", partSize, s3manager.MinUploadPartSize)
+	}
+	concurrency := opts.Concurrency
+	if concurrency == 0 {
+		concurrency = s3manager.DefaultUploadConcurrency
+	}
+	if opts.PresignExpiry < 0 || opts.PresignExpiry > s3MaxPresignExpiry {
+		return nil, fmt.Errorf("presigned URL expiry must be between 0 and %v", s3MaxPresignExpiry)
+	}
+
+	client, err := newS3Client(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Uploader{
+		client:        client,
+		bucketName:    bucketName,
+		keyName:       keyName,
+		tags:          opts.Tags,
+		public:        opts.Public,
+		presignExpiry: opts.PresignExpiry,
+		partSize:      partSize,
+		concurrency:   concurrency,
+		progress:      cloud.NewProgressReporter(opts.Progress),
+	}, nil
+}
+
+var _ cloud.Uploader = &s3Uploader{}
+
+func (su *s3Uploader) Check(status io.Writer) error {
+	fmt.Fprintf(status, "Checking S3 bucket access...\n")
+	_, err := su.client.HeadBucket(&awss3.HeadBucketInput{
+		Bucket: aws.String(su.bucketName),
+	})
+	if err != nil {
+		return fmt.Errorf("cannot access bucket '%s': %w", su.bucketName, err)
+	}
+	fmt.Fprintf(status, "Upload conditions met.\n")
+	return nil
+}
+
+// UploadAndRegister uploads the image, there is nothing to register for
+// generic S3 storage.
+func (su *s3Uploader) UploadAndRegister(r io.Reader, status io.Writer) error {
+	uploader := s3manager.NewUploaderWithClient(su.client, func(u *s3manager.Uploader) {
+		u.PartSize = su.partSize
+		u.Concurrency = su.concurrency
+	})
+
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(su.bucketName),
+		Key:    aws.String(su.keyName),
+		Body:   su.progress.Reader(r, 0),
+	}
+	if len(su.tags) > 0 {
+		tagging := url.Values{}
+		for k, v := range su.tags {
+			tagging.Set(k, v)
+		}
+		input.Tagging = aws.String(tagging.Encode())
+	}
+	if su.public {
+		input.ACL = aws.String(awss3.ObjectCannedACLPublicRead)
+	}
+
+	fmt.Fprintf(status, "Uploading to %s/%s\n", su.bucketName, su.keyName)
+	res, err := uploader.Upload(input)
+	if err != nil {
+		return fmt.Errorf("cannot upload to %s/%s: %w", su.bucketName, su.keyName, err)
+	}
+	fmt.Fprintf(status, "File uploaded to %s\n", res.Location)
+
+	if su.presignExpiry > 0 {
+		req, _ := su.client.GetObjectRequest(&awss3.GetObjectInput{
+			Bucket: aws.String(su.bucketName),
+			Key:    aws.String(su.keyName),
+		})
+		presignedURL, err := req.Presign(su.presignExpiry)
+		if err != nil {
+			return fmt.Errorf("cannot presign the URL of %s/%s: %w", su.bucketName, su.keyName, err)
+		}
+		fmt.Fprintf(status, "Presigned URL (valid for %v): %s\n", su.presignExpiry, presignedURL)
+	}
+
+	return nil
+}
@@ -0,0 +1,259 @@
+package s3_test
+
+import (
+	"bytes"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/cloud/s3"
+)
+
+type fakeObject struct {
+	data    []byte
+	tagging string
+	acl     string
+}
+
+type fakeMultipartUpload struct {
+	key     string
+	tagging string
+	acl     string
+	parts   map[int][]byte
+}
+
+// fakeS3 is a minimal MinIO-like S3 server that supports the path-style
+// requests of the uploader
+type fakeS3 struct {
+	mu sync.Mutex
+
+	bucket  string
+	objects map[string]*fakeObject
+	uploads map[string]*fakeMultipartUpload
+	nextID  int
+}
+
+func newFakeS3(bucket string) *fakeS3 {
+	return &fakeS3{
+		bucket:  bucket,
+		objects: map[string]*fakeObject{},
+		uploads: map[string]*fakeMultipartUpload{},
+	}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	bucket, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if bucket != f.bucket {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `<Error><Code>NoSuchBucket</Code></Error>`)
+		return
+	}
+	query := r.URL.Query()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodHead && key == "":
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodPut && query.Has("partNumber"):
+		upload := f.uploads[query.Get("uploadId")]
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		upload.parts[partNumber] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"etag-%d"`, partNumber))
+	case r.Method == http.MethodPut:
+		f.objects[key] = &fakeObject{
+			data:    body,
+			tagging: r.Header.Get("X-Amz-Tagging"),
+			acl:     r.Header.Get("X-Amz-Acl"),
+		}
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		f.nextID++
+		id := fmt.Sprintf("upload-%d", f.nextID)
+		f.uploads[id] = &fakeMultipartUpload{
+			key:     key,
+			tagging: r.Header.Get("X-Amz-Tagging"),
+			acl:     r.Header.Get("X-Amz-Acl"),
+			parts:   map[int][]byte{},
+		}
+		fmt.Fprintf(w, `<InitiateMultipartUploadResult><Bucket>%s</Bucket><Key>%s</Key><UploadId>%s</UploadId></InitiateMultipartUploadResult>`, bucket, key, id)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		upload := f.uploads[query.Get("uploadId")]
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+			} `xml:"Part"`
+		}
+		if err := xml.Unmarshal(body, &complete); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		sort.Slice(complete.Parts, func(i, j int) bool { return complete.Parts[i].PartNumber < complete.Parts[j].PartNumber })
+		obj := &fakeObject{tagging: upload.tagging, acl: upload.acl}
+		for _, part := range complete.Parts {
+			obj.data = append(obj.data, upload.parts[part.PartNumber]...)
+		}
+		f.objects[upload.key] = obj
+		delete(f.uploads, query.Get("uploadId"))
+		fmt.Fprintf(w, `<CompleteMultipartUploadResult><Location>http://%s/%s/%s</Location><Bucket>%s</Bucket><Key>%s</Key><ETag>"etag"</ETag></CompleteMultipartUploadResult>`, r.Host, bucket, key, bucket, key)
+	case r.Method == http.MethodGet && key != "":
+		obj := f.objects[key]
+		if obj == nil || !query.Has("X-Amz-Signature") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_, _ = w.Write(obj.data)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+func testOptions(endpoint string) *s3.UploaderOptions {
+	return &s3.UploaderOptions{
+		Endpoint:        endpoint,
+		Region:          "us-east-1",
+		AccessKeyID:     "access-key",
+		SecretAccessKey: "secret-key",
+	}
+}
+
+func TestUploaderCheck(t *testing.T) {
+	srv := httptest.NewServer(newFakeS3("bucket"))
+	defer srv.Close()
+
+	uploader, err := s3.NewUploader("bucket", "image.raw", testOptions(srv.URL))
+	require.NoError(t, err)
+	var statusLog bytes.Buffer
+	err = uploader.Check(&statusLog)
+	require.NoError(t, err)
+	assert.Equal(t, "Checking S3 bucket access...\nUpload conditions met.\n", statusLog.String())
+
+	uploader, err = s3.NewUploader("other-bucket", "image.raw", testOptions(srv.URL))
+	require.NoError(t, err)
+	err = uploader.Check(io.Discard)
+	assert.ErrorContains(t, err, "cannot access bucket 'other-bucket'")
+}
+
+func TestUploaderUploadSinglePart(t *testing.T) {
+	fake := newFakeS3("bucket")
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	opts := testOptions(srv.URL)
+	opts.Tags = map[string]string{"distro": "fedora-41", "arch": "x86_64"}
+	opts.Public = true
+	opts.PresignExpiry = time.Hour
+	uploader, err := s3.NewUploader("bucket", "image.raw", opts)
+	require.NoError(t, err)
+	var statusLog bytes.Buffer
+	err = uploader.UploadAndRegister(strings.NewReader("fake-image"), &statusLog)
+	require.NoError(t, err)
+
+	obj := fake.objects["image.raw"]
+	require.NotNil(t, obj)
+	assert.Equal(t, []byte("fake-image"), obj.data)
+	assert.Equal(t, "arch=x86_64&distro=fedora-41", obj.tagging)
+	assert.Equal(t, "public-read", obj.acl)
+
+	lines := strings.Split(strings.TrimSpace(statusLog.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Equal(t, "Uploading to bucket/image.raw", lines[0])
+	assert.Equal(t, fmt.Sprintf("File uploaded to %s/bucket/image.raw", srv.URL), lines[1])
+	presignedURL, found := strings.CutPrefix(lines[2], "Presigned URL (valid for 1h0m0s): ")
+	require.True(t, found, lines[2])
+	assert.Contains(t, presignedURL, "X-Amz-Expires=3600")
+	resp, err := http.Get(presignedURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("fake-image"), body)
+}
+
+func TestUploaderUploadMultipart(t *testing.T) {
+	fake := newFakeS3("bucket")
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	opts := testOptions(srv.URL)
+	opts.Tags = map[string]string{"name": "my image"}
+	opts.PartSize = 5 * 1024 * 1024
+	opts.Concurrency = 2
+	uploader, err := s3.NewUploader("bucket", "image.raw", opts)
+	require.NoError(t, err)
+	image := bytes.Repeat([]byte("0123456789"), 1200*1024)
+	err = uploader.UploadAndRegister(bytes.NewReader(image), io.Discard)
+	require.NoError(t, err)
+
+	obj := fake.objects["image.raw"]
+	require.NotNil(t, obj)
+	assert.Equal(t, image, obj.data)
+	assert.Equal(t, "name=my+image", obj.tagging)
+	assert.Equal(t, "", obj.acl)
+	assert.Empty(t, fake.uploads)
+}
+
+func TestUploaderCABundle(t *testing.T) {
+	srv := httptest.NewTLSServer(newFakeS3("bucket"))
+	defer srv.Close()
+
+	// the certificate of the test server is not trusted by default
+	uploader, err := s3.NewUploader("bucket", "image.raw", testOptions(srv.URL))
+	require.NoError(t, err)
+	err = uploader.Check(io.Discard)
+	assert.ErrorContains(t, err, "certificate")
+
+	caBundle := filepath.Join(t.TempDir(), "ca.pem")
+	err = os.WriteFile(caBundle, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0600)
+	require.NoError(t, err)
+	opts := testOptions(srv.URL)
+	opts.CABundle = caBundle
+	uploader, err = s3.NewUploader("bucket", "image.raw", opts)
+	require.NoError(t, err)
+	err = uploader.Check(io.Discard)
+	assert.NoError(t, err)
+
+	opts = testOptions(srv.URL)
+	opts.SkipSSLVerification = true
+	uploader, err = s3.NewUploader("bucket", "image.raw", opts)
+	require.NoError(t, err)
+	err = uploader.Check(io.Discard)
+	assert.NoError(t, err)
+}
+
+func TestNewUploaderErrors(t *testing.T) {
+	for _, tc := range []struct {
+		bucket, key string
+		opts        *s3.UploaderOptions
+		expectedErr string
+	}{
+		{"", "key", testOptions(""), "bucket and key must be set"},
+		{"bucket", "key", nil, "region must be set"},
+		{"bucket", "key", &s3.UploaderOptions{Region: "r", PartSize: 1024}, "part size 1024 is smaller than the minimum of 5242880 bytes"},
+		{"bucket", "key", &s3.UploaderOptions{Region: "r", PresignExpiry: 8 * 24 * time.Hour}, "presigned URL expiry must be between 0 and 168h0m0s"},
+		{"bucket", "key", &s3.UploaderOptions{Region: "r", CABundle: "/non-existing"}, "cannot open the CA bundle: open /non-existing: no such file or directory"},
+	} {
+		_, err := s3.NewUploader(tc.bucket, tc.key, tc.opts)
+		assert.EqualError(t, err, tc.expectedErr)
+	}
+}
@@ -1,6 +1,7 @@
 package cloud
 
 import (
+	"fmt"
 	"io"
 )
 
@@ -18,7 +19,66 @@ type Uploader interface {
 
 	// UploadAndRegister will upload the given image from
 	// the reader and write status message to the given
-	// status writer.
-	// To implement progress a proxy reader can be used.
+	// status writer. The structured progress is passed to
+	// the cloud.ProgressFunc in the options of the uploader.
 	UploadAndRegister(f io.Reader, status io.Writer) error
 }
+
+// UploadState identifies an interrupted upload so that it can be
+// resumed. Callers should persist it (it can be marshalled as JSON)
+// when it is passed to UploadAtOptions.StateCallback.
+type UploadState struct {
+	// Object is the cloud specific name of the uploaded object,
+	// e.g. the S3 key or the Azure blob name.
+	Object string `json:"object"`
+	// Session is the cloud specific ID of the upload session,
+	// e.g. the S3 multipart upload ID or the GCS resumable
+	// session URI. It is empty for clouds that need no session.
+	Session string `json:"session,omitempty"`
+}
+
+// UploadAtOptions contains the optional settings for
+// ResumableUploader.UploadAndRegisterAt.
+type UploadAtOptions struct {
+	// Resume continues the upload described by the given state
+	// instead of starting a new one.
+	Resume *UploadState
+
+	// StateCallback is called with the state of the upload as soon
+	// as it can be resumed.
+	StateCallback func(UploadState)
+}
+
+// UploadResult contains information about a finished upload.
+type UploadResult struct {
+	// SHA256 is the hex encoded SHA-256 sum of the uploaded image.
+	// The integrity of the data stored in the cloud was verified
+	// against the local data using the checksums the cloud
+	// provides.
+	SHA256 string
+}
+
+// ResumableUploader is implemented by uploaders that can upload from
+// a random access source of a known size. An upload that fails is not
+// cleaned up so that it can be resumed by passing the last state that
+// was given to the UploadAtOptions.StateCallback.
+type ResumableUploader interface {
+	Uploader
+
+	// UploadAndRegisterAt works like UploadAndRegister but reads
+	// the image of the given size from r and verifies its
+	// checksum after the upload.
+	UploadAndRegisterAt(r io.ReaderAt, size int64, opts *UploadAtOptions, status io.Writer) (*UploadResult, error)
+}
+
+// ChecksumMismatchError is returned when the checksum of the data
+// stored in the cloud does not match the checksum of the local data.
+type ChecksumMismatchError struct {
+	Algorithm string
+	Expected  string
+	Actual    string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("%s checksum mismatch: expected %s but the cloud stored %s", e.Algorithm, e.Expected, e.Actual)
+}
@@ -0,0 +1,184 @@
+package network
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/blueprint"
+	"github.com/osbuild/images/pkg/customizations/fsnode"
+)
+
+// KeyfileDir is the directory of the NetworkManager connection profiles
+// (keyfiles).
+const KeyfileDir = "/etc/NetworkManager/system-connections"
+
+// connectionNamespace is the namespace of the UUIDs of the connections, which
+// are derived from the connection names so that the keyfiles are reproducible.
+var connectionNamespace = uuid.MustParse("6a3f4b8e-2c1d-4e5f-9a7b-0c8d1e2f3a4b")
+
+// keyfileSection is a section of a keyfile with its keys in order.
+type keyfileSection struct {
+	name   string
+	values [][2]string
+}
+
+func (s *keyfileSection) set(key, value string) {
+	s.values = append(s.values, [2]string{key, value})
+}
+
+// KeyfilesFromBP returns the NetworkManager keyfiles for the interfaces of
+// the network customization. The keyfiles are only readable by root, as
+// required by NetworkManager. The customization must be valid, see
+// [blueprint.NetworkCustomization.Validate].
+func KeyfilesFromBP(nc *blueprint.NetworkCustomization) ([]*fsnode.File, error) {
+	if nc == nil {
+		return nil, nil
+	}
+
+	types := make(map[string]string, len(nc.Interfaces))
+	for _, iface := range nc.Interfaces {
+		types[iface.Name] = iface.GetType()
+	}
+
+	var files []*fsnode.File
+	for _, iface := range nc.Interfaces {
+		data := genKeyfile(iface, types[iface.Controller])
+		path := filepath.Join(KeyfileDir, iface.Name+".nmconnection")
+		file, err := fsnode.NewFile(path, common.ToPtr(os.FileMode(0600)), "root", "root", []byte(data))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func genKeyfile(iface blueprint.NetworkInterfaceCustomization, controllerType string) string {
+	ifaceType := iface.GetType()
+
+	connection := keyfileSection{name: "connection"}
+	connection.set("id", iface.Name)
+	connection.set("uuid", uuid.NewSHA1(connectionNamespace, []byte(iface.Name)).String())
+	connection.set("type", ifaceType)
+	connection.set("interface-name", iface.Name)
+	if iface.Controller != "" {
+		// 'master' and 'slave-type' are understood by all versions of
+		// NetworkManager, unlike their newer aliases
+		connection.set("master", iface.Controller)
+		connection.set("slave-type", controllerType)
+	}
+	sections := []keyfileSection{connection}
+
+	ethernet := keyfileSection{name: "ethernet"}
+	if iface.MACAddress != "" {
+		if ifaceType == blueprint.NetworkInterfaceTypeEthernet {
+			ethernet.set("mac-address", strings.ToUpper(iface.MACAddress))
+		} else {
+			ethernet.set("cloned-mac-address", strings.ToUpper(iface.MACAddress))
+		}
+	}
+	if iface.MTU != 0 {
+		ethernet.set("mtu", fmt.Sprintf("%d", iface.MTU))
+	}
+	if len(ethernet.values) > 0 {
+		sections = append(sections, ethernet)
+	}
+
+	switch ifaceType {
+	case blueprint.NetworkInterfaceTypeBond:
+		bond := keyfileSection{name: "bond"}
+		mode := "balance-rr"
+		if iface.Bond != nil && iface.Bond.Mode != "" {
+			mode = iface.Bond.Mode
+		}
+		// NetworkManager requires the mode
+		bond.set("mode", mode)
+		if iface.Bond != nil {
+			keys := make([]string, 0, len(iface.Bond.Options))
+			for key := range iface.Bond.Options {
+				keys = append(keys, key)
+			}
+			slices.Sort(keys)
+			for _, key := range keys {
+				bond.set(key, iface.Bond.Options[key])
+			}
+		}
+		sections = append(sections, bond)
+	case blueprint.NetworkInterfaceTypeVLAN:
+		vlan := keyfileSection{name: "vlan"}
+		vlan.set("id", fmt.Sprintf("%d", iface.VLAN.ID))
+		vlan.set("parent", iface.VLAN.Parent)
+		sections = append(sections, vlan)
+	case blueprint.NetworkInterfaceTypeBridge:
+		bridge := keyfileSection{name: "bridge"}
+		if iface.Bridge != nil && iface.Bridge.STP != nil {
+			bridge.set("stp", fmt.Sprintf("%t", *iface.Bridge.STP))
+		}
+		sections = append(sections, bridge)
+	}
+
+	// ports are configured by their controller
+	if iface.Controller == "" {
+		sections = append(sections, genIPSection("ipv4", iface.IPv4), genIPSection("ipv6", iface.IPv6))
+	}
+
+	var b strings.Builder
+	for idx, section := range sections {
+		if idx > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "[%s]\n", section.name)
+		for _, kv := range section.values {
+			fmt.Fprintf(&b, "%s=%s\n", kv[0], kv[1])
+		}
+	}
+	return b.String()
+}
+
+func genIPSection(name string, ip *blueprint.NetworkIPCustomization) keyfileSection {
+	section := keyfileSection{name: name}
+	section.set("method", ip.GetMethod())
+	if ip == nil {
+		return section
+	}
+
+	for idx, addr := range ip.Addresses {
+		value := addr
+		// the gateway is set on the first address
+		if idx == 0 && ip.Gateway != "" {
+			value += "," + ip.Gateway
+		}
+		section.set(fmt.Sprintf("address%d", idx+1), value)
+	}
+	if len(ip.DNS) > 0 {
+		section.set("dns", strings.Join(ip.DNS, ";")+";")
+	}
+	if len(ip.DNSSearch) > 0 {
+		section.set("dns-search", strings.Join(ip.DNSSearch, ";")+";")
+	}
+	for idx, route := range ip.Routes {
+		value := route.Destination
+		if route.Metric != nil {
+			gateway := route.Gateway
+			if gateway == "" {
+				// the metric requires a gateway, the unspecified address
+				// means that there is none
+				gateway = "0.0.0.0"
+				if name == "ipv6" {
+					gateway = "::"
+				}
+			}
+			value += fmt.Sprintf(",%s,%d", gateway, *route.Metric)
+		} else if route.Gateway != "" {
+			value += "," + route.Gateway
+		}
+		section.set(fmt.Sprintf("route%d", idx+1), value)
+	}
+	return section
+}
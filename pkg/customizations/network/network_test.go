@@ -0,0 +1,165 @@
+package network_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/blueprint"
+	"github.com/osbuild/images/pkg/customizations/network"
+)
+
+func TestKeyfilesFromBP(t *testing.T) {
+	nc := &blueprint.NetworkCustomization{
+		Interfaces: []blueprint.NetworkInterfaceCustomization{
+			{
+				Name:       "eth0",
+				MACAddress: "52:54:00:12:34:56",
+				MTU:        9000,
+				IPv4: &blueprint.NetworkIPCustomization{
+					Addresses: []string{"192.168.1.10/24", "192.168.1.11/24"},
+					Gateway:   "192.168.1.1",
+					DNS:       []string{"192.168.1.1", "192.168.1.2"},
+					DNSSearch: []string{"example.com"},
+					Routes: []blueprint.NetworkRouteCustomization{
+						{Destination: "10.0.0.0/8", Gateway: "192.168.1.254"},
+						{Destination: "172.16.0.0/12", Metric: common.ToPtr(uint32(100))},
+					},
+				},
+				IPv6: &blueprint.NetworkIPCustomization{
+					Method: "disabled",
+				},
+			},
+			{
+				Name:       "eth1",
+				Controller: "bond0",
+			},
+			{
+				Name: "bond0",
+				Type: "bond",
+				Bond: &blueprint.NetworkBondCustomization{
+					Mode: "active-backup",
+					Options: map[string]string{
+						"primary": "eth1",
+						"miimon":  "100",
+					},
+				},
+			},
+			{
+				Name: "bond0.100",
+				Type: "vlan",
+				VLAN: &blueprint.NetworkVLANCustomization{
+					ID:     100,
+					Parent: "bond0",
+				},
+			},
+			{
+				Name: "br0",
+				Type: "bridge",
+				Bridge: &blueprint.NetworkBridgeCustomization{
+					STP: common.ToPtr(false),
+				},
+			},
+		},
+	}
+
+	files, err := network.KeyfilesFromBP(nc)
+	require.NoError(t, err)
+	require.Len(t, files, 5)
+
+	for _, file := range files {
+		assert.Equal(t, common.ToPtr(os.FileMode(0600)), file.Mode())
+		assert.Equal(t, "root", file.User())
+		assert.Equal(t, "root", file.Group())
+	}
+
+	assert.Equal(t, "/etc/NetworkManager/system-connections/eth0.nmconnection", files[0].Path())
+	assert.Equal(t, `[connection]
+id=eth0
+uuid=`+connectionUUID(t, files[0].Data())+`
+type=ethernet
+interface-name=eth0
+
+[ethernet]
+mac-address=52:54:00:12:34:56
+mtu=9000
+
+[ipv4]
+method=manual
+address1=192.168.1.10/24,192.168.1.1
+address2=192.168.1.11/24
+dns=192.168.1.1;192.168.1.2;
+dns-search=example.com;
+route1=10.0.0.0/8,192.168.1.254
+route2=172.16.0.0/12,0.0.0.0,100
+
+[ipv6]
+method=disabled
+`, string(files[0].Data()))
+
+	assert.Equal(t, `[connection]
+id=eth1
+uuid=`+connectionUUID(t, files[1].Data())+`
+type=ethernet
+interface-name=eth1
+master=bond0
+slave-type=bond
+`, string(files[1].Data()))
+
+	assert.Equal(t, `[connection]
+id=bond0
+uuid=`+connectionUUID(t, files[2].Data())+`
+type=bond
+interface-name=bond0
+
+[bond]
+mode=active-backup
+miimon=100
+primary=eth1
+
+[ipv4]
+method=auto
+
+[ipv6]
+method=auto
+`, string(files[2].Data()))
+
+	assert.Contains(t, string(files[3].Data()), "\n[vlan]\nid=100\nparent=bond0\n")
+	assert.Contains(t, string(files[4].Data()), "\n[bridge]\nstp=false\n")
+}
+
+func TestKeyfilesFromBPDeterministicUUIDs(t *testing.T) {
+	nc := &blueprint.NetworkCustomization{
+		Interfaces: []blueprint.NetworkInterfaceCustomization{
+			{Name: "eth0"},
+			{Name: "eth1"},
+		},
+	}
+
+	files1, err := network.KeyfilesFromBP(nc)
+	require.NoError(t, err)
+	files2, err := network.KeyfilesFromBP(nc)
+	require.NoError(t, err)
+
+	assert.Equal(t, files1[0].Data(), files2[0].Data())
+	assert.NotEqual(t, connectionUUID(t, files1[0].Data()), connectionUUID(t, files1[1].Data()))
+}
+
+func TestKeyfilesFromBPNil(t *testing.T) {
+	files, err := network.KeyfilesFromBP(nil)
+	require.NoError(t, err)
+	assert.Nil(t, files)
+}
+
+// connectionUUID returns the uuid of the connection of the keyfile
+func connectionUUID(t *testing.T, data []byte) string {
+	t.Helper()
+	_, rest, found := strings.Cut(string(data), "\nuuid=")
+	require.True(t, found, "no uuid in keyfile:\n%s", data)
+	uuid, _, _ := strings.Cut(rest, "\n")
+	return uuid
+}
@@ -0,0 +1,67 @@
+package sudoers
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/blueprint"
+	"github.com/osbuild/images/pkg/customizations/fsnode"
+)
+
+// Dir is the directory of the sudoers drop-in files.
+const Dir = "/etc/sudoers.d"
+
+// FilePath is the sudoers file created for the sudoers customization. sudo
+// skips the files in Dir with a '.' in their name, so it has no extension.
+const FilePath = Dir + "/blueprint"
+
+// argsEscaper escapes the characters with a special meaning in the
+// arguments of a command, see "Other special characters and reserved words"
+// in sudoers(5).
+var argsEscaper = strings.NewReplacer(`\`, `\\`, `,`, `\,`, `:`, `\:`, `=`, `\=`)
+
+func formatCommand(command string) string {
+	path, args, found := strings.Cut(command, " ")
+	if !found {
+		return command
+	}
+	return path + " " + argsEscaper.Replace(strings.TrimSpace(args))
+}
+
+func formatCommands(commands []string) string {
+	formatted := make([]string, 0, len(commands))
+	for _, command := range commands {
+		formatted = append(formatted, formatCommand(command))
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// FileFromBP returns the sudoers file for the sudoers customization, or nil
+// if there is none. The file is only readable by root and its group, as
+// required by sudo. The customization must be valid, see
+// [blueprint.SudoersCustomization.Validate].
+func FileFromBP(sc *blueprint.SudoersCustomization) (*fsnode.File, error) {
+	if sc == nil {
+		return nil, nil
+	}
+
+	var b strings.Builder
+	for _, alias := range sc.CommandAliases {
+		fmt.Fprintf(&b, "Cmnd_Alias %s = %s\n", alias.Name, formatCommands(alias.Commands))
+	}
+	for _, rule := range sc.Rules {
+		who := rule.User
+		if rule.Group != "" {
+			who = "%" + rule.Group
+		}
+		tag := ""
+		if rule.NoPasswd {
+			tag = "NOPASSWD: "
+		}
+		fmt.Fprintf(&b, "%s %s=(%s) %s%s\n", who, rule.GetHost(), rule.GetRunAs(), tag, formatCommands(rule.Commands))
+	}
+
+	return fsnode.NewFile(FilePath, common.ToPtr(os.FileMode(0440)), "root", "root", []byte(b.String()))
+}
@@ -0,0 +1,44 @@
+package sudoers
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/blueprint"
+)
+
+func TestFileFromBP(t *testing.T) {
+	file, err := FileFromBP(nil)
+	require.NoError(t, err)
+	assert.Nil(t, file)
+
+	sc := &blueprint.SudoersCustomization{
+		CommandAliases: []blueprint.SudoCommandAliasCustomization{
+			{Name: "SERVICES", Commands: []string{"/usr/bin/systemctl restart httpd", "/usr/bin/systemctl reload httpd"}},
+			{Name: "NETWORK", Commands: []string{"/usr/bin/nmcli connection up eth0,eth1", `/usr/sbin/ip addr add 10.0.0.1/24 dev eth0 label a:b=c\d`}},
+		},
+		Rules: []blueprint.SudoRuleCustomization{
+			{Group: "webadmins", Commands: []string{"SERVICES", "NETWORK"}, NoPasswd: true},
+			{User: "operator", Host: "web01", RunAs: "root:wheel", Commands: []string{"ALL", "!/usr/bin/su"}},
+			{User: "editor", Commands: []string{"sudoedit /etc/httpd/conf/httpd.conf"}},
+		},
+	}
+	require.NoError(t, sc.Validate())
+
+	file, err = FileFromBP(sc)
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/sudoers.d/blueprint", file.Path())
+	assert.Equal(t, common.ToPtr(os.FileMode(0440)), file.Mode())
+	assert.Equal(t, "root", file.User())
+	assert.Equal(t, "root", file.Group())
+	assert.Equal(t, `Cmnd_Alias SERVICES = /usr/bin/systemctl restart httpd, /usr/bin/systemctl reload httpd
+Cmnd_Alias NETWORK = /usr/bin/nmcli connection up eth0\,eth1, /usr/sbin/ip addr add 10.0.0.1/24 dev eth0 label a\:b\=c\\d
+%webadmins ALL=(ALL) NOPASSWD: SERVICES, NETWORK
+operator web01=(root:wheel) ALL, !/usr/bin/su
+editor ALL=(ALL) sudoedit /etc/httpd/conf/httpd.conf
+`, string(file.Data()))
+}
@@ -37,6 +37,9 @@ const (
 	// Default sector size in bytes
 	DefaultSectorSize = 512
 
+	// Sector size in bytes of 4K native (4Kn) disks
+	SectorSize4Kn = 4096
+
 	// Default grain size in bytes. The grain controls how sizes of certain
 	// entities are rounded. For example, by default, partition sizes are
 	// rounded to the next MiB.
@@ -191,6 +194,7 @@ const (
 	FS_EXT4
 	FS_XFS
 	FS_BTRFS
+	FS_EROFS
 )
 
 func (f FSType) String() string {
@@ -205,6 +209,8 @@ func (f FSType) String() string {
 		return "xfs"
 	case FS_BTRFS:
 		return "btrfs"
+	case FS_EROFS:
+		return "erofs"
 	default:
 		panic(fmt.Sprintf("unknown or unsupported filesystem type with enum value %d", f))
 	}
@@ -240,6 +246,8 @@ func NewFSType(s string) (FSType, error) {
 		return FS_XFS, nil
 	case "btrfs":
 		return FS_BTRFS, nil
+	case "erofs":
+		return FS_EROFS, nil
 	default:
 		return FS_NONE, fmt.Errorf("unknown or unsupported filesystem type name: %s", s)
 	}
@@ -85,6 +85,7 @@ func TestEnumFSType(t *testing.T) {
 		"ext4":  disk.FS_EXT4,
 		"xfs":   disk.FS_XFS,
 		"btrfs": disk.FS_BTRFS,
+		"erofs": disk.FS_EROFS,
 	}
 
 	assert := assert.New(t)
@@ -99,8 +100,8 @@ func TestEnumFSType(t *testing.T) {
 	}
 
 	// error test: bad value
-	badFst := disk.FSType(5)
-	assert.PanicsWithValue("unknown or unsupported filesystem type with enum value 5", func() { _ = badFst.String() })
+	badFst := disk.FSType(6)
+	assert.PanicsWithValue("unknown or unsupported filesystem type with enum value 6", func() { _ = badFst.String() })
 
 	// error test: bad name
 	_, err := disk.NewFSType("not-a-type")
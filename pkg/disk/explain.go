@@ -0,0 +1,292 @@
+package disk
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/blueprint"
+)
+
+// Layout describes a partition table and all its entities together with the
+// reasons why they were created and resized. It is meant for humans that need
+// to understand why a partition table has a specific layout.
+type Layout struct {
+	// Name of the disk for additional disks, empty for the main disk.
+	Name       string             `json:"name,omitempty"`
+	Type       PartitionTableType `json:"type"`
+	UUID       string             `json:"uuid,omitempty"`
+	Size       uint64             `json:"size"`
+	SectorSize uint64             `json:"sector_size"`
+	Entities   []LayoutEntity     `json:"entities"`
+}
+
+// LayoutEntity describes a single entity of a [Layout].
+type LayoutEntity struct {
+	Entity string `json:"entity"`
+	// Name of the entity, e.g. the name of a volume group or logical volume.
+	Name string `json:"name,omitempty"`
+
+	// Start (partitions only) and size of the entity in bytes.
+	Start uint64 `json:"start,omitempty"`
+	Size  uint64 `json:"size,omitempty"`
+	// Padding is the unused space (in bytes) between the end of the previous
+	// partition (or the partition table header) and the start of the
+	// partition, caused by alignment.
+	Padding uint64 `json:"padding,omitempty"`
+
+	PartType     string `json:"part_type,omitempty"`
+	UUID         string `json:"uuid,omitempty"`
+	Label        string `json:"label,omitempty"`
+	Mountpoint   string `json:"mountpoint,omitempty"`
+	FSType       string `json:"fs_type,omitempty"`
+	FSTabOptions string `json:"fstab_options,omitempty"`
+
+	// Origin is the rule that created the entity.
+	Origin string `json:"origin,omitempty"`
+	// Resizes lists the rules that changed the size of the entity.
+	Resizes []LayoutResize `json:"resizes,omitempty"`
+
+	Children []LayoutEntity `json:"children,omitempty"`
+}
+
+// LayoutResize describes a size change of an entity by a rule.
+type LayoutResize struct {
+	Rule string `json:"rule"`
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+}
+
+// ExplainNewPartitionTable creates a new partition table exactly like
+// [NewPartitionTable] and additionally returns the explanation of the rules
+// that created and resized each entity.
+func ExplainNewPartitionTable(basePT *PartitionTable, mountpoints []blueprint.FilesystemCustomization, imageSize uint64, mode PartitioningMode, architecture arch.Arch, requiredSizes map[string]uint64, rng *rand.Rand) (*PartitionTable, *Explanation, error) {
+	rec := newExplanation()
+	pt, err := newPartitionTable(basePT, mountpoints, imageSize, mode, architecture, requiredSizes, rng, rec)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pt, rec, nil
+}
+
+// ExplainNewCustomPartitionTable creates a new partition table exactly like
+// [NewCustomPartitionTable] and additionally returns the explanation of the
+// rules that created and resized each entity.
+func ExplainNewCustomPartitionTable(customizations *blueprint.DiskCustomization, options *CustomPartitionTableOptions, rng *rand.Rand) (*PartitionTable, *Explanation, error) {
+	rec := newExplanation()
+	pt, err := newCustomPartitionTable(customizations, options, rng, rec)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pt, rec, nil
+}
+
+// ExplainNewCustomAdditionalDisks creates the additional disks exactly like
+// [NewCustomAdditionalDisks] and additionally returns the explanations of
+// their partition tables, in the same order as the disks.
+func ExplainNewCustomAdditionalDisks(customizations *blueprint.DiskCustomization, mainPT *PartitionTable, options *CustomPartitionTableOptions, rng *rand.Rand) ([]AdditionalDisk, []*Explanation, error) {
+	return newCustomAdditionalDisks(customizations, mainPT, options, rng, true)
+}
+
+// Explanation keeps track of the rules that created and resized the
+// entities of a partition table while it is being built. Entities are
+// identified by their position in the entity tree, see layoutKey. The
+// layout is created with [Explanation.Layout] once the partition table is
+// final, e.g. after its UUIDs were derived with [PartitionTable.DeriveUUIDs].
+type Explanation struct {
+	origins map[string]string
+	sizes   map[string]uint64
+	resizes map[string][]LayoutResize
+}
+
+func newExplanation() *Explanation {
+	return &Explanation{
+		origins: make(map[string]string),
+		sizes:   make(map[string]uint64),
+		resizes: make(map[string][]LayoutResize),
+	}
+}
+
+// record attributes all entities of the partition table that were not seen
+// before to the rule and records any size changes since the last call.
+// Recording on a nil recorder is a no-op.
+func (r *Explanation) record(pt *PartitionTable, rule string) {
+	if r == nil {
+		return
+	}
+	walkUniqueLayoutKeys(pt, func(key string, e Entity) {
+		var size uint64
+		if sz, ok := e.(Sizeable); ok {
+			size = sz.GetSize()
+		}
+		if _, seen := r.origins[key]; !seen {
+			r.origins[key] = rule
+		} else if prev := r.sizes[key]; prev != size {
+			r.resizes[key] = append(r.resizes[key], LayoutResize{Rule: rule, From: prev, To: size})
+		}
+		r.sizes[key] = size
+	})
+}
+
+// Layout returns the layout of the partition table with the rules that
+// created and resized each entity. The partition table must be the one that
+// was explained.
+func (r *Explanation) Layout(pt *PartitionTable) *Layout {
+	l := &Layout{
+		Type:       pt.Type,
+		UUID:       pt.UUID,
+		Size:       pt.Size,
+		SectorSize: pt.SectorsToBytes(1),
+	}
+
+	partitions := make([]*Partition, 0, len(pt.Partitions))
+	for idx := range pt.Partitions {
+		partitions = append(partitions, &pt.Partitions[idx])
+	}
+	sort.SliceStable(partitions, func(i, j int) bool {
+		return partitions[i].Start < partitions[j].Start
+	})
+
+	keys := make(map[Entity]string)
+	walkUniqueLayoutKeys(pt, func(key string, e Entity) {
+		keys[e] = key
+	})
+
+	end := pt.HeaderSize()
+	for _, part := range partitions {
+		le := r.layoutEntity(part, keys)
+		if part.Start > end {
+			le.Padding = part.Start - end
+		}
+		end = part.Start + part.Size
+		l.Entities = append(l.Entities, le)
+	}
+	return l
+}
+
+func (r *Explanation) layoutEntity(e Entity, keys map[Entity]string) LayoutEntity {
+	key := keys[e]
+	le := LayoutEntity{
+		Origin:  r.origins[key],
+		Resizes: r.resizes[key],
+	}
+	if pe, ok := e.(PayloadEntity); ok {
+		le.Entity = pe.EntityName()
+	}
+	if sz, ok := e.(Sizeable); ok {
+		le.Size = sz.GetSize()
+	}
+	if fse, ok := e.(FSTabEntity); ok {
+		spec := fse.GetFSSpec()
+		le.UUID = spec.UUID
+		le.Label = spec.Label
+		le.FSType = fse.GetFSType()
+		if opts, err := fse.GetFSTabOptions(); err == nil {
+			le.FSTabOptions = opts.MntOps
+		}
+	}
+	if mnt, ok := e.(Mountable); ok {
+		le.Mountpoint = mnt.GetMountpoint()
+	}
+
+	switch ent := e.(type) {
+	case *Partition:
+		le.Entity = "partition"
+		le.Start = ent.Start
+		le.PartType = ent.Type
+		le.UUID = ent.UUID
+		le.Label = ent.Label
+	case *LUKSContainer:
+		le.UUID = ent.UUID
+		le.Label = ent.Label
+	case *LVMVolumeGroup:
+		le.Name = ent.Name
+	case *LVMLogicalVolume:
+		le.Entity = "lvm-logical-volume"
+		le.Name = ent.Name
+	case *Btrfs:
+		le.UUID = ent.UUID
+		le.Label = ent.Label
+	case *BtrfsSubvolume:
+		le.Entity = "btrfs-subvolume"
+		le.Name = ent.Name
+	}
+
+	if c, ok := e.(Container); ok {
+		for idx := uint(0); idx < c.GetItemCount(); idx++ {
+			le.Children = append(le.Children, r.layoutEntity(c.GetChild(idx), keys))
+		}
+	}
+	return le
+}
+
+// walkLayoutKeys calls the callback for all entities of the partition table
+// (but not the partition table itself) with their layout key.
+func walkLayoutKeys(pt *PartitionTable, cb func(key string, e Entity)) {
+	var walk func(e Entity, parentKey string)
+	walk = func(e Entity, parentKey string) {
+		key := parentKey + "/" + layoutKey(e)
+		cb(key, e)
+		if c, ok := e.(Container); ok {
+			for idx := uint(0); idx < c.GetItemCount(); idx++ {
+				walk(c.GetChild(idx), key)
+			}
+		}
+	}
+	for idx := range pt.Partitions {
+		walk(&pt.Partitions[idx], "")
+	}
+}
+
+// walkUniqueLayoutKeys is walkLayoutKeys with unique keys: entities with the
+// same key (e.g. two swap partitions or two raw partitions of the same type)
+// are numbered in the order of the partition table.
+func walkUniqueLayoutKeys(pt *PartitionTable, cb func(key string, e Entity)) {
+	seen := make(map[string]int)
+	walkLayoutKeys(pt, func(key string, e Entity) {
+		seen[key]++
+		if n := seen[key]; n > 1 {
+			key = fmt.Sprintf("%s#%d", key, n)
+		}
+		cb(key, e)
+	})
+}
+
+// layoutKey returns a key for the entity that is stable while the partition
+// table is built, i.e. it does not depend on sizes, offsets, or UUIDs that are
+// only set at the end. Partitions are identified by their content.
+func layoutKey(e Entity) string {
+	switch ent := e.(type) {
+	case *Partition:
+		if ent.Payload == nil {
+			return fmt.Sprintf("partition(%s)", strings.ToUpper(ent.Type))
+		}
+		return fmt.Sprintf("partition(%s)", layoutKey(ent.Payload))
+	case *Filesystem:
+		if ent.Mountpoint == "" {
+			return fmt.Sprintf("filesystem(%s)", ent.Type)
+		}
+		return fmt.Sprintf("filesystem(%s)", ent.Mountpoint)
+	case *LUKSContainer:
+		return fmt.Sprintf("luks(%s)", layoutKey(ent.Payload))
+	case *LVMVolumeGroup:
+		return fmt.Sprintf("lvm(%s)", ent.Name)
+	case *LVMLogicalVolume:
+		return fmt.Sprintf("lv(%s)", ent.Name)
+	case *BtrfsSubvolume:
+		return fmt.Sprintf("subvolume(%s)", ent.Name)
+	case PayloadEntity:
+		return ent.EntityName()
+	}
+	return fmt.Sprintf("%T", e)
+}
+
+// modeName returns the name of the partitioning mode for explanations.
+func modeName(mode PartitioningMode) PartitioningMode {
+	if mode == DefaultPartitioningMode {
+		return AutoLVMPartitioningMode
+	}
+	return mode
+}
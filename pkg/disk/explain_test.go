@@ -0,0 +1,242 @@
+package disk_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/testdisk"
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/blueprint"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/platform"
+)
+
+func TestExplainNewPartitionTable(t *testing.T) {
+	basePT := testdisk.TestPartitionTables()["plain"]
+	mountpoints := []blueprint.FilesystemCustomization{
+		{
+			Mountpoint: "/var/log",
+			MinSize:    3 * GiB,
+		},
+	}
+
+	/* #nosec G404 */
+	expected, err := disk.NewPartitionTable(&basePT, mountpoints, 10*GiB, disk.AutoLVMPartitioningMode, arch.ARCH_X86_64, nil, rand.New(rand.NewSource(13)))
+	require.NoError(t, err)
+	/* #nosec G404 */
+	pt, explanation, err := disk.ExplainNewPartitionTable(&basePT, mountpoints, 10*GiB, disk.AutoLVMPartitioningMode, arch.ARCH_X86_64, nil, rand.New(rand.NewSource(13)))
+	require.NoError(t, err)
+	// explaining must not change the result
+	assert.Equal(t, expected, pt)
+
+	layout := explanation.Layout(pt)
+
+	assert.Equal(t, disk.PT_GPT, layout.Type)
+	assert.Equal(t, pt.Size, layout.Size)
+	assert.Equal(t, uint64(512), layout.SectorSize)
+	require.Len(t, layout.Entities, 4)
+
+	// the first partition is aligned to 1 MiB after the GPT header
+	bios := layout.Entities[0]
+	assert.Equal(t, "partition", bios.Entity)
+	assert.Equal(t, uint64(1*MiB), bios.Start)
+	assert.Equal(t, uint64(1*MiB)-pt.HeaderSize(), bios.Padding)
+	assert.Equal(t, "base partition table", bios.Origin)
+
+	esp := layout.Entities[1]
+	require.Len(t, esp.Children, 1)
+	assert.Equal(t, "/boot/efi", esp.Children[0].Mountpoint)
+	assert.Equal(t, "vfat", esp.Children[0].FSType)
+	assert.Equal(t, "defaults,uid=0,gid=0,umask=077,shortname=winnt", esp.Children[0].FSTabOptions)
+	assert.Equal(t, "base partition table", esp.Children[0].Origin)
+
+	lvm := layout.Entities[3]
+	assert.Equal(t, "lvm conversion (auto-lvm partitioning mode)", lvm.Origin)
+	require.NotEmpty(t, lvm.Resizes)
+	assert.Equal(t, "relayout (alignment and image size)", lvm.Resizes[len(lvm.Resizes)-1].Rule)
+	require.Len(t, lvm.Children, 1)
+	vg := lvm.Children[0]
+	assert.Equal(t, "lvm", vg.Entity)
+	require.Len(t, vg.Children, 2)
+
+	rootLV := vg.Children[0]
+	assert.Equal(t, "lvm-logical-volume", rootLV.Entity)
+	assert.Equal(t, "rootlv", rootLV.Name)
+	assert.Equal(t, "lvm conversion (auto-lvm partitioning mode)", rootLV.Origin)
+	// the root partition of the base partition table has no size
+	assert.Equal(t, []disk.LayoutResize{
+		{Rule: "required directory sizes", From: 0, To: 3 * GiB},
+	}, rootLV.Resizes)
+
+	logLV := vg.Children[1]
+	assert.Equal(t, "var_loglv", logLV.Name)
+	assert.Equal(t, uint64(3*GiB), logLV.Size)
+	assert.Equal(t, "filesystem customizations (new mountpoints)", logLV.Origin)
+	require.Len(t, logLV.Children, 1)
+	assert.Equal(t, "/var/log", logLV.Children[0].Mountpoint)
+	assert.Equal(t, "filesystem customizations (new mountpoints)", logLV.Children[0].Origin)
+}
+
+func TestExplainNewCustomPartitionTable(t *testing.T) {
+	customizations := &blueprint.DiskCustomization{
+		Partitions: []blueprint.PartitionCustomization{
+			{
+				MinSize: 2 * GiB,
+				FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+					Mountpoint: "/data",
+					FSType:     "ext4",
+				},
+			},
+			{
+				Type:    "lvm",
+				MinSize: 5 * GiB,
+				VGCustomization: blueprint.VGCustomization{
+					Name: "vg0",
+					LogicalVolumes: []blueprint.LVCustomization{
+						{
+							MinSize: 1 * GiB,
+							FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+								Mountpoint: "/home",
+								FSType:     "xfs",
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	options := &disk.CustomPartitionTableOptions{
+		BootMode:      platform.BOOT_UEFI,
+		DefaultFSType: disk.FS_XFS,
+		Architecture:  arch.ARCH_X86_64,
+	}
+
+	/* #nosec G404 */
+	expected, err := disk.NewCustomPartitionTable(customizations, options, rand.New(rand.NewSource(13)))
+	require.NoError(t, err)
+	/* #nosec G404 */
+	pt, explanation, err := disk.ExplainNewCustomPartitionTable(customizations, options, rand.New(rand.NewSource(13)))
+	require.NoError(t, err)
+	// explaining must not change the result
+	assert.Equal(t, expected, pt)
+
+	layout := explanation.Layout(pt)
+
+	origins := make(map[string]string)
+	for _, ent := range layout.Entities {
+		require.NotEmpty(t, ent.Children)
+		payload := ent.Children[0]
+		switch {
+		case payload.Mountpoint != "":
+			origins[payload.Mountpoint] = ent.Origin
+		case payload.Entity == "lvm":
+			origins[payload.Name] = ent.Origin
+			require.NotEmpty(t, payload.Children)
+			for _, lv := range payload.Children {
+				require.Len(t, lv.Children, 1)
+				origins[lv.Children[0].Mountpoint] = lv.Origin
+			}
+		}
+	}
+	assert.Equal(t, map[string]string{
+		"/boot/efi": "boot partitions (uefi boot mode)",
+		"/boot":     "/boot partition (required by lvm or btrfs)",
+		"/data":     `disk customizations (main disk, partition 1 "/data")`,
+		"vg0":       `disk customizations (main disk, partition 2 lvm "vg0")`,
+		"/home":     `disk customizations (main disk, partition 2 lvm "vg0")`,
+		"/":         "root filesystem",
+	}, origins)
+}
+
+func TestExplainNewCustomPartitionTableSameEntities(t *testing.T) {
+	swap := blueprint.PartitionCustomization{
+		MinSize: 1 * GiB,
+		FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+			FSType: "swap",
+		},
+	}
+	customizations := &blueprint.DiskCustomization{
+		Partitions: []blueprint.PartitionCustomization{swap, swap},
+	}
+	options := &disk.CustomPartitionTableOptions{
+		BootMode:      platform.BOOT_UEFI,
+		DefaultFSType: disk.FS_XFS,
+		Architecture:  arch.ARCH_X86_64,
+	}
+
+	/* #nosec G404 */
+	pt, explanation, err := disk.ExplainNewCustomPartitionTable(customizations, options, rand.New(rand.NewSource(13)))
+	require.NoError(t, err)
+	layout := explanation.Layout(pt)
+
+	// entities of the same kind keep their own history
+	var origins []string
+	for _, ent := range layout.Entities {
+		require.NotEmpty(t, ent.Children)
+		if ent.Children[0].Entity == "swap" {
+			origins = append(origins, ent.Origin, ent.Children[0].Origin)
+		}
+	}
+	assert.Equal(t, []string{
+		`disk customizations (main disk, partition 1 swap)`,
+		`disk customizations (main disk, partition 1 swap)`,
+		`disk customizations (main disk, partition 2 swap)`,
+		`disk customizations (main disk, partition 2 swap)`,
+	}, origins)
+}
+
+func TestExplainNewCustomAdditionalDisks(t *testing.T) {
+	customizations := &blueprint.DiskCustomization{
+		AdditionalDisks: []blueprint.DiskCustomization{
+			{
+				Name:    "data",
+				MinSize: 20 * GiB,
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						MinSize: 3 * GiB,
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/data",
+							FSType:     "ext4",
+						},
+					},
+				},
+			},
+		},
+	}
+	options := &disk.CustomPartitionTableOptions{
+		BootMode:      platform.BOOT_UEFI,
+		DefaultFSType: disk.FS_XFS,
+		Architecture:  arch.ARCH_X86_64,
+	}
+
+	/* #nosec G404 */
+	pt, err := disk.NewCustomPartitionTable(customizations, options, rand.New(rand.NewSource(13)))
+	require.NoError(t, err)
+	/* #nosec G404 */
+	expected, err := disk.NewCustomAdditionalDisks(customizations, pt, options, rand.New(rand.NewSource(13)))
+	require.NoError(t, err)
+	/* #nosec G404 */
+	disks, explanations, err := disk.ExplainNewCustomAdditionalDisks(customizations, pt, options, rand.New(rand.NewSource(13)))
+	require.NoError(t, err)
+	// explaining must not change the result
+	assert.Equal(t, expected, disks)
+	require.Len(t, explanations, 1)
+
+	// the layout is created from the final partition table
+	data := disks[0].PartitionTable
+	data.DeriveUUIDs(uuid.MustParse("a95e3db4-8ee5-4cd8-b6b4-53c5d2c6e9a2"), nil)
+	layout := explanations[0].Layout(data)
+	assert.Equal(t, uint64(20*GiB), layout.Size)
+	assert.Equal(t, data.UUID, layout.UUID)
+	require.Len(t, layout.Entities, 1)
+	part := layout.Entities[0]
+	assert.Equal(t, `disk customizations (additional disk 1 "data", partition 1 "/data")`, part.Origin)
+	require.Len(t, part.Children, 1)
+	assert.Equal(t, data.Partitions[0].Payload.(*disk.Filesystem).UUID, part.Children[0].UUID)
+	require.NotEmpty(t, part.Resizes)
+	assert.Equal(t, "relayout (alignment and disk size)", part.Resizes[len(part.Resizes)-1].Rule)
+}
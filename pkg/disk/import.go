@@ -0,0 +1,287 @@
+package disk
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/google/uuid"
+)
+
+// sfdiskDump is the output of `sfdisk --json`
+type sfdiskDump struct {
+	PartitionTable *sfdiskPartitionTable `json:"partitiontable"`
+}
+
+type sfdiskPartitionTable struct {
+	Label      string            `json:"label"`
+	ID         string            `json:"id"`
+	Unit       string            `json:"unit"`
+	LastLBA    uint64            `json:"lastlba"`
+	SectorSize uint64            `json:"sectorsize"`
+	Partitions []sfdiskPartition `json:"partitions"`
+}
+
+type sfdiskPartition struct {
+	Node     string `json:"node"`
+	Start    uint64 `json:"start"`
+	Size     uint64 `json:"size"`
+	Type     string `json:"type"`
+	UUID     string `json:"uuid"`
+	Name     string `json:"name"`
+	Attrs    string `json:"attrs"`
+	Bootable bool   `json:"bootable"`
+}
+
+// NewPartitionTableFromSfdiskJSON creates a partition table from the output
+// of `sfdisk --json`. The partition types, UUIDs, labels, start offsets, and
+// sizes are preserved; the partitions have no payloads since sfdisk does not
+// know about their content.
+//
+// The partition table has a fixed layout (see PartitionTable.FixedLayout):
+// when it is used as the base partition table of an image type, the start
+// offsets, sizes, and the order of the partitions are kept exactly and
+// [NewPartitionTable] fails if partitions overlap.
+func NewPartitionTableFromSfdiskJSON(data []byte) (*PartitionTable, error) {
+	var dump sfdiskDump
+	if err := json.Unmarshal(data, &dump); err != nil {
+		return nil, fmt.Errorf("cannot parse sfdisk dump: %w", err)
+	}
+	spt := dump.PartitionTable
+	if spt == nil {
+		return nil, fmt.Errorf("cannot parse sfdisk dump: no partition table found")
+	}
+	if spt.Unit != "" && spt.Unit != "sectors" {
+		return nil, fmt.Errorf("unsupported sfdisk unit %q (must be \"sectors\")", spt.Unit)
+	}
+
+	ptType, err := NewPartitionTableType(spt.Label)
+	if err != nil {
+		return nil, err
+	}
+	if ptType == PT_NONE {
+		return nil, fmt.Errorf("cannot parse sfdisk dump: no partition table type found")
+	}
+	if err := ValidateSectorSize(spt.SectorSize); err != nil {
+		return nil, err
+	}
+
+	pt := &PartitionTable{
+		Type:        ptType,
+		UUID:        spt.ID,
+		SectorSize:  spt.SectorSize,
+		FixedLayout: true,
+	}
+	if pt.SectorSize == DefaultSectorSize {
+		pt.SectorSize = 0
+	}
+
+	for _, sp := range spt.Partitions {
+		part := Partition{
+			Start: pt.SectorsToBytes(sp.Start),
+			Size:  pt.SectorsToBytes(sp.Size),
+		}
+		switch ptType {
+		case PT_GPT:
+			part.Type = strings.ToUpper(sp.Type)
+			part.UUID = strings.ToUpper(sp.UUID)
+			part.Label = sp.Name
+			part.Bootable = slices.Contains(strings.Fields(sp.Attrs), "LegacyBIOSBootable")
+		case PT_DOS:
+			id, err := strconv.ParseUint(sp.Type, 16, 8)
+			if err != nil {
+				return nil, fmt.Errorf("invalid type %q of partition %s: %w", sp.Type, sp.Node, err)
+			}
+			if isDOSExtendedType(id) {
+				return nil, fmt.Errorf("partition %s: extended partitions are not supported", sp.Node)
+			}
+			part.Type = fmt.Sprintf("%02x", id)
+			part.Bootable = sp.Bootable
+		}
+		pt.Partitions = append(pt.Partitions, part)
+	}
+
+	if ptType == PT_GPT && spt.LastLBA > 0 {
+		// the secondary header follows the last usable sector
+		pt.Size = pt.SectorsToBytes(spt.LastLBA+1) + pt.FooterSize()
+	} else {
+		pt.Size = pt.partitionsEnd()
+	}
+
+	return pt, nil
+}
+
+// gptSignature is the signature of a GPT header ("EFI PART")
+var gptSignature = []byte("EFI PART")
+
+const (
+	// minimum size of a GPT header (revision 1.0)
+	gptHeaderSize = 92
+	// minimum size of a GPT partition entry, the size must be this value
+	// multiplied by a power of two
+	gptEntrySize = 128
+	// maximum size of a GPT partition entry that is read
+	gptMaxEntrySize = 4096
+	// maximum number of GPT partition entries that are read
+	gptMaxEntries = 1024
+	// GPT partition attribute bit 2: Legacy BIOS bootable
+	gptAttrLegacyBIOSBootable = uint64(1) << 2
+)
+
+// NewPartitionTableFromGPT reads the GPT partition table of a disk image,
+// e.g. a raw image file. The sector size (512 or 4096 bytes) is detected
+// from the position of the primary GPT header. The partition types, UUIDs,
+// labels, start offsets, and sizes are preserved; the partitions have no
+// payloads. See [NewPartitionTableFromSfdiskJSON] for how the partition table
+// can be used.
+func NewPartitionTableFromGPT(r io.ReaderAt) (*PartitionTable, error) {
+	var header []byte
+	var sectorSize uint64
+	for _, ss := range []uint64{DefaultSectorSize, SectorSize4Kn} {
+		buf := make([]byte, ss)
+		if _, err := r.ReadAt(buf, int64(ss)); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("cannot read gpt header: %w", err)
+		}
+		if bytes.HasPrefix(buf, gptSignature) {
+			header = buf
+			sectorSize = ss
+			break
+		}
+	}
+	if header == nil {
+		return nil, fmt.Errorf("no gpt partition table found")
+	}
+
+	headerSize := binary.LittleEndian.Uint32(header[12:16])
+	if headerSize < gptHeaderSize || uint64(headerSize) > sectorSize {
+		return nil, fmt.Errorf("invalid gpt header size %d", headerSize)
+	}
+	checked := bytes.Clone(header[:headerSize])
+	binary.LittleEndian.PutUint32(checked[16:20], 0)
+	if crc32.ChecksumIEEE(checked) != binary.LittleEndian.Uint32(header[16:20]) {
+		return nil, fmt.Errorf("invalid gpt header checksum")
+	}
+
+	backupLBA := binary.LittleEndian.Uint64(header[32:40])
+	diskGUID := gptGUID(header[56:72])
+	entriesLBA := binary.LittleEndian.Uint64(header[72:80])
+	numEntries := binary.LittleEndian.Uint32(header[80:84])
+	entrySize := binary.LittleEndian.Uint32(header[84:88])
+	if !validGPTEntrySize(entrySize) || numEntries > gptMaxEntries {
+		return nil, fmt.Errorf("unsupported gpt partition entries (%d entries of %d bytes)", numEntries, entrySize)
+	}
+
+	entries := make([]byte, uint64(numEntries)*uint64(entrySize))
+	if _, err := r.ReadAt(entries, int64(entriesLBA*sectorSize)); err != nil {
+		return nil, fmt.Errorf("cannot read gpt partition entries: %w", err)
+	}
+	if crc32.ChecksumIEEE(entries) != binary.LittleEndian.Uint32(header[88:92]) {
+		return nil, fmt.Errorf("invalid gpt partition entries checksum")
+	}
+
+	pt := &PartitionTable{
+		Type:        PT_GPT,
+		UUID:        strings.ToUpper(diskGUID.String()),
+		FixedLayout: true,
+	}
+	if sectorSize != DefaultSectorSize {
+		pt.SectorSize = sectorSize
+	}
+
+	for idx := uint32(0); idx < numEntries; idx++ {
+		entry := entries[idx*entrySize : (idx+1)*entrySize]
+		partType := gptGUID(entry[0:16])
+		if partType == uuid.Nil {
+			// unused entry
+			continue
+		}
+		firstLBA := binary.LittleEndian.Uint64(entry[32:40])
+		lastLBA := binary.LittleEndian.Uint64(entry[40:48])
+		if lastLBA < firstLBA {
+			return nil, fmt.Errorf("invalid gpt partition entry %d: last lba %d before first lba %d", idx+1, lastLBA, firstLBA)
+		}
+		attrs := binary.LittleEndian.Uint64(entry[48:56])
+
+		pt.Partitions = append(pt.Partitions, Partition{
+			Start:    pt.SectorsToBytes(firstLBA),
+			Size:     pt.SectorsToBytes(lastLBA - firstLBA + 1),
+			Type:     strings.ToUpper(partType.String()),
+			UUID:     strings.ToUpper(gptGUID(entry[16:32]).String()),
+			Label:    gptPartitionName(entry[56:128]),
+			Bootable: attrs&gptAttrLegacyBIOSBootable != 0,
+		})
+	}
+
+	// the secondary header is the last sector of the disk
+	pt.Size = pt.SectorsToBytes(backupLBA + 1)
+	if end := pt.partitionsEnd(); end > pt.Size {
+		pt.Size = end
+	}
+
+	return pt, nil
+}
+
+// validGPTEntrySize returns true if size is a valid size of a GPT partition
+// entry that is supported, i.e. 128 multiplied by a power of two and at most
+// gptMaxEntrySize.
+func validGPTEntrySize(size uint32) bool {
+	if size < gptEntrySize || size > gptMaxEntrySize || size%gptEntrySize != 0 {
+		return false
+	}
+	n := size / gptEntrySize
+	return n&(n-1) == 0
+}
+
+// gptGUID converts a GUID as stored on disk (mixed endian) to a UUID.
+func gptGUID(b []byte) uuid.UUID {
+	var u uuid.UUID
+	// the first three fields are stored little endian
+	u[0], u[1], u[2], u[3] = b[3], b[2], b[1], b[0]
+	u[4], u[5] = b[5], b[4]
+	u[6], u[7] = b[7], b[6]
+	copy(u[8:], b[8:16])
+	return u
+}
+
+// gptPartitionName decodes the UTF-16LE name of a GPT partition entry.
+func gptPartitionName(b []byte) string {
+	name := make([]uint16, 0, len(b)/2)
+	for idx := 0; idx+1 < len(b); idx += 2 {
+		c := binary.LittleEndian.Uint16(b[idx:])
+		if c == 0 {
+			break
+		}
+		name = append(name, c)
+	}
+	return string(utf16.Decode(name))
+}
+
+// isDOSExtendedType returns true for the DOS partition type IDs of extended
+// partitions, which cannot be represented by a PartitionTable.
+func isDOSExtendedType(id uint64) bool {
+	switch id {
+	case 0x05, 0x0f, 0x85:
+		return true
+	}
+	return false
+}
+
+// partitionsEnd returns the offset (in bytes) of the end of the last
+// partition.
+func (pt *PartitionTable) partitionsEnd() uint64 {
+	var end uint64
+	for _, part := range pt.Partitions {
+		if part.Start+part.Size > end {
+			end = part.Start + part.Size
+		}
+	}
+	return end
+}
@@ -0,0 +1,386 @@
+package disk_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"math/rand"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+
+	"github.com/osbuild/images/pkg/arch"
+	"github.com/osbuild/images/pkg/disk"
+)
+
+// output of `sfdisk --json` for a 10 GiB disk image
+const sfdiskGPTDump = `{
+   "partitiontable": {
+      "label": "gpt",
+      "id": "D209C89E-EA5E-4FBD-B161-B461CCE297E0",
+      "device": "disk.img",
+      "unit": "sectors",
+      "firstlba": 2048,
+      "lastlba": 20971486,
+      "sectorsize": 512,
+      "partitions": [
+         {
+            "node": "disk.img1",
+            "start": 2048,
+            "size": 2048,
+            "type": "21686148-6449-6E6F-744E-656564454649",
+            "uuid": "FAC7F1FB-3E8D-4137-A512-961DE09A5549",
+            "name": "bios-boot",
+            "attrs": "LegacyBIOSBootable"
+         },{
+            "node": "disk.img2",
+            "start": 4096,
+            "size": 409600,
+            "type": "C12A7328-F81F-11D2-BA4B-00A0C93EC93B",
+            "uuid": "68B2905B-DF3E-4FB3-80FA-49D1E773AA33",
+            "name": "EFI System Partition"
+         },{
+            "node": "disk.img3",
+            "start": 413696,
+            "size": 2097152,
+            "type": "0FC63DAF-8483-4772-8E79-3D69D8477DE4",
+            "uuid": "CB07C243-BC44-4717-853E-28852021225B",
+            "name": "boot"
+         },{
+            "node": "disk.img4",
+            "start": 2510848,
+            "size": 18460639,
+            "type": "0FC63DAF-8483-4772-8E79-3D69D8477DE4",
+            "uuid": "6264D520-3FB9-423F-8AB8-7A0A8E3D3562",
+            "name": "root"
+         }
+      ]
+   }
+}`
+
+var importedGPT = disk.PartitionTable{
+	Type:        disk.PT_GPT,
+	FixedLayout: true,
+	UUID:        "D209C89E-EA5E-4FBD-B161-B461CCE297E0",
+	Size:        10 * GiB,
+	Partitions: []disk.Partition{
+		{
+			Start:    1 * MiB,
+			Size:     1 * MiB,
+			Type:     disk.BIOSBootPartitionGUID,
+			UUID:     "FAC7F1FB-3E8D-4137-A512-961DE09A5549",
+			Label:    "bios-boot",
+			Bootable: true,
+		},
+		{
+			Start: 2 * MiB,
+			Size:  200 * MiB,
+			Type:  disk.EFISystemPartitionGUID,
+			UUID:  "68B2905B-DF3E-4FB3-80FA-49D1E773AA33",
+			Label: "EFI System Partition",
+		},
+		{
+			Start: 202 * MiB,
+			Size:  1 * GiB,
+			Type:  disk.FilesystemDataGUID,
+			UUID:  "CB07C243-BC44-4717-853E-28852021225B",
+			Label: "boot",
+		},
+		{
+			Start: 1226 * MiB,
+			Size:  18460639 * 512,
+			Type:  disk.FilesystemDataGUID,
+			UUID:  "6264D520-3FB9-423F-8AB8-7A0A8E3D3562",
+			Label: "root",
+		},
+	},
+}
+
+func TestNewPartitionTableFromSfdiskJSONGPT(t *testing.T) {
+	pt, err := disk.NewPartitionTableFromSfdiskJSON([]byte(sfdiskGPTDump))
+	require.NoError(t, err)
+	assert.Equal(t, &importedGPT, pt)
+
+	// the imported partition table can be used in image definitions
+	out, err := yaml.Marshal(pt)
+	require.NoError(t, err)
+	var fromYAML disk.PartitionTable
+	require.NoError(t, yaml.Unmarshal(out, &fromYAML))
+	assert.Equal(t, &importedGPT, &fromYAML)
+}
+
+func TestNewPartitionTableFromSfdiskJSONDOS(t *testing.T) {
+	dump := `{
+   "partitiontable": {
+      "label": "dos",
+      "id": "0x14fc63d2",
+      "device": "disk.img",
+      "unit": "sectors",
+      "sectorsize": 512,
+      "partitions": [
+         {
+            "node": "disk.img1",
+            "start": 2048,
+            "size": 1048576,
+            "type": "83",
+            "bootable": true
+         },{
+            "node": "disk.img2",
+            "start": 1050624,
+            "size": 8192,
+            "type": "6"
+         }
+      ]
+   }
+}`
+	pt, err := disk.NewPartitionTableFromSfdiskJSON([]byte(dump))
+	require.NoError(t, err)
+	assert.Equal(t, &disk.PartitionTable{
+		Type:        disk.PT_DOS,
+		UUID:        "0x14fc63d2",
+		FixedLayout: true,
+		Size:        517 * MiB,
+		Partitions: []disk.Partition{
+			{
+				Start:    1 * MiB,
+				Size:     512 * MiB,
+				Type:     disk.FilesystemLinuxDOSID,
+				Bootable: true,
+			},
+			{
+				Start: 513 * MiB,
+				Size:  4 * MiB,
+				Type:  disk.FAT16BDOSID,
+			},
+		},
+	}, pt)
+}
+
+func TestNewPartitionTableFromSfdiskJSONErrors(t *testing.T) {
+	testCases := map[string]struct {
+		dump string
+		err  string
+	}{
+		"bad-json": {
+			dump: `{"partitiontable": [`,
+			err:  "cannot parse sfdisk dump: unexpected end of JSON input",
+		},
+		"no-partition-table": {
+			dump: `{}`,
+			err:  "cannot parse sfdisk dump: no partition table found",
+		},
+		"unit": {
+			dump: `{"partitiontable": {"label": "gpt", "unit": "bytes"}}`,
+			err:  `unsupported sfdisk unit "bytes" (must be "sectors")`,
+		},
+		"label": {
+			dump: `{"partitiontable": {"label": "sun", "unit": "sectors"}}`,
+			err:  "unknown or unsupported partition table type name: sun",
+		},
+		"sector-size": {
+			dump: `{"partitiontable": {"label": "gpt", "unit": "sectors", "sectorsize": 2048}}`,
+			err:  "unsupported sector size 2048 (must be 512 or 4096)",
+		},
+		"extended": {
+			dump: `{"partitiontable": {"label": "dos", "unit": "sectors", "partitions": [{"node": "disk.img1", "start": 2048, "size": 2048, "type": "5"}]}}`,
+			err:  "partition disk.img1: extended partitions are not supported",
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := disk.NewPartitionTableFromSfdiskJSON([]byte(tc.dump))
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+}
+
+// putGUID writes the UUID in the mixed endian GPT format
+func putGUID(b []byte, s string) {
+	u := uuid.MustParse(s)
+	b[0], b[1], b[2], b[3] = u[3], u[2], u[1], u[0]
+	b[4], b[5] = u[5], u[4]
+	b[6], b[7] = u[7], u[6]
+	copy(b[8:16], u[8:])
+}
+
+// makeGPTImage returns the start of a disk image with a primary GPT for the
+// partition table.
+func makeGPTImage(pt *disk.PartitionTable) []byte {
+	ss := pt.GetSectorSize()
+	entries := make([]byte, 128*128)
+	for idx, part := range pt.Partitions {
+		entry := entries[idx*128 : (idx+1)*128]
+		putGUID(entry[0:16], part.Type)
+		putGUID(entry[16:32], part.UUID)
+		binary.LittleEndian.PutUint64(entry[32:40], pt.BytesToSectors(part.Start))
+		binary.LittleEndian.PutUint64(entry[40:48], pt.BytesToSectors(part.Start+part.Size)-1)
+		if part.Bootable {
+			binary.LittleEndian.PutUint64(entry[48:56], 1<<2)
+		}
+		for cidx, c := range utf16.Encode([]rune(part.Label)) {
+			binary.LittleEndian.PutUint16(entry[56+2*cidx:], c)
+		}
+	}
+
+	header := make([]byte, 92)
+	copy(header[0:8], "EFI PART")
+	binary.LittleEndian.PutUint32(header[8:12], 0x00010000)
+	binary.LittleEndian.PutUint32(header[12:16], 92)
+	binary.LittleEndian.PutUint64(header[24:32], 1)
+	binary.LittleEndian.PutUint64(header[32:40], pt.BytesToSectors(pt.Size)-1)
+	putGUID(header[56:72], pt.UUID)
+	binary.LittleEndian.PutUint64(header[72:80], 2)
+	binary.LittleEndian.PutUint32(header[80:84], 128)
+	binary.LittleEndian.PutUint32(header[84:88], 128)
+	binary.LittleEndian.PutUint32(header[88:92], crc32.ChecksumIEEE(entries))
+	binary.LittleEndian.PutUint32(header[16:20], crc32.ChecksumIEEE(header))
+
+	img := make([]byte, 2*ss+uint64(len(entries)))
+	copy(img[ss:], header)
+	copy(img[2*ss:], entries)
+	return img
+}
+
+func TestNewPartitionTableFromGPT(t *testing.T) {
+	pt, err := disk.NewPartitionTableFromGPT(bytes.NewReader(makeGPTImage(&importedGPT)))
+	require.NoError(t, err)
+	assert.Equal(t, &importedGPT, pt)
+}
+
+func TestNewPartitionTableFromGPT4Kn(t *testing.T) {
+	expected := importedGPT.Clone().(*disk.PartitionTable)
+	expected.SectorSize = disk.SectorSize4Kn
+	expected.Partitions[3].Size = 10*GiB - expected.Partitions[3].Start - expected.FooterSize()
+
+	pt, err := disk.NewPartitionTableFromGPT(bytes.NewReader(makeGPTImage(expected)))
+	require.NoError(t, err)
+	assert.Equal(t, expected, pt)
+}
+
+func TestNewPartitionTableFromGPTErrors(t *testing.T) {
+	_, err := disk.NewPartitionTableFromGPT(bytes.NewReader(make([]byte, 8192)))
+	assert.EqualError(t, err, "no gpt partition table found")
+
+	img := makeGPTImage(&importedGPT)
+	img[512+24]++
+	_, err = disk.NewPartitionTableFromGPT(bytes.NewReader(img))
+	assert.EqualError(t, err, "invalid gpt header checksum")
+
+	img = makeGPTImage(&importedGPT)
+	img[2*512+32]++
+	_, err = disk.NewPartitionTableFromGPT(bytes.NewReader(img))
+	assert.EqualError(t, err, "invalid gpt partition entries checksum")
+
+	for _, entrySize := range []uint32{0, 64, 192, 384, 8192} {
+		img = makeGPTImage(&importedGPT)
+		header := img[512 : 512+92]
+		binary.LittleEndian.PutUint32(header[84:88], entrySize)
+		binary.LittleEndian.PutUint32(header[16:20], 0)
+		binary.LittleEndian.PutUint32(header[16:20], crc32.ChecksumIEEE(header))
+		_, err = disk.NewPartitionTableFromGPT(bytes.NewReader(img))
+		assert.EqualError(t, err, fmt.Sprintf("unsupported gpt partition entries (128 entries of %d bytes)", entrySize))
+	}
+}
+
+// importedBasePT returns the imported GPT partition table with filesystems
+// on the partitions, the root filesystem on partition rootIdx and /boot on
+// the other partition.
+func importedBasePT(t *testing.T, rootIdx int) *disk.PartitionTable {
+	basePT, err := disk.NewPartitionTableFromSfdiskJSON([]byte(sfdiskGPTDump))
+	require.NoError(t, err)
+	basePT.Partitions[1].Payload = &disk.Filesystem{
+		Type:       "vfat",
+		Mountpoint: "/boot/efi",
+	}
+	for _, idx := range []int{2, 3} {
+		mountpoint := "/boot"
+		if idx == rootIdx {
+			mountpoint = "/"
+		}
+		basePT.Partitions[idx].Payload = &disk.Filesystem{
+			Type:       "xfs",
+			Mountpoint: mountpoint,
+		}
+	}
+	return basePT
+}
+
+func TestNewPartitionTableFromImportedBase(t *testing.T) {
+	basePT := importedBasePT(t, 3)
+
+	/* #nosec G404 */
+	pt, err := disk.NewPartitionTable(basePT, nil, basePT.Size, disk.RawPartitioningMode, arch.ARCH_X86_64, nil, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+
+	// the layout is reproduced exactly
+	assert.Equal(t, importedGPT.Size, pt.Size)
+	assert.Equal(t, importedGPT.UUID, pt.UUID)
+	require.Len(t, pt.Partitions, len(importedGPT.Partitions))
+	for idx, part := range pt.Partitions {
+		expected := importedGPT.Partitions[idx]
+		assert.Equal(t, expected.Start, part.Start)
+		assert.Equal(t, expected.Size, part.Size)
+		assert.Equal(t, expected.Type, part.Type)
+		assert.Equal(t, expected.UUID, part.UUID)
+		assert.Equal(t, expected.Label, part.Label)
+	}
+}
+
+func TestNewPartitionTableFromImportedBaseGrow(t *testing.T) {
+	testCases := map[string]struct {
+		rootIdx  int
+		lastSize uint64
+	}{
+		// the root partition is the last partition and takes the extra space
+		"root-last": {
+			rootIdx:  3,
+			lastSize: importedGPT.Partitions[3].Size + 2*GiB,
+		},
+		// the root partition is not moved to the end and keeps its size
+		"root-not-last": {
+			rootIdx:  2,
+			lastSize: importedGPT.Partitions[3].Size,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			basePT := importedBasePT(t, tc.rootIdx)
+			/* #nosec G404 */
+			pt, err := disk.NewPartitionTable(basePT, nil, 12*GiB, disk.RawPartitioningMode, arch.ARCH_X86_64, map[string]uint64{}, rand.New(rand.NewSource(0)))
+			require.NoError(t, err)
+
+			assert.Equal(t, uint64(12*GiB), pt.Size)
+			require.Len(t, pt.Partitions, len(importedGPT.Partitions))
+			for idx, part := range pt.Partitions {
+				expected := importedGPT.Partitions[idx]
+				assert.Equal(t, expected.UUID, part.UUID)
+				assert.Equal(t, expected.Start, part.Start)
+				if idx < len(pt.Partitions)-1 {
+					assert.Equal(t, expected.Size, part.Size)
+				}
+			}
+			assert.Equal(t, tc.lastSize, pt.Partitions[3].Size)
+		})
+	}
+}
+
+func TestNewPartitionTableFromImportedBaseOverlap(t *testing.T) {
+	basePT := importedBasePT(t, 3)
+	basePT.Partitions[2].Size += 1 * MiB
+	/* #nosec G404 */
+	_, err := disk.NewPartitionTable(basePT, nil, basePT.Size, disk.RawPartitioningMode, arch.ARCH_X86_64, nil, rand.New(rand.NewSource(0)))
+	assert.EqualError(t, err, "partition 4 (start 1285554176) overlaps partition 3 (end 1286602752)")
+
+	basePT = importedBasePT(t, 3)
+	basePT.Partitions[0].Start = 512
+	/* #nosec G404 */
+	_, err = disk.NewPartitionTable(basePT, nil, basePT.Size, disk.RawPartitioningMode, arch.ARCH_X86_64, nil, rand.New(rand.NewSource(0)))
+	assert.EqualError(t, err, "partition 1 (start 512) overlaps the partition table header (end 17408)")
+}
@@ -176,6 +176,41 @@ func (vg *LVMVolumeGroup) minSize(size uint64) uint64 {
 	return vg.AlignUp(size)
 }
 
+// GrowLogicalVolume returns the first logical volume that is marked to grow.
+func (vg *LVMVolumeGroup) GrowLogicalVolume() *LVMLogicalVolume {
+	for idx := range vg.LogicalVolumes {
+		if vg.LogicalVolumes[idx].Grow {
+			return &vg.LogicalVolumes[idx]
+		}
+	}
+	return nil
+}
+
+// growTo grows the logical volume that is marked to grow (if any), so that
+// the logical volumes fill a volume group of the given size.
+func (vg *LVMVolumeGroup) growTo(size uint64) {
+	grow := vg.GrowLogicalVolume()
+	if grow == nil {
+		return
+	}
+
+	used := vg.MetadataSize()
+	for idx := range vg.LogicalVolumes {
+		if lv := &vg.LogicalVolumes[idx]; lv != grow {
+			used += lv.Size
+		}
+	}
+	if size <= used {
+		return
+	}
+	// logical volumes are made of whole extents
+	free := size - used
+	free -= free % LVMDefaultExtentSize
+	if free > grow.Size {
+		grow.Size = free
+	}
+}
+
 func (vg *LVMVolumeGroup) UnmarshalJSON(data []byte) error {
 	type alias LVMVolumeGroup
 	var tmp alias
@@ -187,8 +222,12 @@ func (vg *LVMVolumeGroup) UnmarshalJSON(data []byte) error {
 }
 
 type LVMLogicalVolume struct {
-	Name    string `json:"name,omitempty" yaml:"name,omitempty"`
-	Size    uint64 `json:"size,omitempty" yaml:"size,omitempty"`
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	Size uint64 `json:"size,omitempty" yaml:"size,omitempty"`
+	// Grow the logical volume to fill the remaining space of the volume
+	// group. The partition of the volume group then grows to fill the
+	// partition table.
+	Grow    bool   `json:"grow,omitempty" yaml:"grow,omitempty"`
 	Payload Entity `json:"payload,omitempty" yaml:"payload,omitempty"`
 }
 
@@ -199,6 +238,7 @@ func (lv *LVMLogicalVolume) Clone() Entity {
 	return &LVMLogicalVolume{
 		Name:    lv.Name,
 		Size:    lv.Size,
+		Grow:    lv.Grow,
 		Payload: lv.Payload.Clone(),
 	}
 }
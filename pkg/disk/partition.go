@@ -25,6 +25,10 @@ type Partition struct {
 	// Partition name (not filesystem label), only supported for GPT
 	Label string `json:"label,omitempty" yaml:"label,omitempty"`
 
+	// Grow the partition to fill the remaining space of the partition
+	// table. By default, the partition of the root filesystem grows.
+	Grow bool `json:"grow,omitempty" yaml:"grow,omitempty"`
+
 	// If nil, the partition is raw; It doesn't contain a payload.
 	Payload PayloadEntity `json:"payload,omitempty" yaml:"payload,omitempty"`
 }
@@ -41,6 +45,7 @@ func (p *Partition) Clone() Entity {
 		Bootable: p.Bootable,
 		UUID:     p.UUID,
 		Label:    p.Label,
+		Grow:     p.Grow,
 	}
 
 	if p.Payload != nil {
@@ -77,6 +82,27 @@ func (p *Partition) fitTo(size uint64) {
 	p.Size = size
 }
 
+// volumeGroup returns the LVM volume group of the partition (if any) and the
+// size of the partition that is available for it.
+func (p *Partition) volumeGroup() (*LVMVolumeGroup, uint64) {
+	switch payload := p.Payload.(type) {
+	case *LVMVolumeGroup:
+		return payload, p.Size
+	case *LUKSContainer:
+		if vg, ok := payload.Payload.(*LVMVolumeGroup); ok && p.Size > payload.MetadataSize() {
+			return vg, p.Size - payload.MetadataSize()
+		}
+	}
+	return nil, 0
+}
+
+// hasGrowLogicalVolume returns true if the partition holds a logical volume
+// that is marked to grow.
+func (p *Partition) hasGrowLogicalVolume() bool {
+	vg, _ := p.volumeGroup()
+	return vg != nil && vg.GrowLogicalVolume() != nil
+}
+
 func (p *Partition) GetSize() uint64 {
 	return p.Size
 }
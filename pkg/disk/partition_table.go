@@ -1,9 +1,12 @@
 package disk
 
 import (
+	"cmp"
+	"encoding/hex"
 	"fmt"
 	"math/rand"
 	"path/filepath"
+	"slices"
 
 	"github.com/google/uuid"
 
@@ -29,6 +32,10 @@ type PartitionTable struct {
 	ExtraPadding uint64 `json:"extra_padding,omitempty" yaml:"extra_padding,omitempty"`
 	// Starting offset of the first partition in the table (in bytes)
 	StartOffset uint64 `json:"start_offset,omitempty" yaml:"start_offset,omitempty"`
+	// Keep the start offsets, sizes, and order of the partitions instead of
+	// laying them out again, e.g. for partition tables that must match an
+	// existing layout.
+	FixedLayout bool `json:"fixed_layout,omitempty" yaml:"fixed_layout,omitempty"`
 }
 
 type PartitioningMode string
@@ -111,7 +118,15 @@ const DefaultBootPartitionSize = 1 * datasizes.GiB
 // partition table. Logical Volumes are not grown to fill the space in the
 // Volume Group since they are trivial to grow on a live system.
 func NewPartitionTable(basePT *PartitionTable, mountpoints []blueprint.FilesystemCustomization, imageSize uint64, mode PartitioningMode, architecture arch.Arch, requiredSizes map[string]uint64, rng *rand.Rand) (*PartitionTable, error) {
+	return newPartitionTable(basePT, mountpoints, imageSize, mode, architecture, requiredSizes, rng, nil)
+}
+
+// newPartitionTable implements NewPartitionTable, the steps that modify the
+// partition table are recorded in rec if it is not nil (see
+// ExplainNewPartitionTable).
+func newPartitionTable(basePT *PartitionTable, mountpoints []blueprint.FilesystemCustomization, imageSize uint64, mode PartitioningMode, architecture arch.Arch, requiredSizes map[string]uint64, rng *rand.Rand, rec *Explanation) (*PartitionTable, error) {
 	newPT := basePT.Clone().(*PartitionTable)
+	rec.record(newPT, "base partition table")
 
 	if basePT.features().LVM && (mode == RawPartitioningMode || mode == BtrfsPartitioningMode) {
 		return nil, fmt.Errorf("%s partitioning mode set for a base partition table with LVM, this is unsupported", mode)
@@ -119,6 +134,7 @@ func NewPartitionTable(basePT *PartitionTable, mountpoints []blueprint.Filesyste
 
 	// first pass: enlarge existing mountpoints and collect new ones
 	newMountpoints, _ := newPT.applyCustomization(mountpoints, false)
+	rec.record(newPT, "filesystem customizations (existing mountpoints)")
 
 	var ensureLVM, ensureBtrfs bool
 	switch mode {
@@ -138,11 +154,13 @@ func NewPartitionTable(basePT *PartitionTable, mountpoints []blueprint.Filesyste
 		if err != nil {
 			return nil, err
 		}
+		rec.record(newPT, fmt.Sprintf("lvm conversion (%s partitioning mode)", modeName(mode)))
 	} else if ensureBtrfs {
 		err := newPT.ensureBtrfs(architecture)
 		if err != nil {
 			return nil, err
 		}
+		rec.record(newPT, fmt.Sprintf("btrfs conversion (%s partitioning mode)", modeName(mode)))
 	}
 
 	// second pass: deal with new mountpoints and newly created ones, after switching to
@@ -151,6 +169,7 @@ func NewPartitionTable(basePT *PartitionTable, mountpoints []blueprint.Filesyste
 	if err != nil {
 		return nil, err
 	}
+	rec.record(newPT, "filesystem customizations (new mountpoints)")
 
 	// If no separate requiredSizes are given then we use our defaults
 	if requiredSizes == nil {
@@ -162,10 +181,18 @@ func NewPartitionTable(basePT *PartitionTable, mountpoints []blueprint.Filesyste
 
 	if len(requiredSizes) != 0 {
 		newPT.EnsureDirectorySizes(requiredSizes)
+		rec.record(newPT, "required directory sizes")
 	}
 
 	// Calculate partition table offsets and sizes
-	newPT.relayout(imageSize)
+	if newPT.FixedLayout {
+		if err := newPT.keepLayout(imageSize); err != nil {
+			return nil, err
+		}
+	} else {
+		newPT.relayout(imageSize)
+	}
+	rec.record(newPT, "relayout (alignment and image size)")
 
 	// Generate new UUIDs for filesystems and partitions
 	newPT.GenerateUUIDs(rng)
@@ -207,6 +234,7 @@ func (pt *PartitionTable) Clone() Entity {
 		SectorSize:   pt.SectorSize,
 		ExtraPadding: pt.ExtraPadding,
 		StartOffset:  pt.StartOffset,
+		FixedLayout:  pt.FixedLayout,
 	}
 
 	for idx, partition := range pt.Partitions {
@@ -240,20 +268,12 @@ func (pt *PartitionTable) AlignUp(size uint64) uint64 {
 
 // Convert the given bytes to the number of sectors.
 func (pt *PartitionTable) BytesToSectors(size uint64) uint64 {
-	sectorSize := pt.SectorSize
-	if sectorSize == 0 {
-		sectorSize = DefaultSectorSize
-	}
-	return size / sectorSize
+	return size / pt.GetSectorSize()
 }
 
 // Convert the given number of sectors to bytes.
 func (pt *PartitionTable) SectorsToBytes(size uint64) uint64 {
-	sectorSize := pt.SectorSize
-	if sectorSize == 0 {
-		sectorSize = DefaultSectorSize
-	}
-	return size * sectorSize
+	return size * pt.GetSectorSize()
 }
 
 // Returns if the partition table contains a filesystem with the given
@@ -288,6 +308,93 @@ func (pt *PartitionTable) GenerateUUIDs(rng *rand.Rand) {
 	}
 }
 
+// DeriveUUIDs replaces the UUIDs of the partition table, its partitions (GPT
+// only), and all entities with UUIDs (see UniqueEntity) with UUIDs that are
+// derived (version 5) from the namespace and the position of the entity in
+// the partition table, e.g. the mountpoint of a filesystem. The UUIDs are
+// therefore independent of the random number generator that was used to
+// create the partition table and stable across builds.
+//
+// UUIDs that are set in keep are not replaced, e.g. the fixed UUIDs of the
+// base partition table of an image type. keep can be nil.
+func (pt *PartitionTable) DeriveUUIDs(namespace uuid.UUID, keep *PartitionTable) {
+	kept := make(map[string]bool)
+	if keep != nil {
+		for _, id := range keep.uuids() {
+			kept[id] = true
+		}
+	}
+
+	if !kept[pt.UUID] {
+		pt.UUID = uuid.NewSHA1(namespace, []byte("partition-table")).String()
+	}
+	walkUniqueLayoutKeys(pt, func(key string, e Entity) {
+		id := uuid.NewSHA1(namespace, []byte(key))
+		switch ent := e.(type) {
+		case *Partition:
+			if pt.Type == PT_GPT && !kept[ent.UUID] {
+				ent.UUID = id.String()
+			}
+		case UniqueEntity:
+			setDerivedUUID(ent, id, kept)
+		}
+	})
+}
+
+// setDerivedUUID sets the UUID of the entity to id unless its current UUID is
+// kept. vfat filesystems use the first 32 bits of id as volume ID.
+func setDerivedUUID(e UniqueEntity, id uuid.UUID, kept map[string]bool) {
+	switch ent := e.(type) {
+	case *Filesystem:
+		if kept[ent.UUID] {
+			return
+		}
+		if ent.Type == "vfat" {
+			ent.UUID = hex.EncodeToString(id[:4])
+		} else {
+			ent.UUID = id.String()
+		}
+	case *Swap:
+		if !kept[ent.UUID] {
+			ent.UUID = id.String()
+		}
+	case *LUKSContainer:
+		if !kept[ent.UUID] {
+			ent.UUID = id.String()
+		}
+	case *Btrfs:
+		if !kept[ent.UUID] {
+			ent.UUID = id.String()
+		}
+		// subvolumes inherit the UUID of the volume
+		for idx := range ent.Subvolumes {
+			ent.Subvolumes[idx].UUID = ent.UUID
+		}
+	default:
+		panic(fmt.Sprintf("cannot derive UUID for entity of type %T; this is a programming error", e))
+	}
+}
+
+// uuids returns the UUIDs of the partition table and all its partitions and
+// entities.
+func (pt *PartitionTable) uuids() []string {
+	ids := []string{pt.UUID}
+	_ = pt.ForEachEntity(func(e Entity, path []Entity) error {
+		switch ent := e.(type) {
+		case *Partition:
+			ids = append(ids, ent.UUID)
+		case FSTabEntity:
+			ids = append(ids, ent.GetFSSpec().UUID)
+		case *LUKSContainer:
+			ids = append(ids, ent.UUID)
+		case *Btrfs:
+			ids = append(ids, ent.UUID)
+		}
+		return nil
+	})
+	return slices.DeleteFunc(ids, func(id string) bool { return id == "" })
+}
+
 func (pt *PartitionTable) GetItemCount() uint {
 	return uint(len(pt.Partitions))
 }
@@ -427,15 +534,48 @@ func (pt *PartitionTable) ForEachEntity(cb EntityCallback) error {
 	return forEachEntity(pt, []Entity{}, cb)
 }
 
-func (pt *PartitionTable) HeaderSize() uint64 {
-	// always reserve one extra sector for the GPT header
-	// this also ensure we have enough space for the MBR
-	header := pt.SectorsToBytes(1)
+// ValidateSectorSize returns an error if the sector size is not supported.
+// Supported are DefaultSectorSize (512), SectorSize4Kn (4096), and 0, which
+// selects the default.
+func ValidateSectorSize(size uint64) error {
+	switch size {
+	case 0, DefaultSectorSize, SectorSize4Kn:
+		return nil
+	}
+	return fmt.Errorf("unsupported sector size %d (must be %d or %d)", size, DefaultSectorSize, SectorSize4Kn)
+}
+
+// GetSectorSize returns the sector size of the partition table in bytes.
+func (pt *PartitionTable) GetSectorSize() uint64 {
+	if pt.SectorSize == 0 {
+		return DefaultSectorSize
+	}
+	return pt.SectorSize
+}
 
+// HeaderSize returns the size of the space that is reserved for the
+// partition table at the start of the disk in bytes: the MBR and, for GPT,
+// the primary GPT header and the partition entries.
+func (pt *PartitionTable) HeaderSize() uint64 {
+	// the first sector holds the MBR, for GPT it is the protective MBR
+	mbr := pt.SectorsToBytes(1)
 	if pt.Type == PT_DOS {
-		return header
+		return mbr
+	}
+	return mbr + pt.FooterSize()
+}
+
+// FooterSize returns the size of the space that is reserved for the
+// secondary GPT header and its partition entries at the end of the disk in
+// bytes. It is zero for other partition table types.
+func (pt *PartitionTable) FooterSize() uint64 {
+	if pt.Type != PT_GPT {
+		return 0
 	}
 
+	// reserve one sector for the GPT header
+	header := pt.SectorsToBytes(1)
+
 	// calculate the space we need for
 	parts := uint64(len(pt.Partitions))
 
@@ -446,8 +586,10 @@ func (pt *PartitionTable) HeaderSize() uint64 {
 
 	// Assume that each partition entry is 128 bytes
 	// which might not be the case if the partition
-	// name exceeds 72 bytes
-	header += parts * 128
+	// name exceeds 72 bytes. The entries occupy full sectors.
+	entries := parts * 128
+	sectorSize := pt.GetSectorSize()
+	header += (entries + sectorSize - 1) / sectorSize * sectorSize
 
 	return header
 }
@@ -481,50 +623,44 @@ func (pt *PartitionTable) applyCustomization(mountpoints []blueprint.FilesystemC
 // Dynamically calculate and update the start point for each of the existing
 // partitions. Adjusts the overall size of image to either the supplied value
 // in `size` or to the sum of all partitions if that is larger. Will grow the
-// root partition if there is any empty space. Returns the updated start point.
+// partition that is marked to grow (see growPartitionIndex) if there is any
+// empty space. Returns the updated start point.
 func (pt *PartitionTable) relayout(size uint64) uint64 {
-	// always reserve one extra sector for the GPT header
 	header := pt.HeaderSize()
-	footer := uint64(0)
-
-	// The GPT header is also at the end of the partition table
-	if pt.Type == PT_GPT {
-		footer = header
-	}
+	// the secondary GPT header is at the end of the partition table
+	footer := pt.FooterSize()
 
 	start := pt.AlignUp(header)
 	start += pt.StartOffset
 	size = pt.AlignUp(size)
 
-	var rootIdx = -1
+	growIdx := pt.growPartitionIndex()
+	if growIdx < 0 {
+		panic("no root filesystem found; this is a programming error")
+	}
 	for idx := range pt.Partitions {
-		partition := &pt.Partitions[idx]
-		if len(entityPath(partition, "/")) != 0 {
-			// keep the root partition index to handle after all the other
+		if idx == growIdx {
+			// the growing partition is handled after all the other
 			// partitions have been moved and resized
-			rootIdx = idx
 			continue
 		}
+		partition := &pt.Partitions[idx]
 		partition.Start = start
 		partition.fitTo(partition.Size)
 		partition.Size = pt.AlignUp(partition.Size)
 		start += partition.Size
 	}
 
-	if rootIdx < 0 {
-		panic("no root filesystem found; this is a programming error")
-	}
-
-	root := &pt.Partitions[rootIdx]
-	root.Start = start
-	root.fitTo(root.Size)
+	grow := &pt.Partitions[growIdx]
+	grow.Start = start
+	grow.fitTo(grow.Size)
 
 	// add the extra padding specified in the partition table
 	footer += pt.ExtraPadding
 
 	// If the sum of all partitions is bigger then the specified size,
 	// we use that instead. Grow the partition table size if needed.
-	end := pt.AlignUp(root.Start + footer + root.Size)
+	end := pt.AlignUp(grow.Start + footer + grow.Size)
 	if end > size {
 		size = end
 	}
@@ -533,16 +669,117 @@ func (pt *PartitionTable) relayout(size uint64) uint64 {
 		pt.Size = size
 	}
 
-	// If there is space left in the partition table, grow root
-	root.Size = pt.Size - root.Start
+	// If there is space left in the partition table, grow the partition
+	grow.Size = pt.Size - grow.Start
 
-	// Finally we shrink the last partition, i.e. the root partition,
+	// Finally we shrink the last partition, i.e. the growing partition,
 	// to leave space for the footer, e.g. the secondary GPT header.
-	root.Size -= footer
+	grow.Size -= footer
+
+	// pass the extra space on to the logical volume that is marked to grow
+	if vg, vgSize := grow.volumeGroup(); vg != nil {
+		vg.growTo(vgSize)
+	}
 
 	return start
 }
 
+// keepLayout is used instead of relayout for partition tables with a fixed
+// layout (see PartitionTable.FixedLayout). The start offsets, sizes, and the
+// order of the partitions are kept; a partition only grows if its payload
+// needs more space. If the partition table is smaller than size, it is
+// enlarged and the partition that grows (see growPartitionIndex) takes the
+// extra space if it is the last partition on the disk. Returns an error if a
+// partition overlaps the partition table header or another partition.
+func (pt *PartitionTable) keepLayout(size uint64) error {
+	header := pt.HeaderSize()
+	// the secondary GPT header is at the end of the partition table
+	footer := pt.FooterSize() + pt.ExtraPadding
+
+	// the partitions in the order of their start offsets
+	order := make([]int, len(pt.Partitions))
+	for idx := range pt.Partitions {
+		pt.Partitions[idx].fitTo(pt.Partitions[idx].Size)
+		order[idx] = idx
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return cmp.Compare(pt.Partitions[a].Start, pt.Partitions[b].Start)
+	})
+
+	end := header
+	prev := -1
+	for _, idx := range order {
+		partition := &pt.Partitions[idx]
+		if partition.Start < end {
+			if prev < 0 {
+				return fmt.Errorf("partition %d (start %d) overlaps the partition table header (end %d)", idx+1, partition.Start, end)
+			}
+			return fmt.Errorf("partition %d (start %d) overlaps partition %d (end %d)", idx+1, partition.Start, prev+1, end)
+		}
+		end = partition.Start + partition.Size
+		prev = idx
+	}
+
+	if end+footer > pt.Size {
+		pt.Size = end + footer
+	}
+
+	growIdx := pt.growPartitionIndex()
+	if growIdx < 0 {
+		return nil
+	}
+	grow := &pt.Partitions[growIdx]
+	if size > pt.Size {
+		if growIdx == prev {
+			grow.Size += size - pt.Size
+		}
+		pt.Size = size
+	}
+
+	// pass the extra space on to the logical volume that is marked to grow
+	if vg, vgSize := grow.volumeGroup(); vg != nil {
+		vg.growTo(vgSize)
+	}
+
+	return nil
+}
+
+// GrowPartition returns the partition that grows to fill the partition table
+// (see growPartitionIndex) or nil if the partition table has no partitions.
+func (pt *PartitionTable) GrowPartition() *Partition {
+	idx := pt.growPartitionIndex()
+	if idx < 0 {
+		return nil
+	}
+	return &pt.Partitions[idx]
+}
+
+// growPartitionIndex returns the index of the partition that grows to fill
+// the partition table, which is placed after all other partitions:
+//   - The partition that is marked to grow or holds a logical volume that is
+//     marked to grow, otherwise
+//   - The partition of the root filesystem, otherwise
+//   - The last partition (e.g. for additional disks, which have no root
+//     filesystem).
+//
+// Returns -1 if the partition table has no partitions.
+func (pt *PartitionTable) growPartitionIndex() int {
+	rootIdx := -1
+	for idx := range pt.Partitions {
+		partition := &pt.Partitions[idx]
+		if partition.Grow || partition.hasGrowLogicalVolume() {
+			return idx
+		}
+		if rootIdx < 0 && len(entityPath(partition, "/")) != 0 {
+			rootIdx = idx
+		}
+	}
+	if rootIdx < 0 {
+		return len(pt.Partitions) - 1
+	}
+	return rootIdx
+}
+
 func (pt *PartitionTable) createFilesystem(mountpoint string, size uint64) error {
 	rootPath := entityPath(pt, "/")
 	if rootPath == nil {
@@ -662,6 +899,20 @@ func (pt *PartitionTable) FindMountable(mountpoint string) Mountable {
 	return path[0].(Mountable)
 }
 
+// ErofsRoot returns the partition that holds the root filesystem if it is an
+// erofs filesystem on a plain partition and nil otherwise. An erofs
+// filesystem cannot be created empty, the image of the filesystem is created
+// from the tree and written into the partition instead.
+func (pt *PartitionTable) ErofsRoot() *Partition {
+	for idx := range pt.Partitions {
+		part := &pt.Partitions[idx]
+		if fs, ok := part.Payload.(*Filesystem); ok && fs.Mountpoint == "/" && fs.Type == "erofs" {
+			return part
+		}
+	}
+	return nil
+}
+
 func clampFSSize(mountpoint string, size uint64) uint64 {
 	// set a minimum size of 1GB for all mountpoints
 	// with the exception for '/boot' (= 500 MB)
@@ -871,8 +1122,11 @@ type partitionTableFeatures struct {
 	XFS   bool
 	FAT   bool
 	EXT4  bool
+	EROFS bool
 	LUKS  bool
 	Swap  bool
+	// Clevis is set if any LUKS container is bound with clevis
+	Clevis bool
 }
 
 // features examines all of the PartitionTable entities and returns a struct
@@ -900,11 +1154,16 @@ func (pt *PartitionTable) features() partitionTableFeatures {
 				ptFeatures.XFS = true
 			case "ext4":
 				ptFeatures.EXT4 = true
+			case "erofs":
+				ptFeatures.EROFS = true
 			}
 		case *Swap:
 			ptFeatures.Swap = true
 		case *LUKSContainer:
 			ptFeatures.LUKS = true
+			if ent.Clevis != nil {
+				ptFeatures.Clevis = true
+			}
 		case *PartitionTable, *Partition:
 			// nothing to do
 		default:
@@ -938,6 +1197,9 @@ func (pt *PartitionTable) GetBuildPackages() []string {
 	if features.EXT4 {
 		packages = append(packages, "e2fsprogs")
 	}
+	if features.EROFS {
+		packages = append(packages, "erofs-utils")
+	}
 	if features.LUKS {
 		packages = append(packages,
 			"clevis",
@@ -945,6 +1207,10 @@ func (pt *PartitionTable) GetBuildPackages() []string {
 			"cryptsetup",
 		)
 	}
+	if features.Clevis {
+		// unlocks the container in the initramfs
+		packages = append(packages, "clevis-dracut")
+	}
 
 	return packages
 }
@@ -1264,6 +1530,10 @@ type CustomPartitionTableOptions struct {
 	// enable automatic discovery. It has no effect and is not required when
 	// the PartitionTableType is PT_DOS.
 	Architecture arch.Arch
+
+	// SectorSize of the disk in bytes, either DefaultSectorSize (512) or
+	// SectorSize4Kn (4096). Defaults to DefaultSectorSize.
+	SectorSize uint64
 }
 
 // Returns the default filesystem type if the fstype is empty. If both are
@@ -1304,6 +1574,10 @@ func maybeAddBootPartition(pt *PartitionTable, disk *blueprint.DiskCustomization
 
 // NewCustomPartitionTable creates a partition table based almost entirely on the disk customizations from a blueprint.
 func NewCustomPartitionTable(customizations *blueprint.DiskCustomization, options *CustomPartitionTableOptions, rng *rand.Rand) (*PartitionTable, error) {
+	return newCustomPartitionTable(customizations, options, rng, nil)
+}
+
+func newCustomPartitionTable(customizations *blueprint.DiskCustomization, options *CustomPartitionTableOptions, rng *rand.Rand, rec *Explanation) (*PartitionTable, error) {
 	if options == nil {
 		options = &CustomPartitionTableOptions{}
 	}
@@ -1318,27 +1592,18 @@ func NewCustomPartitionTable(customizations *blueprint.DiskCustomization, option
 		return nil, fmt.Errorf("%s %w", errPrefix, err)
 	}
 
-	pt := &PartitionTable{}
-
-	switch customizations.Type {
-	case "dos":
-		pt.Type = PT_DOS
-	case "gpt":
-		pt.Type = PT_GPT
-	case "":
-		// partition table type not specified, determine the default
-		switch options.PartitionTableType {
-		case PT_GPT, PT_DOS:
-			pt.Type = options.PartitionTableType
-		case PT_NONE:
-			// default to "gpt"
-			pt.Type = PT_GPT
-		default:
-			return nil, fmt.Errorf("%s invalid partition table type enum value: %d", errPrefix, options.PartitionTableType)
-		}
-	default:
-		return nil, fmt.Errorf("%s invalid partition table type: %s", errPrefix, customizations.Type)
+	ptType, err := customPartitionTableType(customizations.Type, options)
+	if err != nil {
+		return nil, fmt.Errorf("%s %w", errPrefix, err)
 	}
+	if ptType != PT_GPT && hasErofsRoot(customizations) {
+		// the erofs root is found by its partition UUID
+		return nil, fmt.Errorf("%s an erofs root filesystem requires a \"gpt\" partition table", errPrefix)
+	}
+	if err := ValidateSectorSize(options.SectorSize); err != nil {
+		return nil, fmt.Errorf("%s %w", errPrefix, err)
+	}
+	pt := &PartitionTable{Type: ptType, SectorSize: options.SectorSize}
 
 	// add any partition(s) that are needed for booting (like /boot/efi)
 	// if needed
@@ -1346,52 +1611,29 @@ func NewCustomPartitionTable(customizations *blueprint.DiskCustomization, option
 	if err := addPartitionsForBootMode(pt, customizations, options.BootMode, options.Architecture); err != nil {
 		return nil, fmt.Errorf("%s %w", errPrefix, err)
 	}
+	rec.record(pt, fmt.Sprintf("boot partitions (%s boot mode)", options.BootMode))
 	// add the /boot partition (if it is needed)
 	if err := maybeAddBootPartition(pt, customizations, options.DefaultFSType); err != nil {
 		return nil, fmt.Errorf("%s %w", errPrefix, err)
 	}
+	rec.record(pt, "/boot partition (required by lvm or btrfs)")
 	// add user customized partitions
-	for _, part := range customizations.Partitions {
-		if part.PartType != "" {
-			// check the partition details now that we also know the partition table type
-			if err := part.ValidatePartitionTypeID(pt.Type.String()); err != nil {
-				return nil, fmt.Errorf("%s error validating partition type ID for %q: %w", errPrefix, part.Mountpoint, err)
-			}
-			if err := part.ValidatePartitionID(pt.Type.String()); err != nil {
-				return nil, fmt.Errorf("%s error validating partition ID for %q: %w", errPrefix, part.Mountpoint, err)
-			}
-			if err := part.ValidatePartitionLabel(pt.Type.String()); err != nil {
-				return nil, fmt.Errorf("%s error validating partition label for %q: %w", errPrefix, part.Mountpoint, err)
-			}
-		}
-
-		switch part.Type {
-		case "plain", "":
-			if err := addPlainPartition(pt, part, options); err != nil {
-				return nil, fmt.Errorf("%s %w", errPrefix, err)
-			}
-		case "lvm":
-			if err := addLVMPartition(pt, part, options); err != nil {
-				return nil, fmt.Errorf("%s %w", errPrefix, err)
-			}
-		case "btrfs":
-			if err := addBtrfsPartition(pt, part); err != nil {
-				return nil, fmt.Errorf("%s %w", errPrefix, err)
-			}
-		default:
-			return nil, fmt.Errorf("%s invalid partition type: %s", errPrefix, part.Type)
-		}
+	if err := addCustomPartitions(pt, customizations.Partitions, options, nil, "main disk", rec); err != nil {
+		return nil, fmt.Errorf("%s %w", errPrefix, err)
 	}
 
 	if err := EnsureRootFilesystem(pt, options.DefaultFSType, options.Architecture); err != nil {
 		return nil, fmt.Errorf("%s %w", errPrefix, err)
 	}
+	rec.record(pt, "root filesystem")
 
 	if len(options.RequiredMinSizes) != 0 {
 		pt.EnsureDirectorySizes(options.RequiredMinSizes)
+		rec.record(pt, "required directory sizes")
 	}
 
 	pt.relayout(customizations.MinSize)
+	rec.record(pt, "relayout (alignment and image size)")
 	pt.GenerateUUIDs(rng)
 
 	// One thing not caught by the customization validation is if a final "dos"
@@ -1407,6 +1649,155 @@ func NewCustomPartitionTable(customizations *blueprint.DiskCustomization, option
 	return pt, nil
 }
 
+// AdditionalDisk is a disk of an image next to the main disk that holds the
+// operating system, e.g. a separate disk for data.
+type AdditionalDisk struct {
+	// Name of the disk, used to name its image file.
+	Name           string          `json:"name" yaml:"name"`
+	PartitionTable *PartitionTable `json:"partition_table" yaml:"partition_table"`
+}
+
+// NewCustomAdditionalDisks creates the partition tables for the additional
+// disks of the disk customizations. Unlike for the main disk, no
+// boot-related partitions and no root filesystem are created. The partition
+// table of the main disk, mainPT, is needed to generate volume group names
+// that are unique across all disks.
+func NewCustomAdditionalDisks(customizations *blueprint.DiskCustomization, mainPT *PartitionTable, options *CustomPartitionTableOptions, rng *rand.Rand) ([]AdditionalDisk, error) {
+	disks, _, err := newCustomAdditionalDisks(customizations, mainPT, options, rng, false)
+	return disks, err
+}
+
+// newCustomAdditionalDisks implements NewCustomAdditionalDisks; the
+// explanations of the partition tables are only returned if explain is true.
+func newCustomAdditionalDisks(customizations *blueprint.DiskCustomization, mainPT *PartitionTable, options *CustomPartitionTableOptions, rng *rand.Rand, explain bool) ([]AdditionalDisk, []*Explanation, error) {
+	if customizations == nil || len(customizations.AdditionalDisks) == 0 {
+		return nil, nil, nil
+	}
+	if options == nil {
+		options = &CustomPartitionTableOptions{}
+	}
+
+	if err := customizations.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("error generating partition tables for additional disks: %w", err)
+	}
+
+	otherDisks := []*PartitionTable{mainPT}
+	disks := make([]AdditionalDisk, 0, len(customizations.AdditionalDisks))
+	var explanations []*Explanation
+	for idx, dc := range customizations.AdditionalDisks {
+		errPrefix := fmt.Sprintf("error generating partition table for additional disk %q:", dc.Name)
+
+		ptType, err := customPartitionTableType(dc.Type, options)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s %w", errPrefix, err)
+		}
+		pt := &PartitionTable{Type: ptType, SectorSize: options.SectorSize}
+		var rec *Explanation
+		if explain {
+			rec = newExplanation()
+			explanations = append(explanations, rec)
+		}
+		if err := addCustomPartitions(pt, dc.Partitions, options, otherDisks, fmt.Sprintf("additional disk %d %q", idx+1, dc.Name), rec); err != nil {
+			return nil, nil, fmt.Errorf("%s %w", errPrefix, err)
+		}
+		if len(pt.Partitions) == 0 {
+			return nil, nil, fmt.Errorf("%s no partitions defined", errPrefix)
+		}
+
+		pt.relayout(dc.MinSize)
+		rec.record(pt, "relayout (alignment and disk size)")
+		pt.GenerateUUIDs(rng)
+
+		if pt.Type == PT_DOS && len(pt.Partitions) > 4 {
+			return nil, nil, fmt.Errorf("%s invalid partition table: \"dos\" partition table type only supports up to 4 partitions: got %d", errPrefix, len(pt.Partitions))
+		}
+
+		otherDisks = append(otherDisks, pt)
+		disks = append(disks, AdditionalDisk{Name: dc.Name, PartitionTable: pt})
+	}
+	return disks, explanations, nil
+}
+
+// customPartitionTableType returns the partition table type for the type
+// from the disk customizations, or the default from the options if it is
+// empty.
+func customPartitionTableType(ptType string, options *CustomPartitionTableOptions) (PartitionTableType, error) {
+	switch ptType {
+	case "dos":
+		return PT_DOS, nil
+	case "gpt":
+		return PT_GPT, nil
+	case "":
+		// partition table type not specified, determine the default
+		switch options.PartitionTableType {
+		case PT_GPT, PT_DOS:
+			return options.PartitionTableType, nil
+		case PT_NONE:
+			// default to "gpt"
+			return PT_GPT, nil
+		default:
+			return PT_NONE, fmt.Errorf("invalid partition table type enum value: %d", options.PartitionTableType)
+		}
+	default:
+		return PT_NONE, fmt.Errorf("invalid partition table type: %s", ptType)
+	}
+}
+
+// addCustomPartitions adds the partitions from the customizations to the
+// partition table. Names for volume groups are generated so that they are unique within pt and otherDisks. Each partition is recorded
+// with the disk, diskDesc, and its position on the disk.
+func addCustomPartitions(pt *PartitionTable, partitions []blueprint.PartitionCustomization, options *CustomPartitionTableOptions, otherDisks []*PartitionTable, diskDesc string, rec *Explanation) error {
+	for idx, part := range partitions {
+		if part.PartType != "" {
+			// check the partition details now that we also know the partition table type
+			if err := part.ValidatePartitionTypeID(pt.Type.String()); err != nil {
+				return fmt.Errorf("error validating partition type ID for %q: %w", part.Mountpoint, err)
+			}
+			if err := part.ValidatePartitionID(pt.Type.String()); err != nil {
+				return fmt.Errorf("error validating partition ID for %q: %w", part.Mountpoint, err)
+			}
+			if err := part.ValidatePartitionLabel(pt.Type.String()); err != nil {
+				return fmt.Errorf("error validating partition label for %q: %w", part.Mountpoint, err)
+			}
+		}
+
+		switch part.Type {
+		case "plain", "":
+			if err := addPlainPartition(pt, part, options); err != nil {
+				return err
+			}
+		case "lvm":
+			if err := addLVMPartition(pt, part, options, otherDisks); err != nil {
+				return err
+			}
+		case "btrfs":
+			if err := addBtrfsPartition(pt, part); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("invalid partition type: %s", part.Type)
+		}
+		rec.record(pt, fmt.Sprintf("disk customizations (%s, partition %d %s)", diskDesc, idx+1, customPartitionDesc(part)))
+	}
+	return nil
+}
+
+// customPartitionDesc describes a partition customization for humans by its
+// mountpoint or, for partitions without one, by what it holds.
+func customPartitionDesc(part blueprint.PartitionCustomization) string {
+	switch {
+	case part.Type == "lvm" && part.Name != "":
+		return fmt.Sprintf("lvm %q", part.Name)
+	case part.Type == "lvm":
+		return "lvm"
+	case part.Type == "btrfs":
+		return "btrfs"
+	case part.FSType == "swap":
+		return "swap"
+	}
+	return fmt.Sprintf("%q", part.Mountpoint)
+}
+
 func addPlainPartition(pt *PartitionTable, partition blueprint.PartitionCustomization, options *CustomPartitionTableOptions) error {
 	fstype, err := options.getfstype(partition.FSType)
 	if err != nil {
@@ -1439,44 +1830,56 @@ func addPlainPartition(pt *PartitionTable, partition blueprint.PartitionCustomiz
 		}
 	}
 
-	var payload PayloadEntity
+	newpart := Partition{
+		Type:    partType,
+		UUID:    partition.PartUUID,
+		Label:   partition.PartLabel,
+		Size:    partition.MinSize,
+		Grow:    partition.Grow,
+		Payload: encryptPayload(partition.Encryption, newPlainPayload(partition.FilesystemTypedCustomization, fstype)),
+	}
+	pt.Partitions = append(pt.Partitions, newpart)
+	return nil
+}
+
+// newPlainPayload returns the swap area or filesystem for a plain partition.
+func newPlainPayload(fs blueprint.FilesystemTypedCustomization, fstype string) PayloadEntity {
 	switch fstype {
 	case "swap":
-		payload = &Swap{
-			Label:        partition.Label,
+		return &Swap{
+			Label:        fs.Label,
 			FSTabOptions: "defaults", // TODO: add customization
 		}
+	case "erofs":
+		// erofs is a read-only filesystem
+		return &Filesystem{
+			Type:         fstype,
+			Mountpoint:   fs.Mountpoint,
+			FSTabOptions: "ro",
+		}
 	default:
-		payload = &Filesystem{
+		return &Filesystem{
 			Type:         fstype,
-			Label:        partition.Label,
-			Mountpoint:   partition.Mountpoint,
+			Label:        fs.Label,
+			Mountpoint:   fs.Mountpoint,
 			FSTabOptions: "defaults", // TODO: add customization
 		}
 	}
-
-	newpart := Partition{
-		Type:    partType,
-		UUID:    partition.PartUUID,
-		Label:   partition.PartLabel,
-		Size:    partition.MinSize,
-		Payload: payload,
-	}
-	pt.Partitions = append(pt.Partitions, newpart)
-	return nil
 }
 
-func addLVMPartition(pt *PartitionTable, partition blueprint.PartitionCustomization, options *CustomPartitionTableOptions) error {
+func addLVMPartition(pt *PartitionTable, partition blueprint.PartitionCustomization, options *CustomPartitionTableOptions, otherDisks []*PartitionTable) error {
 	vgname := partition.Name
 	if vgname == "" {
 		// get existing volume groups and generate unique name
 		existing := make(map[string]bool)
-		for _, part := range pt.Partitions {
-			vg, ok := part.Payload.(*LVMVolumeGroup)
-			if !ok {
-				continue
+		for _, table := range append([]*PartitionTable{pt}, otherDisks...) {
+			for _, part := range table.Partitions {
+				vg, ok := part.Payload.(*LVMVolumeGroup)
+				if !ok {
+					continue
+				}
+				existing[vg.Name] = true
 			}
-			existing[vg.Name] = true
 		}
 		// unlike other unique name generation cases, here we want the first
 		// name to have the 00 suffix, so we add the base to the existing set
@@ -1514,9 +1917,11 @@ func addLVMPartition(pt *PartitionTable, partition blueprint.PartitionCustomizat
 				FSTabOptions: "defaults", // TODO: add customization
 			}
 		}
-		if _, err := newvg.CreateLogicalVolume(lv.Name, lv.MinSize, newfs); err != nil {
+		newlv, err := newvg.CreateLogicalVolume(lv.Name, lv.MinSize, newfs)
+		if err != nil {
 			return fmt.Errorf("error creating logical volume %q (%s): %w", lv.Name, lv.Mountpoint, err)
 		}
+		newlv.Grow = lv.Grow
 	}
 
 	// create partition for volume group
@@ -1535,7 +1940,8 @@ func addLVMPartition(pt *PartitionTable, partition blueprint.PartitionCustomizat
 		Label:    partition.PartLabel,
 		Size:     partition.MinSize,
 		Bootable: false,
-		Payload:  newvg,
+		Grow:     partition.Grow,
+		Payload:  encryptPayload(partition.Encryption, newvg),
 	}
 	pt.Partitions = append(pt.Partitions, newpart)
 	return nil
@@ -1569,7 +1975,8 @@ func addBtrfsPartition(pt *PartitionTable, partition blueprint.PartitionCustomiz
 		UUID:     partition.PartUUID,
 		Label:    partition.PartLabel,
 		Bootable: false,
-		Payload:  newvol,
+		Grow:     partition.Grow,
+		Payload:  encryptPayload(partition.Encryption, newvol),
 		Size:     partition.MinSize,
 	}
 
@@ -1577,10 +1984,57 @@ func addBtrfsPartition(pt *PartitionTable, partition blueprint.PartitionCustomiz
 	return nil
 }
 
+// encryptPayload wraps the payload in a LUKS container if the encryption
+// customization is set and returns it unchanged otherwise.
+func encryptPayload(enc *blueprint.EncryptionCustomization, payload PayloadEntity) PayloadEntity {
+	if enc == nil {
+		return payload
+	}
+
+	luks := &LUKSContainer{
+		Passphrase: enc.Passphrase,
+		Label:      enc.Label,
+		Cipher:     enc.Cipher,
+		// minimal key derivation parameters, the same as the ones of the
+		// encrypted base partition tables of the distros
+		PBKDF: Argon2id{
+			Memory:      32,
+			Iterations:  4,
+			Parallelism: 1,
+		},
+		Payload: payload,
+	}
+	if enc.Clevis != nil {
+		policy := enc.Clevis.Policy
+		if policy == "" {
+			policy = "{}"
+		}
+		luks.Clevis = &ClevisBind{
+			Pin:              enc.Clevis.Pin,
+			Policy:           policy,
+			RemovePassphrase: enc.Clevis.RemovePassphrase,
+		}
+	}
+	return luks
+}
+
+// hasErofsRoot returns true if the root filesystem of the customizations is
+// an erofs filesystem.
+func hasErofsRoot(disk *blueprint.DiskCustomization) bool {
+	for _, part := range disk.Partitions {
+		if part.Mountpoint == "/" && part.FSType == "erofs" {
+			return true
+		}
+	}
+	return false
+}
+
 // Determine if a boot partition is needed based on the customizations. A boot
 // partition is needed if any of the following conditions apply:
 //   - / is on LVM or btrfs and /boot is not defined.
 //   - / is not defined and btrfs or lvm volumes are defined.
+//   - / is on an encrypted partition and /boot is not defined.
+//   - / is an erofs filesystem and /boot is not defined.
 //
 // In the second case, a root partition will be created automatically on either
 // btrfs or lvm.
@@ -1589,15 +2043,20 @@ func needsBoot(disk *blueprint.DiskCustomization) bool {
 		return false
 	}
 
+	// a /boot partition of the customizations is used wherever it is
+	// defined
+	for _, part := range disk.Partitions {
+		if part.Mountpoint == "/boot" {
+			return false
+		}
+	}
+
 	var foundBtrfsOrLVM bool
 	for _, part := range disk.Partitions {
 		switch part.Type {
 		case "plain", "":
 			if part.Mountpoint == "/" {
-				return false
-			}
-			if part.Mountpoint == "/boot" {
-				return false
+				return part.Encryption != nil || part.FSType == "erofs"
 			}
 		case "lvm":
 			foundBtrfsOrLVM = true
@@ -787,6 +787,118 @@ func TestRelayout(t *testing.T) {
 				},
 			},
 		},
+		"grow-partition": {
+			pt: &PartitionTable{
+				Type: PT_DOS,
+				Size: 100 * MiB,
+				Partitions: []Partition{
+					{
+						Size: 10 * MiB,
+					},
+					{
+						Payload: &Filesystem{
+							Mountpoint: "/var",
+						},
+						Size: 10 * MiB,
+						Grow: true,
+					},
+					{
+						Payload: &Filesystem{
+							Mountpoint: "/",
+						},
+						Size: 20 * MiB,
+					},
+				},
+			},
+			size: 100 * MiB,
+			expected: &PartitionTable{
+				Type: PT_DOS,
+				Size: 100 * MiB,
+				Partitions: []Partition{
+					{
+						Start: 1 * MiB,
+						Size:  10 * MiB,
+					},
+					{
+						Payload: &Filesystem{
+							Mountpoint: "/var",
+						},
+						Start: 31 * MiB, // moved to the end
+						Size:  69 * MiB, // Grows to fill the space
+						Grow:  true,
+					},
+					{
+						Payload: &Filesystem{
+							Mountpoint: "/",
+						},
+						Start: 11 * MiB,
+						Size:  20 * MiB, // root keeps its size
+					},
+				},
+			},
+		},
+		"grow-logical-volume": {
+			pt: &PartitionTable{
+				Type: PT_DOS,
+				Size: 100 * MiB,
+				Partitions: []Partition{
+					{
+						Size: 10 * MiB,
+					},
+					{
+						Payload: &LVMVolumeGroup{
+							LogicalVolumes: []LVMLogicalVolume{
+								{
+									Size: 20 * MiB,
+									Payload: &Filesystem{
+										Mountpoint: "/",
+									},
+								},
+								{
+									Size: 8 * MiB,
+									Grow: true,
+									Payload: &Filesystem{
+										Mountpoint: "/var",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+			size: 100 * MiB,
+			expected: &PartitionTable{
+				Type: PT_DOS,
+				Size: 100 * MiB,
+				Partitions: []Partition{
+					{
+						Start: 1 * MiB,
+						Size:  10 * MiB,
+					},
+					{
+						Payload: &LVMVolumeGroup{
+							LogicalVolumes: []LVMLogicalVolume{
+								{
+									Size: 20 * MiB, // root keeps its size
+									Payload: &Filesystem{
+										Mountpoint: "/",
+									},
+								},
+								{
+									Size: 68 * MiB, // 89 MiB - 1 MiB metadata - 20 MiB root
+									Grow: true,
+									Payload: &Filesystem{
+										Mountpoint: "/var",
+									},
+								},
+							},
+						},
+						Start: 11 * MiB,
+						Size:  89 * MiB,
+					},
+				},
+			},
+		},
 	}
 
 	for name := range testCases {
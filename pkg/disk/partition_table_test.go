@@ -4,8 +4,11 @@ import (
 	"encoding/json"
 	"fmt"
 	"math/rand"
+	"reflect"
+	"slices"
 	"testing"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -112,6 +115,148 @@ func TestPartitionTable_GenerateUUIDs_VFAT(t *testing.T) {
 	assert.Equal(t, "6e4ff95f", pt.Partitions[0].Payload.(*disk.Filesystem).UUID)
 }
 
+func TestPartitionTable_DeriveUUIDs(t *testing.T) {
+	newPT := func() *disk.PartitionTable {
+		return &disk.PartitionTable{
+			Type: disk.PT_GPT,
+			Partitions: []disk.Partition{
+				{
+					Size:     1 * datasizes.MebiByte,
+					Bootable: true,
+					Type:     disk.BIOSBootPartitionGUID,
+					UUID:     disk.BIOSBootPartitionUUID,
+				},
+				{
+					Size: 200 * datasizes.MebiByte,
+					Type: disk.EFISystemPartitionGUID,
+					Payload: &disk.Filesystem{
+						Type:       "vfat",
+						Mountpoint: "/boot/efi",
+					},
+				},
+				{
+					Size: 2 * datasizes.GibiByte,
+					Type: disk.FilesystemDataGUID,
+					Payload: &disk.LUKSContainer{
+						Payload: &disk.Filesystem{
+							Type:       "xfs",
+							Mountpoint: "/",
+						},
+					},
+				},
+				{
+					Size: 10 * datasizes.GibiByte,
+					Type: disk.FilesystemDataGUID,
+					Payload: &disk.Btrfs{
+						Subvolumes: []disk.BtrfsSubvolume{
+							{
+								Name:       "var",
+								Mountpoint: "/var",
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+	namespace := uuid.MustParse("7c3c7b9e-7a8e-4c55-9d3b-0d6d0b9c2f5e")
+
+	// the derived UUIDs do not depend on the random UUIDs
+	/* #nosec G404 */
+	rnd := rand.New(rand.NewSource(0))
+	pt := newPT()
+	pt.GenerateUUIDs(rnd)
+	pt.DeriveUUIDs(namespace, newPT())
+	/* #nosec G404 */
+	rnd = rand.New(rand.NewSource(1))
+	pt2 := newPT()
+	pt2.GenerateUUIDs(rnd)
+	pt2.DeriveUUIDs(namespace, newPT())
+	assert.Equal(t, pt, pt2)
+
+	// UUIDs of the partition table to keep are not replaced
+	assert.Equal(t, disk.BIOSBootPartitionUUID, pt.Partitions[0].UUID)
+
+	// vfat uses 32 bit volume IDs
+	assert.Regexp(t, "^[0-9a-f]{8}$", pt.Partitions[1].Payload.(*disk.Filesystem).UUID)
+
+	luks := pt.Partitions[2].Payload.(*disk.LUKSContainer)
+	root := luks.Payload.(*disk.Filesystem)
+	btrfs := pt.Partitions[3].Payload.(*disk.Btrfs)
+	ids := []string{pt.UUID, pt.Partitions[1].UUID, pt.Partitions[2].UUID, pt.Partitions[3].UUID, luks.UUID, root.UUID, btrfs.UUID}
+	for _, id := range ids {
+		assert.Equal(t, uuid.Version(5), uuid.MustParse(id).Version())
+	}
+	// all UUIDs are unique
+	assert.ElementsMatch(t, ids, slices.Compact(slices.Sorted(slices.Values(ids))))
+	assert.Equal(t, btrfs.UUID, btrfs.Subvolumes[0].UUID)
+
+	// a different namespace results in different UUIDs
+	pt3 := newPT()
+	pt3.DeriveUUIDs(uuid.MustParse("0f8d1c7e-4d6b-4a0e-9f3c-6a2b5e8d7c91"), nil)
+	assert.NotEqual(t, root.UUID, pt3.Partitions[2].Payload.(*disk.LUKSContainer).Payload.(*disk.Filesystem).UUID)
+}
+
+func TestPartitionTable_DeriveUUIDsAllUniqueEntities(t *testing.T) {
+	for name, typ := range disk.PayloadEntityMap {
+		ent, ok := reflect.New(typ).Interface().(disk.UniqueEntity)
+		if !ok {
+			continue
+		}
+		pt := &disk.PartitionTable{
+			Type: disk.PT_GPT,
+			Partitions: []disk.Partition{
+				{Payload: ent.(disk.PayloadEntity)},
+			},
+		}
+		assert.NotPanics(t, func() { pt.DeriveUUIDs(uuid.Nil, nil) }, name)
+	}
+}
+
+func TestPartitionTable_HeaderSize(t *testing.T) {
+	testCases := map[string]struct {
+		pt             disk.PartitionTable
+		expectedHeader uint64
+		expectedFooter uint64
+	}{
+		"gpt-512": {
+			pt: disk.PartitionTable{Type: disk.PT_GPT},
+			// protective MBR, GPT header and 128 entries of 128 bytes
+			expectedHeader: 512 + 512 + 128*128,
+			// GPT header and the entries
+			expectedFooter: 512 + 128*128,
+		},
+		"gpt-4096": {
+			pt:             disk.PartitionTable{Type: disk.PT_GPT, SectorSize: disk.SectorSize4Kn},
+			expectedHeader: 4096 + 4096 + 128*128,
+			expectedFooter: 4096 + 128*128,
+		},
+		"gpt-4096-200-partitions": {
+			pt: disk.PartitionTable{Type: disk.PT_GPT, SectorSize: disk.SectorSize4Kn, Partitions: make([]disk.Partition, 200)},
+			// 200 entries of 128 bytes fill 7 sectors
+			expectedHeader: 4096 + 4096 + 7*4096,
+			expectedFooter: 4096 + 7*4096,
+		},
+		"dos-512": {
+			pt:             disk.PartitionTable{Type: disk.PT_DOS},
+			expectedHeader: 512,
+		},
+		"dos-4096": {
+			pt:             disk.PartitionTable{Type: disk.PT_DOS, SectorSize: disk.SectorSize4Kn},
+			expectedHeader: 4096,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedHeader, tc.pt.HeaderSize())
+			assert.Equal(t, tc.expectedFooter, tc.pt.FooterSize())
+			assert.Zero(t, tc.pt.HeaderSize()%tc.pt.GetSectorSize())
+			assert.Zero(t, tc.pt.FooterSize()%tc.pt.GetSectorSize())
+		})
+	}
+}
+
 func TestEnsureRootFilesystem(t *testing.T) {
 	type testCase struct {
 		pt            disk.PartitionTable
@@ -2635,6 +2780,297 @@ func TestNewCustomPartitionTable(t *testing.T) {
 
 }
 
+func TestNewCustomPartitionTableEncrypted(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	customizations := &blueprint.DiskCustomization{
+		Partitions: []blueprint.PartitionCustomization{
+			{
+				Type:    "lvm",
+				MinSize: 100 * datasizes.MiB,
+				Encryption: &blueprint.EncryptionCustomization{
+					Passphrase: "secret",
+					Label:      "crypt",
+					Clevis: &blueprint.ClevisCustomization{
+						Pin:              "null",
+						RemovePassphrase: true,
+					},
+				},
+				VGCustomization: blueprint.VGCustomization{
+					Name: "testvg",
+					LogicalVolumes: []blueprint.LVCustomization{
+						{
+							Name:    "rootlv",
+							MinSize: 50 * datasizes.MiB,
+							FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+								Mountpoint: "/",
+								FSType:     "xfs",
+							},
+						},
+					},
+				},
+			},
+			{
+				MinSize: 20 * datasizes.MiB,
+				Encryption: &blueprint.EncryptionCustomization{
+					Passphrase: "secret",
+					Cipher:     "aes-xts-plain64",
+				},
+				FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+					Mountpoint: "/data",
+					FSType:     "ext4",
+				},
+			},
+		},
+	}
+	options := &disk.CustomPartitionTableOptions{
+		DefaultFSType: disk.FS_XFS,
+		BootMode:      platform.BOOT_UEFI,
+	}
+
+	/* #nosec G404 */
+	rnd := rand.New(rand.NewSource(0))
+	pt, err := disk.NewCustomPartitionTable(customizations, options, rnd)
+	require.NoError(err)
+
+	// a /boot partition is added for the encrypted root
+	assert.NotNil(pt.FindMountable("/boot"))
+
+	var containers []*disk.LUKSContainer
+	for _, part := range pt.Partitions {
+		if luks, ok := part.Payload.(*disk.LUKSContainer); ok {
+			containers = append(containers, luks)
+		}
+	}
+	require.Len(containers, 2)
+
+	vgLUKS := containers[0]
+	assert.Equal("secret", vgLUKS.Passphrase)
+	assert.Equal("crypt", vgLUKS.Label)
+	assert.NotEmpty(vgLUKS.UUID)
+	assert.Equal(disk.Argon2id{Memory: 32, Iterations: 4, Parallelism: 1}, vgLUKS.PBKDF)
+	assert.Equal(&disk.ClevisBind{Pin: "null", Policy: "{}", RemovePassphrase: true}, vgLUKS.Clevis)
+	vg, ok := vgLUKS.Payload.(*disk.LVMVolumeGroup)
+	require.True(ok)
+	assert.Equal("testvg", vg.Name)
+
+	dataLUKS := containers[1]
+	assert.Equal("aes-xts-plain64", dataLUKS.Cipher)
+	assert.Nil(dataLUKS.Clevis)
+	fs, ok := dataLUKS.Payload.(*disk.Filesystem)
+	require.True(ok)
+	assert.Equal("/data", fs.Mountpoint)
+
+	// the initramfs unlocks the container bound with clevis
+	assert.Contains(pt.GetBuildPackages(), "clevis-dracut")
+}
+
+func TestNewCustomPartitionTableEncryptedRootBeforeBoot(t *testing.T) {
+	customizations := &blueprint.DiskCustomization{
+		Partitions: []blueprint.PartitionCustomization{
+			{
+				MinSize: 1 * datasizes.GiB,
+				Encryption: &blueprint.EncryptionCustomization{
+					Passphrase: "secret",
+				},
+				FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+					Mountpoint: "/",
+					FSType:     "xfs",
+				},
+			},
+			{
+				MinSize: 500 * datasizes.MiB,
+				FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+					Mountpoint: "/boot",
+					FSType:     "ext4",
+				},
+			},
+		},
+	}
+	options := &disk.CustomPartitionTableOptions{
+		DefaultFSType: disk.FS_XFS,
+		BootMode:      platform.BOOT_UEFI,
+		Architecture:  arch.ARCH_X86_64,
+	}
+
+	/* #nosec G404 */
+	pt, err := disk.NewCustomPartitionTable(customizations, options, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+
+	// the /boot partition of the customizations is used, no other one
+	// is added for the encrypted root
+	var mountpoints []string
+	_ = pt.ForEachMountable(func(mnt disk.Mountable, path []disk.Entity) error {
+		mountpoints = append(mountpoints, mnt.GetMountpoint())
+		return nil
+	})
+	assert.Equal(t, []string{"/boot/efi", "/", "/boot"}, mountpoints)
+	assert.Equal(t, "ext4", pt.FindMountable("/boot").GetFSType())
+	// containers without a clevis binding are unlocked with the
+	// passphrase
+	assert.NotContains(t, pt.GetBuildPackages(), "clevis-dracut")
+}
+
+func TestNewCustomPartitionTableErofsRoot(t *testing.T) {
+	customizations := &blueprint.DiskCustomization{
+		Partitions: []blueprint.PartitionCustomization{
+			{
+				MinSize: 2 * datasizes.GiB,
+				FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+					Mountpoint: "/",
+					FSType:     "erofs",
+				},
+			},
+		},
+	}
+	options := &disk.CustomPartitionTableOptions{
+		DefaultFSType: disk.FS_EXT4,
+		BootMode:      platform.BOOT_UEFI,
+		Architecture:  arch.ARCH_X86_64,
+	}
+
+	/* #nosec G404 */
+	pt, err := disk.NewCustomPartitionTable(customizations, options, rand.New(rand.NewSource(0)))
+	require.NoError(t, err)
+
+	// the kernel and the bootloader configuration need a writable /boot
+	assert.Equal(t, "ext4", pt.FindMountable("/boot").GetFSType())
+	root := pt.ErofsRoot()
+	require.NotNil(t, root)
+	fs := root.Payload.(*disk.Filesystem)
+	assert.Equal(t, "/", fs.Mountpoint)
+	assert.Equal(t, "ro", fs.FSTabOptions)
+	assert.Contains(t, pt.GetBuildPackages(), "erofs-utils")
+
+	// the root is found by its partition UUID
+	customizations.Type = "dos"
+	/* #nosec G404 */
+	_, err = disk.NewCustomPartitionTable(customizations, options, rand.New(rand.NewSource(0)))
+	assert.EqualError(t, err, `error generating partition table: an erofs root filesystem requires a "gpt" partition table`)
+}
+
+func TestErofsRootNone(t *testing.T) {
+	pt := testdisk.MakeFakePartitionTable("/", "/boot")
+	assert.Nil(t, pt.ErofsRoot())
+}
+
+func TestNewCustomPartitionTableGrow(t *testing.T) {
+	customizations := map[string]*blueprint.DiskCustomization{
+		"plain": {
+			MinSize: 20 * datasizes.GiB,
+			Partitions: []blueprint.PartitionCustomization{
+				{
+					MinSize: 5 * datasizes.GiB,
+					Grow:    true,
+					FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+						Mountpoint: "/var",
+						FSType:     "xfs",
+					},
+				},
+				{
+					MinSize: 4 * datasizes.GiB,
+					FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+						Mountpoint: "/",
+						FSType:     "xfs",
+					},
+				},
+			},
+		},
+		"lvm": {
+			MinSize: 20 * datasizes.GiB,
+			Partitions: []blueprint.PartitionCustomization{
+				{
+					Type:    "lvm",
+					MinSize: 10 * datasizes.GiB,
+					VGCustomization: blueprint.VGCustomization{
+						LogicalVolumes: []blueprint.LVCustomization{
+							{
+								MinSize: 4 * datasizes.GiB,
+								FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+									Mountpoint: "/",
+									FSType:     "xfs",
+								},
+							},
+							{
+								MinSize: 5 * datasizes.GiB,
+								Grow:    true,
+								FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+									Mountpoint: "/var",
+									FSType:     "xfs",
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	options := &disk.CustomPartitionTableOptions{
+		DefaultFSType: disk.FS_XFS,
+		BootMode:      platform.BOOT_UEFI,
+		Architecture:  arch.ARCH_X86_64,
+	}
+
+	for name, dc := range customizations {
+		t.Run(name, func(t *testing.T) {
+			/* #nosec G404 */
+			rnd := rand.New(rand.NewSource(0))
+			pt, err := disk.NewCustomPartitionTable(dc, options, rnd)
+			require.NoError(t, err)
+			assert.Equal(t, uint64(20*datasizes.GiB), pt.Size)
+
+			rootSize, err := pt.GetMountpointSize("/")
+			require.NoError(t, err)
+			assert.Equal(t, uint64(4*datasizes.GiB), rootSize, "root keeps its minimum size")
+
+			varSize, err := pt.GetMountpointSize("/var")
+			require.NoError(t, err)
+			assert.Greater(t, varSize, uint64(14*datasizes.GiB), "/var takes the free space")
+		})
+	}
+}
+
+func TestNewCustomPartitionTable4Kn(t *testing.T) {
+	customizations := &blueprint.DiskCustomization{
+		Partitions: []blueprint.PartitionCustomization{
+			{
+				Type:    "plain",
+				MinSize: 1*datasizes.GiB + 1,
+				FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+					Mountpoint: "/data",
+					FSType:     "ext4",
+				},
+			},
+		},
+	}
+	options := &disk.CustomPartitionTableOptions{
+		DefaultFSType: disk.FS_XFS,
+		BootMode:      platform.BOOT_HYBRID,
+		Architecture:  arch.ARCH_X86_64,
+		SectorSize:    disk.SectorSize4Kn,
+	}
+
+	/* #nosec G404 */
+	rnd := rand.New(rand.NewSource(0))
+	pt, err := disk.NewCustomPartitionTable(customizations, options, rnd)
+	require.NoError(t, err)
+
+	assert.Equal(t, uint64(disk.SectorSize4Kn), pt.SectorSize)
+	assert.Zero(t, pt.Size%disk.SectorSize4Kn)
+	for _, part := range pt.Partitions {
+		assert.Zero(t, part.Start%disk.SectorSize4Kn)
+		assert.Zero(t, part.Size%disk.SectorSize4Kn)
+	}
+	// the last partition leaves space for the secondary GPT header
+	last := pt.Partitions[len(pt.Partitions)-1]
+	assert.Equal(t, pt.Size, last.Start+last.Size+pt.FooterSize())
+
+	options.SectorSize = 1024
+	_, err = disk.NewCustomPartitionTable(customizations, options, rnd)
+	assert.EqualError(t, err, "error generating partition table: unsupported sector size 1024 (must be 512 or 4096)")
+}
+
 func TestNewCustomPartitionTableErrors(t *testing.T) {
 	type testCase struct {
 		customizations *blueprint.DiskCustomization
@@ -2936,3 +3372,111 @@ func TestUnmarshalSizeUnitStringPartitionTable(t *testing.T) {
 		})
 	}
 }
+
+func TestNewCustomAdditionalDisks(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	lvm := blueprint.PartitionCustomization{
+		Type:    "lvm",
+		MinSize: 1 * datasizes.GiB,
+		VGCustomization: blueprint.VGCustomization{
+			LogicalVolumes: []blueprint.LVCustomization{
+				{
+					Name:    "datalv",
+					MinSize: 512 * datasizes.MiB,
+					FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+						Mountpoint: "/data",
+						FSType:     "xfs",
+					},
+				},
+			},
+		},
+	}
+	customizations := &blueprint.DiskCustomization{
+		Partitions: []blueprint.PartitionCustomization{
+			{
+				Type:    "lvm",
+				MinSize: 5 * datasizes.GiB,
+				VGCustomization: blueprint.VGCustomization{
+					LogicalVolumes: []blueprint.LVCustomization{
+						{
+							Name:    "rootlv",
+							MinSize: 2 * datasizes.GiB,
+							FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+								Mountpoint: "/",
+								FSType:     "xfs",
+							},
+						},
+					},
+				},
+			},
+		},
+		AdditionalDisks: []blueprint.DiskCustomization{
+			{
+				Name:       "data",
+				MinSize:    20 * datasizes.GiB,
+				Partitions: []blueprint.PartitionCustomization{lvm},
+			},
+			{
+				Name: "containers",
+				Type: "dos",
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						MinSize: 3 * datasizes.GiB,
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/var/lib/containers",
+							FSType:     "ext4",
+						},
+					},
+				},
+			},
+		},
+	}
+	options := &disk.CustomPartitionTableOptions{
+		DefaultFSType:      disk.FS_XFS,
+		BootMode:           platform.BOOT_UEFI,
+		PartitionTableType: disk.PT_GPT,
+		RequiredMinSizes:   map[string]uint64{"/": 1 * datasizes.GiB, "/usr": 2 * datasizes.GiB},
+	}
+
+	/* #nosec G404 */
+	rnd := rand.New(rand.NewSource(0))
+	pt, err := disk.NewCustomPartitionTable(customizations, options, rnd)
+	require.NoError(err)
+	disks, err := disk.NewCustomAdditionalDisks(customizations, pt, options, rnd)
+	require.NoError(err)
+	require.Len(disks, 2)
+
+	data := disks[0]
+	assert.Equal("data", data.Name)
+	assert.Equal(disk.PT_GPT, data.PartitionTable.Type)
+	assert.Equal(uint64(20*datasizes.GiB), data.PartitionTable.Size)
+	// no boot partitions and no root filesystem on additional disks
+	require.Len(data.PartitionTable.Partitions, 1)
+	assert.Nil(data.PartitionTable.FindMountable("/"))
+	assert.NotEmpty(data.PartitionTable.UUID)
+	// the volume group name is unique across disks
+	vg, ok := data.PartitionTable.Partitions[0].Payload.(*disk.LVMVolumeGroup)
+	require.True(ok)
+	assert.Equal("vg01", vg.Name)
+	// the only partition grows to fill the disk
+	part := data.PartitionTable.Partitions[0]
+	assert.Equal(data.PartitionTable.Size, part.Start+part.Size+data.PartitionTable.FooterSize())
+
+	containers := disks[1]
+	assert.Equal("containers", containers.Name)
+	assert.Equal(disk.PT_DOS, containers.PartitionTable.Type)
+	require.Len(containers.PartitionTable.Partitions, 1)
+	fs, ok := containers.PartitionTable.Partitions[0].Payload.(*disk.Filesystem)
+	require.True(ok)
+	assert.Equal("/var/lib/containers", fs.Mountpoint)
+	assert.Equal("ext4", fs.Type)
+	assert.NotEmpty(fs.UUID)
+	assert.GreaterOrEqual(containers.PartitionTable.Partitions[0].Size, uint64(3*datasizes.GiB))
+
+	// no additional disks
+	disks, err = disk.NewCustomAdditionalDisks(&blueprint.DiskCustomization{}, pt, options, rnd)
+	assert.NoError(err)
+	assert.Nil(disks)
+}
@@ -196,3 +196,41 @@ partition_table:
 	}
 	assert.Equal(t, expected, ptWrapper.PartitionTable)
 }
+
+func TestPartitionTableUnmarshalYAMLGrow(t *testing.T) {
+	inputYAML := `
+partition_table:
+  type: "gpt"
+  partitions:
+    - size: "2 GiB"
+      payload_type: "filesystem"
+      payload:
+        type: "xfs"
+        mountpoint: "/"
+    - size: "1 GiB"
+      grow: true
+      payload_type: "lvm"
+      payload:
+        name: "datavg"
+        logical_volumes:
+          - name: "varlv"
+            size: "512 MiB"
+            grow: true
+            payload_type: "filesystem"
+            payload:
+              type: "xfs"
+              mountpoint: "/var"
+`
+	var ptWrapper struct {
+		PartitionTable disk.PartitionTable `yaml:"partition_table"`
+	}
+
+	err := yaml.Unmarshal([]byte(inputYAML), &ptWrapper)
+	require.NoError(t, err)
+	pt := ptWrapper.PartitionTable
+	assert.False(t, pt.Partitions[0].Grow)
+	assert.True(t, pt.Partitions[1].Grow)
+	vg := pt.Partitions[1].Payload.(*disk.LVMVolumeGroup)
+	assert.True(t, vg.LogicalVolumes[0].Grow)
+	assert.Equal(t, uint64(512*datasizes.MiB), vg.LogicalVolumes[0].Size)
+}
@@ -92,6 +92,10 @@ type DistroYAML struct {
 
 	OscapProfilesAllowList []oscap.Profile `yaml:"oscap_profiles_allowlist"`
 
+	// CryptoPolicies lists the system-wide crypto policies shipped by the
+	// distro. It is nil if the distro has no crypto policies.
+	CryptoPolicies *CryptoPolicies `yaml:"crypto_policies"`
+
 	imageTypes map[string]ImageTypeYAML
 	// distro wide default image config
 	imageConfig *distro.ImageConfig `yaml:"default"`
@@ -106,6 +110,13 @@ type DistroYAML struct {
 	DistroLike manifest.Distro `yaml:"distro_like"`
 }
 
+// CryptoPolicies are the policies and subpolicy modules that are available
+// to update-crypto-policies(8).
+type CryptoPolicies struct {
+	Policies []string `yaml:"policies"`
+	Modules  []string `yaml:"modules"`
+}
+
 func (d *DistroYAML) ImageTypes() map[string]ImageTypeYAML {
 	return d.imageTypes
 }
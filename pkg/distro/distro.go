@@ -139,6 +139,18 @@ type ImageOptions struct {
 	Facts            *facts.ImageOptions        `json:"facts,omitempty"`
 	PartitioningMode disk.PartitioningMode      `json:"partitioning-mode,omitempty"`
 
+	// DeterministicUUIDs derives the UUIDs of the partition tables,
+	// partitions, and filesystems from the distribution, architecture, image
+	// type, and the blueprint name and version instead of generating them from
+	// the random seed, so that they are the same for every build.
+	DeterministicUUIDs bool `json:"deterministic_uuids,omitempty"`
+
+	// SectorSize of the disk image in bytes, either 512 (the default) or
+	// 4096 for 4K native (4Kn) disks. It determines the sector size of the
+	// partition table and of all devices that are created on it. 4Kn disks
+	// are not supported for image types that boot with BIOS.
+	SectorSize uint64 `json:"sector_size,omitempty"`
+
 	UseBootstrapContainer bool `json:"use_bootstrap_container,omitempty"`
 }
 
@@ -0,0 +1,79 @@
+package generic
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/blueprint"
+	"github.com/osbuild/images/pkg/customizations/fsnode"
+)
+
+// cryptoPolicyModulesDir is the directory of the local subpolicy modules,
+// they take precedence over the modules of the crypto-policies package.
+const cryptoPolicyModulesDir = "/etc/crypto-policies/policies/modules"
+
+// cryptoPolicy returns the system-wide crypto policy of the blueprint with
+// its subpolicy modules, e.g. "DEFAULT:NO-SHA1", and the files of the custom
+// modules. The policy and the modules must be available on the distro and
+// the policy must be consistent with the FIPS customization. The policy is
+// empty if the blueprint does not select one.
+func cryptoPolicy(t *imageType, c *blueprint.Customizations) (string, []*fsnode.File, error) {
+	cp, err := c.GetCryptoPolicy()
+	if err != nil {
+		return "", nil, err
+	}
+	if cp == nil {
+		return "", nil, nil
+	}
+
+	available := t.arch.distro.DistroYAML.CryptoPolicies
+	if available == nil {
+		return "", nil, fmt.Errorf("crypto policy customizations are not supported on %s", t.arch.distro.Name())
+	}
+
+	fips := c.GetFIPS()
+	base := cp.GetBasePolicy()
+	if base == "" {
+		base = "DEFAULT"
+		if fips {
+			base = "FIPS"
+		}
+	}
+	switch {
+	case fips && base != "FIPS":
+		return "", nil, fmt.Errorf("crypto policy %q conflicts with the FIPS customization, FIPS mode requires the \"FIPS\" policy", base)
+	case !fips && base == "FIPS":
+		return "", nil, fmt.Errorf("crypto policy \"FIPS\" requires the FIPS customization")
+	}
+	if !slices.Contains(available.Policies, base) {
+		return "", nil, fmt.Errorf("crypto policy %q is not available on %s (available: %s)", base, t.arch.distro.Name(), strings.Join(available.Policies, ", "))
+	}
+
+	modules := cp.GetModules()
+	var files []*fsnode.File
+	for _, cm := range cp.CustomModules {
+		contents := cm.Contents
+		if !strings.HasSuffix(contents, "\n") {
+			contents += "\n"
+		}
+		file, err := fsnode.NewFile(path.Join(cryptoPolicyModulesDir, cm.Name+".pmod"), common.ToPtr(os.FileMode(0644)), "root", "root", []byte(contents))
+		if err != nil {
+			return "", nil, err
+		}
+		files = append(files, file)
+	}
+	for _, module := range modules {
+		custom := slices.ContainsFunc(cp.CustomModules, func(cm blueprint.CryptoPolicyModuleCustomization) bool {
+			return cm.Name == module
+		})
+		if !custom && !slices.Contains(available.Modules, module) {
+			return "", nil, fmt.Errorf("crypto policy module %q is not available on %s, add it to the custom modules", module, t.arch.distro.Name())
+		}
+	}
+
+	return strings.Join(append([]string{base}, modules...), ":"), files, nil
+}
@@ -0,0 +1,122 @@
+package generic
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/blueprint"
+	"github.com/osbuild/images/pkg/distro"
+)
+
+func TestCryptoPolicy(t *testing.T) {
+	d := common.Must(newDistro("rhel-9.6"))
+	a, err := d.GetArch("x86_64")
+	require.NoError(t, err)
+	it, err := a.GetImageType("qcow2")
+	require.NoError(t, err)
+	imgType := it.(*imageType)
+
+	testCases := map[string]struct {
+		customizations *blueprint.Customizations
+		policy         string
+		err            string
+	}{
+		"none": {
+			customizations: &blueprint.Customizations{},
+		},
+		"policy": {
+			customizations: &blueprint.Customizations{CryptoPolicy: &blueprint.CryptoPolicyCustomization{Policy: "FUTURE"}},
+			policy:         "FUTURE",
+		},
+		"policy-modules": {
+			customizations: &blueprint.Customizations{CryptoPolicy: &blueprint.CryptoPolicyCustomization{Policy: "DEFAULT:NO-SHA1", Modules: []string{"OSPP"}}},
+			policy:         "DEFAULT:NO-SHA1:OSPP",
+		},
+		"default-policy": {
+			customizations: &blueprint.Customizations{CryptoPolicy: &blueprint.CryptoPolicyCustomization{Modules: []string{"NO-SHA1"}}},
+			policy:         "DEFAULT:NO-SHA1",
+		},
+		"fips-default-policy": {
+			customizations: &blueprint.Customizations{
+				FIPS:         common.ToPtr(true),
+				CryptoPolicy: &blueprint.CryptoPolicyCustomization{Modules: []string{"OSPP"}},
+			},
+			policy: "FIPS:OSPP",
+		},
+		"fips-conflict": {
+			customizations: &blueprint.Customizations{
+				FIPS:         common.ToPtr(true),
+				CryptoPolicy: &blueprint.CryptoPolicyCustomization{Policy: "FUTURE"},
+			},
+			err: `crypto policy "FUTURE" conflicts with the FIPS customization, FIPS mode requires the "FIPS" policy`,
+		},
+		"fips-policy-without-fips": {
+			customizations: &blueprint.Customizations{CryptoPolicy: &blueprint.CryptoPolicyCustomization{Policy: "FIPS"}},
+			err:            `crypto policy "FIPS" requires the FIPS customization`,
+		},
+		"unknown-policy": {
+			customizations: &blueprint.Customizations{CryptoPolicy: &blueprint.CryptoPolicyCustomization{Policy: "BSI"}},
+			err:            `crypto policy "BSI" is not available on rhel-9.6 (available: DEFAULT, LEGACY, FUTURE, FIPS)`,
+		},
+		"unknown-module": {
+			customizations: &blueprint.Customizations{CryptoPolicy: &blueprint.CryptoPolicyCustomization{Policy: "DEFAULT:NO-PQ"}},
+			err:            `crypto policy module "NO-PQ" is not available on rhel-9.6, add it to the custom modules`,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			policy, files, err := cryptoPolicy(imgType, tc.customizations)
+			if tc.err != "" {
+				assert.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.policy, policy)
+			assert.Empty(t, files)
+		})
+	}
+}
+
+func TestCryptoPolicyCustomModules(t *testing.T) {
+	d := common.Must(newDistro("fedora-42"))
+	a, err := d.GetArch("x86_64")
+	require.NoError(t, err)
+
+	bp := &blueprint.Blueprint{
+		Customizations: &blueprint.Customizations{
+			CryptoPolicy: &blueprint.CryptoPolicyCustomization{
+				Policy:  "DEFAULT:NO-SHA1",
+				Modules: []string{"NO-CBC"},
+				CustomModules: []blueprint.CryptoPolicyModuleCustomization{
+					{Name: "NO-CBC", Contents: "cipher = -*-CBC"},
+				},
+			},
+		},
+	}
+
+	it, err := a.GetImageType("qcow2")
+	require.NoError(t, err)
+	policy, files, err := cryptoPolicy(it.(*imageType), bp.Customizations)
+	require.NoError(t, err)
+	assert.Equal(t, "DEFAULT:NO-SHA1:NO-CBC", policy)
+	require.Len(t, files, 1)
+	assert.Equal(t, "/etc/crypto-policies/policies/modules/NO-CBC.pmod", files[0].Path())
+	assert.Equal(t, common.ToPtr(os.FileMode(0644)), files[0].Mode())
+	assert.Equal(t, "cipher = -*-CBC\n", string(files[0].Data()))
+
+	checkPackageAndOSTreeManifests(t, a, bp)
+
+	// RHEL 7 has no crypto policies
+	d = common.Must(newDistro("rhel-7.9"))
+	a, err = d.GetArch("x86_64")
+	require.NoError(t, err)
+	it, err = a.GetImageType("qcow2")
+	require.NoError(t, err)
+	_, _, err = it.Manifest(bp, distro.ImageOptions{}, nil, nil)
+	assert.EqualError(t, err, "crypto policy customizations are not supported on rhel-7.9")
+}
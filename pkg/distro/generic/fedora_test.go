@@ -515,7 +515,7 @@ func TestFedoraDistro_ManifestError(t *testing.T) {
 					} else if imgTypeName == "workstation-live-installer" {
 						assert.EqualError(t, err, fmt.Sprintf(distro.NoCustomizationsAllowedError, imgTypeName))
 					} else if imgTypeName == "iot-raw-xz" || imgTypeName == "iot-qcow2" {
-						assert.EqualError(t, err, fmt.Sprintf(distro.UnsupportedCustomizationError, imgTypeName, "User, Group, Directories, Files, Services, FIPS"))
+						assert.EqualError(t, err, fmt.Sprintf(distro.UnsupportedCustomizationError, imgTypeName, "User, Group, Directories, Files, Services, FIPS, Network, SSHServer, PasswordQuality, Limits, CryptoPolicy, Sudoers"))
 					} else {
 						assert.NoError(t, err)
 					}
@@ -710,7 +710,7 @@ func TestFedoraDistro_CustomFileSystemManifestError(t *testing.T) {
 				if imgTypeName == "iot-commit" || imgTypeName == "iot-container" || imgTypeName == "iot-bootable-container" {
 					assert.EqualError(t, err, "Custom mountpoints and partitioning are not supported for ostree types")
 				} else if imgTypeName == "iot-raw-xz" || imgTypeName == "iot-qcow2" {
-					assert.EqualError(t, err, fmt.Sprintf(distro.UnsupportedCustomizationError, imgTypeName, "User, Group, Directories, Files, Services, FIPS"))
+					assert.EqualError(t, err, fmt.Sprintf(distro.UnsupportedCustomizationError, imgTypeName, "User, Group, Directories, Files, Services, FIPS, Network, SSHServer, PasswordQuality, Limits, CryptoPolicy, Sudoers"))
 				} else if imgTypeName == "iot-installer" || imgTypeName == "iot-simplified-installer" || imgTypeName == "minimal-installer" {
 					continue
 				} else if imgTypeName == "workstation-live-installer" {
@@ -743,7 +743,7 @@ func TestFedoraDistro_TestRootMountPoint(t *testing.T) {
 				if imgTypeName == "iot-commit" || imgTypeName == "iot-container" || imgTypeName == "iot-bootable-container" {
 					assert.EqualError(t, err, "Custom mountpoints and partitioning are not supported for ostree types")
 				} else if imgTypeName == "iot-raw-xz" || imgTypeName == "iot-qcow2" {
-					assert.EqualError(t, err, fmt.Sprintf(distro.UnsupportedCustomizationError, imgTypeName, "User, Group, Directories, Files, Services, FIPS"))
+					assert.EqualError(t, err, fmt.Sprintf(distro.UnsupportedCustomizationError, imgTypeName, "User, Group, Directories, Files, Services, FIPS, Network, SSHServer, PasswordQuality, Limits, CryptoPolicy, Sudoers"))
 				} else if imgTypeName == "iot-installer" || imgTypeName == "iot-simplified-installer" || imgTypeName == "minimal-installer" {
 					continue
 				} else if imgTypeName == "workstation-live-installer" {
@@ -887,7 +887,7 @@ func TestFedoraDistro_CustomUsrPartitionNotLargeEnough(t *testing.T) {
 				if imgTypeName == "iot-commit" || imgTypeName == "iot-container" || imgTypeName == "iot-bootable-container" {
 					assert.EqualError(t, err, "Custom mountpoints and partitioning are not supported for ostree types")
 				} else if imgTypeName == "iot-raw-xz" || imgTypeName == "iot-qcow2" {
-					assert.EqualError(t, err, fmt.Sprintf(distro.UnsupportedCustomizationError, imgTypeName, "User, Group, Directories, Files, Services, FIPS"))
+					assert.EqualError(t, err, fmt.Sprintf(distro.UnsupportedCustomizationError, imgTypeName, "User, Group, Directories, Files, Services, FIPS, Network, SSHServer, PasswordQuality, Limits, CryptoPolicy, Sudoers"))
 				} else if imgTypeName == "iot-installer" || imgTypeName == "iot-simplified-installer" || imgTypeName == "minimal-installer" {
 					continue
 				} else if imgTypeName == "workstation-live-installer" {
@@ -931,7 +931,7 @@ func TestFedoraDistro_PartitioningConflict(t *testing.T) {
 				if imgTypeName == "iot-commit" || imgTypeName == "iot-container" || imgTypeName == "iot-bootable-container" {
 					assert.EqualError(t, err, "Custom mountpoints and partitioning are not supported for ostree types")
 				} else if imgTypeName == "iot-raw-xz" || imgTypeName == "iot-qcow2" {
-					assert.EqualError(t, err, fmt.Sprintf(distro.UnsupportedCustomizationError, imgTypeName, "User, Group, Directories, Files, Services, FIPS"))
+					assert.EqualError(t, err, fmt.Sprintf(distro.UnsupportedCustomizationError, imgTypeName, "User, Group, Directories, Files, Services, FIPS, Network, SSHServer, PasswordQuality, Limits, CryptoPolicy, Sudoers"))
 				} else if imgTypeName == "iot-installer" || imgTypeName == "iot-simplified-installer" || imgTypeName == "minimal-installer" {
 					continue
 				} else if imgTypeName == "workstation-live-installer" {
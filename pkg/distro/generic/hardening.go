@@ -0,0 +1,338 @@
+package generic
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/blueprint"
+	"github.com/osbuild/images/pkg/customizations/fsnode"
+	"github.com/osbuild/images/pkg/manifest"
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+const (
+	// bpSshdConfigDropinPath is the sshd configuration file with the
+	// options of the blueprint. sshd uses the first value it reads for
+	// every option and sshd_config includes sshd_config.d at the top, so
+	// the file sorts before the configuration of the distribution and the
+	// system-wide crypto policy (50-redhat.conf) and cloud-init
+	// (50-cloud-init.conf).
+	bpSshdConfigDropinPath = "/etc/ssh/sshd_config.d/40-blueprint.conf"
+
+	bpPamLimitsConfFilename = "blueprint.conf"
+)
+
+// sshdBoolString returns the boolean value as it is written to
+// sshd_config.
+func sshdBoolString(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+// permitRootLoginString returns the PermitRootLogin value as it is written
+// to sshd_config.
+func permitRootLoginString(value osbuild.PermitRootLoginValue) string {
+	switch value := value.(type) {
+	case osbuild.PermitRootLoginValueBool:
+		return sshdBoolString(bool(value))
+	case osbuild.PermitRootLoginValueStr:
+		return string(value)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// sshdConfigStageOptions merges the sshd options of the blueprint with the
+// sshd configuration of the image type. The blueprint options take
+// precedence and a warning is returned for every default value that is
+// overridden.
+func sshdConfigStageOptions(defaults *osbuild.SshdConfigStageOptions, sc *blueprint.SSHServerCustomization) (*osbuild.SshdConfigStageOptions, []string) {
+	if !sc.HasOptions() {
+		return defaults, nil
+	}
+
+	var config osbuild.SshdConfigConfig
+	if defaults != nil {
+		config = defaults.Config
+	}
+
+	var warnings []string
+	override := func(option string, bpValue, defaultValue string) {
+		if defaultValue != bpValue {
+			warnings = append(warnings, fmt.Sprintf("sshd %s: the blueprint value %s overrides the image type default %s", option, bpValue, defaultValue))
+		}
+	}
+
+	if sc.PasswordAuthentication != nil {
+		if config.PasswordAuthentication != nil {
+			override("PasswordAuthentication", sshdBoolString(*sc.PasswordAuthentication), sshdBoolString(*config.PasswordAuthentication))
+		}
+		config.PasswordAuthentication = common.ToPtr(*sc.PasswordAuthentication)
+	}
+	if sc.ChallengeResponseAuthentication != nil {
+		if config.ChallengeResponseAuthentication != nil {
+			override("ChallengeResponseAuthentication", sshdBoolString(*sc.ChallengeResponseAuthentication), sshdBoolString(*config.ChallengeResponseAuthentication))
+		}
+		config.ChallengeResponseAuthentication = common.ToPtr(*sc.ChallengeResponseAuthentication)
+	}
+	if sc.ClientAliveInterval != nil {
+		if config.ClientAliveInterval != nil {
+			override("ClientAliveInterval", strconv.Itoa(*sc.ClientAliveInterval), strconv.Itoa(*config.ClientAliveInterval))
+		}
+		config.ClientAliveInterval = common.ToPtr(*sc.ClientAliveInterval)
+	}
+	if sc.PermitRootLogin != "" {
+		var permitRootLogin osbuild.PermitRootLoginValue
+		switch sc.PermitRootLogin {
+		case "yes":
+			permitRootLogin = osbuild.PermitRootLoginValueYes
+		case "no":
+			permitRootLogin = osbuild.PermitRootLoginValueNo
+		default:
+			permitRootLogin = osbuild.PermitRootLoginValueStr(sc.PermitRootLogin)
+		}
+		if config.PermitRootLogin != nil {
+			override("PermitRootLogin", permitRootLoginString(permitRootLogin), permitRootLoginString(config.PermitRootLogin))
+		}
+		config.PermitRootLogin = permitRootLogin
+	}
+
+	return &osbuild.SshdConfigStageOptions{Config: config}, warnings
+}
+
+// sshdConfigDropin returns the sshd configuration file with the algorithms
+// of the blueprint, or nil if there are none. The sshd config stage does not
+// support these options. If withOptions is set, the other options of the
+// blueprint are written to the file too, so that they are not overridden by
+// the other files in sshd_config.d.
+func sshdConfigDropin(sc *blueprint.SSHServerCustomization, withOptions bool) (*fsnode.File, error) {
+	if !sc.HasAlgorithms() && !(withOptions && sc.HasOptions()) {
+		return nil, nil
+	}
+
+	var b strings.Builder
+	if withOptions {
+		if sc.PasswordAuthentication != nil {
+			fmt.Fprintf(&b, "PasswordAuthentication %s\n", sshdBoolString(*sc.PasswordAuthentication))
+		}
+		if sc.ChallengeResponseAuthentication != nil {
+			fmt.Fprintf(&b, "ChallengeResponseAuthentication %s\n", sshdBoolString(*sc.ChallengeResponseAuthentication))
+		}
+		if sc.PermitRootLogin != "" {
+			fmt.Fprintf(&b, "PermitRootLogin %s\n", sc.PermitRootLogin)
+		}
+		if sc.ClientAliveInterval != nil {
+			fmt.Fprintf(&b, "ClientAliveInterval %d\n", *sc.ClientAliveInterval)
+		}
+	}
+	for _, option := range []struct {
+		name       string
+		algorithms []string
+	}{
+		{"Ciphers", sc.Ciphers},
+		{"MACs", sc.MACs},
+		{"KexAlgorithms", sc.KexAlgorithms},
+	} {
+		if len(option.algorithms) > 0 {
+			fmt.Fprintf(&b, "%s %s\n", option.name, strings.Join(option.algorithms, ","))
+		}
+	}
+	return fsnode.NewFile(bpSshdConfigDropinPath, common.ToPtr(os.FileMode(0600)), "root", "root", []byte(b.String()))
+}
+
+// pwqualityConfStageOptions merges the password quality settings of the
+// blueprint with the pwquality configuration of the image type. The
+// blueprint settings take precedence and a warning is returned for every
+// default value that is overridden.
+func pwqualityConfStageOptions(defaults *osbuild.PwqualityConfStageOptions, pc *blueprint.PasswordQualityCustomization) (*osbuild.PwqualityConfStageOptions, []string) {
+	if pc == nil {
+		return defaults, nil
+	}
+
+	var config osbuild.PwqualityConfConfig
+	if defaults != nil {
+		config = defaults.Config
+	}
+
+	var warnings []string
+	for _, setting := range []struct {
+		name    string
+		bpValue *int
+		value   **int
+	}{
+		{"minlen", pc.MinLen, &config.Minlen},
+		{"dcredit", pc.DCredit, &config.Dcredit},
+		{"ucredit", pc.UCredit, &config.Ucredit},
+		{"lcredit", pc.LCredit, &config.Lcredit},
+		{"ocredit", pc.OCredit, &config.Ocredit},
+		{"minclass", pc.MinClass, &config.Minclass},
+	} {
+		if setting.bpValue == nil {
+			continue
+		}
+		if *setting.value != nil && **setting.value != *setting.bpValue {
+			warnings = append(warnings, fmt.Sprintf("pwquality %s: the blueprint value %d overrides the image type default %d", setting.name, *setting.bpValue, **setting.value))
+		}
+		*setting.value = common.ToPtr(*setting.bpValue)
+	}
+
+	return &osbuild.PwqualityConfStageOptions{Config: config}, warnings
+}
+
+func pamLimitsValueString(value osbuild.PamLimitsValue) string {
+	switch value := value.(type) {
+	case osbuild.PamLimitsValueInt:
+		return strconv.Itoa(int(value))
+	case osbuild.PamLimitsValueStr:
+		return string(value)
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// limitTypes returns the limit types that a pam_limits type sets.
+func limitTypes(limitType string) []string {
+	if limitType == string(osbuild.PamLimitsTypeBoth) {
+		return []string{string(osbuild.PamLimitsTypeSoft), string(osbuild.PamLimitsTypeHard)}
+	}
+	return []string{limitType}
+}
+
+// pamLimitsConfStageOptions merges the limits of the blueprint with the
+// pam_limits configuration files of the image type. The blueprint limits
+// take precedence: the limits they set are removed from the default
+// configuration files and a warning is returned for every default value that
+// is overridden.
+func pamLimitsConfStageOptions(defaults []*osbuild.PamLimitsConfStageOptions, limits []blueprint.LimitCustomization) ([]*osbuild.PamLimitsConfStageOptions, []string) {
+	if len(limits) == 0 {
+		return defaults, nil
+	}
+
+	bpValues := make(map[string]string)
+	config := make([]osbuild.PamLimitsConfigLine, 0, len(limits))
+	for _, l := range limits {
+		for _, t := range limitTypes(l.GetType()) {
+			bpValues[l.Domain+" "+t+" "+l.Item] = l.Value
+		}
+
+		var value osbuild.PamLimitsValue = osbuild.PamLimitsValueStr(l.Value)
+		if i, err := strconv.Atoi(l.Value); err == nil {
+			value = osbuild.PamLimitsValueInt(i)
+		}
+		config = append(config, osbuild.PamLimitsConfigLine{
+			Domain: l.Domain,
+			Type:   osbuild.PamLimitsType(l.GetType()),
+			Item:   osbuild.PamLimitsItem(l.Item),
+			Value:  value,
+		})
+	}
+
+	var warnings []string
+	merged := make([]*osbuild.PamLimitsConfStageOptions, 0, len(defaults)+1)
+	for _, opts := range defaults {
+		lines := make([]osbuild.PamLimitsConfigLine, 0, len(opts.Config))
+		for _, line := range opts.Config {
+			var kept []string
+			for _, t := range limitTypes(string(line.Type)) {
+				value, found := bpValues[line.Domain+" "+t+" "+string(line.Item)]
+				if !found {
+					kept = append(kept, t)
+					continue
+				}
+				if value != pamLimitsValueString(line.Value) {
+					warnings = append(warnings, fmt.Sprintf("limits: the blueprint value %q of the %s limit %s of domain %q overrides the image type default %q", value, t, line.Item, line.Domain, pamLimitsValueString(line.Value)))
+				}
+			}
+			switch len(kept) {
+			case 0:
+				continue
+			case 1:
+				// only one of the limits set by a "-" line is overridden
+				line.Type = osbuild.PamLimitsType(kept[0])
+			}
+			lines = append(lines, line)
+		}
+		if len(lines) > 0 {
+			merged = append(merged, osbuild.NewPamLimitsConfStageOptions(opts.Filename, lines))
+		}
+	}
+	merged = append(merged, osbuild.NewPamLimitsConfStageOptions(bpPamLimitsConfFilename, config))
+	return merged, warnings
+}
+
+// hardeningCustomizations holds the sshd, pwquality and pam_limits
+// configuration of an image, merged from the image type defaults and the
+// blueprint.
+type hardeningCustomizations struct {
+	SshdConfig       *osbuild.SshdConfigStageOptions
+	SshdConfigDropin *fsnode.File
+	PwQuality        *osbuild.PwqualityConfStageOptions
+	PamLimitsConf    []*osbuild.PamLimitsConfStageOptions
+
+	warnings []string
+}
+
+// getHardeningCustomizations validates the sshd, pwquality and limits
+// customizations and merges them with the defaults of the image type. If
+// customizedOnly is set, the configuration that the blueprint does not
+// customize is left unset instead of being set to the defaults, ostree
+// deployments inherit it from their commit.
+func getHardeningCustomizations(t *imageType, c *blueprint.Customizations, customizedOnly bool) (*hardeningCustomizations, error) {
+	sc, err := c.GetSSHServer()
+	if err != nil {
+		return nil, err
+	}
+	pc, err := c.GetPasswordQuality()
+	if err != nil {
+		return nil, err
+	}
+	limits, err := c.GetLimits()
+	if err != nil {
+		return nil, err
+	}
+
+	// sshd_config.d is not available before RHEL 9
+	sshdDropinSupported := true
+	switch t.arch.distro.DistroYAML.DistroLike {
+	case manifest.DISTRO_EL7, manifest.DISTRO_EL8:
+		sshdDropinSupported = false
+	}
+	if sc.HasAlgorithms() && !sshdDropinSupported {
+		return nil, fmt.Errorf("sshd: ciphers, macs and kex_algorithms are not supported on %s", t.arch.distro.Name())
+	}
+
+	imageConfig := t.getDefaultImageConfig()
+	hc := &hardeningCustomizations{}
+	var w []string
+	hc.SshdConfig, w = sshdConfigStageOptions(imageConfig.SshdConfig, sc)
+	hc.warnings = append(hc.warnings, w...)
+	if sshdDropinSupported {
+		// the options of the blueprint are written to the drop-in,
+		// sshd_config keeps the defaults of the image type
+		hc.SshdConfig = imageConfig.SshdConfig
+	}
+	hc.PwQuality, w = pwqualityConfStageOptions(imageConfig.PwQuality, pc)
+	hc.warnings = append(hc.warnings, w...)
+	hc.PamLimitsConf, w = pamLimitsConfStageOptions(imageConfig.PamLimitsConf, limits)
+	hc.warnings = append(hc.warnings, w...)
+	hc.SshdConfigDropin, err = sshdConfigDropin(sc, sshdDropinSupported)
+	if err != nil {
+		return nil, err
+	}
+
+	if customizedOnly {
+		if !sc.HasOptions() || sshdDropinSupported {
+			hc.SshdConfig = nil
+		}
+		if pc == nil {
+			hc.PwQuality = nil
+		}
+		if len(limits) == 0 {
+			hc.PamLimitsConf = nil
+		}
+	}
+	return hc, nil
+}
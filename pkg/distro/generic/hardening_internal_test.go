@@ -0,0 +1,252 @@
+package generic
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/blueprint"
+	"github.com/osbuild/images/pkg/distro"
+	"github.com/osbuild/images/pkg/osbuild"
+	"github.com/osbuild/images/pkg/ostree"
+)
+
+func TestSshdConfigStageOptions(t *testing.T) {
+	defaults := &osbuild.SshdConfigStageOptions{
+		Config: osbuild.SshdConfigConfig{
+			PasswordAuthentication: common.ToPtr(false),
+			ClientAliveInterval:    common.ToPtr(420),
+			PermitRootLogin:        osbuild.PermitRootLoginValueNo,
+		},
+	}
+
+	merged, warnings := sshdConfigStageOptions(defaults, nil)
+	assert.Equal(t, defaults, merged)
+	assert.Nil(t, warnings)
+
+	// algorithms are not set by the stage
+	merged, warnings = sshdConfigStageOptions(nil, &blueprint.SSHServerCustomization{Ciphers: []string{"aes256-ctr"}})
+	assert.Nil(t, merged)
+	assert.Nil(t, warnings)
+
+	merged, warnings = sshdConfigStageOptions(defaults, &blueprint.SSHServerCustomization{
+		PasswordAuthentication:          common.ToPtr(false),
+		ChallengeResponseAuthentication: common.ToPtr(false),
+		ClientAliveInterval:             common.ToPtr(300),
+		PermitRootLogin:                 "prohibit-password",
+	})
+	assert.Equal(t, &osbuild.SshdConfigStageOptions{
+		Config: osbuild.SshdConfigConfig{
+			PasswordAuthentication:          common.ToPtr(false),
+			ChallengeResponseAuthentication: common.ToPtr(false),
+			ClientAliveInterval:             common.ToPtr(300),
+			PermitRootLogin:                 osbuild.PermitRootLoginValueProhibitPassword,
+		},
+	}, merged)
+	assert.Equal(t, []string{
+		"sshd ClientAliveInterval: the blueprint value 300 overrides the image type default 420",
+		"sshd PermitRootLogin: the blueprint value prohibit-password overrides the image type default no",
+	}, warnings)
+
+	// the defaults are not modified
+	assert.Equal(t, 420, *defaults.Config.ClientAliveInterval)
+
+	merged, _ = sshdConfigStageOptions(nil, &blueprint.SSHServerCustomization{PermitRootLogin: "yes"})
+	assert.Equal(t, osbuild.PermitRootLoginValueYes, merged.Config.PermitRootLogin)
+}
+
+func TestSshdConfigDropin(t *testing.T) {
+	file, err := sshdConfigDropin(&blueprint.SSHServerCustomization{PasswordAuthentication: common.ToPtr(false)}, false)
+	require.NoError(t, err)
+	assert.Nil(t, file)
+
+	file, err = sshdConfigDropin(&blueprint.SSHServerCustomization{
+		Ciphers:       []string{"aes256-gcm@openssh.com", "aes256-ctr"},
+		KexAlgorithms: []string{"curve25519-sha256"},
+	}, false)
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/ssh/sshd_config.d/40-blueprint.conf", file.Path())
+	assert.Equal(t, common.ToPtr(os.FileMode(0600)), file.Mode())
+	assert.Equal(t, "Ciphers aes256-gcm@openssh.com,aes256-ctr\nKexAlgorithms curve25519-sha256\n", string(file.Data()))
+
+	// the options are written before the algorithms
+	file, err = sshdConfigDropin(&blueprint.SSHServerCustomization{
+		PasswordAuthentication:          common.ToPtr(false),
+		ChallengeResponseAuthentication: common.ToPtr(true),
+		PermitRootLogin:                 "prohibit-password",
+		ClientAliveInterval:             common.ToPtr(300),
+		MACs:                            []string{"hmac-sha2-512"},
+	}, true)
+	require.NoError(t, err)
+	assert.Equal(t, "PasswordAuthentication no\nChallengeResponseAuthentication yes\nPermitRootLogin prohibit-password\nClientAliveInterval 300\nMACs hmac-sha2-512\n", string(file.Data()))
+}
+
+func TestPwqualityConfStageOptions(t *testing.T) {
+	defaults := &osbuild.PwqualityConfStageOptions{
+		Config: osbuild.PwqualityConfConfig{
+			Minlen:   common.ToPtr(9),
+			Minclass: common.ToPtr(3),
+		},
+	}
+
+	merged, warnings := pwqualityConfStageOptions(defaults, &blueprint.PasswordQualityCustomization{
+		MinLen:  common.ToPtr(14),
+		DCredit: common.ToPtr(-1),
+	})
+	assert.Equal(t, &osbuild.PwqualityConfStageOptions{
+		Config: osbuild.PwqualityConfConfig{
+			Minlen:   common.ToPtr(14),
+			Dcredit:  common.ToPtr(-1),
+			Minclass: common.ToPtr(3),
+		},
+	}, merged)
+	assert.Equal(t, []string{"pwquality minlen: the blueprint value 14 overrides the image type default 9"}, warnings)
+	assert.Equal(t, 9, *defaults.Config.Minlen)
+}
+
+func TestPamLimitsConfStageOptions(t *testing.T) {
+	defaults := []*osbuild.PamLimitsConfStageOptions{
+		osbuild.NewPamLimitsConfStageOptions("99-sap.conf", []osbuild.PamLimitsConfigLine{
+			{Domain: "@sapsys", Type: osbuild.PamLimitsTypeHard, Item: osbuild.PamLimitsItemNofile, Value: osbuild.PamLimitsValueInt(1048576)},
+			{Domain: "@sapsys", Type: osbuild.PamLimitsTypeSoft, Item: osbuild.PamLimitsItemNofile, Value: osbuild.PamLimitsValueInt(1048576)},
+			{Domain: "@sapsys", Type: osbuild.PamLimitsTypeBoth, Item: osbuild.PamLimitsItemNproc, Value: osbuild.PamLimitsValueUnlimited},
+		}),
+	}
+
+	merged, warnings := pamLimitsConfStageOptions(defaults, nil)
+	assert.Equal(t, defaults, merged)
+	assert.Nil(t, warnings)
+
+	merged, warnings = pamLimitsConfStageOptions(defaults, []blueprint.LimitCustomization{
+		{Domain: "@sapsys", Item: "nofile", Value: "1048576"},
+		{Domain: "@sapsys", Type: "soft", Item: "nproc", Value: "4096"},
+		{Domain: "*", Type: "hard", Item: "core", Value: "0"},
+	})
+	assert.Equal(t, []*osbuild.PamLimitsConfStageOptions{
+		osbuild.NewPamLimitsConfStageOptions("99-sap.conf", []osbuild.PamLimitsConfigLine{
+			{Domain: "@sapsys", Type: osbuild.PamLimitsTypeHard, Item: osbuild.PamLimitsItemNproc, Value: osbuild.PamLimitsValueUnlimited},
+		}),
+		osbuild.NewPamLimitsConfStageOptions("blueprint.conf", []osbuild.PamLimitsConfigLine{
+			{Domain: "@sapsys", Type: osbuild.PamLimitsTypeBoth, Item: osbuild.PamLimitsItemNofile, Value: osbuild.PamLimitsValueInt(1048576)},
+			{Domain: "@sapsys", Type: osbuild.PamLimitsTypeSoft, Item: osbuild.PamLimitsItemNproc, Value: osbuild.PamLimitsValueInt(4096)},
+			{Domain: "*", Type: osbuild.PamLimitsTypeHard, Item: osbuild.PamLimitsItemCore, Value: osbuild.PamLimitsValueInt(0)},
+		}),
+	}, merged)
+	assert.Equal(t, []string{`limits: the blueprint value "4096" of the soft limit nproc of domain "@sapsys" overrides the image type default "unlimited"`}, warnings)
+
+	// the defaults are not modified
+	assert.Len(t, defaults[0].Config, 3)
+	assert.Equal(t, osbuild.PamLimitsTypeBoth, defaults[0].Config[2].Type)
+}
+
+func TestHardeningCustomizations(t *testing.T) {
+	bp := &blueprint.Blueprint{
+		Customizations: &blueprint.Customizations{
+			SSHServer: &blueprint.SSHServerCustomization{
+				PasswordAuthentication: common.ToPtr(true),
+				Ciphers:                []string{"aes256-gcm@openssh.com"},
+			},
+			PasswordQuality: &blueprint.PasswordQualityCustomization{
+				MinLen: common.ToPtr(14),
+			},
+			Limits: []blueprint.LimitCustomization{
+				{Domain: "@sapsys", Type: "hard", Item: "nofile", Value: "65536"},
+			},
+		},
+	}
+
+	d := common.Must(newDistro("rhel-9.6"))
+	a, err := d.GetArch("x86_64")
+	require.NoError(t, err)
+
+	it, err := a.GetImageType("qcow2")
+	require.NoError(t, err)
+	_, warnings, err := it.Manifest(bp, distro.ImageOptions{}, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	it, err = a.GetImageType("ec2-sap")
+	require.NoError(t, err)
+	_, warnings, err = it.Manifest(bp, distro.ImageOptions{}, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"sshd PasswordAuthentication: the blueprint value yes overrides the image type default no",
+		`limits: the blueprint value "65536" of the hard limit nofile of domain "@sapsys" overrides the image type default "1048576"`,
+	}, warnings)
+
+	// ostree deployments
+	it, err = a.GetImageType("edge-raw-image")
+	require.NoError(t, err)
+	_, _, err = it.Manifest(bp, distro.ImageOptions{OSTree: &ostree.ImageOptions{URL: "https://example.com/repo"}}, nil, nil)
+	assert.NoError(t, err)
+
+	// sshd_config.d is not available on RHEL 8
+	d = common.Must(newDistro("rhel-8.10"))
+	a, err = d.GetArch("x86_64")
+	require.NoError(t, err)
+	it, err = a.GetImageType("qcow2")
+	require.NoError(t, err)
+	_, _, err = it.Manifest(bp, distro.ImageOptions{}, nil, nil)
+	assert.EqualError(t, err, "sshd: ciphers, macs and kex_algorithms are not supported on rhel-8.10")
+
+	bp.Customizations.SSHServer.Ciphers = nil
+	_, _, err = it.Manifest(bp, distro.ImageOptions{}, nil, nil)
+	assert.NoError(t, err)
+}
+
+func TestHardeningCustomizationsCustomizedOnly(t *testing.T) {
+	d := common.Must(newDistro("rhel-9.6"))
+	a, err := d.GetArch("x86_64")
+	require.NoError(t, err)
+	it, err := a.GetImageType("ec2-sap")
+	require.NoError(t, err)
+	sap := it.(*imageType)
+	imageConfig := sap.getDefaultImageConfig()
+	require.NotNil(t, imageConfig.SshdConfig)
+	require.NotEmpty(t, imageConfig.PamLimitsConf)
+
+	hc, err := getHardeningCustomizations(sap, nil, false)
+	require.NoError(t, err)
+	assert.Equal(t, imageConfig.SshdConfig, hc.SshdConfig)
+	assert.Equal(t, imageConfig.PamLimitsConf, hc.PamLimitsConf)
+
+	// ostree deployments inherit the configuration of the commit
+	hc, err = getHardeningCustomizations(sap, nil, true)
+	require.NoError(t, err)
+	assert.Nil(t, hc.SshdConfig)
+	assert.Nil(t, hc.PwQuality)
+	assert.Nil(t, hc.PamLimitsConf)
+
+	// the sshd options are written to the drop-in, sshd_config keeps the
+	// defaults of the image type
+	customizations := &blueprint.Customizations{
+		SSHServer: &blueprint.SSHServerCustomization{ClientAliveInterval: common.ToPtr(300)},
+	}
+	hc, err = getHardeningCustomizations(sap, customizations, false)
+	require.NoError(t, err)
+	assert.Equal(t, imageConfig.SshdConfig, hc.SshdConfig)
+	require.NotNil(t, hc.SshdConfigDropin)
+	assert.Equal(t, "ClientAliveInterval 300\n", string(hc.SshdConfigDropin.Data()))
+
+	hc, err = getHardeningCustomizations(sap, customizations, true)
+	require.NoError(t, err)
+	assert.Nil(t, hc.SshdConfig)
+	require.NotNil(t, hc.SshdConfigDropin)
+	assert.Nil(t, hc.PamLimitsConf)
+
+	// the customized configuration is merged with the defaults where
+	// sshd_config.d is not available
+	d = common.Must(newDistro("rhel-8.10"))
+	a, err = d.GetArch("x86_64")
+	require.NoError(t, err)
+	rhel8It, err := a.GetImageType("qcow2")
+	require.NoError(t, err)
+	hc, err = getHardeningCustomizations(rhel8It.(*imageType), customizations, true)
+	require.NoError(t, err)
+	require.NotNil(t, hc.SshdConfig)
+	assert.Equal(t, 300, *hc.SshdConfig.Config.ClientAliveInterval)
+	assert.Nil(t, hc.SshdConfigDropin)
+}
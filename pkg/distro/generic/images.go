@@ -14,8 +14,10 @@ import (
 	"github.com/osbuild/images/pkg/customizations/fsnode"
 	"github.com/osbuild/images/pkg/customizations/ignition"
 	"github.com/osbuild/images/pkg/customizations/kickstart"
+	"github.com/osbuild/images/pkg/customizations/network"
 	"github.com/osbuild/images/pkg/customizations/oscap"
 	"github.com/osbuild/images/pkg/customizations/subscription"
+	"github.com/osbuild/images/pkg/customizations/sudoers"
 	"github.com/osbuild/images/pkg/customizations/users"
 	"github.com/osbuild/images/pkg/distro"
 	"github.com/osbuild/images/pkg/image"
@@ -177,6 +179,48 @@ func osCustomizations(t *imageType, osPackageSet rpmmd.PackageSet, options distr
 		panic(fmt.Sprintf("failed to convert file customizations to fs node files: %v", err))
 	}
 
+	nc, err := c.GetNetwork()
+	if err != nil {
+		return manifest.OSCustomizations{}, err
+	}
+	osc.NetworkConnections, err = network.KeyfilesFromBP(nc)
+	if err != nil {
+		return manifest.OSCustomizations{}, err
+	}
+
+	sysctl, err := c.GetSysctl()
+	if err != nil {
+		return manifest.OSCustomizations{}, err
+	}
+	modprobe, err := c.GetModprobe()
+	if err != nil {
+		return manifest.OSCustomizations{}, err
+	}
+	dracut, err := c.GetDracut()
+	if err != nil {
+		return manifest.OSCustomizations{}, err
+	}
+	osc.ModprobeOptions, err = moduleOptionsFile(modprobe)
+	if err != nil {
+		return manifest.OSCustomizations{}, err
+	}
+	hardening, err := getHardeningCustomizations(t, c, false)
+	if err != nil {
+		return manifest.OSCustomizations{}, err
+	}
+	osc.CryptoPolicy, osc.CryptoPolicyModules, err = cryptoPolicy(t, c)
+	if err != nil {
+		return manifest.OSCustomizations{}, err
+	}
+	sc, err := c.GetSudoers()
+	if err != nil {
+		return manifest.OSCustomizations{}, err
+	}
+	osc.Sudoers, err = sudoers.FileFromBP(sc)
+	if err != nil {
+		return manifest.OSCustomizations{}, err
+	}
+
 	// OSTree commits do not include data in `/var` since that is tied to the
 	// deployment, rather than the commit. Therefore the containers need to be
 	// stored in a different location, like `/usr/share`, and the container
@@ -260,22 +304,26 @@ func osCustomizations(t *imageType, osPackageSet rpmmd.PackageSet, options distr
 	osc.Sysconfig = imageConfig.SysconfigStageOptions()
 	osc.SystemdLogind = imageConfig.SystemdLogind
 	osc.CloudInit = imageConfig.CloudInit
-	osc.Modprobe = imageConfig.Modprobe
-	osc.DracutConf = imageConfig.DracutConf
+	// conflicts with the defaults are reported as warnings by the options
+	// checks
+	osc.Modprobe, _ = modprobeStageOptions(imageConfig.Modprobe, modprobe)
+	osc.DracutConf, _ = dracutConfStageOptions(imageConfig.DracutConf, dracut)
+	osc.RegenerateInitramfs = dracut != nil && (len(dracut.AddModules) > 0 || len(dracut.AddDrivers) > 0)
 	osc.SystemdDropin = imageConfig.SystemdDropin
 	osc.SystemdUnit = imageConfig.SystemdUnit
 	osc.Authselect = imageConfig.Authselect
 	osc.SELinuxConfig = imageConfig.SELinuxConfig
 	osc.Tuned = imageConfig.Tuned
 	osc.Tmpfilesd = imageConfig.Tmpfilesd
-	osc.PamLimitsConf = imageConfig.PamLimitsConf
-	osc.Sysctld = imageConfig.Sysctld
+	osc.PamLimitsConf = hardening.PamLimitsConf
+	osc.Sysctld, _ = sysctldStageOptions(imageConfig.Sysctld, sysctl)
 	osc.DNFConfig = imageConfig.DNFConfigOptions(t.arch.distro.OsVersion())
 	osc.DNFAutomaticConfig = imageConfig.DNFAutomaticConfig
 	osc.YUMConfig = imageConfig.YumConfig
-	osc.SshdConfig = imageConfig.SshdConfig
+	osc.SshdConfig = hardening.SshdConfig
+	osc.SshdConfigDropin = hardening.SshdConfigDropin
 	osc.AuthConfig = imageConfig.Authconfig
-	osc.PwQuality = imageConfig.PwQuality
+	osc.PwQuality = hardening.PwQuality
 	osc.Subscription = options.Subscription
 	osc.WAAgentConfig = imageConfig.WAAgentConfig
 	osc.UdevRules = imageConfig.UdevRules
@@ -314,6 +362,10 @@ func osCustomizations(t *imageType, osPackageSet rpmmd.PackageSet, options distr
 		osc.MountUnits = *imageConfig.MountUnits
 	}
 
+	if imageConfig.SystemdRepart != nil {
+		osc.SystemdRepart = *imageConfig.SystemdRepart
+	}
+
 	osc.VersionlockPackages = imageConfig.VersionlockPackages
 
 	return osc, nil
@@ -361,6 +413,34 @@ func ostreeDeploymentCustomizations(
 	if err != nil {
 		return manifest.OSTreeDeploymentCustomizations{}, err
 	}
+	nc, err := c.GetNetwork()
+	if err != nil {
+		return manifest.OSTreeDeploymentCustomizations{}, err
+	}
+	deploymentConf.NetworkConnections, err = network.KeyfilesFromBP(nc)
+	if err != nil {
+		return manifest.OSTreeDeploymentCustomizations{}, err
+	}
+	hardening, err := getHardeningCustomizations(t, c, true)
+	if err != nil {
+		return manifest.OSTreeDeploymentCustomizations{}, err
+	}
+	deploymentConf.SshdConfig = hardening.SshdConfig
+	deploymentConf.SshdConfigDropin = hardening.SshdConfigDropin
+	deploymentConf.PwQuality = hardening.PwQuality
+	deploymentConf.PamLimitsConf = hardening.PamLimitsConf
+	deploymentConf.CryptoPolicy, deploymentConf.CryptoPolicyModules, err = cryptoPolicy(t, c)
+	if err != nil {
+		return manifest.OSTreeDeploymentCustomizations{}, err
+	}
+	sc, err := c.GetSudoers()
+	if err != nil {
+		return manifest.OSTreeDeploymentCustomizations{}, err
+	}
+	deploymentConf.Sudoers, err = sudoers.FileFromBP(sc)
+	if err != nil {
+		return manifest.OSTreeDeploymentCustomizations{}, err
+	}
 
 	language, keyboard := c.GetPrimaryLocale()
 	if language != nil {
@@ -422,6 +502,14 @@ func diskImage(workload workload.Workload,
 	}
 	img.PartitionTable = pt
 
+	img.AdditionalDisks, err = t.getAdditionalDisks(bp.Customizations, pt, rng)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.deriveUUIDs(bp, options, pt, img.AdditionalDisks); err != nil {
+		return nil, err
+	}
+
 	img.Filename = t.Filename()
 
 	img.VPCForceSize = t.ImageTypeYAML.DiskImageVPCForceSize
@@ -890,6 +978,9 @@ func iotImage(workload workload.Workload,
 	if err != nil {
 		return nil, err
 	}
+	if err := t.deriveUUIDs(bp, options, pt, nil); err != nil {
+		return nil, err
+	}
 	img.PartitionTable = pt
 
 	img.Filename = t.Filename()
@@ -935,6 +1026,9 @@ func iotSimplifiedInstallerImage(workload workload.Workload,
 	if err != nil {
 		return nil, err
 	}
+	if err := t.deriveUUIDs(bp, options, pt, nil); err != nil {
+		return nil, err
+	}
 	rawImg.PartitionTable = pt
 
 	rawImg.Filename = t.Filename()
@@ -6,6 +6,8 @@ import (
 	"math/rand"
 	"slices"
 
+	"github.com/google/uuid"
+
 	"github.com/osbuild/images/internal/common"
 	"github.com/osbuild/images/internal/workload"
 	"github.com/osbuild/images/pkg/arch"
@@ -157,15 +159,57 @@ func (t *imageType) BasePartitionTable() (*disk.PartitionTable, error) {
 }
 
 func (t *imageType) getPartitionTable(customizations *blueprint.Customizations, options distro.ImageOptions, rng *rand.Rand) (*disk.PartitionTable, error) {
-	basePartitionTable, err := t.BasePartitionTable()
+	pt, _, err := t.newPartitionTable(customizations, options, rng, false)
+	return pt, err
+}
+
+// ExplainPartitionTable returns the layouts of the partition tables of the
+// main disk and the additional disks (in this order) that are created for the
+// blueprint and options, including the rules that created and resized each
+// entity. This is meant for debugging partition table layouts.
+func (t *imageType) ExplainPartitionTable(bp *blueprint.Blueprint, options distro.ImageOptions, rng *rand.Rand) ([]*disk.Layout, error) {
+	// the options are checked like for the manifest, e.g. the sector size
+	if _, err := t.checkOptions(bp, options); err != nil {
+		return nil, err
+	}
+
+	pt, explanation, err := t.newPartitionTable(bp.Customizations, options, rng, true)
 	if err != nil {
 		return nil, err
 	}
+	additionalDisks, explanations, err := t.newAdditionalDisks(bp.Customizations, pt, rng, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.deriveUUIDs(bp, options, pt, additionalDisks); err != nil {
+		return nil, err
+	}
+
+	layouts := []*disk.Layout{explanation.Layout(pt)}
+	for idx, additionalDisk := range additionalDisks {
+		layout := explanations[idx].Layout(additionalDisk.PartitionTable)
+		layout.Name = additionalDisk.Name
+		layouts = append(layouts, layout)
+	}
+	return layouts, nil
+}
+
+// newPartitionTable creates the partition table for the image type; the
+// explanation is only returned if explain is true.
+func (t *imageType) newPartitionTable(customizations *blueprint.Customizations, options distro.ImageOptions, rng *rand.Rand, explain bool) (*disk.PartitionTable, *disk.Explanation, error) {
+	basePartitionTable, err := t.BasePartitionTable()
+	if err != nil {
+		return nil, nil, err
+	}
+	if options.SectorSize != 0 {
+		basePartitionTable = basePartitionTable.Clone().(*disk.PartitionTable)
+		basePartitionTable.SectorSize = options.SectorSize
+	}
 
 	imageSize := t.Size(options.Size)
 	partitioning, err := customizations.GetPartitioning()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	if partitioning != nil {
 		// Use the new custom partition table to create a PT fully based on the user's customizations.
@@ -176,18 +220,89 @@ func (t *imageType) getPartitionTable(customizations *blueprint.Customizations,
 			partitioning.MinSize = imageSize
 		}
 
-		partOptions := &disk.CustomPartitionTableOptions{
-			PartitionTableType: basePartitionTable.Type, // PT type is not customizable, it is determined by the base PT for an image type or architecture
-			BootMode:           t.BootMode(),
-			DefaultFSType:      t.arch.distro.DefaultFSType,
-			RequiredMinSizes:   t.ImageTypeYAML.RequiredPartitionSizes,
-			Architecture:       t.platform.GetArch(),
+		if explain {
+			return disk.ExplainNewCustomPartitionTable(partitioning, t.customPartitionTableOptions(basePartitionTable), rng)
 		}
-		return disk.NewCustomPartitionTable(partitioning, partOptions, rng)
+		pt, err := disk.NewCustomPartitionTable(partitioning, t.customPartitionTableOptions(basePartitionTable), rng)
+		return pt, nil, err
 	}
 
 	mountpoints := customizations.GetFilesystems()
-	return disk.NewPartitionTable(basePartitionTable, mountpoints, imageSize, options.PartitioningMode, t.platform.GetArch(), t.ImageTypeYAML.RequiredPartitionSizes, rng)
+	if explain {
+		return disk.ExplainNewPartitionTable(basePartitionTable, mountpoints, imageSize, options.PartitioningMode, t.platform.GetArch(), t.ImageTypeYAML.RequiredPartitionSizes, rng)
+	}
+	pt, err := disk.NewPartitionTable(basePartitionTable, mountpoints, imageSize, options.PartitioningMode, t.platform.GetArch(), t.ImageTypeYAML.RequiredPartitionSizes, rng)
+	return pt, nil, err
+}
+
+// derivedUUIDNamespace is the namespace for the UUIDs of all image types
+// when deterministic UUIDs are requested in the image options.
+var derivedUUIDNamespace = uuid.MustParse("39a8c4df-3810-46b4-9f36-cc50fad3e4f9")
+
+// deriveUUIDs replaces the randomly generated UUIDs of the partition tables
+// with UUIDs derived from the distribution, architecture, image type, and
+// the blueprint name and version if requested in the image options. Fixed
+// UUIDs of the base partition table are kept.
+func (t *imageType) deriveUUIDs(bp *blueprint.Blueprint, options distro.ImageOptions, pt *disk.PartitionTable, additionalDisks []disk.AdditionalDisk) error {
+	if !options.DeterministicUUIDs || pt == nil {
+		return nil
+	}
+	basePartitionTable, err := t.BasePartitionTable()
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s/%s/%s/%s/%s", t.arch.distro.Name(), t.arch.name, t.Name(), bp.Name, bp.Version)
+	namespace := uuid.NewSHA1(derivedUUIDNamespace, []byte(name))
+	pt.DeriveUUIDs(namespace, basePartitionTable)
+	for _, additionalDisk := range additionalDisks {
+		additionalDisk.PartitionTable.DeriveUUIDs(uuid.NewSHA1(namespace, []byte(additionalDisk.Name)), nil)
+	}
+	return nil
+}
+
+// getAdditionalDisks creates the partition tables for the additional disks
+// from the disk customizations. The partition table of the main disk, pt,
+// is needed to generate names that are unique across all disks.
+func (t *imageType) getAdditionalDisks(customizations *blueprint.Customizations, pt *disk.PartitionTable, rng *rand.Rand) ([]disk.AdditionalDisk, error) {
+	disks, _, err := t.newAdditionalDisks(customizations, pt, rng, false)
+	return disks, err
+}
+
+// newAdditionalDisks implements getAdditionalDisks; the explanations are only
+// returned if explain is true.
+func (t *imageType) newAdditionalDisks(customizations *blueprint.Customizations, pt *disk.PartitionTable, rng *rand.Rand, explain bool) ([]disk.AdditionalDisk, []*disk.Explanation, error) {
+	partitioning, err := customizations.GetPartitioning()
+	if err != nil {
+		return nil, nil, err
+	}
+	if partitioning == nil || len(partitioning.AdditionalDisks) == 0 {
+		return nil, nil, nil
+	}
+
+	basePartitionTable, err := t.BasePartitionTable()
+	if err != nil {
+		return nil, nil, err
+	}
+	options := t.customPartitionTableOptions(basePartitionTable)
+	// all disks of an image share the sector size
+	options.SectorSize = pt.SectorSize
+	if explain {
+		return disk.ExplainNewCustomAdditionalDisks(partitioning, pt, options, rng)
+	}
+	disks, err := disk.NewCustomAdditionalDisks(partitioning, pt, options, rng)
+	return disks, nil, err
+}
+
+func (t *imageType) customPartitionTableOptions(basePartitionTable *disk.PartitionTable) *disk.CustomPartitionTableOptions {
+	return &disk.CustomPartitionTableOptions{
+		PartitionTableType: basePartitionTable.Type, // PT type is not customizable, it is determined by the base PT for an image type or architecture
+		BootMode:           t.BootMode(),
+		DefaultFSType:      t.arch.distro.DefaultFSType,
+		RequiredMinSizes:   t.ImageTypeYAML.RequiredPartitionSizes,
+		Architecture:       t.platform.GetArch(),
+		SectorSize:         basePartitionTable.SectorSize,
+	}
 }
 
 func (t *imageType) getDefaultImageConfig() *distro.ImageConfig {
@@ -326,24 +441,27 @@ func (t *imageType) Manifest(bp *blueprint.Blueprint,
 // Returns ([]string, error) where []string, if non-nil, will hold any generated warnings (e.g. deprecation notices).
 func (t *imageType) checkOptions(bp *blueprint.Blueprint, options distro.ImageOptions) ([]string, error) {
 
-	if warnings, err := checkOptionsCommon(t, bp, options); err != nil {
-		return warnings, err
+	commonWarnings, err := checkOptionsCommon(t, bp, options)
+	if err != nil {
+		return commonWarnings, err
 	}
 
+	var warnings []string
 	switch idLike := t.arch.distro.DistroYAML.DistroLike; idLike {
 	case manifest.DISTRO_FEDORA:
-		return checkOptionsFedora(t, bp, options)
+		warnings, err = checkOptionsFedora(t, bp, options)
 	case manifest.DISTRO_EL7:
-		return checkOptionsRhel7(t, bp, options)
+		warnings, err = checkOptionsRhel7(t, bp, options)
 	case manifest.DISTRO_EL8:
-		return checkOptionsRhel8(t, bp, options)
+		warnings, err = checkOptionsRhel8(t, bp, options)
 	case manifest.DISTRO_EL9:
-		return checkOptionsRhel9(t, bp, options)
+		warnings, err = checkOptionsRhel9(t, bp, options)
 	case manifest.DISTRO_EL10:
-		return checkOptionsRhel10(t, bp, options)
+		warnings, err = checkOptionsRhel10(t, bp, options)
 	default:
 		return nil, fmt.Errorf("checkOptions called with unknown distro-like %v", idLike)
 	}
+	return append(commonWarnings, warnings...), err
 }
 
 func bootstrapContainerFor(t *imageType) string {
@@ -0,0 +1,258 @@
+package generic
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/blueprint"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/distro"
+	"github.com/osbuild/images/pkg/ostree"
+)
+
+// checkPackageAndOSTreeManifests checks that the manifests of a package
+// based and an ostree based image type of the arch can be generated for the
+// blueprint, the latter applies the customizations to the deployment.
+func checkPackageAndOSTreeManifests(t *testing.T, a distro.Arch, bp *blueprint.Blueprint) {
+	t.Helper()
+
+	for _, name := range []string{"qcow2", "iot-raw-xz"} {
+		t.Run(name, func(t *testing.T) {
+			it, err := a.GetImageType(name)
+			require.NoError(t, err)
+			var options distro.ImageOptions
+			if it.OSTreeRef() != "" {
+				options.OSTree = &ostree.ImageOptions{URL: "https://example.com/repo"}
+			}
+			_, _, err = it.Manifest(bp, options, nil, nil)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestDeriveUUIDs(t *testing.T) {
+	d := common.Must(newDistro("fedora-42"))
+	a, err := d.GetArch("x86_64")
+	require.NoError(t, err)
+	it, err := a.GetImageType("qcow2")
+	require.NoError(t, err)
+
+	bp := &blueprint.Blueprint{
+		Name:    "test",
+		Version: "1.0.0",
+		Customizations: &blueprint.Customizations{
+			Filesystem: []blueprint.FilesystemCustomization{
+				{Mountpoint: "/var/log", MinSize: 1 * 1024 * 1024 * 1024},
+			},
+		},
+	}
+
+	newPT := func(bp *blueprint.Blueprint, options distro.ImageOptions, seed int64) *disk.PartitionTable {
+		/* #nosec G404 */
+		pt, err := it.(*imageType).getPartitionTable(bp.Customizations, options, rand.New(rand.NewSource(seed)))
+		require.NoError(t, err)
+		require.NoError(t, it.(*imageType).deriveUUIDs(bp, options, pt, nil))
+		return pt
+	}
+
+	// without the option the UUIDs depend on the seed
+	assert.NotEqual(t, newPT(bp, distro.ImageOptions{}, 1), newPT(bp, distro.ImageOptions{}, 2))
+
+	options := distro.ImageOptions{DeterministicUUIDs: true}
+	pt := newPT(bp, options, 1)
+	assert.Equal(t, pt, newPT(bp, options, 2))
+
+	// a different blueprint version results in different UUIDs
+	bp2 := *bp
+	bp2.Version = "1.0.1"
+	assert.NotEqual(t, pt, newPT(&bp2, options, 1))
+}
+
+func TestSectorSizeOption(t *testing.T) {
+	d := common.Must(newDistro("fedora-42"))
+	a, err := d.GetArch("aarch64")
+	require.NoError(t, err)
+	it, err := a.GetImageType("qcow2")
+	require.NoError(t, err)
+
+	options := distro.ImageOptions{SectorSize: disk.SectorSize4Kn}
+	for name, customizations := range map[string]*blueprint.Customizations{
+		"default":    {},
+		"filesystem": {Filesystem: []blueprint.FilesystemCustomization{{Mountpoint: "/data", MinSize: 1024 * 1024 * 1024}}},
+		"disk": {
+			Disk: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Type: "plain",
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/data",
+							FSType:     "xfs",
+						},
+					},
+				},
+			},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			/* #nosec G404 */
+			pt, err := it.(*imageType).getPartitionTable(customizations, options, rand.New(rand.NewSource(0)))
+			require.NoError(t, err)
+			assert.Equal(t, uint64(disk.SectorSize4Kn), pt.SectorSize)
+		})
+	}
+
+	_, _, err = it.Manifest(&blueprint.Blueprint{}, options, nil, nil)
+	assert.NoError(t, err)
+
+	_, _, err = it.Manifest(&blueprint.Blueprint{}, distro.ImageOptions{SectorSize: 1024}, nil, nil)
+	assert.EqualError(t, err, "unsupported sector size 1024 (must be 512 or 4096)")
+
+	// the x86_64 qcow2 boots with BIOS and UEFI
+	a, err = d.GetArch("x86_64")
+	require.NoError(t, err)
+	it, err = a.GetImageType("qcow2")
+	require.NoError(t, err)
+	_, _, err = it.Manifest(&blueprint.Blueprint{}, options, nil, nil)
+	assert.EqualError(t, err, `sector size 4096 is not supported for "server-qcow2": BIOS boot requires a sector size of 512`)
+	_, _, err = it.Manifest(&blueprint.Blueprint{}, distro.ImageOptions{SectorSize: disk.DefaultSectorSize}, nil, nil)
+	assert.NoError(t, err)
+}
+
+func TestNetworkCustomization(t *testing.T) {
+	d := common.Must(newDistro("fedora-42"))
+	a, err := d.GetArch("x86_64")
+	require.NoError(t, err)
+
+	bp := &blueprint.Blueprint{
+		Customizations: &blueprint.Customizations{
+			Network: &blueprint.NetworkCustomization{
+				Interfaces: []blueprint.NetworkInterfaceCustomization{
+					{
+						Name: "eth0",
+						IPv4: &blueprint.NetworkIPCustomization{
+							Addresses: []string{"192.168.1.10/24"},
+							Gateway:   "192.168.1.1",
+						},
+					},
+				},
+			},
+		},
+	}
+
+	checkPackageAndOSTreeManifests(t, a, bp)
+
+	bp.Customizations.Network.Interfaces[0].IPv4.Gateway = "fe80::1"
+	it, err := a.GetImageType("qcow2")
+	require.NoError(t, err)
+	_, _, err = it.Manifest(bp, distro.ImageOptions{}, nil, nil)
+	assert.EqualError(t, err, `network interface "eth0": ipv4: gateway: invalid address "fe80::1"`)
+}
+
+func TestRAIDPartitionsRejected(t *testing.T) {
+	d := common.Must(newDistro("fedora-42"))
+	a, err := d.GetArch("x86_64")
+	require.NoError(t, err)
+	it, err := a.GetImageType("qcow2")
+	require.NoError(t, err)
+
+	bp := &blueprint.Blueprint{
+		Customizations: &blueprint.Customizations{
+			Disk: &blueprint.DiskCustomization{
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						Type: "raid",
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/data",
+							FSType:     "xfs",
+						},
+					},
+				},
+			},
+		},
+	}
+	// osbuild cannot create md RAID arrays, so there is no "raid" type
+	_, _, err = it.Manifest(bp, distro.ImageOptions{}, nil, nil)
+	assert.ErrorContains(t, err, "unknown partition type: raid")
+}
+
+func TestAdditionalDisksExported(t *testing.T) {
+	d := common.Must(newDistro("fedora-42"))
+	a, err := d.GetArch("x86_64")
+	require.NoError(t, err)
+
+	bp := &blueprint.Blueprint{
+		Customizations: &blueprint.Customizations{
+			Disk: &blueprint.DiskCustomization{
+				AdditionalDisks: []blueprint.DiskCustomization{
+					{
+						Name: "data",
+						Partitions: []blueprint.PartitionCustomization{
+							{
+								FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+									Mountpoint: "/var/lib/data",
+									FSType:     "xfs",
+								},
+								MinSize: 1024 * 1024 * 1024,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	for _, name := range []string{"qcow2", "minimal-raw-xz", "minimal-raw-zst"} {
+		t.Run(name, func(t *testing.T) {
+			it, err := a.GetImageType(name)
+			require.NoError(t, err)
+			mf, _, err := it.Manifest(bp, distro.ImageOptions{}, nil, nil)
+			require.NoError(t, err)
+			// the image files of the additional disks must be in a
+			// pipeline that is exported
+			assert.Equal(t, it.Exports(), mf.GetExports())
+		})
+	}
+}
+
+func TestSystemdRepartPartitionTableType(t *testing.T) {
+	d := common.Must(newDistro("fedora-42"))
+	a, err := d.GetArch("x86_64")
+	require.NoError(t, err)
+	it, err := a.GetImageType("qcow2")
+	require.NoError(t, err)
+
+	// enable systemd-repart on a copy of the image type
+	repartIt := *it.(*imageType)
+	imageConfig := distro.ImageConfig{}
+	if ic := repartIt.ImageConfigYAML.ImageConfig; ic != nil {
+		imageConfig = *ic
+	}
+	imageConfig.SystemdRepart = common.ToPtr(true)
+	repartIt.ImageConfigYAML.ImageConfig = &imageConfig
+
+	_, _, err = repartIt.Manifest(&blueprint.Blueprint{}, distro.ImageOptions{}, nil, nil)
+	assert.NoError(t, err)
+
+	bp := &blueprint.Blueprint{
+		Customizations: &blueprint.Customizations{
+			Disk: &blueprint.DiskCustomization{
+				Type: "dos",
+				Partitions: []blueprint.PartitionCustomization{
+					{
+						FilesystemTypedCustomization: blueprint.FilesystemTypedCustomization{
+							Mountpoint: "/data",
+							FSType:     "xfs",
+						},
+						MinSize: 1024 * 1024 * 1024,
+					},
+				},
+			},
+		},
+	}
+	_, _, err = repartIt.Manifest(bp, distro.ImageOptions{}, nil, nil)
+	assert.EqualError(t, err, `systemd-repart requires a gpt partition table, got dos for "server-qcow2"`)
+}
@@ -0,0 +1,217 @@
+package generic
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/blueprint"
+	"github.com/osbuild/images/pkg/customizations/fsnode"
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+// Names of the configuration files created for the sysctl, modprobe, and
+// dracut blueprint customizations. They are added next to the configuration
+// files of the image type.
+const (
+	bpSysctldFilename    = "blueprint.conf"
+	bpModprobeFilename   = "blacklist-blueprint.conf"
+	bpDracutConfFilename = "blueprint.conf"
+	bpModuleOptionsPath  = "/etc/modprobe.d/blueprint.conf"
+)
+
+// modprobeInstallDisabled is the command line of the install commands that
+// prevent a kernel module from being loaded at all.
+const modprobeInstallDisabled = "/bin/true"
+
+// sysctldStageOptions merges the sysctl settings of the blueprint with the
+// sysctl.d configuration files of the image type. The blueprint settings take
+// precedence: the keys they set are removed from the default configuration
+// files and a warning is returned for every default value that is
+// overridden.
+func sysctldStageOptions(defaults []*osbuild.SysctldStageOptions, sysctl []blueprint.SysctlCustomization) ([]*osbuild.SysctldStageOptions, []string) {
+	if len(sysctl) == 0 {
+		return defaults, nil
+	}
+
+	bpValues := make(map[string]string, len(sysctl))
+	config := make([]osbuild.SysctldConfigLine, 0, len(sysctl))
+	for _, s := range sysctl {
+		bpValues[blueprint.NormalizeSysctlKey(s.Key)] = s.Value
+		config = append(config, osbuild.SysctldConfigLine{Key: s.Key, Value: s.Value})
+	}
+
+	var warnings []string
+	merged := make([]*osbuild.SysctldStageOptions, 0, len(defaults)+1)
+	for _, opts := range defaults {
+		lines := make([]osbuild.SysctldConfigLine, 0, len(opts.Config))
+		for _, line := range opts.Config {
+			value, found := bpValues[blueprint.NormalizeSysctlKey(line.Key)]
+			if !found {
+				lines = append(lines, line)
+				continue
+			}
+			if value != line.Value {
+				warnings = append(warnings, fmt.Sprintf("sysctl %q: the blueprint value %q overrides the image type default %q", line.Key, value, line.Value))
+			}
+		}
+		if len(lines) > 0 {
+			merged = append(merged, osbuild.NewSysctldStageOptions(opts.Filename, lines))
+		}
+	}
+	merged = append(merged, osbuild.NewSysctldStageOptions(bpSysctldFilename, config))
+	return merged, warnings
+}
+
+// modprobeStageOptions adds the modules blacklisted by the blueprint to the
+// modprobe configuration files of the image type. Modules that are already
+// blacklisted are skipped. A warning is returned for every module with
+// options in the blueprint that the image type blacklists or disables.
+func modprobeStageOptions(defaults []*osbuild.ModprobeStageOptions, mc *blueprint.ModprobeCustomization) ([]*osbuild.ModprobeStageOptions, []string) {
+	if mc == nil {
+		return defaults, nil
+	}
+
+	blacklisted := make(map[string]bool)
+	disabled := make(map[string]bool)
+	for _, opts := range defaults {
+		for _, cmd := range opts.Commands {
+			switch cmd := cmd.(type) {
+			case *osbuild.ModprobeConfigCmdBlacklist:
+				blacklisted[cmd.Modulename] = true
+			case *osbuild.ModprobeConfigCmdInstall:
+				if cmd.Cmdline == modprobeInstallDisabled {
+					disabled[cmd.Modulename] = true
+				}
+			}
+		}
+	}
+
+	var warnings []string
+	for _, mo := range mc.Options {
+		switch {
+		case disabled[mo.Module]:
+			warnings = append(warnings, fmt.Sprintf("modprobe: kernel module %q is disabled by the image type, its options have no effect", mo.Module))
+		case blacklisted[mo.Module]:
+			warnings = append(warnings, fmt.Sprintf("modprobe: kernel module %q is blacklisted by the image type, its options only apply when it is loaded explicitly", mo.Module))
+		}
+	}
+
+	var commands osbuild.ModprobeConfigCmdList
+	for _, module := range mc.Blacklist {
+		if blacklisted[module] {
+			continue
+		}
+		blacklisted[module] = true
+		commands = append(commands, osbuild.NewModprobeConfigCmdBlacklist(module))
+	}
+	if len(commands) == 0 {
+		return defaults, warnings
+	}
+
+	merged := slices.Clone(defaults)
+	merged = append(merged, &osbuild.ModprobeStageOptions{
+		Filename: bpModprobeFilename,
+		Commands: commands,
+	})
+	return merged, warnings
+}
+
+// moduleOptionsFile returns the modprobe configuration file with the module
+// options of the blueprint, or nil if there are none. The modprobe stage
+// does not support the options command.
+func moduleOptionsFile(mc *blueprint.ModprobeCustomization) (*fsnode.File, error) {
+	if mc == nil || len(mc.Options) == 0 {
+		return nil, nil
+	}
+
+	var b strings.Builder
+	for _, mo := range mc.Options {
+		fmt.Fprintf(&b, "options %s %s\n", mo.Module, strings.TrimSpace(mo.Options))
+	}
+	return fsnode.NewFile(bpModuleOptionsPath, common.ToPtr(os.FileMode(0644)), "root", "root", []byte(b.String()))
+}
+
+// dracutConfStageOptions adds the dracut modules and drivers of the
+// blueprint to the dracut configuration files of the image type. Modules
+// that the image type omits are removed from its omit list, with a warning.
+func dracutConfStageOptions(defaults []*osbuild.DracutConfStageOptions, dc *blueprint.DracutCustomization) ([]*osbuild.DracutConfStageOptions, []string) {
+	if dc == nil || (len(dc.AddModules) == 0 && len(dc.AddDrivers) == 0) {
+		return defaults, nil
+	}
+
+	var warnings []string
+	merged := make([]*osbuild.DracutConfStageOptions, 0, len(defaults)+1)
+	for _, opts := range defaults {
+		omit := slices.DeleteFunc(slices.Clone(opts.Config.OmitModules), func(module string) bool {
+			if slices.Contains(dc.AddModules, module) {
+				warnings = append(warnings, fmt.Sprintf("dracut: module %q is omitted by the image type configuration %q, the blueprint adds it", module, opts.Filename))
+				return true
+			}
+			return false
+		})
+		if len(omit) == len(opts.Config.OmitModules) {
+			merged = append(merged, opts)
+			continue
+		}
+
+		config := opts.Config
+		config.OmitModules = nil
+		if len(omit) > 0 {
+			config.OmitModules = omit
+		}
+		// a configuration file that only omitted the added modules is dropped
+		if !reflect.ValueOf(config).IsZero() {
+			merged = append(merged, &osbuild.DracutConfStageOptions{
+				Filename: opts.Filename,
+				Config:   config,
+			})
+		}
+	}
+
+	merged = append(merged, &osbuild.DracutConfStageOptions{
+		Filename: bpDracutConfFilename,
+		Config: osbuild.DracutConfigFile{
+			AddModules: dc.AddModules,
+			AddDrivers: dc.AddDrivers,
+		},
+	})
+	return merged, warnings
+}
+
+// checkKernelTuningCustomizations validates the sysctl, modprobe, and dracut
+// customizations and returns warnings for the conflicts with the defaults of
+// the image type.
+func checkKernelTuningCustomizations(t *imageType, c *blueprint.Customizations) ([]string, error) {
+	sysctl, err := c.GetSysctl()
+	if err != nil {
+		return nil, err
+	}
+	modprobe, err := c.GetModprobe()
+	if err != nil {
+		return nil, err
+	}
+	dracut, err := c.GetDracut()
+	if err != nil {
+		return nil, err
+	}
+
+	// the initramfs is regenerated for the kernel of the image, see
+	// osCustomizations
+	if dracut != nil && (len(dracut.AddModules) > 0 || len(dracut.AddDrivers) > 0) && !t.ImageTypeYAML.Bootable && !t.ImageTypeYAML.RPMOSTree {
+		return nil, fmt.Errorf("dracut customizations are not supported for %q: the image has no kernel", t.Name())
+	}
+
+	imageConfig := t.getDefaultImageConfig()
+	var warnings []string
+	_, w := sysctldStageOptions(imageConfig.Sysctld, sysctl)
+	warnings = append(warnings, w...)
+	_, w = modprobeStageOptions(imageConfig.Modprobe, modprobe)
+	warnings = append(warnings, w...)
+	_, w = dracutConfStageOptions(imageConfig.DracutConf, dracut)
+	warnings = append(warnings, w...)
+	return warnings, nil
+}
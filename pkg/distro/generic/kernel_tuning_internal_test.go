@@ -0,0 +1,236 @@
+package generic
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/blueprint"
+	"github.com/osbuild/images/pkg/distro"
+	"github.com/osbuild/images/pkg/osbuild"
+	"github.com/osbuild/images/pkg/ostree"
+)
+
+func TestSysctldStageOptions(t *testing.T) {
+	defaults := []*osbuild.SysctldStageOptions{
+		osbuild.NewSysctldStageOptions("sap.conf", []osbuild.SysctldConfigLine{
+			{Key: "kernel.pid_max", Value: "4194304"},
+			{Key: "vm.max_map_count", Value: "2147483647"},
+		}),
+		osbuild.NewSysctldStageOptions("forward.conf", []osbuild.SysctldConfigLine{
+			{Key: "net.ipv4.ip_forward", Value: "1"},
+		}),
+	}
+
+	merged, warnings := sysctldStageOptions(defaults, nil)
+	assert.Equal(t, defaults, merged)
+	assert.Nil(t, warnings)
+
+	merged, warnings = sysctldStageOptions(defaults, []blueprint.SysctlCustomization{
+		{Key: "kernel.pid_max", Value: "65536"},
+		{Key: "net/ipv4/ip_forward", Value: "1"},
+		{Key: "vm.swappiness", Value: "10"},
+	})
+	assert.Equal(t, []*osbuild.SysctldStageOptions{
+		osbuild.NewSysctldStageOptions("sap.conf", []osbuild.SysctldConfigLine{
+			{Key: "vm.max_map_count", Value: "2147483647"},
+		}),
+		osbuild.NewSysctldStageOptions("blueprint.conf", []osbuild.SysctldConfigLine{
+			{Key: "kernel.pid_max", Value: "65536"},
+			{Key: "net/ipv4/ip_forward", Value: "1"},
+			{Key: "vm.swappiness", Value: "10"},
+		}),
+	}, merged)
+	assert.Equal(t, []string{`sysctl "kernel.pid_max": the blueprint value "65536" overrides the image type default "4194304"`}, warnings)
+
+	// the defaults are not modified
+	assert.Len(t, defaults[0].Config, 2)
+
+	// dots in the names of VLAN interfaces are not separators if the key
+	// uses slashes, see sysctl.d(5)
+	vlanDefaults := []*osbuild.SysctldStageOptions{
+		osbuild.NewSysctldStageOptions("vlan.conf", []osbuild.SysctldConfigLine{
+			{Key: "net.ipv4.conf.eth0/100.forwarding", Value: "1"},
+			{Key: "net.ipv4.conf.eth0.forwarding", Value: "1"},
+		}),
+	}
+	merged, warnings = sysctldStageOptions(vlanDefaults, []blueprint.SysctlCustomization{
+		{Key: "net/ipv4/conf/eth0.100/forwarding", Value: "0"},
+	})
+	assert.Equal(t, []*osbuild.SysctldStageOptions{
+		osbuild.NewSysctldStageOptions("vlan.conf", []osbuild.SysctldConfigLine{
+			{Key: "net.ipv4.conf.eth0.forwarding", Value: "1"},
+		}),
+		osbuild.NewSysctldStageOptions("blueprint.conf", []osbuild.SysctldConfigLine{
+			{Key: "net/ipv4/conf/eth0.100/forwarding", Value: "0"},
+		}),
+	}, merged)
+	assert.Equal(t, []string{`sysctl "net.ipv4.conf.eth0/100.forwarding": the blueprint value "0" overrides the image type default "1"`}, warnings)
+}
+
+func TestModprobeStageOptions(t *testing.T) {
+	defaults := []*osbuild.ModprobeStageOptions{
+		{
+			Filename: "blacklist-nouveau.conf",
+			Commands: osbuild.ModprobeConfigCmdList{
+				osbuild.NewModprobeConfigCmdBlacklist("nouveau"),
+			},
+		},
+		{
+			Filename: "disable-floppy.conf",
+			Commands: osbuild.ModprobeConfigCmdList{
+				osbuild.NewModprobeConfigCmdInstall("floppy", "/bin/true"),
+			},
+		},
+	}
+
+	merged, warnings := modprobeStageOptions(defaults, &blueprint.ModprobeCustomization{
+		Blacklist: []string{"nouveau", "amdgpu"},
+		Options: []blueprint.ModuleOptionsCustomization{
+			{Module: "nouveau", Options: "modeset=0"},
+			{Module: "floppy", Options: "allowed_drive_mask=0"},
+			{Module: "iwlwifi", Options: "power_save=0"},
+		},
+	})
+	assert.Equal(t, append(defaults, &osbuild.ModprobeStageOptions{
+		Filename: "blacklist-blueprint.conf",
+		Commands: osbuild.ModprobeConfigCmdList{
+			osbuild.NewModprobeConfigCmdBlacklist("amdgpu"),
+		},
+	}), merged)
+	assert.Equal(t, []string{
+		`modprobe: kernel module "nouveau" is blacklisted by the image type, its options only apply when it is loaded explicitly`,
+		`modprobe: kernel module "floppy" is disabled by the image type, its options have no effect`,
+	}, warnings)
+
+	// modules that are already blacklisted are not blacklisted again
+	merged, warnings = modprobeStageOptions(defaults, &blueprint.ModprobeCustomization{
+		Blacklist: []string{"nouveau"},
+	})
+	assert.Equal(t, defaults, merged)
+	assert.Nil(t, warnings)
+}
+
+func TestModuleOptionsFile(t *testing.T) {
+	file, err := moduleOptionsFile(nil)
+	require.NoError(t, err)
+	assert.Nil(t, file)
+
+	file, err = moduleOptionsFile(&blueprint.ModprobeCustomization{
+		Options: []blueprint.ModuleOptionsCustomization{
+			{Module: "iwlwifi", Options: "11n_disable=8 power_save=0"},
+			{Module: "kvm_intel", Options: " nested=1 "},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "/etc/modprobe.d/blueprint.conf", file.Path())
+	assert.Equal(t, common.ToPtr(os.FileMode(0644)), file.Mode())
+	assert.Equal(t, "options iwlwifi 11n_disable=8 power_save=0\noptions kvm_intel nested=1\n", string(file.Data()))
+}
+
+func TestDracutConfStageOptions(t *testing.T) {
+	defaults := []*osbuild.DracutConfStageOptions{
+		{
+			Filename: "sgdisk.conf",
+			Config: osbuild.DracutConfigFile{
+				Install: []string{"sgdisk"},
+			},
+		},
+		{
+			Filename: "omit.conf",
+			Config: osbuild.DracutConfigFile{
+				OmitModules: []string{"nfs", "iscsi"},
+			},
+		},
+		{
+			Filename: "omit-nfs.conf",
+			Config: osbuild.DracutConfigFile{
+				OmitModules: []string{"nfs"},
+			},
+		},
+	}
+
+	merged, warnings := dracutConfStageOptions(defaults, &blueprint.DracutCustomization{
+		AddModules: []string{"nfs"},
+		AddDrivers: []string{"nvme"},
+	})
+	assert.Equal(t, []*osbuild.DracutConfStageOptions{
+		defaults[0],
+		{
+			Filename: "omit.conf",
+			Config: osbuild.DracutConfigFile{
+				OmitModules: []string{"iscsi"},
+			},
+		},
+		{
+			Filename: "blueprint.conf",
+			Config: osbuild.DracutConfigFile{
+				AddModules: []string{"nfs"},
+				AddDrivers: []string{"nvme"},
+			},
+		},
+	}, merged)
+	assert.Equal(t, []string{
+		`dracut: module "nfs" is omitted by the image type configuration "omit.conf", the blueprint adds it`,
+		`dracut: module "nfs" is omitted by the image type configuration "omit-nfs.conf", the blueprint adds it`,
+	}, warnings)
+
+	// the defaults are not modified
+	assert.Equal(t, []string{"nfs", "iscsi"}, defaults[1].Config.OmitModules)
+}
+
+func TestKernelTuningCustomizations(t *testing.T) {
+	d := common.Must(newDistro("rhel-9.6"))
+	a, err := d.GetArch("x86_64")
+	require.NoError(t, err)
+
+	bp := &blueprint.Blueprint{
+		Customizations: &blueprint.Customizations{
+			Sysctl: []blueprint.SysctlCustomization{
+				{Key: "kernel.pid_max", Value: "65536"},
+			},
+			Modprobe: &blueprint.ModprobeCustomization{
+				Blacklist: []string{"floppy"},
+				Options: []blueprint.ModuleOptionsCustomization{
+					{Module: "kvm_intel", Options: "nested=1"},
+				},
+			},
+			Dracut: &blueprint.DracutCustomization{
+				AddDrivers: []string{"nvme"},
+			},
+		},
+	}
+
+	it, err := a.GetImageType("qcow2")
+	require.NoError(t, err)
+	_, warnings, err := it.Manifest(bp, distro.ImageOptions{}, nil, nil)
+	require.NoError(t, err)
+	assert.Empty(t, warnings)
+
+	it, err = a.GetImageType("ec2-sap")
+	require.NoError(t, err)
+	_, warnings, err = it.Manifest(bp, distro.ImageOptions{}, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`sysctl "kernel.pid_max": the blueprint value "65536" overrides the image type default "4194304"`}, warnings)
+
+	// image types that do not support the customizations reject them
+	it, err = a.GetImageType("edge-raw-image")
+	require.NoError(t, err)
+	_, _, err = it.Manifest(bp, distro.ImageOptions{OSTree: &ostree.ImageOptions{URL: "https://example.com/repo"}}, nil, nil)
+	assert.ErrorContains(t, err, "unsupported blueprint customizations found for image type \"edge-raw-image\"")
+
+	// the initramfs cannot be regenerated for images without a kernel
+	it, err = a.GetImageType("tar")
+	require.NoError(t, err)
+	_, _, err = it.Manifest(bp, distro.ImageOptions{}, nil, nil)
+	assert.EqualError(t, err, `dracut customizations are not supported for "tar": the image has no kernel`)
+
+	bp.Customizations.Sysctl[0].Value = ""
+	it, err = a.GetImageType("qcow2")
+	require.NoError(t, err)
+	_, _, err = it.Manifest(bp, distro.ImageOptions{}, nil, nil)
+	assert.EqualError(t, err, `sysctl key "kernel.pid_max": invalid value ""`)
+}
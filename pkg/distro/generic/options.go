@@ -2,6 +2,7 @@ package generic
 
 import (
 	"fmt"
+	"path"
 	"slices"
 	"strings"
 
@@ -9,7 +10,10 @@ import (
 	"github.com/osbuild/images/pkg/arch"
 	"github.com/osbuild/images/pkg/blueprint"
 	"github.com/osbuild/images/pkg/customizations/oscap"
+	"github.com/osbuild/images/pkg/customizations/sudoers"
+	"github.com/osbuild/images/pkg/disk"
 	"github.com/osbuild/images/pkg/distro"
+	"github.com/osbuild/images/pkg/platform"
 	"github.com/osbuild/images/pkg/policies"
 )
 
@@ -21,7 +25,122 @@ func checkOptionsCommon(t *imageType, bp *blueprint.Blueprint, options distro.Im
 	if len(t.ImageTypeYAML.SupportedPartitioningModes) > 0 && !slices.Contains(t.ImageTypeYAML.SupportedPartitioningModes, options.PartitioningMode) {
 		return nil, fmt.Errorf("partitioning mode %s not supported for %q", options.PartitioningMode, t.Name())
 	}
-	return nil, nil
+
+	if options.SectorSize != 0 {
+		if err := disk.ValidateSectorSize(options.SectorSize); err != nil {
+			return nil, err
+		}
+		if t.PartitionType() == disk.PT_NONE {
+			return nil, fmt.Errorf("sector size is not supported for %q", t.Name())
+		}
+		// the BIOS boot loader can only be installed on disks with
+		// 512 byte sectors
+		if options.SectorSize != disk.DefaultSectorSize && t.platform.GetBIOSPlatform() != "" {
+			return nil, fmt.Errorf("sector size %d is not supported for %q: BIOS boot requires a sector size of %d", options.SectorSize, t.Name(), disk.DefaultSectorSize)
+		}
+	}
+
+	if _, err := bp.Customizations.GetNetwork(); err != nil {
+		return nil, err
+	}
+
+	warnings, err := checkKernelTuningCustomizations(t, bp.Customizations)
+	if err != nil {
+		return nil, err
+	}
+	hardening, err := getHardeningCustomizations(t, bp.Customizations, false)
+	if err != nil {
+		return nil, err
+	}
+	warnings = append(warnings, hardening.warnings...)
+	if _, _, err := cryptoPolicy(t, bp.Customizations); err != nil {
+		return nil, err
+	}
+	if err := checkSudoersCustomization(bp.Customizations); err != nil {
+		return nil, err
+	}
+
+	partitioning, err := bp.Customizations.GetPartitioning()
+	if err != nil {
+		return nil, err
+	}
+	if partitioning != nil && len(partitioning.AdditionalDisks) > 0 {
+		if err := checkAdditionalDisksSupported(t); err != nil {
+			return nil, err
+		}
+	}
+	if err := checkSystemdRepart(t, partitioning); err != nil {
+		return nil, err
+	}
+	return warnings, nil
+}
+
+// checkSystemdRepart checks that image types that write systemd-repart
+// definitions (see ImageConfig.SystemdRepart) have a gpt partition table,
+// including when the partition table type is set by the disk customizations,
+// since systemd-repart does not support other partition table types.
+func checkSystemdRepart(t *imageType, partitioning *blueprint.DiskCustomization) error {
+	if repart := t.getDefaultImageConfig().SystemdRepart; repart == nil || !*repart {
+		return nil
+	}
+	ptType := t.PartitionType()
+	if partitioning != nil && partitioning.Type != "" {
+		var err error
+		ptType, err = disk.NewPartitionTableType(partitioning.Type)
+		if err != nil {
+			return err
+		}
+	}
+	if ptType != disk.PT_GPT {
+		return fmt.Errorf("systemd-repart requires a gpt partition table, got %s for %q", ptType, t.Name())
+	}
+	return nil
+}
+
+// checkSudoersCustomization validates the sudoers customization and checks
+// that the files customizations do not overwrite the sudoers file that it
+// creates.
+func checkSudoersCustomization(c *blueprint.Customizations) error {
+	sc, err := c.GetSudoers()
+	if err != nil {
+		return err
+	}
+	if sc == nil {
+		return nil
+	}
+	for _, file := range c.GetFiles() {
+		if path.Clean(file.Path) == sudoers.FilePath {
+			return fmt.Errorf("the file customization %q conflicts with the sudoers customization", file.Path)
+		}
+	}
+	return nil
+}
+
+// checkAdditionalDisksSupported checks that the image type can create the
+// image files for additional disks: only uncompressed raw and qcow2 disk
+// images are supported.
+func checkAdditionalDisksSupported(t *imageType) error {
+	if t.ImageTypeYAML.Image != "disk" {
+		return fmt.Errorf("additional disks are not supported for %q", t.Name())
+	}
+	// the image files of the additional disks are created (and compressed)
+	// next to the one of the main disk, so its pipeline must be exported
+	var pipeline string
+	switch t.platform.GetImageFormat() {
+	case platform.FORMAT_RAW:
+		pipeline = "image"
+	case platform.FORMAT_QCOW2:
+		pipeline = "qcow2"
+	default:
+		return fmt.Errorf("additional disks are not supported for %q", t.Name())
+	}
+	if t.ImageTypeYAML.Compression != "" {
+		pipeline = t.ImageTypeYAML.Compression
+	}
+	if !slices.Contains(t.Exports(), pipeline) {
+		return fmt.Errorf("additional disks are not supported for %q", t.Name())
+	}
+	return nil
 }
 
 func checkOptionsRhel10(t *imageType, bp *blueprint.Blueprint, options distro.ImageOptions) ([]string, error) {
@@ -119,7 +238,7 @@ func checkOptionsRhel9(t *imageType, bp *blueprint.Blueprint, options distro.Ima
 		}
 
 		if t.Name() == "edge-simplified-installer" {
-			allowed := []string{"InstallationDevice", "FDO", "Ignition", "Kernel", "User", "Group", "FIPS", "Filesystem"}
+			allowed := []string{"InstallationDevice", "FDO", "Ignition", "Kernel", "User", "Group", "FIPS", "Filesystem", "Network", "SSHServer", "PasswordQuality", "Limits", "CryptoPolicy", "Sudoers"}
 			if err := customizations.CheckAllowed(allowed...); err != nil {
 				return warnings, fmt.Errorf(distro.UnsupportedCustomizationError, t.Name(), strings.Join(allowed, ", "))
 			}
@@ -170,7 +289,7 @@ func checkOptionsRhel9(t *imageType, bp *blueprint.Blueprint, options distro.Ima
 			return warnings, fmt.Errorf("%q images require specifying a URL from which to retrieve the OSTree commit", t.Name())
 		}
 
-		allowed := []string{"Ignition", "Kernel", "User", "Group", "FIPS", "Filesystem"}
+		allowed := []string{"Ignition", "Kernel", "User", "Group", "FIPS", "Filesystem", "Network", "SSHServer", "PasswordQuality", "Limits", "CryptoPolicy", "Sudoers"}
 		if err := customizations.CheckAllowed(allowed...); err != nil {
 			return warnings, fmt.Errorf(distro.UnsupportedCustomizationError, t.Name(), strings.Join(allowed, ", "))
 		}
@@ -318,7 +437,7 @@ func checkOptionsRhel8(t *imageType, bp *blueprint.Blueprint, options distro.Ima
 		}
 
 		if t.Name() == "edge-simplified-installer" {
-			allowed := []string{"InstallationDevice", "FDO", "User", "Group", "FIPS"}
+			allowed := []string{"InstallationDevice", "FDO", "User", "Group", "FIPS", "Network", "SSHServer", "PasswordQuality", "Limits", "CryptoPolicy", "Sudoers"}
 			if err := customizations.CheckAllowed(allowed...); err != nil {
 				return warnings, fmt.Errorf(distro.UnsupportedCustomizationError, t.Name(), strings.Join(allowed, ", "))
 			}
@@ -358,7 +477,7 @@ func checkOptionsRhel8(t *imageType, bp *blueprint.Blueprint, options distro.Ima
 			return warnings, fmt.Errorf("%q images require specifying a URL from which to retrieve the OSTree commit", t.Name())
 		}
 
-		allowed := []string{"User", "Group", "FIPS"}
+		allowed := []string{"User", "Group", "FIPS", "Network", "SSHServer", "PasswordQuality", "Limits", "CryptoPolicy", "Sudoers"}
 		if err := customizations.CheckAllowed(allowed...); err != nil {
 			return warnings, fmt.Errorf(distro.UnsupportedCustomizationError, t.Name(), strings.Join(allowed, ", "))
 		}
@@ -549,7 +668,7 @@ func checkOptionsFedora(t *imageType, bp *blueprint.Blueprint, options distro.Im
 	}
 
 	if t.Name() == "iot-raw-xz" || t.Name() == "iot-qcow2" {
-		allowed := []string{"User", "Group", "Directories", "Files", "Services", "FIPS"}
+		allowed := []string{"User", "Group", "Directories", "Files", "Services", "FIPS", "Network", "SSHServer", "PasswordQuality", "Limits", "CryptoPolicy", "Sudoers"}
 		if err := customizations.CheckAllowed(allowed...); err != nil {
 			return warnings, fmt.Errorf(distro.UnsupportedCustomizationError, t.Name(), strings.Join(allowed, ", "))
 		}
@@ -560,7 +679,7 @@ func checkOptionsFedora(t *imageType, bp *blueprint.Blueprint, options distro.Im
 	// TODO: Support kernel name selection for image-installer
 	if t.BootISO {
 		if t.Name() == "iot-simplified-installer" {
-			allowed := []string{"InstallationDevice", "FDO", "Ignition", "Kernel", "User", "Group", "FIPS"}
+			allowed := []string{"InstallationDevice", "FDO", "Ignition", "Kernel", "User", "Group", "FIPS", "Network", "SSHServer", "PasswordQuality", "Limits", "CryptoPolicy", "Sudoers"}
 			if err := customizations.CheckAllowed(allowed...); err != nil {
 				return warnings, fmt.Errorf(distro.UnsupportedCustomizationError, t.Name(), strings.Join(allowed, ", "))
 			}
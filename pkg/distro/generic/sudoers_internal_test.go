@@ -0,0 +1,44 @@
+package generic
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/blueprint"
+	"github.com/osbuild/images/pkg/distro"
+)
+
+func TestSudoersCustomization(t *testing.T) {
+	d := common.Must(newDistro("fedora-42"))
+	a, err := d.GetArch("x86_64")
+	require.NoError(t, err)
+
+	bp := &blueprint.Blueprint{
+		Customizations: &blueprint.Customizations{
+			Sudoers: &blueprint.SudoersCustomization{
+				Rules: []blueprint.SudoRuleCustomization{
+					{Group: "wheel", Commands: []string{"ALL"}, NoPasswd: true},
+				},
+			},
+		},
+	}
+
+	checkPackageAndOSTreeManifests(t, a, bp)
+
+	it, err := a.GetImageType("qcow2")
+	require.NoError(t, err)
+
+	bp.Customizations.Sudoers.Rules[0].Commands = []string{"visudo"}
+	_, _, err = it.Manifest(bp, distro.ImageOptions{}, nil, nil)
+	assert.EqualError(t, err, `sudoers: rule for group "wheel": command "visudo" must be an absolute path`)
+
+	bp.Customizations.Sudoers.Rules[0].Commands = []string{"ALL"}
+	bp.Customizations.Files = []blueprint.FileCustomization{
+		{Path: "/etc/sudoers.d/blueprint", Data: "%wheel ALL=(ALL) ALL\n"},
+	}
+	_, _, err = it.Manifest(bp, distro.ImageOptions{}, nil, nil)
+	assert.EqualError(t, err, `the file customization "/etc/sudoers.d/blueprint" conflicts with the sudoers customization`)
+}
@@ -135,6 +135,11 @@ type ImageConfig struct {
 	// instead of writing to /etc/fstab
 	MountUnits *bool `yaml:"mount_units,omitempty"`
 
+	// SystemdRepart writes systemd-repart definitions for the partition
+	// table of the image so that partitions and filesystems are grown or
+	// created on first boot. Requires a gpt partition table.
+	SystemdRepart *bool `yaml:"systemd_repart,omitempty"`
+
 	// ISORootfsType defines what rootfs (squashfs, erofs,ext4)
 	// is used
 	ISORootfsType *manifest.RootfsType `yaml:"iso_rootfs_type,omitempty"`
@@ -244,11 +244,15 @@ func (s *Solver) Depsolve(pkgSets []rpmmd.PackageSet, sbomType sbom.StandardType
 	packages, modules, repos := result.toRPMMD(rhsmMap)
 
 	var sbomDoc *sbom.Document
-	if sbomType != sbom.StandardTypeNone {
+	switch sbomType {
+	case sbom.StandardTypeNone:
+	case sbom.StandardTypeCycloneDX:
+		sbomDoc, err = sbom.NewCycloneDXDocument(packages, repos)
+	default:
 		sbomDoc, err = sbom.NewDocument(sbomType, result.SBOM)
-		if err != nil {
-			return nil, fmt.Errorf("creating SBOM document failed: %w", err)
-		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating SBOM document failed: %w", err)
 	}
 
 	return &DepsolveResult{
@@ -513,7 +517,9 @@ func (s *Solver) makeDepsolveRequest(pkgSets []rpmmd.PackageSet, sbomType sbom.S
 		Arguments:        args,
 	}
 
-	if sbomType != sbom.StandardTypeNone {
+	// Only SPDX documents are generated by the depsolver itself, all
+	// other SBOM standards are generated from the depsolve result.
+	if sbomType == sbom.StandardTypeSpdx {
 		req.Arguments.Sbom = &sbomRequest{Type: sbomType.String()}
 	}
 
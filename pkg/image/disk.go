@@ -22,10 +22,17 @@ type DiskImage struct {
 	Platform         platform.Platform
 	PartitionTable   *disk.PartitionTable
 	OSCustomizations manifest.OSCustomizations
-	Environment      environment.Environment
-	Workload         workload.Workload
-	Filename         string
-	Compression      string
+
+	// Disks next to the main disk, each one is exported (and compressed) as
+	// its own image file next to the image file of the main disk, see the
+	// additional filenames of the artifact. Only supported for the raw and
+	// qcow2 image formats.
+	AdditionalDisks []disk.AdditionalDisk
+
+	Environment environment.Environment
+	Workload    workload.Workload
+	Filename    string
+	Compression string
 
 	// Control the VPC subformat use of force_size
 	VPCForceSize *bool
@@ -54,6 +61,7 @@ func (img *DiskImage) InstantiateManifest(m *manifest.Manifest,
 
 	osPipeline := manifest.NewOS(buildPipeline, img.Platform, repos)
 	osPipeline.PartitionTable = img.PartitionTable
+	osPipeline.AdditionalDisks = img.AdditionalDisks
 	osPipeline.OSCustomizations = img.OSCustomizations
 	osPipeline.Environment = img.Environment
 	osPipeline.Workload = img.Workload
@@ -64,13 +72,24 @@ func (img *DiskImage) InstantiateManifest(m *manifest.Manifest,
 	rawImagePipeline := manifest.NewRawImage(buildPipeline, osPipeline)
 	rawImagePipeline.PartTool = img.PartTool
 
+	if len(img.AdditionalDisks) > 0 {
+		if err := img.checkAdditionalDisks(); err != nil {
+			return nil, err
+		}
+	}
+
 	var imagePipeline manifest.FilePipeline
 	switch img.Platform.GetImageFormat() {
 	case platform.FORMAT_RAW:
+		// the image files of the additional disks are created next to
+		// the one of the main disk and exported with it
 		imagePipeline = rawImagePipeline
 	case platform.FORMAT_QCOW2:
 		qcow2Pipeline := manifest.NewQCOW2(buildPipeline, rawImagePipeline)
 		qcow2Pipeline.Compat = img.Platform.GetQCOW2Compat()
+		for _, d := range img.AdditionalDisks {
+			qcow2Pipeline.AddAdditionalDisk(rawImagePipeline, d.Name)
+		}
 		imagePipeline = qcow2Pipeline
 	case platform.FORMAT_VAGRANT_LIBVIRT:
 		qcow2Pipeline := manifest.NewQCOW2(buildPipeline, rawImagePipeline)
@@ -125,6 +144,30 @@ func (img *DiskImage) InstantiateManifest(m *manifest.Manifest,
 
 	compressionPipeline := GetCompressionPipeline(img.Compression, buildPipeline, imagePipeline)
 	compressionPipeline.SetFilename(img.Filename)
+	if img.Compression != "" {
+		for _, d := range img.AdditionalDisks {
+			compressionPipeline.(additionalDiskCompression).AddAdditionalDisk(d.Name)
+		}
+	}
 
 	return compressionPipeline.Export(), nil
 }
+
+// additionalDiskCompression is implemented by the compression pipelines,
+// which compress the image files of the additional disks next to the one of
+// the main disk.
+type additionalDiskCompression interface {
+	AddAdditionalDisk(name string)
+}
+
+// checkAdditionalDisks checks that the image files of the additional disks
+// can be exported with the image file of the main disk, which is only the
+// case for raw and qcow2 images.
+func (img *DiskImage) checkAdditionalDisks() error {
+	switch format := img.Platform.GetImageFormat(); format {
+	case platform.FORMAT_RAW, platform.FORMAT_QCOW2:
+		return nil
+	default:
+		return fmt.Errorf("additional disks are not supported for image format %s", format)
+	}
+}
@@ -0,0 +1,202 @@
+package image_test
+
+import (
+	"encoding/json"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/internal/testdisk"
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/image"
+	"github.com/osbuild/images/pkg/manifest"
+	"github.com/osbuild/images/pkg/platform"
+	"github.com/osbuild/images/pkg/runner"
+)
+
+func TestDiskImageAdditionalDisks(t *testing.T) {
+	testCases := map[string]struct {
+		format      platform.ImageFormat
+		compression string
+		filename    string
+		export      string
+		files       []string
+	}{
+		"qcow2": {
+			format:   platform.FORMAT_QCOW2,
+			filename: "disk.qcow2",
+			export:   "qcow2",
+			files:    []string{"disk.qcow2", "disk-data.qcow2"},
+		},
+		"raw": {
+			format:   platform.FORMAT_RAW,
+			filename: "disk.raw",
+			export:   "image",
+			files:    []string{"disk.raw", "disk-data.raw"},
+		},
+		"raw-xz": {
+			format:      platform.FORMAT_RAW,
+			compression: "xz",
+			filename:    "disk.raw.xz",
+			export:      "xz",
+			files:       []string{"disk.raw.xz", "disk-data.raw.xz"},
+		},
+		"qcow2-zstd": {
+			format:      platform.FORMAT_QCOW2,
+			compression: "zstd",
+			filename:    "disk.qcow2.zst",
+			export:      "zstd",
+			files:       []string{"disk.qcow2.zst", "disk-data.qcow2.zst"},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			img := image.NewDiskImage()
+			img.Platform = &platform.X86{
+				BasePlatform: platform.BasePlatform{
+					ImageFormat: tc.format,
+				},
+				UEFIVendor: "test",
+			}
+			img.PartitionTable = testdisk.MakeFakePartitionTable("/")
+			img.AdditionalDisks = []disk.AdditionalDisk{
+				{Name: "data", PartitionTable: testdisk.MakeFakePartitionTable("/var/lib/data")},
+			}
+			img.Filename = tc.filename
+			img.Compression = tc.compression
+
+			/* #nosec G404 */
+			rng := rand.New(rand.NewSource(0))
+			mf := manifest.New()
+			art, err := img.InstantiateManifest(&mf, nil, &runner.CentOS{Version: 9}, rng)
+			require.NoError(t, err)
+			// the image files of all disks are in the exported pipeline
+			assert.Equal(t, []string{tc.export}, mf.GetExports())
+			assert.Equal(t, tc.export, art.Export())
+			assert.Equal(t, tc.files[0], art.Filename())
+			assert.Equal(t, tc.files[1:], art.AdditionalFilenames())
+
+			mfs, err := mf.Serialize(mockPackageSets(), nil, nil, nil)
+			require.NoError(t, err)
+			var exported struct {
+				Pipelines []struct {
+					Name   string `json:"name"`
+					Stages []struct {
+						Options struct {
+							Filename string `json:"filename"`
+						} `json:"options"`
+					} `json:"stages"`
+				} `json:"pipelines"`
+			}
+			require.NoError(t, json.Unmarshal(mfs, &exported))
+			var files []string
+			for _, pl := range exported.Pipelines {
+				if pl.Name != tc.export {
+					continue
+				}
+				for _, stage := range pl.Stages {
+					if stage.Options.Filename != "" && !slices.Contains(files, stage.Options.Filename) {
+						files = append(files, stage.Options.Filename)
+					}
+				}
+			}
+			assert.Equal(t, tc.files, files)
+		})
+	}
+}
+
+func TestDiskImageAdditionalDisksUnsupported(t *testing.T) {
+	img := image.NewDiskImage()
+	img.Platform = &platform.X86{
+		BasePlatform: platform.BasePlatform{
+			ImageFormat: platform.FORMAT_VMDK,
+		},
+		UEFIVendor: "test",
+	}
+	img.PartitionTable = testdisk.MakeFakePartitionTable("/")
+	img.AdditionalDisks = []disk.AdditionalDisk{
+		{Name: "data", PartitionTable: testdisk.MakeFakePartitionTable("/var/lib/data")},
+	}
+	img.Filename = "disk.vmdk"
+
+	/* #nosec G404 */
+	rng := rand.New(rand.NewSource(0))
+	mf := manifest.New()
+	_, err := img.InstantiateManifest(&mf, nil, &runner.CentOS{Version: 9}, rng)
+	require.EqualError(t, err, "additional disks are not supported for image format vmdk")
+}
+
+func TestDiskImageErofsRoot(t *testing.T) {
+	img := image.NewDiskImage()
+	img.Platform = &platform.X86{
+		BasePlatform: platform.BasePlatform{
+			ImageFormat: platform.FORMAT_RAW,
+		},
+		UEFIVendor: "test",
+	}
+	img.PartitionTable = testdisk.MakeFakePartitionTable("/", "/boot")
+	root := img.PartitionTable.Partitions[0].Payload.(*disk.Filesystem)
+	root.Type = "erofs"
+	root.FSTabOptions = "ro"
+	img.AdditionalDisks = []disk.AdditionalDisk{
+		{Name: "data", PartitionTable: testdisk.MakeFakePartitionTable("/var/lib/data")},
+	}
+	img.Filename = "disk.raw"
+
+	/* #nosec G404 */
+	rng := rand.New(rand.NewSource(0))
+	mf := manifest.New()
+	_, err := img.InstantiateManifest(&mf, nil, &runner.CentOS{Version: 9}, rng)
+	require.NoError(t, err)
+
+	mfs, err := mf.Serialize(mockPackageSets(), nil, nil, nil)
+	require.NoError(t, err)
+	var exported struct {
+		Pipelines []struct {
+			Name   string `json:"name"`
+			Stages []struct {
+				Type    string          `json:"type"`
+				Inputs  json.RawMessage `json:"inputs"`
+				Options json.RawMessage `json:"options"`
+			} `json:"stages"`
+		} `json:"pipelines"`
+	}
+	require.NoError(t, json.Unmarshal(mfs, &exported))
+
+	stageOptions := func(pipeline, stageType string) string {
+		for _, pl := range exported.Pipelines {
+			if pl.Name != pipeline {
+				continue
+			}
+			for _, stage := range pl.Stages {
+				if stage.Type == stageType {
+					return string(stage.Options)
+				}
+			}
+		}
+		return ""
+	}
+	var names []string
+	for _, pl := range exported.Pipelines {
+		names = append(names, pl.Name)
+	}
+	// the erofs image is created before it is written into the root
+	// partition
+	assert.Equal(t, []string{"build", "os", "erofs-root", "image"}, names)
+	assert.JSONEq(t, `{
+		"filename": "root.erofs",
+		"exclude_paths": ["^boot/.*", "^var/lib/data/.*"]
+	}`, stageOptions("erofs-root", "org.osbuild.erofs"))
+	assert.JSONEq(t, `{"from": "input://tree/root.erofs"}`, stageOptions("image", "org.osbuild.write-device"))
+	// the other mountpoints are copied onto their filesystems
+	assert.JSONEq(t, `{
+		"paths": [
+			{"from": "input://root-tree/boot/", "to": "mount://boot/"},
+			{"from": "input://root-tree/var/lib/data/", "to": "mount://var-lib-data/"}
+		]
+	}`, stageOptions("image", "org.osbuild.copy"))
+}
@@ -8,12 +8,14 @@ import (
 // filesystemConfigStages generates either an org.osbuild.fstab stage or a
 // collection of org.osbuild.systemd.unit.create stages for .mount and .swap
 // units (and an org.osbuild.systemd stage to enable them) depending on the
-// pipeline configuration.
-func filesystemConfigStages(pt *disk.PartitionTable, mountUnits bool) ([]*osbuild.Stage, error) {
+// pipeline configuration. The filesystems of the partition tables of
+// additional disks are included in the configuration.
+func filesystemConfigStages(pt *disk.PartitionTable, mountUnits bool, additional ...*disk.PartitionTable) ([]*osbuild.Stage, error) {
+	pts := append([]*disk.PartitionTable{pt}, additional...)
 	if mountUnits {
-		return osbuild.GenSystemdMountStages(pt)
+		return osbuild.GenSystemdMountStages(pts...)
 	} else {
-		opts, err := osbuild.NewFSTabStageOptions(pt)
+		opts, err := osbuild.NewFSTabStageOptions(pts...)
 		if err != nil {
 			return nil, err
 		}
@@ -0,0 +1,73 @@
+package manifest
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/osbuild/images/pkg/disk"
+	"github.com/osbuild/images/pkg/osbuild"
+)
+
+// An ErofsRoot is the erofs image of the root filesystem of an OS tree. It
+// is written into the root partition of the raw image, see
+// disk.PartitionTable.ErofsRoot. The trees of the other mountpoints of the
+// partition tables are not part of the image, they are copied onto their
+// own filesystems.
+type ErofsRoot struct {
+	Base
+	treePipeline *OS
+	filename     string
+}
+
+func (p ErofsRoot) Filename() string {
+	return p.filename
+}
+
+// NewErofsRoot creates a new ErofsRoot pipeline for the tree of the
+// treePipeline.
+func NewErofsRoot(buildPipeline Build, treePipeline *OS) *ErofsRoot {
+	p := &ErofsRoot{
+		Base:         NewBase("erofs-root", buildPipeline),
+		treePipeline: treePipeline,
+		filename:     "root.erofs",
+	}
+	buildPipeline.addDependent(p)
+	return p
+}
+
+func (p *ErofsRoot) serialize() osbuild.Pipeline {
+	pipeline := p.Base.serialize()
+
+	pts := append([]*disk.PartitionTable{p.treePipeline.PartitionTable}, p.treePipeline.additionalPartitionTables()...)
+	options := &osbuild.ErofsStageOptions{
+		Filename:     p.Filename(),
+		ExcludePaths: erofsExcludePaths(pts...),
+	}
+	pipeline.AddStage(osbuild.NewErofsStage(options, p.treePipeline.Name()))
+
+	return pipeline
+}
+
+func (p *ErofsRoot) getBuildPackages(Distro) []string {
+	return []string{"erofs-utils"}
+}
+
+// erofsExcludePaths returns the regular expressions for mkfs.erofs that
+// exclude the content of all mountpoints except the root, but keep their
+// directories, which are needed to mount them.
+func erofsExcludePaths(pts ...*disk.PartitionTable) []string {
+	var paths []string
+	for _, pt := range pts {
+		_ = pt.ForEachMountable(func(mnt disk.Mountable, path []disk.Entity) error {
+			if mountpoint := mnt.GetMountpoint(); mountpoint != "/" {
+				// mkfs.erofs matches the paths relative to the root
+				// of the tree
+				paths = append(paths, "^"+regexp.QuoteMeta(strings.TrimPrefix(mountpoint, "/"))+"/.*")
+			}
+			return nil
+		})
+	}
+	sort.Strings(paths)
+	return paths
+}
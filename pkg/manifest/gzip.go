@@ -11,6 +11,10 @@ type Gzip struct {
 	filename string
 
 	imgPipeline FilePipeline
+
+	// image files of additional disks that are compressed with the main
+	// image file, see AddAdditionalDisk
+	additionalDisks []additionalDiskFile
 }
 
 func (p Gzip) Filename() string {
@@ -33,6 +37,14 @@ func NewGzip(buildPipeline Build, imgPipeline FilePipeline) *Gzip {
 	return p
 }
 
+// AddAdditionalDisk adds the image file of the additional disk with the
+// given name of the image pipeline. It is compressed next to the main image
+// file, so that it is exported with it, e.g. disk-data.raw.gz for the disk
+// "data" of disk.raw.gz.
+func (p *Gzip) AddAdditionalDisk(name string) {
+	p.additionalDisks = append(p.additionalDisks, additionalDiskFile{FilePipeline: p.imgPipeline, name: name})
+}
+
 func (p *Gzip) serialize() osbuild.Pipeline {
 	pipeline := p.Base.serialize()
 
@@ -40,6 +52,12 @@ func (p *Gzip) serialize() osbuild.Pipeline {
 		osbuild.NewGzipStageOptions(p.Filename()),
 		osbuild.NewGzipStageInputs(osbuild.NewFilesInputPipelineObjectRef(p.imgPipeline.Name(), p.imgPipeline.Export().Filename(), nil)),
 	))
+	for _, d := range p.additionalDisks {
+		pipeline.AddStage(osbuild.NewGzipStage(
+			osbuild.NewGzipStageOptions(compressedAdditionalDiskFilename(p.Filename(), d.name)),
+			osbuild.NewGzipStageInputs(osbuild.NewFilesInputPipelineObjectRef(d.Name(), d.Filename(), nil)),
+		))
+	}
 
 	return pipeline
 }
@@ -51,5 +69,9 @@ func (p *Gzip) getBuildPackages(Distro) []string {
 func (p *Gzip) Export() *artifact.Artifact {
 	p.Base.export = true
 	mimeType := "application/gzip"
-	return artifact.New(p.Name(), p.Filename(), &mimeType)
+	a := artifact.New(p.Name(), p.Filename(), &mimeType)
+	for _, d := range p.additionalDisks {
+		a.AddAdditionalFilename(compressedAdditionalDiskFilename(p.Filename(), d.name))
+	}
+	return a
 }
@@ -15,6 +15,7 @@ import (
 	"github.com/osbuild/images/pkg/container"
 	"github.com/osbuild/images/pkg/customizations/bootc"
 	"github.com/osbuild/images/pkg/customizations/fsnode"
+	"github.com/osbuild/images/pkg/customizations/network"
 	"github.com/osbuild/images/pkg/customizations/oscap"
 	"github.com/osbuild/images/pkg/customizations/shell"
 	"github.com/osbuild/images/pkg/customizations/subscription"
@@ -136,6 +137,33 @@ type OSCustomizations struct {
 	Presets               []osbuild.Preset
 	ContainersStorage     *string
 
+	// NetworkManager connection profiles (keyfiles) to create in the image
+	NetworkConnections []*fsnode.File
+
+	// Kernel module options (a modprobe.d configuration file) to create in
+	// the image
+	ModprobeOptions *fsnode.File
+
+	// sshd configuration file (in sshd_config.d) for the options that the
+	// sshd config stage does not support
+	SshdConfigDropin *fsnode.File
+
+	// System-wide crypto policy with its subpolicy modules, e.g.
+	// "DEFAULT:NO-SHA1"
+	CryptoPolicy string
+
+	// Custom subpolicy modules (.pmod files) of the crypto policy to create
+	// in the image
+	CryptoPolicyModules []*fsnode.File
+
+	// sudoers file (in /etc/sudoers.d) to create in the image
+	Sudoers *fsnode.File
+
+	// RegenerateInitramfs regenerates the initramfs of the kernel after the
+	// dracut configuration files (DracutConf) are created, so that they
+	// apply to the initramfs of the image.
+	RegenerateInitramfs bool
+
 	// OpenSCAP config
 	OpenSCAPRemediationConfig *oscap.RemediationConfig
 
@@ -176,6 +204,11 @@ type OSCustomizations struct {
 	// instead of writing to /etc/fstab
 	MountUnits bool
 
+	// SystemdRepart writes systemd-repart definitions (repart.d(5)) for the
+	// partition table of the image so that partitions and filesystems are
+	// grown or created on first boot
+	SystemdRepart bool
+
 	// VersionlockPackges uses dnf versionlock to lock a package to the version
 	// that is installed during image build, preventing it from being updated.
 	// This is only supported for distributions that use dnf4, because osbuild
@@ -211,6 +244,10 @@ type OS struct {
 	// Partition table, if nil the tree cannot be put on a partitioned disk
 	PartitionTable *disk.PartitionTable
 
+	// Disks next to the one with the PartitionTable. Their filesystems are
+	// added to the filesystem configuration of the tree.
+	AdditionalDisks []disk.AdditionalDisk
+
 	// content-related fields
 	repos            []rpmmd.RepoConfig
 	packageSpecs     []rpmmd.PackageSpec
@@ -254,6 +291,9 @@ func (p *OS) getPackageSetChain(Distro) []rpmmd.PackageSet {
 	if p.PartitionTable != nil {
 		partitionTablePackages = p.PartitionTable.GetBuildPackages()
 	}
+	for _, pt := range p.additionalPartitionTables() {
+		partitionTablePackages = append(partitionTablePackages, pt.GetBuildPackages()...)
+	}
 
 	if p.OSCustomizations.KernelName != "" {
 		// kernel is considered part of the platform package set
@@ -302,6 +342,30 @@ func (p *OS) getPackageSetChain(Distro) []rpmmd.PackageSet {
 		customizationPackages = append(customizationPackages, "firewalld")
 	}
 
+	if len(p.OSCustomizations.NetworkConnections) > 0 {
+		// the connection profiles are NetworkManager keyfiles
+		customizationPackages = append(customizationPackages, "NetworkManager")
+	}
+
+	if p.OSCustomizations.SshdConfigDropin != nil {
+		customizationPackages = append(customizationPackages, "openssh-server")
+	}
+
+	if p.OSCustomizations.Sudoers != nil {
+		customizationPackages = append(customizationPackages, "sudo")
+	}
+
+	if p.OSCustomizations.CryptoPolicy != "" {
+		// update-crypto-policies is not part of the crypto-policies package
+		customizationPackages = append(customizationPackages, "crypto-policies-scripts")
+	}
+
+	if p.OSCustomizations.SystemdRepart && p.PartitionTable != nil {
+		// systemd-repart is packaged in different subpackages of systemd
+		// depending on the distribution, so depend on the binary
+		customizationPackages = append(customizationPackages, "/usr/bin/systemd-repart")
+	}
+
 	if len(p.OSCustomizations.VersionlockPackages) > 0 {
 		// versionlocking packages requires dnf and the dnf plugin
 		customizationPackages = append(customizationPackages, "dnf", "python3-dnf-plugin-versionlock")
@@ -380,11 +444,24 @@ func tomlPkgsFor(distro Distro) []string {
 	}
 }
 
+// additionalPartitionTables returns the partition tables of the
+// AdditionalDisks.
+func (p *OS) additionalPartitionTables() []*disk.PartitionTable {
+	pts := make([]*disk.PartitionTable, 0, len(p.AdditionalDisks))
+	for _, d := range p.AdditionalDisks {
+		pts = append(pts, d.PartitionTable)
+	}
+	return pts
+}
+
 func (p *OS) getBuildPackages(distro Distro) []string {
 	packages := p.platform.GetBuildPackages()
 	if p.PartitionTable != nil {
 		packages = append(packages, p.PartitionTable.GetBuildPackages()...)
 	}
+	for _, pt := range p.additionalPartitionTables() {
+		packages = append(packages, pt.GetBuildPackages()...)
+	}
 	packages = append(packages, "rpm")
 	if p.OSTreeRef != "" {
 		packages = append(packages, "rpm-ostree")
@@ -630,6 +707,10 @@ func (p *OS) serialize() osbuild.Pipeline {
 		pipeline.AddStage(osbuild.NewDracutConfStage(dracutConfConfig))
 	}
 
+	if p.OSCustomizations.ModprobeOptions != nil {
+		p.addDirWithFiles(&pipeline, filepath.Dir(p.OSCustomizations.ModprobeOptions.Path()), []*fsnode.File{p.OSCustomizations.ModprobeOptions})
+	}
+
 	for _, systemdUnitConfig := range p.OSCustomizations.SystemdDropin {
 		pipeline.AddStage(osbuild.NewSystemdUnitStage(systemdUnitConfig))
 	}
@@ -686,6 +767,10 @@ func (p *OS) serialize() osbuild.Pipeline {
 		pipeline.AddStage(osbuild.NewSshdConfigStage(p.OSCustomizations.SshdConfig))
 	}
 
+	if p.OSCustomizations.SshdConfigDropin != nil {
+		p.addDirWithFiles(&pipeline, filepath.Dir(p.OSCustomizations.SshdConfigDropin.Path()), []*fsnode.File{p.OSCustomizations.SshdConfigDropin})
+	}
+
 	if p.OSCustomizations.InsightsClientConfig != nil {
 		pipeline.AddStage(osbuild.NewInsightsClientConfigStage(p.OSCustomizations.InsightsClientConfig))
 	}
@@ -731,11 +816,23 @@ func (p *OS) serialize() osbuild.Pipeline {
 		pipeline.AddStage(osbuild.NewUdevRulesStage(p.OSCustomizations.UdevRules))
 	}
 
+	// the initramfs of images with a partition table and FIPS is regenerated
+	// with the fips module below, which also applies the dracut
+	// configuration
+	if p.OSCustomizations.RegenerateInitramfs && p.kernelVer != "" && (p.PartitionTable == nil || !p.OSCustomizations.FIPS) {
+		pipeline.AddStage(osbuild.NewDracutStage(&osbuild.DracutStageOptions{
+			Kernel: []string{p.kernelVer},
+		}))
+	}
+
 	if pt := p.PartitionTable; pt != nil {
 		rootUUID, kernelOptions, err := osbuild.GenImageKernelOptions(p.PartitionTable, p.OSCustomizations.MountUnits)
 		if err != nil {
 			panic(err)
 		}
+		for _, pt := range p.additionalPartitionTables() {
+			kernelOptions = append(kernelOptions, osbuild.GenAdditionalDiskKernelOptions(pt)...)
+		}
 		kernelOptions = append(kernelOptions, p.OSCustomizations.KernelOptionsAppend...)
 
 		if p.OSCustomizations.FIPS {
@@ -746,12 +843,29 @@ func (p *OS) serialize() osbuild.Pipeline {
 			}))
 		}
 
-		fsCfgStages, err := filesystemConfigStages(pt, p.OSCustomizations.MountUnits)
+		fstabPT := pt
+		if p.OSCustomizations.SystemdRepart {
+			fstabPT = osbuild.RepartFSTabPartitionTable(pt)
+		}
+		fsCfgStages, err := filesystemConfigStages(fstabPT, p.OSCustomizations.MountUnits, p.additionalPartitionTables()...)
 		if err != nil {
 			panic(err)
 		}
 		pipeline.AddStages(fsCfgStages...)
 
+		if p.OSCustomizations.SystemdRepart {
+			repartFiles, err := osbuild.GenRepartConfFiles(pt)
+			if err != nil {
+				panic(err)
+			}
+			p.addDirWithFiles(&pipeline, osbuild.RepartConfDir, repartFiles)
+			p.OSCustomizations.EnabledServices = append(p.OSCustomizations.EnabledServices, "systemd-repart.service")
+			if growStage := osbuild.GenRepartGrowUnitStage(pt); growStage != nil {
+				pipeline.AddStage(growStage)
+				p.OSCustomizations.EnabledServices = append(p.OSCustomizations.EnabledServices, osbuild.RepartGrowUnit)
+			}
+		}
+
 		switch p.platform.GetBootloader() {
 		case platform.BOOTLOADER_GRUB2:
 			pipeline.AddStage(grubStage(p, pt, kernelOptions))
@@ -837,6 +951,14 @@ func (p *OS) serialize() osbuild.Pipeline {
 		p.addStagesForAllFilesAndInlineData(&pipeline, failsafeFiles)
 	}
 
+	if len(p.OSCustomizations.NetworkConnections) > 0 {
+		p.addDirWithFiles(&pipeline, network.KeyfileDir, p.OSCustomizations.NetworkConnections)
+	}
+
+	if p.OSCustomizations.Sudoers != nil {
+		p.addDirWithFiles(&pipeline, filepath.Dir(p.OSCustomizations.Sudoers.Path()), []*fsnode.File{p.OSCustomizations.Sudoers})
+	}
+
 	// First create custom directories, because some of the custom files may depend on them
 	if len(p.OSCustomizations.Directories) > 0 {
 		pipeline.AddStages(osbuild.GenDirectoryNodesStages(p.OSCustomizations.Directories)...)
@@ -897,6 +1019,17 @@ func (p *OS) serialize() osbuild.Pipeline {
 		p.addStagesForAllFilesAndInlineData(&pipeline, osbuild.GenFIPSFiles())
 	}
 
+	if len(p.OSCustomizations.CryptoPolicyModules) > 0 {
+		p.addDirWithFiles(&pipeline, filepath.Dir(p.OSCustomizations.CryptoPolicyModules[0].Path()), p.OSCustomizations.CryptoPolicyModules)
+	}
+
+	// the FIPS stages already set the plain FIPS policy
+	if policy := p.OSCustomizations.CryptoPolicy; policy != "" && !(p.OSCustomizations.FIPS && policy == "FIPS") {
+		pipeline.AddStage(osbuild.NewUpdateCryptoPoliciesStage(&osbuild.UpdateCryptoPoliciesStageOptions{
+			Policy: policy,
+		}))
+	}
+
 	// NOTE: We need to run the OpenSCAP stages as the last stage before SELinux
 	// since the remediation may change file permissions and other aspects of the
 	// hardened image
@@ -1195,6 +1328,17 @@ func (p *OS) addStagesForAllFilesAndInlineData(pipeline *osbuild.Pipeline, files
 	}
 }
 
+// addDirWithFiles adds the stages that create the directory dir, including
+// its parents, and the given files in it to the pipeline.
+func (p *OS) addDirWithFiles(pipeline *osbuild.Pipeline, dir string, files []*fsnode.File) {
+	fsDir, err := fsnode.NewDirectory(dir, nil, nil, nil, true)
+	if err != nil {
+		panic(err)
+	}
+	pipeline.AddStages(osbuild.GenDirectoryNodesStages([]*fsnode.Directory{fsDir})...)
+	p.addStagesForAllFilesAndInlineData(pipeline, files)
+}
+
 // fileRefs ensures that any files from customizations that require fetching data
 // (e.g. via the "uri" key in customizations) are added to the manifests "sources"
 //
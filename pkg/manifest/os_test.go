@@ -1,8 +1,12 @@
 package manifest_test
 
 import (
+	"crypto/sha256"
 	"fmt"
+	iofs "io/fs"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -639,3 +643,251 @@ func TestShimVersionLock(t *testing.T) {
 
 	assert.Equal(t, []string{"shim-x64-0:15.8-3"}, stageOptions.Add)
 }
+
+func TestOSPipelineSystemdRepart(t *testing.T) {
+	hasRepartDir := func(stages []*osbuild.Stage) bool {
+		for _, stage := range findStages("org.osbuild.mkdir", stages) {
+			for _, path := range stage.Options.(*osbuild.MkdirStageOptions).Paths {
+				if path.Path == "/usr/lib/repart.d" {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	rootOptions := func(stages []*osbuild.Stage) string {
+		fstab := manifest.FindStage("org.osbuild.fstab", stages)
+		require.NotNil(t, fstab)
+		for _, fs := range fstab.Options.(*osbuild.FSTabStageOptions).FileSystems {
+			if fs.Path == "/" {
+				return fs.Options
+			}
+		}
+		return ""
+	}
+
+	for _, repart := range []bool{false, true} {
+		os := manifest.NewTestOS()
+		os.PartitionTable = testdisk.MakeFakePartitionTable("/", "/home")
+		os.OSCustomizations.SystemdRepart = repart
+		stages := os.Serialize().Stages
+		assert.Equal(t, repart, hasRepartDir(stages))
+		if !repart {
+			assert.NotContains(t, rootOptions(stages), "x-systemd.growfs")
+			continue
+		}
+
+		// systemd-repart is installed and runs on boot and the root
+		// filesystem is grown with the partition
+		CheckPkgSetInclude(t, os.GetPackageSetChain(manifest.DISTRO_NULL), []string{"/usr/bin/systemd-repart"})
+		systemd := manifest.FindStage("org.osbuild.systemd", stages)
+		require.NotNil(t, systemd)
+		assert.Contains(t, systemd.Options.(*osbuild.SystemdStageOptions).EnabledServices, "systemd-repart.service")
+		assert.Contains(t, rootOptions(stages), "x-systemd.growfs")
+		// a filesystem directly on the partition needs no grow unit
+		assert.Nil(t, manifest.FindStage("org.osbuild.systemd.unit.create", stages))
+	}
+}
+
+func TestOSPipelineRegenerateInitramfs(t *testing.T) {
+	testCases := map[string]struct {
+		regenerate     bool
+		partitionTable bool
+		fips           bool
+		kernel         bool
+		// dracut stages and the modules they add
+		expected [][]string
+	}{
+		"disabled": {
+			partitionTable: true,
+			kernel:         true,
+		},
+		"partition-table": {
+			regenerate:     true,
+			partitionTable: true,
+			kernel:         true,
+			expected:       [][]string{nil},
+		},
+		// e.g. the OS tree of a live ISO
+		"no-partition-table": {
+			regenerate: true,
+			kernel:     true,
+			expected:   [][]string{nil},
+		},
+		// the initramfs is regenerated once for FIPS
+		"fips": {
+			regenerate:     true,
+			partitionTable: true,
+			fips:           true,
+			kernel:         true,
+			expected:       [][]string{{"fips"}},
+		},
+		"no-kernel": {
+			regenerate: true,
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			os := manifest.NewTestOS()
+			if tc.partitionTable {
+				os.PartitionTable = testdisk.MakeFakePartitionTable("/")
+			}
+			os.OSCustomizations.RegenerateInitramfs = tc.regenerate
+			os.OSCustomizations.FIPS = tc.fips
+			packages := []rpmmd.PackageSpec{
+				{Name: "pkg1", Checksum: "sha1:c02524e2bd19490f2a7167958f792262754c5f46"},
+			}
+			if tc.kernel {
+				os.OSCustomizations.KernelName = "kernel"
+				packages = append(packages, rpmmd.PackageSpec{
+					Name:     "kernel",
+					Version:  "6.12.0",
+					Release:  "1.fc42",
+					Arch:     "x86_64",
+					Checksum: "sha256:aae94b3b8451ef28b02594d9abca5979e153c14f4db25283b011403fa92254fd",
+				})
+			}
+			pipeline := os.SerializeWith(manifest.Inputs{Depsolved: dnfjson.DepsolveResult{Packages: packages}})
+
+			var modules [][]string
+			for _, stage := range findStages("org.osbuild.dracut", pipeline.Stages) {
+				options := stage.Options.(*osbuild.DracutStageOptions)
+				assert.Equal(t, []string{"6.12.0-1.fc42.x86_64"}, options.Kernel)
+				modules = append(modules, options.AddModules)
+			}
+			assert.Equal(t, tc.expected, modules)
+		})
+	}
+}
+
+func TestOSPipelineCryptoPolicy(t *testing.T) {
+	policies := func(stages []*osbuild.Stage) []string {
+		var policies []string
+		for _, stage := range findStages("org.osbuild.update-crypto-policies", stages) {
+			policies = append(policies, stage.Options.(*osbuild.UpdateCryptoPoliciesStageOptions).Policy)
+		}
+		return policies
+	}
+
+	os := manifest.NewTestOS()
+	os.OSCustomizations.CryptoPolicy = "DEFAULT:NO-SHA1:NO-CBC"
+	os.OSCustomizations.CryptoPolicyModules = []*fsnode.File{
+		common.Must(fsnode.NewFile("/etc/crypto-policies/policies/modules/NO-CBC.pmod", nil, nil, nil, []byte("cipher = -*-CBC\n"))),
+	}
+	stages := os.Serialize().Stages
+	assert.Equal(t, []string{"DEFAULT:NO-SHA1:NO-CBC"}, policies(stages))
+	assert.Contains(t, collectCopyDestinationPaths(stages), "tree:///etc/crypto-policies/policies/modules/NO-CBC.pmod")
+
+	// the FIPS policy is set by the FIPS stages
+	os = manifest.NewTestOS()
+	os.OSCustomizations.FIPS = true
+	os.OSCustomizations.CryptoPolicy = "FIPS"
+	assert.Equal(t, []string{"FIPS"}, policies(os.Serialize().Stages))
+
+	os = manifest.NewTestOS()
+	os.OSCustomizations.FIPS = true
+	os.OSCustomizations.CryptoPolicy = "FIPS:OSPP"
+	assert.Equal(t, []string{"FIPS", "FIPS:OSPP"}, policies(os.Serialize().Stages))
+}
+
+// checkDirWithFilesStages checks that the stages create the parent directory
+// of the file before copying the file into it and returns these stages.
+func checkDirWithFilesStages(t *testing.T, stages []*osbuild.Stage, file *fsnode.File) (mkdirStage, copyStage *osbuild.Stage) {
+	t.Helper()
+
+	var mkdirIdx, copyIdx int
+	var mode string
+	for idx, stage := range stages {
+		switch options := stage.Options.(type) {
+		case *osbuild.MkdirStageOptions:
+			expected := []osbuild.MkdirStagePath{{Path: filepath.Dir(file.Path()), Parents: true, ExistOk: true}}
+			if slices.Equal(expected, options.Paths) {
+				mkdirStage, mkdirIdx = stage, idx
+			}
+		case *osbuild.CopyStageOptions:
+			for _, path := range options.Paths {
+				if strings.HasSuffix(path.To, file.Path()) {
+					copyStage, copyIdx = stage, idx
+				}
+			}
+		case *osbuild.ChmodStageOptions:
+			if item, ok := options.Items[file.Path()]; ok {
+				mode = item.Mode
+			}
+		}
+	}
+	require.NotNil(t, mkdirStage, "no mkdir stage for %s", file.Path())
+	require.NotNil(t, copyStage, "no copy stage for %s", file.Path())
+	assert.Less(t, mkdirIdx, copyIdx)
+	if file.Mode() != nil {
+		assert.Equal(t, fmt.Sprintf("%#o", *file.Mode()), mode)
+	} else {
+		assert.Empty(t, mode)
+	}
+	return mkdirStage, copyStage
+}
+
+func TestOSPipelineCustomizationFiles(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		file     *fsnode.File
+		set      func(*manifest.OSCustomizations, *fsnode.File)
+		packages []string
+	}{
+		{
+			name: "network-connections",
+			file: common.Must(fsnode.NewFile("/etc/NetworkManager/system-connections/eth0.nmconnection", nil, nil, nil, []byte("[connection]\nid=eth0\n"))),
+			set: func(c *manifest.OSCustomizations, f *fsnode.File) {
+				c.NetworkConnections = []*fsnode.File{f}
+			},
+			packages: []string{"NetworkManager"},
+		},
+		{
+			name: "modprobe-options",
+			file: common.Must(fsnode.NewFile("/etc/modprobe.d/blueprint.conf", common.ToPtr(iofs.FileMode(0644)), "root", "root", []byte("options iwlwifi 11n_disable=8\n"))),
+			set: func(c *manifest.OSCustomizations, f *fsnode.File) {
+				c.ModprobeOptions = f
+			},
+		},
+		{
+			name: "sshd-config-dropin",
+			file: common.Must(fsnode.NewFile("/etc/ssh/sshd_config.d/40-blueprint.conf", common.ToPtr(iofs.FileMode(0600)), "root", "root", []byte("Ciphers aes256-ctr\n"))),
+			set: func(c *manifest.OSCustomizations, f *fsnode.File) {
+				c.SshdConfigDropin = f
+			},
+		},
+		{
+			name: "crypto-policy-modules",
+			file: common.Must(fsnode.NewFile("/etc/crypto-policies/policies/modules/NO-CBC.pmod", nil, nil, nil, []byte("cipher = -*-CBC\n"))),
+			set: func(c *manifest.OSCustomizations, f *fsnode.File) {
+				c.CryptoPolicyModules = []*fsnode.File{f}
+			},
+		},
+		{
+			name: "sudoers",
+			file: common.Must(fsnode.NewFile("/etc/sudoers.d/blueprint", common.ToPtr(iofs.FileMode(0440)), "root", "root", []byte("%wheel ALL=(ALL) NOPASSWD: ALL\n"))),
+			set: func(c *manifest.OSCustomizations, f *fsnode.File) {
+				c.Sudoers = f
+			},
+			packages: []string{"sudo"},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			os := manifest.NewTestOS()
+			tc.set(&os.OSCustomizations, tc.file)
+			if len(tc.packages) > 0 {
+				CheckPkgSetInclude(t, os.GetPackageSetChain(manifest.DISTRO_NULL), tc.packages)
+			}
+
+			_, copyStage := checkDirWithFilesStages(t, os.Serialize().Stages, tc.file)
+			assert.Equal(t, []osbuild.CopyStagePath{{
+				From:              fmt.Sprintf("input://file-%[1]x/sha256:%[1]x", sha256.Sum256(tc.file.Data())),
+				To:                "tree://" + tc.file.Path(),
+				RemoveDestination: true,
+			}}, copyStage.Options.(*osbuild.CopyStageOptions).Paths)
+			assert.Contains(t, os.GetInline(), string(tc.file.Data()))
+		})
+	}
+}
@@ -3,11 +3,13 @@ package manifest
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/osbuild/images/internal/common"
 	"github.com/osbuild/images/pkg/container"
 	"github.com/osbuild/images/pkg/customizations/fsnode"
+	"github.com/osbuild/images/pkg/customizations/network"
 	"github.com/osbuild/images/pkg/customizations/users"
 	"github.com/osbuild/images/pkg/disk"
 	"github.com/osbuild/images/pkg/osbuild"
@@ -35,8 +37,26 @@ type OSTreeDeploymentCustomizations struct {
 	Directories []*fsnode.Directory
 	Files       []*fsnode.File
 
+	// NetworkManager connection profiles (keyfiles) to create in the
+	// deployment
+	NetworkConnections []*fsnode.File
+
+	// sshd, pam_pwquality and pam_limits configuration of the deployment
+	SshdConfig       *osbuild.SshdConfigStageOptions
+	SshdConfigDropin *fsnode.File
+	PwQuality        *osbuild.PwqualityConfStageOptions
+	PamLimitsConf    []*osbuild.PamLimitsConfStageOptions
+
 	FIPS bool
 
+	// System-wide crypto policy with its subpolicy modules and the custom
+	// subpolicy modules to create in the deployment
+	CryptoPolicy        string
+	CryptoPolicyModules []*fsnode.File
+
+	// sudoers file (in /etc/sudoers.d) to create in the deployment
+	Sudoers *fsnode.File
+
 	CustomFileSystems []string
 
 	// Lock the root account in the deployment unless the user defined root
@@ -454,6 +474,19 @@ func (p *OSTreeDeployment) serialize() osbuild.Pipeline {
 		}
 	}
 
+	if len(p.CryptoPolicyModules) > 0 {
+		p.addDirWithFiles(&pipeline, filepath.Dir(p.CryptoPolicyModules[0].Path()), p.CryptoPolicyModules, ref)
+	}
+
+	// the FIPS stages already set the plain FIPS policy
+	if p.CryptoPolicy != "" && !(p.FIPS && p.CryptoPolicy == "FIPS") {
+		policyStage := osbuild.NewUpdateCryptoPoliciesStage(&osbuild.UpdateCryptoPoliciesStageOptions{
+			Policy: p.CryptoPolicy,
+		})
+		policyStage.MountOSTree(p.osName, ref, 0)
+		pipeline.AddStage(policyStage)
+	}
+
 	if !p.UseBootupd {
 		grubOptions := osbuild.NewGrub2StageOptions(p.PartitionTable,
 			strings.Join(kernelOpts, " "),
@@ -473,6 +506,36 @@ func (p *OSTreeDeployment) serialize() osbuild.Pipeline {
 		pipeline.AddStage(bootloader)
 	}
 
+	if len(p.NetworkConnections) > 0 {
+		p.addDirWithFiles(&pipeline, network.KeyfileDir, p.NetworkConnections, ref)
+	}
+
+	if p.Sudoers != nil {
+		p.addDirWithFiles(&pipeline, filepath.Dir(p.Sudoers.Path()), []*fsnode.File{p.Sudoers}, ref)
+	}
+
+	if p.SshdConfig != nil {
+		sshdStage := osbuild.NewSshdConfigStage(p.SshdConfig)
+		sshdStage.MountOSTree(p.osName, ref, 0)
+		pipeline.AddStage(sshdStage)
+	}
+
+	if p.SshdConfigDropin != nil {
+		p.addDirWithFiles(&pipeline, filepath.Dir(p.SshdConfigDropin.Path()), []*fsnode.File{p.SshdConfigDropin}, ref)
+	}
+
+	if p.PwQuality != nil {
+		pwqualityStage := osbuild.NewPwqualityConfStage(p.PwQuality)
+		pwqualityStage.MountOSTree(p.osName, ref, 0)
+		pipeline.AddStage(pwqualityStage)
+	}
+
+	for _, pamLimitsConfConfig := range p.PamLimitsConf {
+		pamLimitsStage := osbuild.NewPamLimitsConfStage(pamLimitsConfConfig)
+		pamLimitsStage.MountOSTree(p.osName, ref, 0)
+		pipeline.AddStage(pamLimitsStage)
+	}
+
 	// First create custom directories, because some of the files may depend on them
 	if len(p.Directories) > 0 {
 		dirStages := osbuild.GenDirectoryNodesStages(p.Directories)
@@ -511,6 +574,20 @@ func (p *OSTreeDeployment) getInline() []string {
 	return p.inlineData
 }
 
+// addDirWithFiles adds the stages that create the directory dir, including
+// its parents, and the given files in it to the pipeline.
+func (p *OSTreeDeployment) addDirWithFiles(pipeline *osbuild.Pipeline, dir string, files []*fsnode.File, ref string) {
+	fsDir, err := fsnode.NewDirectory(dir, nil, nil, nil, true)
+	if err != nil {
+		panic(err)
+	}
+	for _, stage := range osbuild.GenDirectoryNodesStages([]*fsnode.Directory{fsDir}) {
+		stage.MountOSTree(p.osName, ref, 0)
+		pipeline.AddStage(stage)
+	}
+	p.addStagesForAllFilesAndInlineData(pipeline, files, ref)
+}
+
 // addStagesForAllFilesAndInlineData generates stages for creating files and adds them to
 // the pipeline. It also adds their data to the inlineData for the pipeline so
 // that the appropriate sources are created.
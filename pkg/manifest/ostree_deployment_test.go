@@ -1,14 +1,20 @@
 package manifest_test
 
 import (
+	iofs "io/fs"
+	"strings"
 	"testing"
 
+	"github.com/osbuild/images/internal/common"
 	"github.com/osbuild/images/internal/testdisk"
+	"github.com/osbuild/images/pkg/customizations/fsnode"
 	"github.com/osbuild/images/pkg/manifest"
+	"github.com/osbuild/images/pkg/osbuild"
 	"github.com/osbuild/images/pkg/ostree"
 	"github.com/osbuild/images/pkg/platform"
 	"github.com/osbuild/images/pkg/rpmmd"
 	"github.com/osbuild/images/pkg/runner"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -87,3 +93,106 @@ func TestAddInlineOSTreeDeployment(t *testing.T) {
 	// order doesn't matter
 	require.ElementsMatch(expectedContents, fileContents)
 }
+
+func TestOSTreeDeploymentHardening(t *testing.T) {
+	deployment := NewTestOSTreeDeployment()
+	deployment.PartitionTable = testdisk.MakeFakePartitionTable("/")
+	deployment.SshdConfig = &osbuild.SshdConfigStageOptions{
+		Config: osbuild.SshdConfigConfig{PasswordAuthentication: common.ToPtr(false)},
+	}
+	deployment.PwQuality = &osbuild.PwqualityConfStageOptions{
+		Config: osbuild.PwqualityConfConfig{Minlen: common.ToPtr(14)},
+	}
+	deployment.PamLimitsConf = []*osbuild.PamLimitsConfStageOptions{
+		osbuild.NewPamLimitsConfStageOptions("blueprint.conf", []osbuild.PamLimitsConfigLine{
+			{Domain: "*", Type: osbuild.PamLimitsTypeBoth, Item: osbuild.PamLimitsItemNofile, Value: osbuild.PamLimitsValueInt(65536)},
+		}),
+	}
+
+	stages := deployment.Serialize().Stages
+	for _, tc := range []struct {
+		stageType string
+		options   osbuild.StageOptions
+	}{
+		{"org.osbuild.sshd.config", deployment.SshdConfig},
+		{"org.osbuild.pwquality.conf", deployment.PwQuality},
+		{"org.osbuild.pam.limits.conf", deployment.PamLimitsConf[0]},
+	} {
+		found := findStages(tc.stageType, stages)
+		require.Len(t, found, 1, tc.stageType)
+		assert.Equal(t, tc.options, found[0].Options, tc.stageType)
+		assert.NotEmpty(t, found[0].Mounts, tc.stageType)
+	}
+}
+
+func TestOSTreeDeploymentCryptoPolicy(t *testing.T) {
+	deployment := NewTestOSTreeDeployment()
+	deployment.PartitionTable = testdisk.MakeFakePartitionTable("/")
+	deployment.CryptoPolicy = "DEFAULT:NO-CBC"
+	deployment.CryptoPolicyModules = []*fsnode.File{
+		common.Must(fsnode.NewFile("/etc/crypto-policies/policies/modules/NO-CBC.pmod", nil, nil, nil, []byte("cipher = -*-CBC\n"))),
+	}
+
+	stages := deployment.Serialize().Stages
+	policyStages := findStages("org.osbuild.update-crypto-policies", stages)
+	require.Len(t, policyStages, 1)
+	assert.Equal(t, "DEFAULT:NO-CBC", policyStages[0].Options.(*osbuild.UpdateCryptoPoliciesStageOptions).Policy)
+	assert.NotEmpty(t, policyStages[0].Mounts)
+
+	var copied bool
+	for _, path := range collectCopyDestinationPaths(stages) {
+		if strings.HasSuffix(path, "/etc/crypto-policies/policies/modules/NO-CBC.pmod") {
+			copied = true
+		}
+	}
+	assert.True(t, copied)
+}
+
+func TestOSTreeDeploymentCustomizationFiles(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		file *fsnode.File
+		set  func(*manifest.OSTreeDeployment, *fsnode.File)
+	}{
+		{
+			name: "network-connections",
+			file: common.Must(fsnode.NewFile("/etc/NetworkManager/system-connections/eth0.nmconnection", nil, nil, nil, []byte("[connection]\nid=eth0\n"))),
+			set: func(d *manifest.OSTreeDeployment, f *fsnode.File) {
+				d.NetworkConnections = []*fsnode.File{f}
+			},
+		},
+		{
+			name: "sshd-config-dropin",
+			file: common.Must(fsnode.NewFile("/etc/ssh/sshd_config.d/40-blueprint.conf", common.ToPtr(iofs.FileMode(0600)), "root", "root", []byte("Ciphers aes256-ctr\n"))),
+			set: func(d *manifest.OSTreeDeployment, f *fsnode.File) {
+				d.SshdConfigDropin = f
+			},
+		},
+		{
+			name: "crypto-policy-modules",
+			file: common.Must(fsnode.NewFile("/etc/crypto-policies/policies/modules/NO-CBC.pmod", nil, nil, nil, []byte("cipher = -*-CBC\n"))),
+			set: func(d *manifest.OSTreeDeployment, f *fsnode.File) {
+				d.CryptoPolicyModules = []*fsnode.File{f}
+			},
+		},
+		{
+			name: "sudoers",
+			file: common.Must(fsnode.NewFile("/etc/sudoers.d/blueprint", common.ToPtr(iofs.FileMode(0440)), "root", "root", []byte("%wheel ALL=(ALL) NOPASSWD: ALL\n"))),
+			set: func(d *manifest.OSTreeDeployment, f *fsnode.File) {
+				d.Sudoers = f
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			deployment := NewTestOSTreeDeployment()
+			deployment.PartitionTable = testdisk.MakeFakePartitionTable("/")
+			tc.set(deployment, tc.file)
+
+			mkdirStage, copyStage := checkDirWithFilesStages(t, deployment.Serialize().Stages, tc.file)
+			// the files are created in the deployment, not in the build root
+			assert.NotEmpty(t, mkdirStage.Mounts)
+			assert.NotEmpty(t, copyStage.Mounts)
+			assert.Contains(t, deployment.GetInline(), string(tc.file.Data()))
+		})
+	}
+}
@@ -12,6 +12,10 @@ type QCOW2 struct {
 	Compat   string
 
 	imgPipeline FilePipeline
+
+	// image files of additional disks that are converted with the main
+	// image file, see AddAdditionalDisk
+	additionalDisks []additionalDiskFile
 }
 
 func (p QCOW2) Filename() string {
@@ -26,8 +30,20 @@ func (p *QCOW2) SetFilename(filename string) {
 // raw image. The pipeline name is the name of the new pipeline. Filename is the name
 // of the produced qcow2 image.
 func NewQCOW2(buildPipeline Build, imgPipeline FilePipeline) *QCOW2 {
+	return newQCOW2("qcow2", buildPipeline, imgPipeline)
+}
+
+// AddAdditionalDisk adds the image file of the additional disk with the
+// given name of the raw image pipeline. It is converted next to the main
+// image file, so that it is exported with it, e.g. disk-data.qcow2 for the
+// disk "data" of disk.qcow2.
+func (p *QCOW2) AddAdditionalDisk(rawPipeline *RawImage, name string) {
+	p.additionalDisks = append(p.additionalDisks, additionalDiskFile{FilePipeline: rawPipeline, name: name})
+}
+
+func newQCOW2(name string, buildPipeline Build, imgPipeline FilePipeline) *QCOW2 {
 	p := &QCOW2{
-		Base:        NewBase("qcow2", buildPipeline),
+		Base:        NewBase(name, buildPipeline),
 		imgPipeline: imgPipeline,
 		filename:    "image.qcow2",
 	}
@@ -51,6 +67,16 @@ func (p *QCOW2) serialize() osbuild.Pipeline {
 			}),
 		osbuild.NewQemuStagePipelineFilesInputs(p.imgPipeline.Name(), p.imgPipeline.Filename()),
 	))
+	for _, d := range p.additionalDisks {
+		pipeline.AddStage(osbuild.NewQEMUStage(
+			osbuild.NewQEMUStageOptions(AdditionalDiskFilename(p.Filename(), d.name),
+				osbuild.QEMUFormatQCOW2,
+				osbuild.QCOW2Options{
+					Compat: p.Compat,
+				}),
+			osbuild.NewQemuStagePipelineFilesInputs(d.Name(), d.Filename()),
+		))
+	}
 
 	return pipeline
 }
@@ -62,5 +88,9 @@ func (p *QCOW2) getBuildPackages(Distro) []string {
 func (p *QCOW2) Export() *artifact.Artifact {
 	p.Base.export = true
 	mimeType := "application/x-qemu-disk"
-	return artifact.New(p.Name(), p.Filename(), &mimeType)
+	a := artifact.New(p.Name(), p.Filename(), &mimeType)
+	for _, d := range p.additionalDisks {
+		a.AddAdditionalFilename(AdditionalDiskFilename(p.Filename(), d.name))
+	}
+	return a
 }
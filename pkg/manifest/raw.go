@@ -2,6 +2,9 @@ package manifest
 
 import (
 	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"github.com/osbuild/images/pkg/arch"
 	"github.com/osbuild/images/pkg/artifact"
@@ -15,6 +18,9 @@ type RawImage struct {
 	treePipeline *OS
 	filename     string
 	PartTool     osbuild.PartTool
+
+	// the image of an erofs root filesystem, see NewRawImage
+	erofsPipeline *ErofsRoot
 }
 
 func (p RawImage) Filename() string {
@@ -25,12 +31,46 @@ func (p *RawImage) SetFilename(filename string) {
 	p.filename = filename
 }
 
+// AdditionalDiskFilename returns the filename for the image file of the
+// additional disk with the given name, based on the filename of the image
+// file of the main disk, e.g. disk-data.raw for the disk "data" of disk.raw.
+func AdditionalDiskFilename(filename, name string) string {
+	ext := filepath.Ext(filename)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(filename, ext), name, ext)
+}
+
+// compressedAdditionalDiskFilename returns the filename for the compressed
+// image file of the additional disk with the given name, based on the
+// filename of the compressed image file of the main disk, e.g.
+// disk-data.raw.xz for the disk "data" of disk.raw.xz.
+func compressedAdditionalDiskFilename(filename, name string) string {
+	ext := filepath.Ext(filename)
+	return AdditionalDiskFilename(strings.TrimSuffix(filename, ext), name) + ext
+}
+
+// additionalDiskFile is the image file of an additional disk in the tree of
+// a pipeline that creates (or converts) the image file of the main disk.
+type additionalDiskFile struct {
+	FilePipeline
+	name string
+}
+
+func (f additionalDiskFile) Filename() string {
+	return AdditionalDiskFilename(f.FilePipeline.Filename(), f.name)
+}
+
+// NewRawImage creates a new RawImage pipeline for the tree and partition
+// table of the treePipeline. If the root filesystem is an erofs filesystem,
+// an ErofsRoot pipeline is created for the image of the root filesystem.
 func NewRawImage(buildPipeline Build, treePipeline *OS) *RawImage {
 	p := &RawImage{
 		Base:         NewBase("image", buildPipeline),
 		treePipeline: treePipeline,
 		filename:     "disk.img",
 	}
+	if treePipeline != nil && treePipeline.PartitionTable != nil && treePipeline.PartitionTable.ErofsRoot() != nil {
+		p.erofsPipeline = NewErofsRoot(buildPipeline, treePipeline)
+	}
 	buildPipeline.addDependent(p)
 	p.PartTool = osbuild.PTSfdisk // default; can be changed after initialisation
 	return p
@@ -55,9 +95,21 @@ func (p *RawImage) serialize() osbuild.Pipeline {
 	for _, stage := range osbuild.GenImagePrepareStages(pt, p.Filename(), p.PartTool) {
 		pipeline.AddStage(stage)
 	}
+	for _, d := range p.treePipeline.AdditionalDisks {
+		for _, stage := range osbuild.GenImagePrepareStages(d.PartitionTable, AdditionalDiskFilename(p.Filename(), d.Name), p.PartTool) {
+			pipeline.AddStage(stage)
+		}
+	}
 
 	inputName := "root-tree"
 	copyOptions, copyDevices, copyMounts := osbuild.GenCopyFSTreeOptions(inputName, p.treePipeline.Name(), p.Filename(), pt)
+	// mount the filesystems of all disks, so that the tree is copied onto
+	// the disk that holds the mountpoint
+	copyMounts = p.addAdditionalDiskMounts(copyDevices, copyMounts)
+	if p.erofsPipeline != nil {
+		// the root is not mounted, copy the trees of all mounts
+		copyOptions.Paths = osbuild.GenCopyStagePathsForMounts(inputName, copyMounts)
+	}
 	copyInputs := osbuild.NewPipelineTreeInputs(inputName, p.treePipeline.Name())
 	pipeline.AddStage(osbuild.NewCopyStage(copyOptions, copyInputs, copyDevices, copyMounts))
 
@@ -69,37 +121,36 @@ func (p *RawImage) serialize() osbuild.Pipeline {
 		bootCopyOptions := &osbuild.CopyStageOptions{}
 		bootCopyInputs := osbuild.NewPipelineTreeInputs(inputName, p.treePipeline.Name())
 
-		// Find the FS root mount name to use as the destination root
-		// for the target when copying the boot files.
-		var fsRootMntName string
-		for _, mnt := range bootCopyMounts {
-			if mnt.Target == "/" {
-				fsRootMntName = mnt.Name
-				break
-			}
-		}
-
-		if fsRootMntName == "" {
-			panic("no mount found for the filesystem root")
-		}
-
 		for _, paths := range bootFiles {
+			mnt := findMountForPath(bootCopyMounts, paths[1])
+			if mnt == nil {
+				panic(fmt.Sprintf("no mount found for the boot file %q", paths[1]))
+			}
 			bootCopyOptions.Paths = append(bootCopyOptions.Paths, osbuild.CopyStagePath{
 				From: fmt.Sprintf("input://root-tree%s", paths[0]),
-				To:   fmt.Sprintf("mount://%s%s", fsRootMntName, paths[1]),
+				To:   fmt.Sprintf("mount://%s%s", mnt.Name, strings.TrimPrefix(paths[1], strings.TrimSuffix(mnt.Target, "/"))),
 			})
 		}
 
 		pipeline.AddStage(osbuild.NewCopyStage(bootCopyOptions, bootCopyInputs, bootCopyDevices, bootCopyMounts))
 	}
 
+	if p.erofsPipeline != nil {
+		pipeline.AddStage(osbuild.GenErofsRootStage(pt, p.Filename(), p.erofsPipeline.Name(), p.erofsPipeline.Filename()))
+	}
+
 	for _, stage := range osbuild.GenImageFinishStages(pt, p.Filename()) {
 		pipeline.AddStage(stage)
 	}
+	for _, d := range p.treePipeline.AdditionalDisks {
+		for _, stage := range osbuild.GenImageFinishStages(d.PartitionTable, AdditionalDiskFilename(p.Filename(), d.Name)) {
+			pipeline.AddStage(stage)
+		}
+	}
 
 	switch p.treePipeline.platform.GetArch() {
 	case arch.ARCH_S390X:
-		loopback := osbuild.NewLoopbackDevice(&osbuild.LoopbackDeviceOptions{Filename: p.Filename()})
+		loopback := osbuild.NewLoopbackDevice(&osbuild.LoopbackDeviceOptions{Filename: p.Filename(), SectorSize: osbuild.LoopbackSectorSize(pt)})
 		pipeline.AddStage(osbuild.NewZiplInstStage(osbuild.NewZiplInstStageOptions(p.treePipeline.kernelVer, pt), loopback, copyDevices, copyMounts))
 	default:
 		if grubLegacy := p.treePipeline.platform.GetBIOSPlatform(); grubLegacy != "" {
@@ -110,7 +161,63 @@ func (p *RawImage) serialize() osbuild.Pipeline {
 	return pipeline
 }
 
+// findMountForPath returns the mount to copy the file with the given path
+// onto: the FS root mount or, if the root is not mounted (erofs), the mount
+// with the longest target that contains the path. It returns nil if no mount
+// contains the path.
+func findMountForPath(mounts []osbuild.Mount, path string) *osbuild.Mount {
+	var found *osbuild.Mount
+	for idx := range mounts {
+		mnt := &mounts[idx]
+		if mnt.Target == "/" {
+			return mnt
+		}
+		if path != mnt.Target && !strings.HasPrefix(path, mnt.Target+"/") {
+			continue
+		}
+		if found == nil || len(mnt.Target) > len(found.Target) {
+			found = mnt
+		}
+	}
+	return found
+}
+
+// addAdditionalDiskMounts adds the devices of the additional disks to devices
+// and returns the mounts with the mounts of the additional disks added.
+func (p *RawImage) addAdditionalDiskMounts(devices map[string]osbuild.Device, mounts []osbuild.Mount) []osbuild.Mount {
+	if len(p.treePipeline.AdditionalDisks) == 0 {
+		return mounts
+	}
+
+	for _, d := range p.treePipeline.AdditionalDisks {
+		diskMounts, diskDevices, err := osbuild.GenMountsDevicesFromAdditionalPT(AdditionalDiskFilename(p.Filename(), d.Name), d.PartitionTable)
+		if err != nil {
+			panic(err)
+		}
+		for name, device := range diskDevices {
+			if _, exists := devices[name]; exists {
+				panic(fmt.Sprintf("the device name %q is used on more than one disk", name))
+			}
+			devices[name] = device
+		}
+		mounts = append(mounts, diskMounts...)
+	}
+
+	// parent directories need to be mounted before their children
+	sort.Slice(mounts, func(i, j int) bool {
+		return mounts[i].Target < mounts[j].Target
+	})
+	return mounts
+}
+
 func (p *RawImage) Export() *artifact.Artifact {
 	p.Base.export = true
-	return artifact.New(p.Name(), p.Filename(), nil)
+	a := artifact.New(p.Name(), p.Filename(), nil)
+	if p.treePipeline == nil {
+		return a
+	}
+	for _, d := range p.treePipeline.AdditionalDisks {
+		a.AddAdditionalFilename(AdditionalDiskFilename(p.Filename(), d.Name))
+	}
+	return a
 }
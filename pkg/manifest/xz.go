@@ -11,6 +11,10 @@ type XZ struct {
 	filename string
 
 	imgPipeline FilePipeline
+
+	// image files of additional disks that are compressed with the main
+	// image file, see AddAdditionalDisk
+	additionalDisks []additionalDiskFile
 }
 
 func (p XZ) Filename() string {
@@ -33,6 +37,14 @@ func NewXZ(buildPipeline Build, imgPipeline FilePipeline) *XZ {
 	return p
 }
 
+// AddAdditionalDisk adds the image file of the additional disk with the
+// given name of the image pipeline. It is compressed next to the main image
+// file, so that it is exported with it, e.g. disk-data.raw.xz for the disk
+// "data" of disk.raw.xz.
+func (p *XZ) AddAdditionalDisk(name string) {
+	p.additionalDisks = append(p.additionalDisks, additionalDiskFile{FilePipeline: p.imgPipeline, name: name})
+}
+
 func (p *XZ) serialize() osbuild.Pipeline {
 	pipeline := p.Base.serialize()
 
@@ -40,6 +52,12 @@ func (p *XZ) serialize() osbuild.Pipeline {
 		osbuild.NewXzStageOptions(p.Filename()),
 		osbuild.NewXzStageInputs(osbuild.NewFilesInputPipelineObjectRef(p.imgPipeline.Name(), p.imgPipeline.Export().Filename(), nil)),
 	))
+	for _, d := range p.additionalDisks {
+		pipeline.AddStage(osbuild.NewXzStage(
+			osbuild.NewXzStageOptions(compressedAdditionalDiskFilename(p.Filename(), d.name)),
+			osbuild.NewXzStageInputs(osbuild.NewFilesInputPipelineObjectRef(d.Name(), d.Filename(), nil)),
+		))
+	}
 
 	return pipeline
 }
@@ -51,5 +69,9 @@ func (p *XZ) getBuildPackages(Distro) []string {
 func (p *XZ) Export() *artifact.Artifact {
 	p.Base.export = true
 	mimeType := "application/xz"
-	return artifact.New(p.Name(), p.Filename(), &mimeType)
+	a := artifact.New(p.Name(), p.Filename(), &mimeType)
+	for _, d := range p.additionalDisks {
+		a.AddAdditionalFilename(compressedAdditionalDiskFilename(p.Filename(), d.name))
+	}
+	return a
 }
@@ -11,6 +11,10 @@ type Zstd struct {
 	filename string
 
 	imgPipeline FilePipeline
+
+	// image files of additional disks that are compressed with the main
+	// image file, see AddAdditionalDisk
+	additionalDisks []additionalDiskFile
 }
 
 func (p Zstd) Filename() string {
@@ -33,6 +37,14 @@ func NewZstd(buildPipeline Build, imgPipeline FilePipeline) *Zstd {
 	return p
 }
 
+// AddAdditionalDisk adds the image file of the additional disk with the
+// given name of the image pipeline. It is compressed next to the main image
+// file, so that it is exported with it, e.g. disk-data.raw.zstd for the disk
+// "data" of disk.raw.zstd.
+func (p *Zstd) AddAdditionalDisk(name string) {
+	p.additionalDisks = append(p.additionalDisks, additionalDiskFile{FilePipeline: p.imgPipeline, name: name})
+}
+
 func (p *Zstd) serialize() osbuild.Pipeline {
 	pipeline := p.Base.serialize()
 
@@ -40,6 +52,12 @@ func (p *Zstd) serialize() osbuild.Pipeline {
 		osbuild.NewZstdStageOptions(p.Filename()),
 		osbuild.NewZstdStageInputs(osbuild.NewFilesInputPipelineObjectRef(p.imgPipeline.Name(), p.imgPipeline.Export().Filename(), nil)),
 	))
+	for _, d := range p.additionalDisks {
+		pipeline.AddStage(osbuild.NewZstdStage(
+			osbuild.NewZstdStageOptions(compressedAdditionalDiskFilename(p.Filename(), d.name)),
+			osbuild.NewZstdStageInputs(osbuild.NewFilesInputPipelineObjectRef(d.Name(), d.Filename(), nil)),
+		))
+	}
 
 	return pipeline
 }
@@ -51,5 +69,9 @@ func (p *Zstd) getBuildPackages(Distro) []string {
 func (p *Zstd) Export() *artifact.Artifact {
 	p.Base.export = true
 	mimeType := "application/zstd"
-	return artifact.New(p.Name(), p.Filename(), &mimeType)
+	a := artifact.New(p.Name(), p.Filename(), &mimeType)
+	for _, d := range p.additionalDisks {
+		a.AddAdditionalFilename(compressedAdditionalDiskFilename(p.Filename(), d.name))
+	}
+	return a
 }
@@ -24,7 +24,6 @@ import (
 
 const (
 	defaultDepsolverSBOMType = sbom.StandardTypeSpdx
-	defaultSBOMExt           = "spdx.json"
 
 	defaultDepsolveCacheDir = "osbuild-depsolve-dnf"
 )
@@ -44,6 +43,12 @@ type Options struct {
 	// content can be read
 	SBOMWriter SBOMWriterFunc
 
+	// SBOMType selects the standard of the SBOM documents passed
+	// to the SBOMWriter, if unset SPDX documents are generated.
+	// CycloneDX documents are generated from the packages and
+	// repositories of the depsolve result.
+	SBOMType sbom.StandardType
+
 	// WarningsOutput will receive any warnings that are part of
 	// the manifest generation. If it is unset any warnings will
 	// generate an error.
@@ -83,6 +88,7 @@ type Generator struct {
 	containerResolver      ContainerResolverFunc
 	commitResolver         CommitResolverFunc
 	sbomWriter             SBOMWriterFunc
+	sbomType               sbom.StandardType
 	warningsOutput         io.Writer
 	depsolveWarningsOutput io.Writer
 
@@ -111,6 +117,7 @@ func New(reporegistry *reporegistry.RepoRegistry, opts *Options) (*Generator, er
 		commitResolver:         opts.CommitResolver,
 		rpmDownloader:          opts.RpmDownloader,
 		sbomWriter:             opts.SBOMWriter,
+		sbomType:               opts.SBOMType,
 		warningsOutput:         opts.WarningsOutput,
 		depsolveWarningsOutput: opts.DepsolveWarningsOutput,
 		customSeed:             opts.CustomSeed,
@@ -129,6 +136,13 @@ func New(reporegistry *reporegistry.RepoRegistry, opts *Options) (*Generator, er
 	if mg.commitResolver == nil {
 		mg.commitResolver = DefaultCommitResolver
 	}
+	switch mg.sbomType {
+	case sbom.StandardTypeNone:
+		mg.sbomType = defaultDepsolverSBOMType
+	case sbom.StandardTypeSpdx, sbom.StandardTypeCycloneDX:
+	default:
+		return nil, fmt.Errorf("unsupported SBOM type: %d", mg.sbomType)
+	}
 
 	return mg, nil
 }
@@ -201,14 +215,18 @@ func (mg *Generator) Generate(bp *blueprint.Blueprint, dist distro.Distro, imgTy
 			}
 			// XXX: sync with image-builder-cli:build.go name generation - can we have a shared helper?
 			imageName := fmt.Sprintf("%s-%s-%s", dist.Name(), imgType.Name(), a.Name())
-			sbomDocOutputFilename := fmt.Sprintf("%s.%s-%s.%s", imageName, pipelinePurpose, plName, defaultSBOMExt)
+			sbomDocOutputFilename := fmt.Sprintf("%s.%s-%s.%s", imageName, pipelinePurpose, plName, mg.sbomType.FileExtension())
 
+			sbomDoc, err := mg.sbomFor(depsolvedPipeline)
+			if err != nil {
+				return fmt.Errorf("cannot generate SBOM for pipeline %q: %w", plName, err)
+			}
 			var buf bytes.Buffer
 			enc := json.NewEncoder(&buf)
-			if err := enc.Encode(depsolvedPipeline.SBOM.Document); err != nil {
+			if err := enc.Encode(sbomDoc.Document); err != nil {
 				return err
 			}
-			if err := mg.sbomWriter(sbomDocOutputFilename, &buf, depsolvedPipeline.SBOM.DocType); err != nil {
+			if err := mg.sbomWriter(sbomDocOutputFilename, &buf, sbomDoc.DocType); err != nil {
 				return err
 			}
 		}
@@ -217,6 +235,20 @@ func (mg *Generator) Generate(bp *blueprint.Blueprint, dist distro.Distro, imgTy
 	return nil
 }
 
+// sbomFor returns the SBOM document of the configured type for the
+// given depsolve result. The depsolver only generates SPDX documents,
+// CycloneDX documents are generated from the depsolved packages.
+func (mg *Generator) sbomFor(res dnfjson.DepsolveResult) (*sbom.Document, error) {
+	switch {
+	case res.SBOM != nil && res.SBOM.DocType == mg.sbomType:
+		return res.SBOM, nil
+	case mg.sbomType == sbom.StandardTypeCycloneDX:
+		return sbom.NewCycloneDXDocument(res.Packages, res.Repos)
+	default:
+		return nil, fmt.Errorf("depsolver did not generate a %s document", mg.sbomType)
+	}
+}
+
 func xdgCacheHome() (string, error) {
 	xdgCacheHome := os.Getenv("XDG_CACHE_HOME")
 	if xdgCacheHome != "" {
@@ -252,9 +284,9 @@ func DefaultDepsolver(cacheDir string, depsolveWarningsOutput io.Writer, package
 		// Always generate Spdx SBOMs for now, this makes the
 		// default depsolve slightly slower but it means we
 		// need no extra argument here to select the SBOM
-		// type. Once we have more types than Spdx of course
-		// we need to add a option to select the type.
-		res, err := solver.Depsolve(pkgSet, sbom.StandardTypeSpdx)
+		// type. Other SBOM types are generated from the
+		// depsolve result by the Generator.
+		res, err := solver.Depsolve(pkgSet, defaultDepsolverSBOMType)
 		if err != nil {
 			return nil, fmt.Errorf("error depsolving: %w", err)
 		}
@@ -288,6 +288,67 @@ func TestManifestGeneratorDepsolveWithSbomWriter(t *testing.T) {
 	assert.Equal(t, expected, generatedSboms)
 }
 
+func TestManifestGeneratorDepsolveWithCycloneDXSbomWriter(t *testing.T) {
+	repos, err := testrepos.New()
+	assert.NoError(t, err)
+	fac := distrofactory.NewDefault()
+
+	filter, err := imagefilter.New(fac, repos)
+	assert.NoError(t, err)
+	res, err := filter.Filter("distro:centos-9", "type:qcow2", "arch:x86_64")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(res))
+
+	var osbuildManifest bytes.Buffer
+	generatedSboms := map[string][]byte{}
+	opts := &manifestgen.Options{
+		Output:            &osbuildManifest,
+		Depsolver:         fakeDepsolve,
+		CommitResolver:    panicCommitResolver,
+		ContainerResolver: panicContainerResolver,
+
+		SBOMType: sbom.StandardTypeCycloneDX,
+		SBOMWriter: func(filename string, content io.Reader, docType sbom.StandardType) error {
+			assert.Equal(t, sbom.StandardTypeCycloneDX, docType)
+
+			b, err := io.ReadAll(content)
+			assert.NoError(t, err)
+			generatedSboms[filename] = b
+			return nil
+		},
+	}
+	mg, err := manifestgen.New(repos, opts)
+	assert.NoError(t, err)
+	var bp blueprint.Blueprint
+	err = mg.Generate(&bp, res[0].Distro, res[0].ImgType, res[0].Arch, nil)
+	require.NoError(t, err)
+
+	assert.Len(t, generatedSboms, 2)
+	content, ok := generatedSboms["centos-9-qcow2-x86_64.image-os.cdx.json"]
+	require.True(t, ok)
+	var bom sbom.CycloneDXBOM
+	err = json.Unmarshal(content, &bom)
+	require.NoError(t, err)
+	assert.Equal(t, "CycloneDX", bom.BOMFormat)
+	var kernel *sbom.CycloneDXComponent
+	for idx := range bom.Components {
+		if bom.Components[idx].Name == "kernel" {
+			kernel = &bom.Components[idx]
+		}
+	}
+	require.NotNil(t, kernel)
+	assert.Equal(t, []sbom.CycloneDXHash{{Algorithm: "SHA-256", Content: strings.TrimPrefix(sha256For("kernel"), "sha256:")}}, kernel.Hashes)
+	assert.Contains(t, kernel.Properties, sbom.CycloneDXProperty{Name: sbom.CycloneDXPropertyRepoMetalink, Value: "https://example.com/metalink"})
+}
+
+func TestManifestGeneratorBadSBOMType(t *testing.T) {
+	repos, err := testrepos.New()
+	assert.NoError(t, err)
+
+	_, err = manifestgen.New(repos, &manifestgen.Options{SBOMType: sbom.StandardType(99)})
+	assert.EqualError(t, err, "unsupported SBOM type: 99")
+}
+
 func TestManifestGeneratorSeed(t *testing.T) {
 	repos, err := testrepos.New()
 	assert.NoError(t, err)
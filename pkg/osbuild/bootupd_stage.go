@@ -143,8 +143,9 @@ func genDevicesForBootupd(filename, devName string, pt *disk.PartitionTable) (ma
 		devName: Device{
 			Type: "org.osbuild.loopback",
 			Options: &LoopbackDeviceOptions{
-				Filename: filename,
-				Partscan: true,
+				Filename:   filename,
+				Partscan:   true,
+				SectorSize: LoopbackSectorSize(pt),
 			},
 		},
 	}
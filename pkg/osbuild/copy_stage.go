@@ -2,6 +2,8 @@ package osbuild
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 
 	"github.com/osbuild/images/pkg/disk"
 )
@@ -61,6 +63,20 @@ func GenCopyFSTreeOptions(inputName, inputPipeline, filename string, pt *disk.Pa
 	[]Mount,
 ) {
 
+	if pt.ErofsRoot() != nil {
+		// the root filesystem is written from an erofs image of the tree
+		// (see GenErofsRootStage), only the trees of the other mountpoints
+		// are copied onto their filesystems
+		_, mounts, devices, err := genMountsDevicesFromPT(filename, pt)
+		if err != nil {
+			panic(err)
+		}
+		options := CopyStageOptions{
+			Paths: GenCopyStagePathsForMounts(inputName, mounts),
+		}
+		return &options, devices, mounts
+	}
+
 	fsRootMntName, mounts, devices, err := GenMountsDevicesFromPT(filename, pt)
 	if err != nil {
 		panic(err)
@@ -77,3 +93,26 @@ func GenCopyFSTreeOptions(inputName, inputPipeline, filename string, pt *disk.Pa
 
 	return &options, devices, mounts
 }
+
+// GenCopyStagePathsForMounts returns the paths that copy the tree of each
+// mountpoint onto its mount, for when the filesystem root is not mounted.
+// Only the mounts that are not below another mount are copied, the trees of
+// the mounts below are copied with them.
+func GenCopyStagePathsForMounts(inputName string, mounts []Mount) []CopyStagePath {
+	var paths []CopyStagePath
+	var parents []string
+	for _, mnt := range mounts {
+		// the mounts are sorted, parents come before their children
+		if slices.ContainsFunc(parents, func(parent string) bool {
+			return strings.HasPrefix(mnt.Target, parent+"/")
+		}) {
+			continue
+		}
+		parents = append(parents, mnt.Target)
+		paths = append(paths, CopyStagePath{
+			From: fmt.Sprintf("input://%s%s/", inputName, mnt.Target),
+			To:   fmt.Sprintf("mount://%s/", mnt.Name),
+		})
+	}
+	return paths
+}
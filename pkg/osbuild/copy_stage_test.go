@@ -67,3 +67,21 @@ func TestNewCopyStageSimpleSourcesInputs(t *testing.T) {
 	actualStage := NewCopyStageSimple(&CopyStageOptions{paths}, &filesInputs)
 	assert.Equal(t, expectedStage, actualStage)
 }
+
+func TestGenCopyFSTreeOptionsErofs(t *testing.T) {
+	pt := makeErofsPartitionTable()
+
+	// the erofs root is not mounted, the trees of the other mountpoints are
+	// copied onto their own filesystems
+	options, devices, mounts := GenCopyFSTreeOptions("root-tree", "os", "disk.img", pt)
+	assert.Equal(t, []CopyStagePath{
+		{From: "input://root-tree/boot/", To: "mount://boot/"},
+		{From: "input://root-tree/var/", To: "mount://var/"},
+	}, options.Paths)
+	assert.Len(t, devices, 3)
+	var targets []string
+	for _, mnt := range mounts {
+		targets = append(targets, mnt.Target)
+	}
+	assert.Equal(t, []string{"/boot", "/boot/efi", "/var"}, targets)
+}
@@ -19,6 +19,17 @@ type DeviceOptions interface {
 	isDeviceOptions()
 }
 
+// luksSectorSize returns the sector size of the LUKS container. Unless set
+// explicitly, it matches the sector size of disks with sectors larger than
+// the default, since LUKS sectors must not be smaller than the sectors of the
+// underlying device.
+func luksSectorSize(luks *disk.LUKSContainer, pt *disk.PartitionTable) uint64 {
+	if luks.SectorSize == 0 && pt.GetSectorSize() > disk.DefaultSectorSize {
+		return pt.GetSectorSize()
+	}
+	return luks.SectorSize
+}
+
 func GenDeviceCreationStages(pt *disk.PartitionTable, filename string) []*Stage {
 	stages := make([]*Stage, 0)
 
@@ -42,7 +53,7 @@ func GenDeviceCreationStages(pt *disk.PartitionTable, filename string) []*Stage
 					Cipher:     ent.Cipher,
 					Label:      ent.Label,
 					Subsystem:  ent.Subsystem,
-					SectorSize: ent.SectorSize,
+					SectorSize: luksSectorSize(ent, pt),
 					PBKDF: Argon2id{
 						Method:      "argon2id",
 						Iterations:  ent.PBKDF.Iterations,
@@ -86,6 +97,7 @@ func GenDeviceCreationStages(pt *disk.PartitionTable, filename string) []*Stage
 				}, stageDevices)
 
 			stages = append(stages, stage)
+
 		}
 
 		return nil
@@ -197,7 +209,7 @@ func getDevices(path []disk.Entity, filename string, lockLoopback bool) (map[str
 				Filename:   filename,
 				Start:      pt.BytesToSectors(e.Start),
 				Size:       pt.BytesToSectors(e.Size),
-				SectorSize: nil,
+				SectorSize: LoopbackSectorSize(pt),
 				Lock:       lockLoopback,
 			}
 			name := deviceName(e.Payload)
@@ -277,10 +289,35 @@ func genOsbuildMount(source string, mnt disk.Mountable) (*Mount, error) {
 // 3) generated devices
 // 4) error if any
 func GenMountsDevicesFromPT(filename string, pt *disk.PartitionTable) (string, []Mount, map[string]Device, error) {
+	fsRootMntName, mounts, devices, err := genMountsDevicesFromPT(filename, pt)
+	if err != nil {
+		return "", nil, nil, err
+	}
+	if fsRootMntName == "" {
+		return "", nil, nil, fmt.Errorf("no mount found for the filesystem root")
+	}
+	return fsRootMntName, mounts, devices, nil
+}
+
+// GenMountsDevicesFromAdditionalPT generates osbuild mounts and devices from
+// the disk.PartitionTable of an additional disk. Unlike for
+// GenMountsDevicesFromPT, the partition table does not need to contain the
+// filesystem root.
+func GenMountsDevicesFromAdditionalPT(filename string, pt *disk.PartitionTable) ([]Mount, map[string]Device, error) {
+	_, mounts, devices, err := genMountsDevicesFromPT(filename, pt)
+	return mounts, devices, err
+}
+
+func genMountsDevicesFromPT(filename string, pt *disk.PartitionTable) (string, []Mount, map[string]Device, error) {
 	devices := make(map[string]Device, len(pt.Partitions))
 	mounts := make([]Mount, 0, len(pt.Partitions))
 	var fsRootMntName string
 	genMounts := func(mnt disk.Mountable, path []disk.Entity) error {
+		if mnt.GetFSType() == "erofs" {
+			// the read-only root is not mounted, its tree is written
+			// into the partition by GenErofsRootStage
+			return nil
+		}
 		stageDevices, leafDeviceName := getDevices(path, filename, false)
 		mount, err := genOsbuildMount(leafDeviceName, mnt)
 		if err != nil {
@@ -320,9 +357,5 @@ func GenMountsDevicesFromPT(filename string, pt *disk.PartitionTable) (string, [
 		return mounts[i].Target < mounts[j].Target
 	})
 
-	if fsRootMntName == "" {
-		return "", nil, nil, fmt.Errorf("no mount found for the filesystem root")
-	}
-
 	return fsRootMntName, mounts, devices, nil
 }
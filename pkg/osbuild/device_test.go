@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/osbuild/images/internal/common"
 	"github.com/osbuild/images/internal/testdisk"
 	"github.com/osbuild/images/pkg/arch"
 	"github.com/osbuild/images/pkg/blueprint"
@@ -77,6 +78,44 @@ func TestGenDeviceCreationStages(t *testing.T) {
 
 }
 
+func TestGenImagePrepareStages4Kn(t *testing.T) {
+	// math/rand is good enough in this case
+	/* #nosec G404 */
+	rng := rand.New(rand.NewSource(13))
+
+	luks_lvm := testPartitionTables["luks+lvm"]
+	luks_lvm.SectorSize = disk.SectorSize4Kn
+
+	pt, err := disk.NewPartitionTable(&luks_lvm, []blueprint.FilesystemCustomization{}, 0, disk.AutoLVMPartitioningMode, arch.ARCH_AARCH64, make(map[string]uint64), rng)
+	require.NoError(t, err)
+
+	stages := GenImagePrepareStages(pt, "image.raw", PTSfdisk)
+
+	sfdisk := stages[1]
+	require.Equal(t, "org.osbuild.sfdisk", sfdisk.Type)
+	assert.Equal(t, common.ToPtr(uint64(4096)), sfdisk.Devices["device"].Options.(*LoopbackDeviceOptions).SectorSize)
+	// partition offsets and sizes are in 4096 byte sectors
+	for idx, part := range sfdisk.Options.(*SfdiskStageOptions).Partitions {
+		assert.Equal(t, pt.Partitions[idx].Start/4096, part.Start)
+		assert.Equal(t, pt.Partitions[idx].Size/4096, part.Size)
+	}
+
+	var luksFound bool
+	for _, stage := range stages {
+		for _, device := range stage.Devices {
+			if lbopts, ok := device.Options.(*LoopbackDeviceOptions); ok {
+				assert.Equal(t, common.ToPtr(uint64(4096)), lbopts.SectorSize, stage.Type)
+			}
+		}
+		if stage.Type == "org.osbuild.luks2.format" {
+			luksFound = true
+			// the LUKS sector size defaults to the sector size of the disk
+			assert.Equal(t, uint64(4096), stage.Options.(*LUKS2CreateStageOptions).SectorSize)
+		}
+	}
+	assert.True(t, luksFound)
+}
+
 func TestGenDeviceFinishStages(t *testing.T) {
 	assert := assert.New(t)
 
@@ -271,3 +310,22 @@ func Test_deviceName(t *testing.T) {
 		})
 	}
 }
+
+func TestMountsDeviceFromAdditionalPt(t *testing.T) {
+	filename := "fake-disk-data.img"
+	fakePt := testdisk.MakeFakePartitionTable("/var/lib/containers")
+	mounts, devices, err := GenMountsDevicesFromAdditionalPT(filename, fakePt)
+	require.NoError(t, err)
+	assert.Equal(t, []Mount{
+		{Name: "var-lib-containers", Type: "org.osbuild.ext4", Source: "var-lib-containers", Target: "/var/lib/containers"},
+	}, mounts)
+	assert.Equal(t, map[string]Device{
+		"var-lib-containers": {
+			Type: "org.osbuild.loopback",
+			Options: &LoopbackDeviceOptions{
+				Filename: "fake-disk-data.img",
+				Size:     testdisk.FakePartitionSize / 512,
+			},
+		},
+	}, devices)
+}
@@ -80,8 +80,9 @@ func GenImagePrepareStages(pt *disk.PartitionTable, filename string, partTool Pa
 	// create the partition layout in the empty file
 	loopback := NewLoopbackDevice(
 		&LoopbackDeviceOptions{
-			Filename: filename,
-			Lock:     true,
+			Filename:   filename,
+			Lock:       true,
+			SectorSize: LoopbackSectorSize(pt),
 		},
 	)
 
@@ -141,10 +142,10 @@ func GenImageKernelOptions(pt *disk.PartitionTable, mountUnits bool) (string, []
 	}
 
 	genOptions := func(e disk.Entity, path []disk.Entity) error {
-		switch ent := e.(type) {
-		case *disk.LUKSContainer:
-			karg := "luks.uuid=" + ent.UUID
+		if karg := deviceKernelOption(e); karg != "" {
 			cmdline = append(cmdline, karg)
+		}
+		switch ent := e.(type) {
 		case *disk.BtrfsSubvolume:
 			if ent.Mountpoint == "/" && !mountUnits {
 				// if we're using mount units, the rootflags will be added
@@ -156,6 +157,18 @@ func GenImageKernelOptions(pt *disk.PartitionTable, mountUnits bool) (string, []
 		return nil
 	}
 
+	erofsRoot := pt.ErofsRoot()
+	if erofsRoot != nil {
+		// The erofs stage cannot set the UUID of the filesystem, so the root
+		// filesystem is found by the UUID of its partition instead. This
+		// option comes after the root=UUID= option that the bootloader
+		// stages add for rootFsUUID and takes precedence over it.
+		if pt.Type != disk.PT_GPT {
+			return "", nil, fmt.Errorf("an erofs root filesystem requires a gpt partition table")
+		}
+		cmdline = append(cmdline, fmt.Sprintf("root=PARTUUID=%s", erofsRoot.UUID))
+	}
+
 	if mountUnits {
 		// The systemd-remount-fs service reads /etc/fstab to discover mount
 		// options for / and /usr. Without an /etc/fstab, / and /usr do not get
@@ -189,3 +202,27 @@ func GenImageKernelOptions(pt *disk.PartitionTable, mountUnits bool) (string, []
 	_ = pt.ForEachEntity(genOptions)
 	return rootFsUUID, cmdline, nil
 }
+
+// GenAdditionalDiskKernelOptions returns the kernel command line options that
+// are needed to activate the devices of the partition table of an additional
+// disk, i.e. one that does not hold the root filesystem.
+func GenAdditionalDiskKernelOptions(pt *disk.PartitionTable) []string {
+	var cmdline []string
+	_ = pt.ForEachEntity(func(e disk.Entity, path []disk.Entity) error {
+		if karg := deviceKernelOption(e); karg != "" {
+			cmdline = append(cmdline, karg)
+		}
+		return nil
+	})
+	return cmdline
+}
+
+// deviceKernelOption returns the kernel command line option that activates
+// the device of the entity, or an empty string if none is needed.
+func deviceKernelOption(e disk.Entity) string {
+	switch ent := e.(type) {
+	case *disk.LUKSContainer:
+		return "luks.uuid=" + ent.UUID
+	}
+	return ""
+}
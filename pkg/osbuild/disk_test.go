@@ -322,3 +322,95 @@ func TestGenImageKernelOptionsMountUnitsLVMWithUsr(t *testing.T) {
 	assert.Contains(cmdline, "mount.usr=UUID="+uuids["/usr"])
 	assert.Contains(cmdline, "mount.usrfstype=xfs")
 }
+
+func TestGenAdditionalDiskKernelOptions(t *testing.T) {
+	pt := &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Partitions: []disk.Partition{
+			{
+				Payload: &disk.LUKSContainer{
+					UUID: "fb180daf-48a7-4ee0-b10d-394651850fd4",
+					Payload: &disk.Filesystem{
+						Type:       "xfs",
+						Mountpoint: "/data",
+					},
+				},
+			},
+			{
+				Payload: &disk.Filesystem{
+					Type:       "xfs",
+					Mountpoint: "/scratch",
+				},
+			},
+		},
+	}
+	assert.Equal(t, []string{"luks.uuid=fb180daf-48a7-4ee0-b10d-394651850fd4"}, GenAdditionalDiskKernelOptions(pt))
+	assert.Empty(t, GenAdditionalDiskKernelOptions(testdisk.MakeFakePartitionTable("/data")))
+}
+
+// makeErofsPartitionTable returns a partition table with an erofs root
+// filesystem, /boot with the ESP below it, and /var.
+func makeErofsPartitionTable() *disk.PartitionTable {
+	return &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Size: 10 * datasizes.GiB,
+		Partitions: []disk.Partition{
+			{
+				Start: 1 * datasizes.MiB,
+				Size:  100 * datasizes.MiB,
+				Payload: &disk.Filesystem{
+					Type:       "vfat",
+					Mountpoint: "/boot/efi",
+					UUID:       disk.EFIFilesystemUUID,
+				},
+			},
+			{
+				Start: 101 * datasizes.MiB,
+				Size:  1 * datasizes.GiB,
+				Payload: &disk.Filesystem{
+					Type:       "ext4",
+					Mountpoint: "/boot",
+					UUID:       "6e4ff95f-f662-45ee-a82a-bdf44a2d0b75",
+				},
+			},
+			{
+				Start: 1125 * datasizes.MiB,
+				Size:  5 * datasizes.GiB,
+				UUID:  "f83b8e88-3bbf-457a-ab99-c5b252c7429c",
+				Payload: &disk.Filesystem{
+					Type:         "erofs",
+					Mountpoint:   "/",
+					UUID:         "fb180daf-48a7-4ee0-b10d-394651850fd4",
+					FSTabOptions: "ro",
+				},
+			},
+			{
+				Start: 6245 * datasizes.MiB,
+				Size:  3 * datasizes.GiB,
+				Payload: &disk.Filesystem{
+					Type:       "ext4",
+					Mountpoint: "/var",
+					UUID:       "a178892e-e285-4ce1-9114-55780875d64e",
+				},
+			},
+		},
+	}
+}
+
+func TestGenImageKernelOptionsErofs(t *testing.T) {
+	pt := makeErofsPartitionTable()
+
+	// the root is found by the partition UUID, the UUID of the filesystem is
+	// unknown
+	_, cmdline, err := GenImageKernelOptions(pt, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"root=PARTUUID=f83b8e88-3bbf-457a-ab99-c5b252c7429c"}, cmdline)
+
+	_, cmdline, err = GenImageKernelOptions(pt, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"root=PARTUUID=f83b8e88-3bbf-457a-ab99-c5b252c7429c", "rootflags=ro"}, cmdline)
+
+	pt.Type = disk.PT_DOS
+	_, _, err = GenImageKernelOptions(pt, false)
+	assert.EqualError(t, err, "an erofs root filesystem requires a gpt partition table")
+}
@@ -56,9 +56,17 @@ func (options *FSTabStageOptions) AddFilesystem(id string, vfsType string, path
 	})
 }
 
-func NewFSTabStageOptions(pt *disk.PartitionTable) (*FSTabStageOptions, error) {
+// NewFSTabStageOptions creates the fstab entries for all filesystems and swap
+// areas of the partition tables, i.e. of all disks of an image.
+func NewFSTabStageOptions(pts ...*disk.PartitionTable) (*FSTabStageOptions, error) {
 	var options FSTabStageOptions
 	genOption := func(mnt disk.FSTabEntity, path []disk.Entity) error {
+		if mnt.GetFSType() == "erofs" {
+			// the UUID of an erofs filesystem is unknown, the read-only
+			// root is mounted from the kernel command line instead (see
+			// GenImageKernelOptions)
+			return nil
+		}
 		fsSpec := mnt.GetFSSpec()
 		fsOptions, err := mnt.GetFSTabOptions()
 		if err != nil {
@@ -72,9 +80,10 @@ func NewFSTabStageOptions(pt *disk.PartitionTable) (*FSTabStageOptions, error) {
 		return fmt.Sprintf("%d%s", fs.PassNo, fs.Path)
 	}
 
-	err := pt.ForEachFSTabEntity(genOption)
-	if err != nil {
-		return nil, err
+	for _, pt := range pts {
+		if err := pt.ForEachFSTabEntity(genOption); err != nil {
+			return nil, err
+		}
 	}
 
 	// sort the entries by PassNo to maintain backward compatibility
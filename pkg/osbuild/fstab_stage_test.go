@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/osbuild/images/internal/testdisk"
+	"github.com/osbuild/images/pkg/disk"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -128,3 +129,27 @@ func TestNewFSTabStageOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestNewFSTabStageOptionsAdditionalDisks(t *testing.T) {
+	pt := testdisk.MakeFakePartitionTable("/", "/boot/efi")
+	dataPt := testdisk.MakeFakePartitionTable("/var/lib/containers")
+
+	options, err := NewFSTabStageOptions(pt, dataPt)
+	require.NoError(t, err)
+	assert.Equal(t, []*FSTabEntry{
+		{UUID: disk.RootPartitionUUID, VFSType: "ext4", Path: "/"},
+		{UUID: disk.EFIFilesystemUUID, VFSType: "vfat", Path: "/boot/efi"},
+		{UUID: disk.DataPartitionUUID, VFSType: "ext4", Path: "/var/lib/containers"},
+	}, options.FileSystems)
+}
+
+func TestNewFSTabStageOptionsErofs(t *testing.T) {
+	options, err := NewFSTabStageOptions(makeErofsPartitionTable())
+	require.NoError(t, err)
+	// the erofs root is mounted from the kernel command line
+	var paths []string
+	for _, fs := range options.FileSystems {
+		paths = append(paths, fs.Path)
+	}
+	assert.Equal(t, []string{"/boot", "/boot/efi", "/var"}, paths)
+}
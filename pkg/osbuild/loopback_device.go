@@ -1,5 +1,10 @@
 package osbuild
 
+import (
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/disk"
+)
+
 // Expose a file (or part of it) as a device node
 
 type LoopbackDeviceOptions struct {
@@ -30,3 +35,13 @@ func NewLoopbackDevice(options *LoopbackDeviceOptions) *Device {
 		Options: options,
 	}
 }
+
+// LoopbackSectorSize returns the sector size for the loopback devices of the
+// partition table. It is nil for the default sector size (512 bytes), so that
+// the option is omitted from the device options.
+func LoopbackSectorSize(pt *disk.PartitionTable) *uint64 {
+	if pt.GetSectorSize() == disk.DefaultSectorSize {
+		return nil
+	}
+	return common.ToPtr(pt.GetSectorSize())
+}
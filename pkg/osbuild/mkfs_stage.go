@@ -14,12 +14,21 @@ import (
 //   - org.osbuild.mkfs.*: for all filesystems and btrfs volumes
 //   - org.osbuild.btrfs.subvol: for all btrfs subvolumes
 //   - org.osbuild.mkswap: for swap areas
+//
+// No stage is generated for an erofs root filesystem.
 func GenFsStages(pt *disk.PartitionTable, filename string) []*Stage {
 	stages := make([]*Stage, 0, len(pt.Partitions))
 
 	genStage := func(ent disk.Entity, path []disk.Entity) error {
 		switch e := ent.(type) {
 		case *disk.Filesystem:
+			if e.GetFSType() == "erofs" {
+				if root := pt.ErofsRoot(); root == nil || root.Payload != e {
+					panic("erofs is only supported for the root filesystem on a plain partition")
+				}
+				// written from an image of the tree, see GenErofsRootStage
+				return nil
+			}
 			// TODO: extract last device renaming into helper
 			stageDevices, lastName := getDevices(path, filename, true)
 
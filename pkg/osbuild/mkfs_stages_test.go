@@ -379,3 +379,31 @@ func TestGenFsStagesUnhappy(t *testing.T) {
 		GenFsStages(pt, "file.img")
 	})
 }
+
+func TestGenFsStagesErofs(t *testing.T) {
+	// the erofs root is written from an image, see GenErofsRootStage
+	stages := GenFsStages(makeErofsPartitionTable(), "file.img")
+	var types []string
+	for _, stage := range stages {
+		types = append(types, stage.Type)
+	}
+	assert.Equal(t, []string{"org.osbuild.mkfs.fat", "org.osbuild.mkfs.ext4", "org.osbuild.mkfs.ext4"}, types)
+}
+
+func TestGenFsStagesErofsNotRoot(t *testing.T) {
+	pt := &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Partitions: []disk.Partition{
+			{
+				Payload: &disk.Filesystem{
+					Type:       "erofs",
+					Mountpoint: "/opt",
+				},
+			},
+		},
+	}
+
+	assert.PanicsWithValue(t, "erofs is only supported for the root filesystem on a plain partition", func() {
+		GenFsStages(pt, "file.img")
+	})
+}
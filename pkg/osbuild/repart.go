@@ -0,0 +1,216 @@
+package osbuild
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/customizations/fsnode"
+	"github.com/osbuild/images/pkg/disk"
+)
+
+// RepartConfDir is the directory for the systemd-repart definitions that are
+// generated by GenRepartConfFiles.
+const RepartConfDir = "/usr/lib/repart.d"
+
+// filesystems that systemd-repart can create and systemd-growfs can grow
+var repartGrowFSTypes = []string{"btrfs", "ext4", "xfs"}
+
+// filesystems that systemd-repart can create on empty partitions
+var repartFormatFSTypes = []string{"btrfs", "ext4", "vfat", "xfs"}
+
+// GenRepartConfFiles returns the systemd-repart definitions (repart.d(5)) for
+// all partitions of the partition table, so that systemd-repart grows the
+// partition that is marked to grow (see [disk.PartitionTable.GrowPartition])
+// and its filesystem to fill the disk on first boot. Partitions of the
+// definitions that do not exist on the disk are created.
+//
+// systemd-repart matches the definitions to the existing partitions by type
+// and order, the definitions are therefore named after the position of the
+// partition on the disk. Only GPT partition tables are supported.
+func GenRepartConfFiles(pt *disk.PartitionTable) ([]*fsnode.File, error) {
+	if pt.Type != disk.PT_GPT {
+		return nil, fmt.Errorf("systemd-repart requires a gpt partition table, got %s", pt.Type)
+	}
+
+	partitions := make([]*disk.Partition, 0, len(pt.Partitions))
+	for idx := range pt.Partitions {
+		partitions = append(partitions, &pt.Partitions[idx])
+	}
+	sort.SliceStable(partitions, func(i, j int) bool {
+		return partitions[i].Start < partitions[j].Start
+	})
+
+	grow := pt.GrowPartition()
+	files := make([]*fsnode.File, 0, len(partitions))
+	for idx, part := range partitions {
+		data := genRepartDefinition(part, part == grow)
+		path := filepath.Join(RepartConfDir, fmt.Sprintf("%02d-%s.conf", (idx+1)*10, repartDefinitionName(part)))
+		file, err := fsnode.NewFile(path, common.ToPtr(os.FileMode(0644)), "root", "root", []byte(data))
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+func genRepartDefinition(part *disk.Partition, grow bool) string {
+	lines := []string{
+		"# Generated by osbuild",
+		"[Partition]",
+		fmt.Sprintf("Type=%s", strings.ToLower(part.Type)),
+	}
+	if part.Label != "" {
+		lines = append(lines, fmt.Sprintf("Label=%s", part.Label))
+	}
+	lines = append(lines, fmt.Sprintf("SizeMinBytes=%d", part.Size))
+	if !grow {
+		lines = append(lines, fmt.Sprintf("SizeMaxBytes=%d", part.Size))
+	}
+
+	switch payload := part.Payload.(type) {
+	case *disk.Filesystem:
+		if slices.Contains(repartFormatFSTypes, payload.Type) {
+			lines = append(lines, fmt.Sprintf("Format=%s", payload.Type))
+		}
+		if grow && slices.Contains(repartGrowFSTypes, payload.Type) {
+			lines = append(lines, "GrowFileSystem=yes")
+		}
+	case *disk.Btrfs:
+		lines = append(lines, "Format=btrfs")
+		if grow {
+			lines = append(lines, "GrowFileSystem=yes")
+		}
+	case *disk.Swap:
+		lines = append(lines, "Format=swap")
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// repartDefinitionName returns a name for the definition of the partition
+// that describes its content.
+func repartDefinitionName(part *disk.Partition) string {
+	switch payload := part.Payload.(type) {
+	case nil:
+		if part.IsBIOSBoot() {
+			return "bios-boot"
+		}
+		return "partition"
+	case disk.Mountable:
+		if mnt := payload.GetMountpoint(); mnt == "/" {
+			return "root"
+		} else if mnt != "" {
+			return strings.ReplaceAll(strings.Trim(mnt, "/"), "/", "-")
+		}
+	}
+	return part.Payload.EntityName()
+}
+
+// RepartGrowUnit is the service unit that grows the content of the partition
+// that systemd-repart grows, see [GenRepartGrowUnitStage].
+const RepartGrowUnit = "osbuild-repart-grow.service"
+
+// repartGrowFSOption makes systemd grow a filesystem to the size of its
+// partition when it is mounted, see systemd.mount(5).
+const repartGrowFSOption = "x-systemd.growfs"
+
+// RepartFSTabPartitionTable returns a copy of the partition table for the
+// fstab entries or mount units of an image with systemd-repart definitions.
+// systemd-repart grows only the partition itself and filesystems that it
+// creates, the existing filesystem on the partition that grows is therefore
+// mounted with the x-systemd.growfs option. systemd-growfs also grows a LUKS
+// container between the partition and the filesystem.
+func RepartFSTabPartitionTable(pt *disk.PartitionTable) *disk.PartitionTable {
+	clone := pt.Clone().(*disk.PartitionTable)
+	grow := clone.GrowPartition()
+	if grow == nil {
+		return clone
+	}
+	var payload disk.Entity = grow.Payload
+	if luks, ok := payload.(*disk.LUKSContainer); ok {
+		payload = luks.Payload
+	}
+	if fs, ok := payload.(*disk.Filesystem); ok && slices.Contains(repartGrowFSTypes, fs.Type) && fs.Mountpoint != "" {
+		if fs.FSTabOptions == "" {
+			fs.FSTabOptions = repartGrowFSOption
+		} else {
+			fs.FSTabOptions += "," + repartGrowFSOption
+		}
+	}
+	return clone
+}
+
+// GenRepartGrowUnitStage returns the stage that creates the RepartGrowUnit
+// service, which runs after systemd-repart and grows the content of the
+// partition that grows (see [disk.PartitionTable.GrowPartition]) that neither
+// systemd-repart nor systemd-growfs can grow: an LVM physical volume (and the
+// LUKS container it is in) and the logical volume that is marked to grow with
+// its filesystem, or a btrfs volume. Returns nil if there is nothing to grow.
+func GenRepartGrowUnitStage(pt *disk.PartitionTable) *Stage {
+	grow := pt.GrowPartition()
+	if grow == nil {
+		return nil
+	}
+
+	var cmds []string
+	var payload disk.Entity = grow.Payload
+	device := fmt.Sprintf("/dev/disk/by-partuuid/%s", strings.ToLower(grow.UUID))
+	if luks, ok := payload.(*disk.LUKSContainer); ok {
+		// the name of the device mapper device of systemd-cryptsetup for
+		// rd.luks.uuid
+		name := fmt.Sprintf("luks-%s", luks.UUID)
+		cmds = append(cmds, fmt.Sprintf("/usr/sbin/cryptsetup resize %s", name))
+		device = fmt.Sprintf("/dev/mapper/%s", name)
+		payload = luks.Payload
+	}
+
+	switch payload := payload.(type) {
+	case *disk.LVMVolumeGroup:
+		cmds = append(cmds, fmt.Sprintf("/usr/sbin/pvresize %s", device))
+		if lv := payload.GrowLogicalVolume(); lv != nil {
+			// fails if the logical volume has been grown on a previous boot
+			cmds = append(cmds, fmt.Sprintf("-/usr/sbin/lvextend --resizefs -l +100%%FREE /dev/%s/%s", payload.Name, lv.Name))
+		}
+	case *disk.Btrfs:
+		for _, sv := range payload.Subvolumes {
+			if sv.Mountpoint != "" {
+				cmds = append(cmds, fmt.Sprintf("/usr/sbin/btrfs filesystem resize max %s", sv.Mountpoint))
+				break
+			}
+		}
+	default:
+		// a filesystem is grown by systemd-growfs, see
+		// RepartFSTabPartitionTable
+		return nil
+	}
+
+	if len(cmds) == 0 {
+		return nil
+	}
+
+	return NewSystemdUnitCreateStage(&SystemdUnitCreateStageOptions{
+		Filename: RepartGrowUnit,
+		UnitType: SystemUnitType,
+		UnitPath: UsrUnitPath,
+		Config: SystemdUnit{
+			Unit: &UnitSection{
+				Description: "Grow the content of the partition grown by systemd-repart",
+				After:       []string{"systemd-repart.service", "local-fs.target"},
+			},
+			Service: &ServiceSection{
+				Type:            OneshotServiceType,
+				RemainAfterExit: true,
+				ExecStart:       cmds,
+			},
+			Install: &InstallSection{
+				WantedBy: []string{"multi-user.target"},
+			},
+		},
+	})
+}
@@ -0,0 +1,206 @@
+package osbuild
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/datasizes"
+	"github.com/osbuild/images/pkg/disk"
+)
+
+func repartTestPartitionTable() *disk.PartitionTable {
+	return &disk.PartitionTable{
+		Type: disk.PT_GPT,
+		Size: 10 * datasizes.GiB,
+		Partitions: []disk.Partition{
+			{
+				Start: 1 * datasizes.MiB,
+				Size:  1 * datasizes.MiB,
+				Type:  disk.BIOSBootPartitionGUID,
+			},
+			{
+				Start: 2 * datasizes.MiB,
+				Size:  200 * datasizes.MiB,
+				Type:  disk.EFISystemPartitionGUID,
+				Label: "EFI-SYSTEM",
+				Payload: &disk.Filesystem{
+					Type:       "vfat",
+					Mountpoint: "/boot/efi",
+				},
+			},
+			{
+				Start: 1226 * datasizes.MiB,
+				Size:  1 * datasizes.GiB,
+				Type:  disk.FilesystemDataGUID,
+				Payload: &disk.Filesystem{
+					Type:       "xfs",
+					Mountpoint: "/var/lib/data",
+				},
+			},
+			{
+				// root is placed last to grow but listed before the data
+				// partition
+				Start: 2250 * datasizes.MiB,
+				Size:  2 * datasizes.GiB,
+				Type:  disk.RootPartitionX86_64GUID,
+				Label: "root",
+				Grow:  true,
+				Payload: &disk.Filesystem{
+					Type:       "ext4",
+					Mountpoint: "/",
+				},
+			},
+			{
+				Start:   202 * datasizes.MiB,
+				Size:    1 * datasizes.GiB,
+				Type:    disk.SwapPartitionGUID,
+				Payload: &disk.Swap{},
+			},
+		},
+	}
+}
+
+func TestGenRepartConfFiles(t *testing.T) {
+	files, err := GenRepartConfFiles(repartTestPartitionTable())
+	require.NoError(t, err)
+
+	expected := []struct {
+		path string
+		data string
+	}{
+		{
+			"/usr/lib/repart.d/10-bios-boot.conf",
+			"# Generated by osbuild\n[Partition]\nType=21686148-6449-6e6f-744e-656564454649\nSizeMinBytes=1048576\nSizeMaxBytes=1048576\n",
+		},
+		{
+			"/usr/lib/repart.d/20-boot-efi.conf",
+			"# Generated by osbuild\n[Partition]\nType=c12a7328-f81f-11d2-ba4b-00a0c93ec93b\nLabel=EFI-SYSTEM\nSizeMinBytes=209715200\nSizeMaxBytes=209715200\nFormat=vfat\n",
+		},
+		{
+			"/usr/lib/repart.d/30-swap.conf",
+			"# Generated by osbuild\n[Partition]\nType=0657fd6d-a4ab-43c4-84e5-0933c84b4f4f\nSizeMinBytes=1073741824\nSizeMaxBytes=1073741824\nFormat=swap\n",
+		},
+		{
+			"/usr/lib/repart.d/40-var-lib-data.conf",
+			"# Generated by osbuild\n[Partition]\nType=0fc63daf-8483-4772-8e79-3d69d8477de4\nSizeMinBytes=1073741824\nSizeMaxBytes=1073741824\nFormat=xfs\n",
+		},
+		{
+			"/usr/lib/repart.d/50-root.conf",
+			"# Generated by osbuild\n[Partition]\nType=4f68bce3-e8cd-4db1-96e7-fbcaf984b709\nLabel=root\nSizeMinBytes=2147483648\nFormat=ext4\nGrowFileSystem=yes\n",
+		},
+	}
+	require.Len(t, files, len(expected))
+	for idx, exp := range expected {
+		assert.Equal(t, exp.path, files[idx].Path())
+		assert.Equal(t, exp.data, string(files[idx].Data()))
+	}
+}
+
+func TestGenRepartConfFilesDOS(t *testing.T) {
+	_, err := GenRepartConfFiles(&disk.PartitionTable{Type: disk.PT_DOS})
+	assert.EqualError(t, err, "systemd-repart requires a gpt partition table, got dos")
+}
+
+func TestRepartFSTabPartitionTable(t *testing.T) {
+	pt := repartTestPartitionTable()
+	fstabPT := RepartFSTabPartitionTable(pt)
+
+	// the filesystem of the partition that grows is grown when mounted
+	assert.Equal(t, "x-systemd.growfs", fstabPT.Partitions[3].Payload.(*disk.Filesystem).FSTabOptions)
+	assert.Equal(t, "", fstabPT.Partitions[2].Payload.(*disk.Filesystem).FSTabOptions)
+	// the partition table itself is not modified
+	assert.Equal(t, "", pt.Partitions[3].Payload.(*disk.Filesystem).FSTabOptions)
+
+	pt.Partitions[3].Payload.(*disk.Filesystem).FSTabOptions = "defaults"
+	fstabPT = RepartFSTabPartitionTable(pt)
+	assert.Equal(t, "defaults,x-systemd.growfs", fstabPT.Partitions[3].Payload.(*disk.Filesystem).FSTabOptions)
+}
+
+func TestGenRepartGrowUnitStage(t *testing.T) {
+	testCases := map[string]struct {
+		payload disk.PayloadEntity
+		cmds    []string
+	}{
+		"filesystem": {
+			payload: &disk.Filesystem{Type: "ext4", Mountpoint: "/"},
+		},
+		"luks-filesystem": {
+			payload: &disk.LUKSContainer{
+				UUID:    "fb180daf-48a7-4ee0-b10d-394651850fd4",
+				Payload: &disk.Filesystem{Type: "xfs", Mountpoint: "/"},
+			},
+		},
+		"lvm": {
+			payload: &disk.LVMVolumeGroup{
+				Name: "rootvg",
+				LogicalVolumes: []disk.LVMLogicalVolume{
+					{Name: "homelv", Payload: &disk.Filesystem{Type: "xfs", Mountpoint: "/home"}},
+					{Name: "rootlv", Grow: true, Payload: &disk.Filesystem{Type: "xfs", Mountpoint: "/"}},
+				},
+			},
+			cmds: []string{
+				"/usr/sbin/pvresize /dev/disk/by-partuuid/6264d520-3fb9-423f-8ab8-7a0a8e3d3562",
+				"-/usr/sbin/lvextend --resizefs -l +100%FREE /dev/rootvg/rootlv",
+			},
+		},
+		"lvm-no-grow": {
+			payload: &disk.LVMVolumeGroup{
+				Name: "rootvg",
+				LogicalVolumes: []disk.LVMLogicalVolume{
+					{Name: "rootlv", Payload: &disk.Filesystem{Type: "xfs", Mountpoint: "/"}},
+				},
+			},
+			cmds: []string{
+				"/usr/sbin/pvresize /dev/disk/by-partuuid/6264d520-3fb9-423f-8ab8-7a0a8e3d3562",
+			},
+		},
+		"luks-lvm": {
+			payload: &disk.LUKSContainer{
+				UUID: "fb180daf-48a7-4ee0-b10d-394651850fd4",
+				Payload: &disk.LVMVolumeGroup{
+					Name: "rootvg",
+					LogicalVolumes: []disk.LVMLogicalVolume{
+						{Name: "rootlv", Grow: true, Payload: &disk.Filesystem{Type: "xfs", Mountpoint: "/"}},
+					},
+				},
+			},
+			cmds: []string{
+				"/usr/sbin/cryptsetup resize luks-fb180daf-48a7-4ee0-b10d-394651850fd4",
+				"/usr/sbin/pvresize /dev/mapper/luks-fb180daf-48a7-4ee0-b10d-394651850fd4",
+				"-/usr/sbin/lvextend --resizefs -l +100%FREE /dev/rootvg/rootlv",
+			},
+		},
+		"btrfs": {
+			payload: &disk.Btrfs{
+				Subvolumes: []disk.BtrfsSubvolume{
+					{Name: "root", Mountpoint: "/"},
+					{Name: "home", Mountpoint: "/home"},
+				},
+			},
+			cmds: []string{
+				"/usr/sbin/btrfs filesystem resize max /",
+			},
+		},
+	}
+
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			pt := repartTestPartitionTable()
+			pt.Partitions[3].UUID = "6264D520-3FB9-423F-8AB8-7A0A8E3D3562"
+			pt.Partitions[3].Payload = tc.payload
+
+			stage := GenRepartGrowUnitStage(pt)
+			if tc.cmds == nil {
+				assert.Nil(t, stage)
+				return
+			}
+			require.NotNil(t, stage)
+			options := stage.Options.(*SystemdUnitCreateStageOptions)
+			assert.Equal(t, RepartGrowUnit, options.Filename)
+			assert.Equal(t, []string{"systemd-repart.service", "local-fs.target"}, options.Config.Unit.After)
+			assert.Equal(t, tc.cmds, options.Config.Service.ExecStart)
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package osbuild
+
+import (
+	"fmt"
+
+	"github.com/osbuild/images/pkg/disk"
+)
+
+// Write a file from the input tree to a device.
+
+type WriteDeviceStageOptions struct {
+	// The file to write, e.g. input://tree/root.erofs
+	From string `json:"from"`
+}
+
+func (WriteDeviceStageOptions) isStageOptions() {}
+
+func NewWriteDeviceStage(options *WriteDeviceStageOptions, inputPipeline string, devices map[string]Device) *Stage {
+	return &Stage{
+		Type:    "org.osbuild.write-device",
+		Options: options,
+		Inputs:  NewPipelineTreeInputs("tree", inputPipeline),
+		Devices: devices,
+	}
+}
+
+// GenErofsRootStage generates the stage that writes the erofs image with the
+// given filename in the tree of the input pipeline into the partition of the
+// erofs root filesystem (see [disk.PartitionTable.ErofsRoot]) of the image
+// file. It returns nil if the root filesystem is not an erofs filesystem.
+func GenErofsRootStage(pt *disk.PartitionTable, filename, inputPipeline, erofsFilename string) *Stage {
+	root := pt.ErofsRoot()
+	if root == nil {
+		return nil
+	}
+
+	devices, lastName := getDevices([]disk.Entity{pt, root}, filename, true)
+	// The stage writes to the device named "device", like the mkfs stages.
+	lastDevice := devices[lastName]
+	delete(devices, lastName)
+	devices["device"] = lastDevice
+
+	options := &WriteDeviceStageOptions{
+		From: fmt.Sprintf("input://tree/%s", erofsFilename),
+	}
+	return NewWriteDeviceStage(options, inputPipeline, devices)
+}
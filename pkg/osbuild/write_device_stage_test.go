@@ -0,0 +1,36 @@
+package osbuild
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/osbuild/images/internal/testdisk"
+	"github.com/osbuild/images/pkg/datasizes"
+)
+
+func TestGenErofsRootStage(t *testing.T) {
+	pt := makeErofsPartitionTable()
+
+	stage := GenErofsRootStage(pt, "disk.img", "erofs-root", "root.erofs")
+	assert.Equal(t, &Stage{
+		Type: "org.osbuild.write-device",
+		Options: &WriteDeviceStageOptions{
+			From: "input://tree/root.erofs",
+		},
+		Inputs: NewPipelineTreeInputs("tree", "erofs-root"),
+		Devices: map[string]Device{
+			"device": *NewLoopbackDevice(&LoopbackDeviceOptions{
+				Filename: "disk.img",
+				Start:    1125 * datasizes.MiB / 512,
+				Size:     5 * datasizes.GiB / 512,
+				Lock:     true,
+			}),
+		},
+	}, stage)
+}
+
+func TestGenErofsRootStageNoErofs(t *testing.T) {
+	pt := testdisk.MakeFakePartitionTable("/", "/boot")
+	assert.Nil(t, GenErofsRootStage(pt, "disk.img", "erofs-root", "root.erofs"))
+}
@@ -63,7 +63,8 @@ func NewZiplInstStageOptions(kernel string, pt *disk.PartitionTable) *ZiplInstSt
 
 	bootPart := pt.Partitions[bootIdx]
 	return &ZiplInstStageOptions{
-		Kernel:   kernel,
-		Location: pt.BytesToSectors(bootPart.Start),
+		Kernel:     kernel,
+		Location:   pt.BytesToSectors(bootPart.Start),
+		SectorSize: LoopbackSectorSize(pt),
 	}
 }
@@ -0,0 +1,214 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+const (
+	cycloneDXFormat      = "CycloneDX"
+	cycloneDXSpecVersion = "1.5"
+
+	// property names used to carry the depsolve details that have no
+	// native CycloneDX field
+	CycloneDXPropertyRepoID       = "osbuild:repo:id"
+	CycloneDXPropertyRepoBaseURL  = "osbuild:repo:baseurl"
+	CycloneDXPropertyRepoMetalink = "osbuild:repo:metalink"
+	CycloneDXPropertyRepoMirrors  = "osbuild:repo:mirrorlist"
+)
+
+// CycloneDXBOM is the subset of the CycloneDX JSON document format
+// (https://cyclonedx.org/docs/1.5/json/) that is generated for the
+// packages of a depsolved transaction.
+type CycloneDXBOM struct {
+	BOMFormat    string               `json:"bomFormat"`
+	SpecVersion  string               `json:"specVersion"`
+	SerialNumber string               `json:"serialNumber,omitempty"`
+	Version      int                  `json:"version"`
+	Metadata     *CycloneDXMetadata   `json:"metadata,omitempty"`
+	Components   []CycloneDXComponent `json:"components"`
+}
+
+type CycloneDXMetadata struct {
+	Timestamp  string               `json:"timestamp,omitempty"`
+	Tools      *CycloneDXTools      `json:"tools,omitempty"`
+	Lifecycles []CycloneDXLifecycle `json:"lifecycles,omitempty"`
+}
+
+type CycloneDXTools struct {
+	Components []CycloneDXComponent `json:"components,omitempty"`
+}
+
+type CycloneDXLifecycle struct {
+	Phase string `json:"phase"`
+}
+
+type CycloneDXComponent struct {
+	BOMRef             string                       `json:"bom-ref,omitempty"`
+	Type               string                       `json:"type"`
+	Name               string                       `json:"name"`
+	Version            string                       `json:"version,omitempty"`
+	PackageURL         string                       `json:"purl,omitempty"`
+	Hashes             []CycloneDXHash              `json:"hashes,omitempty"`
+	ExternalReferences []CycloneDXExternalReference `json:"externalReferences,omitempty"`
+	Properties         []CycloneDXProperty          `json:"properties,omitempty"`
+}
+
+type CycloneDXHash struct {
+	Algorithm string `json:"alg"`
+	Content   string `json:"content"`
+}
+
+type CycloneDXExternalReference struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type CycloneDXProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// cycloneDXHashAlgorithms maps the checksum prefixes used in
+// rpmmd.PackageSpec.Checksum to the CycloneDX hash algorithm names.
+var cycloneDXHashAlgorithms = map[string]string{
+	"md5":    "MD5",
+	"sha1":   "SHA-1",
+	"sha256": "SHA-256",
+	"sha384": "SHA-384",
+	"sha512": "SHA-512",
+}
+
+// NewCycloneDXDocument generates a CycloneDX SBOM document from the
+// packages and repositories of a depsolved transaction. The repository
+// details of each package are preserved as component properties.
+func NewCycloneDXDocument(pkgs []rpmmd.PackageSpec, repos []rpmmd.RepoConfig) (*Document, error) {
+	bom, err := newCycloneDXBOM(pkgs, repos, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := json.Marshal(bom)
+	if err != nil {
+		return nil, fmt.Errorf("cannot marshal CycloneDX document: %w", err)
+	}
+	return NewDocument(StandardTypeCycloneDX, raw)
+}
+
+func newCycloneDXBOM(pkgs []rpmmd.PackageSpec, repos []rpmmd.RepoConfig, now time.Time) (*CycloneDXBOM, error) {
+	repoByID := make(map[string]rpmmd.RepoConfig, len(repos))
+	for _, repo := range repos {
+		repoByID[repo.Id] = repo
+	}
+
+	components := make([]CycloneDXComponent, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		comp, err := cycloneDXComponentFor(pkg, repoByID)
+		if err != nil {
+			return nil, err
+		}
+		components = append(components, comp)
+	}
+	sort.Slice(components, func(i, j int) bool {
+		return components[i].BOMRef < components[j].BOMRef
+	})
+
+	return &CycloneDXBOM{
+		BOMFormat:    cycloneDXFormat,
+		SpecVersion:  cycloneDXSpecVersion,
+		SerialNumber: "urn:uuid:" + uuid.New().String(),
+		Version:      1,
+		Metadata: &CycloneDXMetadata{
+			Timestamp: now.Format(time.RFC3339),
+			Tools: &CycloneDXTools{
+				Components: []CycloneDXComponent{
+					{
+						Type: "application",
+						Name: "osbuild/images",
+					},
+				},
+			},
+			Lifecycles: []CycloneDXLifecycle{
+				{Phase: "build"},
+			},
+		},
+		Components: components,
+	}, nil
+}
+
+func cycloneDXComponentFor(pkg rpmmd.PackageSpec, repoByID map[string]rpmmd.RepoConfig) (CycloneDXComponent, error) {
+	version := fmt.Sprintf("%s-%s", pkg.Version, pkg.Release)
+	if pkg.Epoch != 0 {
+		version = fmt.Sprintf("%d:%s", pkg.Epoch, version)
+	}
+
+	comp := CycloneDXComponent{
+		BOMRef:     pkg.GetNEVRA(),
+		Type:       "library",
+		Name:       pkg.Name,
+		Version:    version,
+		PackageURL: cycloneDXPackageURL(pkg),
+	}
+
+	if pkg.Checksum != "" {
+		algo, value, ok := strings.Cut(pkg.Checksum, ":")
+		if !ok {
+			return CycloneDXComponent{}, fmt.Errorf("invalid checksum %q for package %s", pkg.Checksum, pkg.Name)
+		}
+		cdxAlgo, ok := cycloneDXHashAlgorithms[algo]
+		if !ok {
+			return CycloneDXComponent{}, fmt.Errorf("unsupported checksum algorithm %q for package %s", algo, pkg.Name)
+		}
+		comp.Hashes = append(comp.Hashes, CycloneDXHash{Algorithm: cdxAlgo, Content: value})
+	}
+
+	if pkg.RemoteLocation != "" {
+		comp.ExternalReferences = append(comp.ExternalReferences, CycloneDXExternalReference{
+			Type: "distribution",
+			URL:  pkg.RemoteLocation,
+		})
+	}
+
+	if pkg.RepoID != "" {
+		comp.Properties = append(comp.Properties, CycloneDXProperty{Name: CycloneDXPropertyRepoID, Value: pkg.RepoID})
+		if repo, ok := repoByID[pkg.RepoID]; ok {
+			for _, baseURL := range repo.BaseURLs {
+				comp.Properties = append(comp.Properties, CycloneDXProperty{Name: CycloneDXPropertyRepoBaseURL, Value: baseURL})
+			}
+			if repo.Metalink != "" {
+				comp.Properties = append(comp.Properties, CycloneDXProperty{Name: CycloneDXPropertyRepoMetalink, Value: repo.Metalink})
+			}
+			if repo.MirrorList != "" {
+				comp.Properties = append(comp.Properties, CycloneDXProperty{Name: CycloneDXPropertyRepoMirrors, Value: repo.MirrorList})
+			}
+		}
+	}
+
+	return comp, nil
+}
+
+// cycloneDXPackageURL returns the purl for the given package, see
+// https://github.com/package-url/purl-spec/blob/master/PURL-TYPES.rst#rpm
+func cycloneDXPackageURL(pkg rpmmd.PackageSpec) string {
+	qualifiers := url.Values{}
+	if pkg.Arch != "" {
+		qualifiers.Set("arch", pkg.Arch)
+	}
+	if pkg.Epoch != 0 {
+		qualifiers.Set("epoch", fmt.Sprintf("%d", pkg.Epoch))
+	}
+	purl := fmt.Sprintf("pkg:rpm/%s@%s-%s", url.PathEscape(pkg.Name), url.PathEscape(pkg.Version), url.PathEscape(pkg.Release))
+	if len(qualifiers) > 0 {
+		// url.Values.Encode() sorts by key as required by the purl spec
+		purl += "?" + qualifiers.Encode()
+	}
+	return purl
+}
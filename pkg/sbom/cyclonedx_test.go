@@ -0,0 +1,101 @@
+package sbom
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+var testPkgs = []rpmmd.PackageSpec{
+	{
+		Name:           "zlib",
+		Version:        "1.2.11",
+		Release:        "40.el9",
+		Arch:           "x86_64",
+		RemoteLocation: "https://example.com/baseos/zlib-1.2.11-40.el9.x86_64.rpm",
+		Checksum:       "sha256:1234",
+		RepoID:         "baseos",
+	},
+	{
+		Name:     "bash",
+		Epoch:    1,
+		Version:  "5.1.8",
+		Release:  "9.el9",
+		Arch:     "x86_64",
+		Checksum: "sha512:abcd",
+		RepoID:   "unknown",
+	},
+}
+
+var testRepos = []rpmmd.RepoConfig{
+	{
+		Id:       "baseos",
+		BaseURLs: []string{"https://example.com/baseos"},
+		Metalink: "https://example.com/metalink",
+	},
+}
+
+func TestNewCycloneDXBOM(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	bom, err := newCycloneDXBOM(testPkgs, testRepos, now)
+	require.NoError(t, err)
+
+	assert.Equal(t, "CycloneDX", bom.BOMFormat)
+	assert.Equal(t, "1.5", bom.SpecVersion)
+	assert.Regexp(t, "^urn:uuid:", bom.SerialNumber)
+	assert.Equal(t, "2025-01-02T03:04:05Z", bom.Metadata.Timestamp)
+	assert.Equal(t, []CycloneDXComponent{
+		{
+			BOMRef:     "bash-1:5.1.8-9.el9.x86_64",
+			Type:       "library",
+			Name:       "bash",
+			Version:    "1:5.1.8-9.el9",
+			PackageURL: "pkg:rpm/bash@5.1.8-9.el9?arch=x86_64&epoch=1",
+			Hashes:     []CycloneDXHash{{Algorithm: "SHA-512", Content: "abcd"}},
+			Properties: []CycloneDXProperty{
+				{Name: CycloneDXPropertyRepoID, Value: "unknown"},
+			},
+		},
+		{
+			BOMRef:     "zlib-1.2.11-40.el9.x86_64",
+			Type:       "library",
+			Name:       "zlib",
+			Version:    "1.2.11-40.el9",
+			PackageURL: "pkg:rpm/zlib@1.2.11-40.el9?arch=x86_64",
+			Hashes:     []CycloneDXHash{{Algorithm: "SHA-256", Content: "1234"}},
+			ExternalReferences: []CycloneDXExternalReference{
+				{Type: "distribution", URL: "https://example.com/baseos/zlib-1.2.11-40.el9.x86_64.rpm"},
+			},
+			Properties: []CycloneDXProperty{
+				{Name: CycloneDXPropertyRepoID, Value: "baseos"},
+				{Name: CycloneDXPropertyRepoBaseURL, Value: "https://example.com/baseos"},
+				{Name: CycloneDXPropertyRepoMetalink, Value: "https://example.com/metalink"},
+			},
+		},
+	}, bom.Components)
+}
+
+func TestNewCycloneDXBOMBadChecksum(t *testing.T) {
+	for _, checksum := range []string{"1234", "crc32:1234"} {
+		pkgs := []rpmmd.PackageSpec{{Name: "pkg", Checksum: checksum}}
+		_, err := newCycloneDXBOM(pkgs, nil, time.Now())
+		assert.ErrorContains(t, err, "checksum")
+	}
+}
+
+func TestNewCycloneDXDocument(t *testing.T) {
+	doc, err := NewCycloneDXDocument(testPkgs, testRepos)
+	require.NoError(t, err)
+	assert.Equal(t, StandardTypeCycloneDX, doc.DocType)
+
+	var bom CycloneDXBOM
+	err = json.Unmarshal(doc.Document, &bom)
+	require.NoError(t, err)
+	assert.Equal(t, "CycloneDX", bom.BOMFormat)
+	assert.Len(t, bom.Components, 2)
+}
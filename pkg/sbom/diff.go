@@ -0,0 +1,540 @@
+package sbom
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/osbuild/images/pkg/rpmmd"
+)
+
+const spdxNoAssertion = "NOASSERTION"
+
+// DiffPackage is a package entry of an SBOM document with the details
+// that are compared when diffing two documents.
+type DiffPackage struct {
+	Name    string `json:"name"`
+	Epoch   uint   `json:"epoch,omitempty"`
+	Version string `json:"version"`
+	Release string `json:"release"`
+	Arch    string `json:"arch"`
+	License string `json:"license,omitempty"`
+	Repo    string `json:"repo,omitempty"`
+}
+
+func (p DiffPackage) packageSpec() rpmmd.PackageSpec {
+	return rpmmd.PackageSpec{
+		Name:    p.Name,
+		Epoch:   p.Epoch,
+		Version: p.Version,
+		Release: p.Release,
+		Arch:    p.Arch,
+	}
+}
+
+// NEVRA returns the Name-Epoch:Version-Release.Arch string of the package
+func (p DiffPackage) NEVRA() string {
+	spec := p.packageSpec()
+	return spec.GetNEVRA()
+}
+
+// MarshalJSON adds the NEVRA string to the JSON representation so that
+// consumers do not need to reassemble it.
+func (p DiffPackage) MarshalJSON() ([]byte, error) {
+	type diffPackage DiffPackage
+	return json.Marshal(struct {
+		diffPackage
+		NEVRA string `json:"nevra"`
+	}{
+		diffPackage: diffPackage(p),
+		NEVRA:       p.NEVRA(),
+	})
+}
+
+// PackageChange describes a package that is present in both documents
+// but differs between them.
+type PackageChange struct {
+	Old DiffPackage `json:"old"`
+	New DiffPackage `json:"new"`
+}
+
+// Diff is the structured change report between two SBOM documents.
+type Diff struct {
+	Added          []DiffPackage   `json:"added"`
+	Removed        []DiffPackage   `json:"removed"`
+	Upgraded       []PackageChange `json:"upgraded"`
+	Downgraded     []PackageChange `json:"downgraded"`
+	LicenseChanged []PackageChange `json:"license_changed"`
+	RepoChanged    []PackageChange `json:"repo_changed"`
+}
+
+// Empty returns true if the two compared documents contain the same
+// packages.
+func (d *Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 &&
+		len(d.Upgraded) == 0 && len(d.Downgraded) == 0 &&
+		len(d.LicenseChanged) == 0 && len(d.RepoChanged) == 0
+}
+
+// WriteText writes a human readable representation of the diff to the
+// given writer.
+func (d *Diff) WriteText(w io.Writer) error {
+	if d.Empty() {
+		_, err := fmt.Fprintln(w, "No package changes")
+		return err
+	}
+
+	var sb strings.Builder
+	section := func(title string, n int) {
+		if n > 0 {
+			fmt.Fprintf(&sb, "%s (%d):\n", title, n)
+		}
+	}
+
+	section("Added", len(d.Added))
+	for _, pkg := range d.Added {
+		fmt.Fprintf(&sb, "  + %s\n", pkg.NEVRA())
+	}
+	section("Removed", len(d.Removed))
+	for _, pkg := range d.Removed {
+		fmt.Fprintf(&sb, "  - %s\n", pkg.NEVRA())
+	}
+	section("Upgraded", len(d.Upgraded))
+	for _, chg := range d.Upgraded {
+		fmt.Fprintf(&sb, "  ^ %s -> %s\n", chg.Old.NEVRA(), chg.New.NEVRA())
+	}
+	section("Downgraded", len(d.Downgraded))
+	for _, chg := range d.Downgraded {
+		fmt.Fprintf(&sb, "  v %s -> %s\n", chg.Old.NEVRA(), chg.New.NEVRA())
+	}
+	section("License changed", len(d.LicenseChanged))
+	for _, chg := range d.LicenseChanged {
+		fmt.Fprintf(&sb, "  * %s: %q -> %q\n", chg.New.NEVRA(), chg.Old.License, chg.New.License)
+	}
+	section("Repository changed", len(d.RepoChanged))
+	for _, chg := range d.RepoChanged {
+		fmt.Fprintf(&sb, "  * %s: %q -> %q\n", chg.New.NEVRA(), chg.Old.Repo, chg.New.Repo)
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// NewDiff compares the packages of the two given SBOM documents and
+// returns a report of the changes from "from" to "to". Packages are
+// matched by name and architecture. When several versions of a package
+// are installed (e.g. kernels) the versions are compared as a set and
+// only reported as added or removed.
+func NewDiff(from, to *Document) (*Diff, error) {
+	fromPkgs, err := from.Packages()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read packages of the old document: %w", err)
+	}
+	toPkgs, err := to.Packages()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read packages of the new document: %w", err)
+	}
+
+	fromByKey := groupByNameArch(fromPkgs)
+	toByKey := groupByNameArch(toPkgs)
+
+	diff := &Diff{}
+	for key, oldPkgs := range fromByKey {
+		newPkgs, ok := toByKey[key]
+		if !ok {
+			diff.Removed = append(diff.Removed, oldPkgs...)
+			continue
+		}
+		if len(oldPkgs) == 1 && len(newPkgs) == 1 {
+			diff.addChange(oldPkgs[0], newPkgs[0])
+			continue
+		}
+		added, removed := diffNEVRASets(oldPkgs, newPkgs)
+		diff.Added = append(diff.Added, added...)
+		diff.Removed = append(diff.Removed, removed...)
+	}
+	for key, newPkgs := range toByKey {
+		if _, ok := fromByKey[key]; !ok {
+			diff.Added = append(diff.Added, newPkgs...)
+		}
+	}
+
+	diff.sort()
+	return diff, nil
+}
+
+func (d *Diff) addChange(oldPkg, newPkg DiffPackage) {
+	chg := PackageChange{Old: oldPkg, New: newPkg}
+	switch cmp := compareEVR(oldPkg, newPkg); {
+	case cmp < 0:
+		d.Upgraded = append(d.Upgraded, chg)
+	case cmp > 0:
+		d.Downgraded = append(d.Downgraded, chg)
+	}
+	if oldPkg.License != newPkg.License {
+		d.LicenseChanged = append(d.LicenseChanged, chg)
+	}
+	if oldPkg.Repo != newPkg.Repo {
+		d.RepoChanged = append(d.RepoChanged, chg)
+	}
+}
+
+func (d *Diff) sort() {
+	sortPkgs := func(pkgs []DiffPackage) {
+		sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].NEVRA() < pkgs[j].NEVRA() })
+	}
+	sortChanges := func(chgs []PackageChange) {
+		sort.Slice(chgs, func(i, j int) bool { return chgs[i].New.NEVRA() < chgs[j].New.NEVRA() })
+	}
+	sortPkgs(d.Added)
+	sortPkgs(d.Removed)
+	sortChanges(d.Upgraded)
+	sortChanges(d.Downgraded)
+	sortChanges(d.LicenseChanged)
+	sortChanges(d.RepoChanged)
+}
+
+func groupByNameArch(pkgs []DiffPackage) map[string][]DiffPackage {
+	res := make(map[string][]DiffPackage)
+	for _, pkg := range pkgs {
+		key := pkg.Name + "." + pkg.Arch
+		res[key] = append(res[key], pkg)
+	}
+	return res
+}
+
+func diffNEVRASets(oldPkgs, newPkgs []DiffPackage) (added, removed []DiffPackage) {
+	oldNEVRAs := make(map[string]bool, len(oldPkgs))
+	for _, pkg := range oldPkgs {
+		oldNEVRAs[pkg.NEVRA()] = true
+	}
+	newNEVRAs := make(map[string]bool, len(newPkgs))
+	for _, pkg := range newPkgs {
+		newNEVRAs[pkg.NEVRA()] = true
+		if !oldNEVRAs[pkg.NEVRA()] {
+			added = append(added, pkg)
+		}
+	}
+	for _, pkg := range oldPkgs {
+		if !newNEVRAs[pkg.NEVRA()] {
+			removed = append(removed, pkg)
+		}
+	}
+	return added, removed
+}
+
+// Packages returns the packages listed in the SBOM document.
+func (d *Document) Packages() ([]DiffPackage, error) {
+	switch d.DocType {
+	case StandardTypeSpdx:
+		return spdxPackages(d.Document)
+	case StandardTypeCycloneDX:
+		return cycloneDXPackages(d.Document)
+	default:
+		return nil, fmt.Errorf("unsupported SBOM document type: %s", d.DocType)
+	}
+}
+
+// spdxDocument is the subset of the SPDX 2.x JSON format that is needed
+// to extract the package list of the documents generated by the
+// depsolver.
+type spdxDocument struct {
+	SPDXVersion string        `json:"spdxVersion"`
+	Packages    []spdxPackage `json:"packages"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	VersionInfo      string            `json:"versionInfo"`
+	DownloadLocation string            `json:"downloadLocation"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+func spdxPackages(raw json.RawMessage) ([]DiffPackage, error) {
+	var doc spdxDocument
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("cannot parse SPDX document: %w", err)
+	}
+	if !strings.HasPrefix(doc.SPDXVersion, "SPDX-2.") {
+		return nil, fmt.Errorf("unsupported SPDX version %q", doc.SPDXVersion)
+	}
+
+	pkgs := make([]DiffPackage, 0, len(doc.Packages))
+	for _, spdxPkg := range doc.Packages {
+		var pkg DiffPackage
+		var err error
+		if purl := spdxPkg.purl(); purl != "" {
+			pkg, err = parseRPMPackageURL(purl)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			pkg = DiffPackage{Name: spdxPkg.Name}
+			pkg.Epoch, pkg.Version, pkg.Release, err = parseEVR(spdxPkg.VersionInfo)
+			if err != nil {
+				return nil, fmt.Errorf("cannot parse version of package %q: %w", spdxPkg.Name, err)
+			}
+		}
+		if spdxPkg.LicenseDeclared != spdxNoAssertion {
+			pkg.License = spdxPkg.LicenseDeclared
+		}
+		if pkg.Repo == "" && spdxPkg.DownloadLocation != "" && spdxPkg.DownloadLocation != spdxNoAssertion {
+			pkg.Repo = repoURLFromLocation(spdxPkg.DownloadLocation)
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs, nil
+}
+
+// repoURLFromLocation returns the repository URL for the given package
+// download location, i.e. everything before the "Packages/" directory
+// or the directory of the package file.
+func repoURLFromLocation(location string) string {
+	if repoURL, _, ok := strings.Cut(location, "/Packages/"); ok {
+		return repoURL
+	}
+	if idx := strings.LastIndex(location, "/"); idx >= 0 {
+		return location[:idx]
+	}
+	return location
+}
+
+func (p spdxPackage) purl() string {
+	for _, ref := range p.ExternalRefs {
+		if ref.ReferenceType == "purl" && strings.HasPrefix(ref.ReferenceLocator, "pkg:rpm/") {
+			return ref.ReferenceLocator
+		}
+	}
+	return ""
+}
+
+func cycloneDXPackages(raw json.RawMessage) ([]DiffPackage, error) {
+	var bom CycloneDXBOM
+	if err := json.Unmarshal(raw, &bom); err != nil {
+		return nil, fmt.Errorf("cannot parse CycloneDX document: %w", err)
+	}
+
+	pkgs := make([]DiffPackage, 0, len(bom.Components))
+	for _, comp := range bom.Components {
+		if !strings.HasPrefix(comp.PackageURL, "pkg:rpm/") {
+			continue
+		}
+		pkg, err := parseRPMPackageURL(comp.PackageURL)
+		if err != nil {
+			return nil, err
+		}
+		for _, prop := range comp.Properties {
+			// the base URL is more meaningful than the
+			// repository ID which is just a hash
+			if prop.Name == CycloneDXPropertyRepoBaseURL && pkg.Repo == "" {
+				pkg.Repo = prop.Value
+			}
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs, nil
+}
+
+// parseRPMPackageURL parses a package URL of the "rpm" type, see
+// https://github.com/package-url/purl-spec/blob/master/PURL-TYPES.rst#rpm
+func parseRPMPackageURL(purl string) (DiffPackage, error) {
+	rest, ok := strings.CutPrefix(purl, "pkg:rpm/")
+	if !ok {
+		return DiffPackage{}, fmt.Errorf("invalid rpm package URL %q", purl)
+	}
+	rest, _, _ = strings.Cut(rest, "#")
+	rest, rawQualifiers, _ := strings.Cut(rest, "?")
+	nameAndVersion := rest[strings.LastIndex(rest, "/")+1:]
+	name, evr, ok := strings.Cut(nameAndVersion, "@")
+	if !ok {
+		return DiffPackage{}, fmt.Errorf("package URL %q has no version", purl)
+	}
+
+	qualifiers, err := url.ParseQuery(rawQualifiers)
+	if err != nil {
+		return DiffPackage{}, fmt.Errorf("cannot parse qualifiers of package URL %q: %w", purl, err)
+	}
+	if name, err = url.PathUnescape(name); err != nil {
+		return DiffPackage{}, fmt.Errorf("cannot parse name of package URL %q: %w", purl, err)
+	}
+	if evr, err = url.PathUnescape(evr); err != nil {
+		return DiffPackage{}, fmt.Errorf("cannot parse version of package URL %q: %w", purl, err)
+	}
+
+	pkg := DiffPackage{
+		Name: name,
+		Arch: qualifiers.Get("arch"),
+		Repo: qualifiers.Get("repository_url"),
+	}
+	pkg.Epoch, pkg.Version, pkg.Release, err = parseEVR(evr)
+	if err != nil {
+		return DiffPackage{}, fmt.Errorf("cannot parse version of package URL %q: %w", purl, err)
+	}
+	if epoch := qualifiers.Get("epoch"); epoch != "" {
+		e, err := strconv.ParseUint(epoch, 10, 32)
+		if err != nil {
+			return DiffPackage{}, fmt.Errorf("invalid epoch in package URL %q: %w", purl, err)
+		}
+		pkg.Epoch = uint(e)
+	}
+	return pkg, nil
+}
+
+// parseEVR splits a "[epoch:]version[-release]" string.
+func parseEVR(evr string) (epoch uint, version, release string, err error) {
+	if e, rest, ok := strings.Cut(evr, ":"); ok {
+		ep, err := strconv.ParseUint(e, 10, 32)
+		if err != nil {
+			return 0, "", "", fmt.Errorf("invalid epoch %q", e)
+		}
+		epoch = uint(ep)
+		evr = rest
+	}
+	if idx := strings.LastIndex(evr, "-"); idx >= 0 {
+		return epoch, evr[:idx], evr[idx+1:], nil
+	}
+	return epoch, evr, "", nil
+}
+
+// compareEVR compares the epoch, version and release of the given
+// packages using the rpm version comparison rules.
+func compareEVR(a, b DiffPackage) int {
+	switch {
+	case a.Epoch < b.Epoch:
+		return -1
+	case a.Epoch > b.Epoch:
+		return 1
+	}
+	if cmp := rpmvercmp(a.Version, b.Version); cmp != 0 {
+		return cmp
+	}
+	return rpmvercmp(a.Release, b.Release)
+}
+
+// rpmvercmp is a port of the rpmvercmp() function from rpm's
+// rpmio/rpmvercmp.c including the handling of "~" and "^".
+func rpmvercmp(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	isSep := func(r byte) bool {
+		return !isAlnum(r) && r != '~' && r != '^'
+	}
+
+	for len(a) > 0 || len(b) > 0 {
+		for len(a) > 0 && isSep(a[0]) {
+			a = a[1:]
+		}
+		for len(b) > 0 && isSep(b[0]) {
+			b = b[1:]
+		}
+
+		// tilde sorts before everything else
+		if strings.HasPrefix(a, "~") || strings.HasPrefix(b, "~") {
+			if !strings.HasPrefix(a, "~") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "~") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		// caret sorts after the end of the string but before
+		// anything else
+		if strings.HasPrefix(a, "^") || strings.HasPrefix(b, "^") {
+			if len(a) == 0 {
+				return -1
+			}
+			if len(b) == 0 {
+				return 1
+			}
+			if !strings.HasPrefix(a, "^") {
+				return 1
+			}
+			if !strings.HasPrefix(b, "^") {
+				return -1
+			}
+			a, b = a[1:], b[1:]
+			continue
+		}
+
+		if len(a) == 0 || len(b) == 0 {
+			break
+		}
+
+		var segA, segB string
+		isNum := isDigit(a[0])
+		if isNum {
+			segA, a = splitWhile(a, isDigit)
+			segB, b = splitWhile(b, isDigit)
+		} else {
+			segA, a = splitWhile(a, isAlpha)
+			segB, b = splitWhile(b, isAlpha)
+		}
+
+		// segments of different types: numeric is newer
+		if len(segB) == 0 {
+			if isNum {
+				return 1
+			}
+			return -1
+		}
+
+		if isNum {
+			segA = strings.TrimLeft(segA, "0")
+			segB = strings.TrimLeft(segB, "0")
+			if len(segA) != len(segB) {
+				if len(segA) > len(segB) {
+					return 1
+				}
+				return -1
+			}
+		}
+		if cmp := strings.Compare(segA, segB); cmp != 0 {
+			return cmp
+		}
+	}
+
+	switch {
+	case len(a) == 0 && len(b) == 0:
+		return 0
+	case len(a) == 0:
+		return -1
+	default:
+		return 1
+	}
+}
+
+func splitWhile(s string, f func(byte) bool) (string, string) {
+	i := 0
+	for i < len(s) && f(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+func isDigit(r byte) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isAlpha(r byte) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z')
+}
+
+func isAlnum(r byte) bool {
+	return isDigit(r) || isAlpha(r)
+}
@@ -0,0 +1,205 @@
+package sbom
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func makeSpdxDoc(t *testing.T, pkgs ...string) *Document {
+	t.Helper()
+
+	raw := fmt.Sprintf(`{"spdxVersion":"SPDX-2.3","packages":[%s]}`, strings.Join(pkgs, ","))
+	doc, err := NewDocument(StandardTypeSpdx, json.RawMessage(raw))
+	require.NoError(t, err)
+	return doc
+}
+
+func spdxPkg(name, evr, arch, license, repo string) string {
+	purl := fmt.Sprintf("pkg:rpm/fedora/%s@%s?arch=%s", name, evr, arch)
+	if e, vr, ok := strings.Cut(evr, ":"); ok {
+		purl = fmt.Sprintf("pkg:rpm/fedora/%s@%s?arch=%s&epoch=%s", name, vr, arch, e)
+	}
+	return fmt.Sprintf(`{
+  "SPDXID": "SPDXRef-%[1]s",
+  "name": "%[1]s",
+  "versionInfo": "%[2]s",
+  "downloadLocation": "%[5]s/Packages/%[1]s/%[1]s.rpm",
+  "licenseDeclared": "%[4]s",
+  "externalRefs": [
+    {"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "%[3]s"}
+  ]
+}`, name, evr, purl, license, repo)
+}
+
+func TestSpdxPackages(t *testing.T) {
+	doc := makeSpdxDoc(t,
+		spdxPkg("bash", "5.2.26-3.fc40", "x86_64", "GPL-3.0-or-later", "https://example.com/fedora"),
+		spdxPkg("shadow-utils", "2:4.15.1-3.fc40", "x86_64", "NOASSERTION", "https://example.com/updates"),
+		`{"name": "nopurl", "versionInfo": "1:1.0-1", "downloadLocation": "NOASSERTION"}`,
+	)
+	pkgs, err := doc.Packages()
+	require.NoError(t, err)
+	assert.Equal(t, []DiffPackage{
+		{
+			Name:    "bash",
+			Version: "5.2.26",
+			Release: "3.fc40",
+			Arch:    "x86_64",
+			License: "GPL-3.0-or-later",
+			Repo:    "https://example.com/fedora",
+		},
+		{
+			Name:    "shadow-utils",
+			Epoch:   2,
+			Version: "4.15.1",
+			Release: "3.fc40",
+			Arch:    "x86_64",
+			Repo:    "https://example.com/updates",
+		},
+		{
+			Name:    "nopurl",
+			Epoch:   1,
+			Version: "1.0",
+			Release: "1",
+		},
+	}, pkgs)
+}
+
+func TestSpdxPackagesBadVersion(t *testing.T) {
+	doc, err := NewDocument(StandardTypeSpdx, json.RawMessage(`{"spdxVersion":"SPDX-3.0"}`))
+	require.NoError(t, err)
+	_, err = doc.Packages()
+	assert.EqualError(t, err, `unsupported SPDX version "SPDX-3.0"`)
+}
+
+func TestNewDiff(t *testing.T) {
+	repo := "https://example.com/fedora"
+	from := makeSpdxDoc(t,
+		spdxPkg("bash", "5.2.26-3.fc40", "x86_64", "GPL-3.0-or-later", repo),
+		spdxPkg("vim-minimal", "2:9.1.0-1.fc40", "x86_64", "Vim", repo),
+		spdxPkg("glibc", "2.39-1.fc40", "x86_64", "LGPL-2.1-or-later", repo),
+		spdxPkg("removed", "1.0-1.fc40", "noarch", "MIT", repo),
+		spdxPkg("kernel", "6.8.1-300.fc40", "x86_64", "GPL-2.0-only", repo),
+		spdxPkg("kernel", "6.8.5-300.fc40", "x86_64", "GPL-2.0-only", repo),
+		spdxPkg("unchanged", "1.0-1.fc40", "noarch", "MIT", repo),
+	)
+	to := makeSpdxDoc(t,
+		spdxPkg("bash", "5.2.26-10.fc40", "x86_64", "GPL-3.0-or-later", repo),
+		spdxPkg("vim-minimal", "2:9.0.0-1.fc40", "x86_64", "Vim", repo),
+		spdxPkg("glibc", "2.39-1.fc40", "x86_64", "LGPL-2.1-or-later AND GPL-2.0-or-later", "https://example.com/updates"),
+		spdxPkg("added", "1.0-1.fc40", "noarch", "MIT", repo),
+		spdxPkg("kernel", "6.8.5-300.fc40", "x86_64", "GPL-2.0-only", repo),
+		spdxPkg("kernel", "6.8.9-300.fc40", "x86_64", "GPL-2.0-only", repo),
+		spdxPkg("unchanged", "1.0-1.fc40", "noarch", "MIT", repo),
+	)
+
+	diff, err := NewDiff(from, to)
+	require.NoError(t, err)
+	assert.False(t, diff.Empty())
+
+	nevras := func(pkgs []DiffPackage) (res []string) {
+		for _, pkg := range pkgs {
+			res = append(res, pkg.NEVRA())
+		}
+		return res
+	}
+	changes := func(chgs []PackageChange) (res []string) {
+		for _, chg := range chgs {
+			res = append(res, chg.Old.NEVRA()+" -> "+chg.New.NEVRA())
+		}
+		return res
+	}
+	assert.Equal(t, []string{"added-1.0-1.fc40.noarch", "kernel-6.8.9-300.fc40.x86_64"}, nevras(diff.Added))
+	assert.Equal(t, []string{"kernel-6.8.1-300.fc40.x86_64", "removed-1.0-1.fc40.noarch"}, nevras(diff.Removed))
+	assert.Equal(t, []string{"bash-5.2.26-3.fc40.x86_64 -> bash-5.2.26-10.fc40.x86_64"}, changes(diff.Upgraded))
+	assert.Equal(t, []string{"vim-minimal-2:9.1.0-1.fc40.x86_64 -> vim-minimal-2:9.0.0-1.fc40.x86_64"}, changes(diff.Downgraded))
+	assert.Equal(t, []string{"glibc-2.39-1.fc40.x86_64 -> glibc-2.39-1.fc40.x86_64"}, changes(diff.LicenseChanged))
+	assert.Equal(t, []string{"glibc-2.39-1.fc40.x86_64 -> glibc-2.39-1.fc40.x86_64"}, changes(diff.RepoChanged))
+
+	var buf bytes.Buffer
+	err = diff.WriteText(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, `Added (2):
+  + added-1.0-1.fc40.noarch
+  + kernel-6.8.9-300.fc40.x86_64
+Removed (2):
+  - kernel-6.8.1-300.fc40.x86_64
+  - removed-1.0-1.fc40.noarch
+Upgraded (1):
+  ^ bash-5.2.26-3.fc40.x86_64 -> bash-5.2.26-10.fc40.x86_64
+Downgraded (1):
+  v vim-minimal-2:9.1.0-1.fc40.x86_64 -> vim-minimal-2:9.0.0-1.fc40.x86_64
+License changed (1):
+  * glibc-2.39-1.fc40.x86_64: "LGPL-2.1-or-later" -> "LGPL-2.1-or-later AND GPL-2.0-or-later"
+Repository changed (1):
+  * glibc-2.39-1.fc40.x86_64: "https://example.com/fedora" -> "https://example.com/updates"
+`, buf.String())
+
+	js, err := json.Marshal(diff.Upgraded)
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{
+  "old": {"name": "bash", "version": "5.2.26", "release": "3.fc40", "arch": "x86_64", "license": "GPL-3.0-or-later", "repo": "https://example.com/fedora", "nevra": "bash-5.2.26-3.fc40.x86_64"},
+  "new": {"name": "bash", "version": "5.2.26", "release": "10.fc40", "arch": "x86_64", "license": "GPL-3.0-or-later", "repo": "https://example.com/fedora", "nevra": "bash-5.2.26-10.fc40.x86_64"}
+}]`, string(js))
+}
+
+func TestNewDiffEmpty(t *testing.T) {
+	doc := makeSpdxDoc(t, spdxPkg("bash", "5.2.26-3.fc40", "x86_64", "GPL-3.0-or-later", "https://example.com"))
+	diff, err := NewDiff(doc, doc)
+	require.NoError(t, err)
+	assert.True(t, diff.Empty())
+
+	var buf bytes.Buffer
+	err = diff.WriteText(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, "No package changes\n", buf.String())
+}
+
+func TestNewDiffCycloneDX(t *testing.T) {
+	from, err := NewCycloneDXDocument(testPkgs, testRepos)
+	require.NoError(t, err)
+	newPkgs := append(testPkgs[:0:0], testPkgs...)
+	newPkgs[0].Release = "41.el9"
+	to, err := NewCycloneDXDocument(newPkgs, testRepos)
+	require.NoError(t, err)
+
+	diff, err := NewDiff(from, to)
+	require.NoError(t, err)
+	require.Len(t, diff.Upgraded, 1)
+	assert.Equal(t, "zlib-1.2.11-41.el9.x86_64", diff.Upgraded[0].New.NEVRA())
+	assert.Equal(t, "https://example.com/baseos", diff.Upgraded[0].New.Repo)
+	assert.Empty(t, diff.Added)
+	assert.Empty(t, diff.Removed)
+}
+
+func TestRpmvercmp(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.0", 0},
+		{"1.0", "2.0", -1},
+		{"2.0.1", "2.0", 1},
+		{"10", "9", 1},
+		{"010", "10", 0},
+		{"1.0a", "1.0", 1},
+		{"1.0~rc1", "1.0", -1},
+		{"1.0~rc1", "1.0~rc2", -1},
+		{"1.0^git1", "1.0", 1},
+		{"1.0^git1", "1.0.1", -1},
+		{"a", "1", -1},
+		{"fc40", "fc39", 1},
+		{"1_0", "1.0", 0},
+	} {
+		t.Run(tc.a+"_vs_"+tc.b, func(t *testing.T) {
+			assert.Equal(t, tc.want, rpmvercmp(tc.a, tc.b))
+			assert.Equal(t, -tc.want, rpmvercmp(tc.b, tc.a))
+		})
+	}
+}
@@ -34,6 +34,14 @@ func TestStandardTypeJSONUnmarhsall(t *testing.T) {
 				TypeOmit: StandardTypeSpdx,
 			},
 		},
+		{
+			name: "StandardTypeCycloneDX",
+			data: []byte(`{"type":"cyclonedx","type_omit":"cyclonedx"}`),
+			want: testStruct{
+				Type:     StandardTypeCycloneDX,
+				TypeOmit: StandardTypeCycloneDX,
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -73,6 +81,14 @@ func TestStandardTypeJSONMarhsall(t *testing.T) {
 				TypeOmit: StandardTypeSpdx,
 			},
 		},
+		{
+			name: "StandardTypeCycloneDX",
+			want: []byte(`{"type":"cyclonedx","type_omit":"cyclonedx"}`),
+			data: TestStruct{
+				Type:     StandardTypeCycloneDX,
+				TypeOmit: StandardTypeCycloneDX,
+			},
+		},
 	}
 
 	for _, tt := range tests {
@@ -3,16 +3,20 @@ package azure
 import (
 	"bufio"
 	"bytes"
+	"cmp"
 	"context"
 	// azure uses MD5 hashes
 	/* #nosec G501 */
 	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"net/url"
 	"os"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
 
@@ -24,6 +28,7 @@ import (
 	"github.com/google/uuid"
 
 	"github.com/osbuild/images/internal/common"
+	"github.com/osbuild/images/pkg/cloud"
 	"github.com/osbuild/images/pkg/datasizes"
 )
 
@@ -63,6 +68,11 @@ const DefaultUploadThreads = 16
 // See https://learn.microsoft.com/en-us/rest/api/storageservices/put-page
 const PageBlobMaxUploadPagesBytes = 4 * datasizes.MiB
 
+// PageBlobMaxSize is the maximal size of a page blob, it is used as the
+// initial size of page blobs whose final size is not known.
+// See https://learn.microsoft.com/en-us/rest/api/storageservices/understanding-block-blobs--append-blobs--and-page-blobs
+const PageBlobMaxSize = 8 * datasizes.TiB
+
 // allZerosSlice returns true if all values in the slice are equal to 0
 func allZerosSlice(slice []byte) bool {
 	for i := 0; i < len(slice); i++ {
@@ -81,16 +91,6 @@ func allZerosSlice(slice []byte) bool {
 // Note that if you want to create an image out of the page blob, make sure that metadata.BlobName
 // has a .vhd extension, see EnsureVHDExtension.
 func (c StorageClient) UploadPageBlob(metadata BlobMetadata, fileName string, threads int) error {
-	// Create a page blob client.
-	URL, _ := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s", metadata.StorageAccount, metadata.ContainerName, metadata.BlobName))
-	client, err := pageblob.NewClientWithSharedKeyCredential(URL.String(), c.credential, nil)
-	if err != nil {
-		return fmt.Errorf("cannot create a pageblob client: %w", err)
-	}
-
-	// Create the container, use a never-expiring context
-	ctx := context.Background()
-
 	// Open the image file for reading
 	imageFile, err := os.Open(fileName)
 	if err != nil {
@@ -104,62 +104,77 @@ func (c StorageClient) UploadPageBlob(metadata BlobMetadata, fileName string, th
 		return fmt.Errorf("cannot stat the image: %w", err)
 	}
 
-	if stat.Size()%512 != 0 {
-		return errors.New("size for azure image must be aligned to 512 bytes")
+	return c.UploadPageBlobFromReader(metadata, imageFile, stat.Size(), threads)
+}
+
+// UploadPageBlobFromReader uploads `size` bytes of the image from the given reader
+// into a page blob, see UploadPageBlob. The MD5 sum of the image is computed while
+// uploading and set as the content MD5 of the blob once all pages are uploaded.
+//
+// If the size is negative the whole reader is uploaded: the page blob is
+// created with PageBlobMaxSize and resized to the size of the image once
+// all pages are uploaded.
+func (c StorageClient) UploadPageBlobFromReader(metadata BlobMetadata, r io.Reader, size int64, threads int) error {
+	// Create a page blob client.
+	URL, _ := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s", metadata.StorageAccount, metadata.ContainerName, metadata.BlobName))
+	client, err := pageblob.NewClientWithSharedKeyCredential(URL.String(), c.credential, nil)
+	if err != nil {
+		return fmt.Errorf("cannot create a pageblob client: %w", err)
 	}
 
-	// Hash the imageFile
-	// azure uses MD5 hashes
-	/* #nosec G401 */
-	imageFileHash := md5.New()
-	if _, err := io.Copy(imageFileHash, imageFile); err != nil {
-		return fmt.Errorf("cannot create md5 of the image: %w", err)
+	// Create the container, use a never-expiring context
+	ctx := context.Background()
+
+	if size > 0 && size%512 != 0 {
+		return errors.New("size for azure image must be aligned to 512 bytes")
 	}
-	// Move the cursor back to the start of the imageFile
-	if _, err := imageFile.Seek(0, 0); err != nil {
-		return fmt.Errorf("cannot seek the image: %w", err)
+
+	blobSize := size
+	var image io.Reader = io.LimitReader(r, size)
+	if size < 0 {
+		blobSize = PageBlobMaxSize
+		image = r
 	}
 
 	// Create page blob. Page blob is required for VM images
-	_, err = client.Create(ctx, stat.Size(), &pageblob.CreateOptions{
-		HTTPHeaders: &blob.HTTPHeaders{
-			BlobContentMD5: imageFileHash.Sum(nil),
-		},
-	})
+	_, err = client.Create(ctx, blobSize, nil)
 	if err != nil {
 		return fmt.Errorf("cannot create a new page blob: %w", err)
 	}
 
+	// Hash the image while reading it
+	// azure uses MD5 hashes
+	/* #nosec G401 */
+	imageHash := md5.New()
+
 	// Create control variables
 	// This channel simulates behavior of a semaphore and bounds the number of parallel threads
 	var semaphore = make(chan int, threads)
 	// Forward error from goroutine to the caller
 	var errorInGoroutine = make(chan error, 1)
 	var counter int64 = 0
+	var total int64 = 0
 
 	// Create buffered reader to speed up the upload
-	reader := bufio.NewReader(imageFile)
+	reader := io.TeeReader(bufio.NewReader(image), imageHash)
 	// Run the upload
-	run := true
 	var wg sync.WaitGroup
-	for run {
+	for {
 		buffer := make([]byte, PageBlobMaxUploadPagesBytes)
-		n, err := reader.Read(buffer)
-		if err != nil {
-			if err == io.EOF {
-				run = false
-			} else {
-				return fmt.Errorf("reading the image failed: %w", err)
-			}
+		n, err := io.ReadFull(reader, buffer)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			wg.Wait()
+			return fmt.Errorf("reading the image failed: %w", err)
 		}
 		if n == 0 {
 			break
 		}
+		total += int64(n)
 
 		// Skip the uploading part if there are only zeros in the buffer.
 		// We already defined the size of the blob in the initial call and the blob is zero-initialized,
 		// so this pushing zeros would actually be a no-op.
-		if allZerosSlice(buffer) {
+		if allZerosSlice(buffer[:n]) {
 			counter++
 			continue
 		}
@@ -194,6 +209,272 @@ func (c StorageClient) UploadPageBlob(metadata BlobMetadata, fileName string, th
 	default:
 	}
 
+	if size < 0 {
+		if total%512 != 0 {
+			return fmt.Errorf("size for azure image must be aligned to 512 bytes, got %d bytes", total)
+		}
+		if _, err := client.Resize(ctx, total, nil); err != nil {
+			return fmt.Errorf("cannot resize the page blob to the size of the image: %w", err)
+		}
+	} else if total != size {
+		return fmt.Errorf("image is shorter than the expected size of %d bytes", size)
+	}
+
+	_, err = client.SetHTTPHeaders(ctx, blob.HTTPHeaders{
+		BlobContentMD5: imageHash.Sum(nil),
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("cannot set the MD5 sum of the page blob: %w", err)
+	}
+
+	return nil
+}
+
+// UploadPageBlobAt uploads `size` bytes of the image from the given reader into a
+// page blob, see UploadPageBlob. Every page is validated by Azure using its MD5
+// sum. If resume is true the page blob is expected to exist from an earlier,
+// interrupted upload; pages that were already uploaded and whose MD5 sum
+// computed by Azure matches the image are skipped, pages of the image that
+// are all zeros are cleared.
+//
+// After the upload, the MD5 sums that Azure computes for all pages of the
+// blob are compared with the image, a cloud.ChecksumMismatchError is
+// returned if they differ. The hex encoded SHA-256 sum of the image is
+// returned, it is also stored as the "sha256" metadata of the blob.
+func (c StorageClient) UploadPageBlobAt(metadata BlobMetadata, r io.ReaderAt, size int64, threads int, resume bool) (string, error) {
+	URL, _ := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s", metadata.StorageAccount, metadata.ContainerName, metadata.BlobName))
+	client, err := pageblob.NewClientWithSharedKeyCredential(URL.String(), c.credential, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot create a pageblob client: %w", err)
+	}
+
+	ctx := context.Background()
+
+	if size%512 != 0 {
+		return "", errors.New("size for azure image must be aligned to 512 bytes")
+	}
+
+	var uploaded []*pageblob.PageRange
+	if resume {
+		props, err := client.GetProperties(ctx, nil)
+		if err != nil {
+			return "", fmt.Errorf("cannot get the properties of the page blob: %w", err)
+		}
+		if blobSize := common.ValueOrEmpty(props.ContentLength); blobSize != size {
+			return "", fmt.Errorf("cannot resume the upload, the page blob has %d bytes instead of %d", blobSize, size)
+		}
+		pager := client.NewGetPageRangesPager(nil)
+		for pager.More() {
+			page, err := pager.NextPage(ctx)
+			if err != nil {
+				return "", fmt.Errorf("cannot get the page ranges of the page blob: %w", err)
+			}
+			uploaded = append(uploaded, page.PageRange...)
+		}
+	} else {
+		_, err = client.Create(ctx, size, nil)
+		if err != nil {
+			return "", fmt.Errorf("cannot create a new page blob: %w", err)
+		}
+	}
+
+	// azure uses MD5 hashes
+	/* #nosec G401 */
+	imageMD5 := md5.New()
+	imageSHA256 := sha256.New()
+	// the MD5 sums of all pages, to verify the blob after the upload
+	var pageMD5s [][md5.Size]byte
+
+	var semaphore = make(chan int, threads)
+	var errorInGoroutine = make(chan error, 1)
+
+	var wg sync.WaitGroup
+	for offset := int64(0); offset < size; offset += PageBlobMaxUploadPagesBytes {
+		n := min(PageBlobMaxUploadPagesBytes, size-offset)
+		buffer := make([]byte, n)
+		if _, err := io.ReadFull(io.NewSectionReader(r, offset, n), buffer); err != nil {
+			wg.Wait()
+			return "", fmt.Errorf("reading the image failed: %w", err)
+		}
+		imageMD5.Write(buffer)
+		imageSHA256.Write(buffer)
+		/* #nosec G401 */
+		pageMD5 := md5.Sum(buffer)
+		pageMD5s = append(pageMD5s, pageMD5)
+
+		uploadRange := blob.HTTPRange{
+			Offset: offset,
+			Count:  n,
+		}
+		zeros := allZerosSlice(buffer)
+		// pages that were never uploaded are all zeros, but an
+		// existing blob may hold other data in them
+		if zeros && !pageRangesOverlap(uploaded, uploadRange) {
+			continue
+		}
+
+		wg.Add(1)
+		semaphore <- 1
+		go func(buffer []byte) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			var err error
+			switch {
+			case zeros:
+				_, err = client.ClearPages(ctx, uploadRange, nil)
+				if err != nil {
+					err = fmt.Errorf("clearing a page failed: %w", err)
+				}
+			case pageRangesCover(uploaded, uploadRange):
+				if blobMD5, dlErr := downloadRangeMD5(ctx, client, uploadRange); dlErr == nil && bytes.Equal(blobMD5, pageMD5[:]) {
+					return
+				}
+				fallthrough
+			default:
+				_, err = client.UploadPages(ctx, common.NopSeekCloser(bytes.NewReader(buffer)), uploadRange, &pageblob.UploadPagesOptions{
+					TransactionalValidation: blob.TransferValidationTypeMD5(pageMD5[:]),
+				})
+				if err != nil {
+					err = fmt.Errorf("uploading a page failed: %w", err)
+				}
+			}
+			if err != nil {
+				select {
+				case errorInGoroutine <- err:
+				default:
+				}
+			}
+		}(buffer)
+	}
+	wg.Wait()
+	select {
+	case err := <-errorInGoroutine:
+		return "", err
+	default:
+	}
+
+	if err := verifyPageBlob(ctx, client, pageMD5s, size, threads); err != nil {
+		return "", err
+	}
+
+	sha256sum := hex.EncodeToString(imageSHA256.Sum(nil))
+	_, err = client.SetHTTPHeaders(ctx, blob.HTTPHeaders{
+		BlobContentMD5: imageMD5.Sum(nil),
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot set the MD5 sum of the page blob: %w", err)
+	}
+	_, err = client.SetMetadata(ctx, map[string]*string{"sha256": &sha256sum}, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot set the SHA-256 sum of the page blob: %w", err)
+	}
+
+	return sha256sum, nil
+}
+
+// downloadRangeMD5 returns the MD5 sum of a range of the blob computed by
+// Azure, the range must not be larger than 4 MiB.
+func downloadRangeMD5(ctx context.Context, client *pageblob.Client, rng blob.HTTPRange) ([]byte, error) {
+	resp, err := client.DownloadStream(ctx, &blob.DownloadStreamOptions{
+		Range:              rng,
+		RangeGetContentMD5: common.ToPtr(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp.ContentMD5, nil
+}
+
+// verifyPageBlob compares the MD5 sums that Azure computes for the pages of
+// the blob with the MD5 sums of the pages of the image.
+func verifyPageBlob(ctx context.Context, client *pageblob.Client, pageMD5s [][md5.Size]byte, size int64, threads int) error {
+	var semaphore = make(chan int, threads)
+	var errorInGoroutine = make(chan error, 1)
+
+	var wg sync.WaitGroup
+	for idx, pageMD5 := range pageMD5s {
+		offset := int64(idx) * PageBlobMaxUploadPagesBytes
+		rng := blob.HTTPRange{
+			Offset: offset,
+			Count:  min(PageBlobMaxUploadPagesBytes, size-offset),
+		}
+
+		wg.Add(1)
+		semaphore <- 1
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			blobMD5, err := downloadRangeMD5(ctx, client, rng)
+			if err != nil {
+				err = fmt.Errorf("cannot get the MD5 sum of a page: %w", err)
+			} else if !bytes.Equal(blobMD5, pageMD5[:]) {
+				err = &cloud.ChecksumMismatchError{
+					Algorithm: fmt.Sprintf("MD5 (bytes %d-%d)", rng.Offset, rng.Offset+rng.Count-1),
+					Expected:  hex.EncodeToString(pageMD5[:]),
+					Actual:    hex.EncodeToString(blobMD5),
+				}
+			}
+			if err != nil {
+				select {
+				case errorInGoroutine <- err:
+				default:
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	select {
+	case err := <-errorInGoroutine:
+		return err
+	default:
+	}
+	return nil
+}
+
+// pageRangesOverlap returns true if any byte of the given range is in the
+// page ranges (with inclusive ends) returned by Azure.
+func pageRangesOverlap(pageRanges []*pageblob.PageRange, rng blob.HTTPRange) bool {
+	for _, pr := range pageRanges {
+		start, end := common.ValueOrEmpty(pr.Start), common.ValueOrEmpty(pr.End)
+		if start < rng.Offset+rng.Count && end >= rng.Offset {
+			return true
+		}
+	}
+	return false
+}
+
+// pageRangesCover returns true if the given range is fully covered by the
+// page ranges (with inclusive ends) returned by Azure.
+func pageRangesCover(pageRanges []*pageblob.PageRange, rng blob.HTTPRange) bool {
+	sorted := slices.Clone(pageRanges)
+	slices.SortFunc(sorted, func(a, b *pageblob.PageRange) int {
+		return cmp.Compare(common.ValueOrEmpty(a.Start), common.ValueOrEmpty(b.Start))
+	})
+	pos := rng.Offset
+	for _, pr := range sorted {
+		start, end := common.ValueOrEmpty(pr.Start), common.ValueOrEmpty(pr.End)
+		if start <= pos && end >= pos {
+			pos = end + 1
+		}
+	}
+	return pos >= rng.Offset+rng.Count
+}
+
+// DeleteBlob deletes the blob described by the given metadata.
+func (c StorageClient) DeleteBlob(ctx context.Context, metadata BlobMetadata) error {
+	URL, _ := url.Parse(fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s", metadata.StorageAccount, metadata.ContainerName, metadata.BlobName))
+
+	client, err := blob.NewClientWithSharedKeyCredential(URL.String(), c.credential, nil)
+	if err != nil {
+		return fmt.Errorf("cannot create a blob client: %w", err)
+	}
+
+	_, err = client.Delete(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("cannot delete the blob: %w", err)
+	}
+
 	return nil
 }
 
@@ -4,6 +4,8 @@ import (
 	"regexp"
 	"testing"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/pageblob"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -31,3 +33,37 @@ func TestEnsureVHDExtension(t *testing.T) {
 		})
 	}
 }
+
+func TestPageRangesCover(t *testing.T) {
+	pageRange := func(start, end int64) *pageblob.PageRange {
+		return &pageblob.PageRange{Start: &start, End: &end}
+	}
+	ranges := []*pageblob.PageRange{
+		pageRange(1024, 2047),
+		pageRange(0, 511),
+		pageRange(512, 1023),
+		pageRange(4096, 8191),
+	}
+	assert.True(t, pageRangesCover(ranges, blob.HTTPRange{Offset: 0, Count: 2048}))
+	assert.True(t, pageRangesCover(ranges, blob.HTTPRange{Offset: 512, Count: 512}))
+	assert.True(t, pageRangesCover(ranges, blob.HTTPRange{Offset: 4096, Count: 4096}))
+	assert.False(t, pageRangesCover(ranges, blob.HTTPRange{Offset: 0, Count: 4096}))
+	assert.False(t, pageRangesCover(ranges, blob.HTTPRange{Offset: 4096, Count: 8192}))
+	assert.False(t, pageRangesCover(nil, blob.HTTPRange{Offset: 0, Count: 512}))
+}
+
+func TestPageRangesOverlap(t *testing.T) {
+	pageRange := func(start, end int64) *pageblob.PageRange {
+		return &pageblob.PageRange{Start: &start, End: &end}
+	}
+	ranges := []*pageblob.PageRange{
+		pageRange(1024, 2047),
+		pageRange(4096, 8191),
+	}
+	assert.True(t, pageRangesOverlap(ranges, blob.HTTPRange{Offset: 0, Count: 1536}))
+	assert.True(t, pageRangesOverlap(ranges, blob.HTTPRange{Offset: 2047, Count: 512}))
+	assert.True(t, pageRangesOverlap(ranges, blob.HTTPRange{Offset: 3072, Count: 8192}))
+	assert.False(t, pageRangesOverlap(ranges, blob.HTTPRange{Offset: 0, Count: 1024}))
+	assert.False(t, pageRangesOverlap(ranges, blob.HTTPRange{Offset: 2048, Count: 2048}))
+	assert.False(t, pageRangesOverlap(nil, blob.HTTPRange{Offset: 0, Count: 512}))
+}
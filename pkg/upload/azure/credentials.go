@@ -11,6 +11,15 @@ type Credentials struct {
 	clientSecret string
 }
 
+// NewCredentials returns the credentials of the application with the
+// given client ID and secret.
+func NewCredentials(clientID, clientSecret string) Credentials {
+	return Credentials{
+		clientID:     clientID,
+		clientSecret: clientSecret,
+	}
+}
+
 // ParseAzureCredentialsFile parses a credentials file for azure.
 // The file is in toml format and contains two keys: client_id and
 // client_secret
@@ -0,0 +1,20 @@
+package azure
+
+type AzureClient = azureClient
+type AzureStorageClient = azureStorageClient
+
+func MockNewAzureClient(f func(Credentials, string, string) (azureClient, error)) (restore func()) {
+	saved := newAzureClient
+	newAzureClient = f
+	return func() {
+		newAzureClient = saved
+	}
+}
+
+func MockNewAzureStorageClient(f func(string, string) (azureStorageClient, error)) (restore func()) {
+	saved := newAzureStorageClient
+	newAzureStorageClient = f
+	return func() {
+		newAzureStorageClient = saved
+	}
+}
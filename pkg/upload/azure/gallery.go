@@ -0,0 +1,357 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+
+	"github.com/osbuild/images/internal/common"
+)
+
+// SecurityType is the security type of the virtual machines that can be
+// created from a gallery image.
+type SecurityType string
+
+const (
+	SecurityTypeStandard       SecurityType = "Standard"
+	SecurityTypeTrustedLaunch  SecurityType = "TrustedLaunch"
+	SecurityTypeConfidentialVM SecurityType = "ConfidentialVM"
+)
+
+// galleryFeatureSecurityType is the name of the gallery image feature
+// that holds the security type
+const galleryFeatureSecurityType = "SecurityType"
+
+// GalleryImageDefinition describes an image definition of an Azure Compute
+// Gallery, all versions of the definition share these properties.
+type GalleryImageDefinition struct {
+	// Gallery is the name of the existing gallery.
+	Gallery string
+	// Name of the image definition.
+	Name string
+
+	// Publisher, Offer and SKU identify the image definition, they
+	// are only used when the definition is created.
+	Publisher string
+	Offer     string
+	SKU       string
+
+	// HyperVGeneration of the image, defaults to HyperVGenV1.
+	HyperVGeneration HyperVGenerationType
+	// SecurityType of the image, defaults to SecurityTypeStandard.
+	// SecurityTypeTrustedLaunch and SecurityTypeConfidentialVM
+	// require HyperVGenV2.
+	SecurityType SecurityType
+	// Architecture of the image, "x64" (the default) or "Arm64".
+	Architecture string
+}
+
+// ErrGalleryImageIdentifierRequired is returned by
+// EnsureGalleryImageDefinition if the image definition does not exist and
+// cannot be created because the Publisher, Offer or SKU is not set.
+var ErrGalleryImageIdentifierRequired = errors.New("publisher, offer and SKU are required to create a gallery image definition")
+
+// galleryIdentifierRegex matches the valid publishers, offers and SKUs of
+// gallery image definitions
+var galleryIdentifierRegex = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,128}$`)
+
+func (def *GalleryImageDefinition) validate() error {
+	if def.Gallery == "" || def.Name == "" {
+		return fmt.Errorf("gallery and image definition name must be set")
+	}
+	for _, id := range []struct{ name, value string }{
+		{"publisher", def.Publisher},
+		{"offer", def.Offer},
+		{"SKU", def.SKU},
+	} {
+		// the identifier is only needed to create the definition, see
+		// validateIdentifier
+		if id.value == "" {
+			continue
+		}
+		if !galleryIdentifierRegex.MatchString(id.value) || strings.HasSuffix(id.value, ".") {
+			return fmt.Errorf("invalid gallery image %s %q: only letters, digits, hyphens, underscores and periods are allowed, up to 128 characters not ending with a period", id.name, id.value)
+		}
+	}
+	switch def.HyperVGeneration {
+	case "", HyperVGenV1, HyperVGenV2:
+	default:
+		return fmt.Errorf("unknown hyper v generation type %v", def.HyperVGeneration)
+	}
+	switch def.SecurityType {
+	case "", SecurityTypeStandard:
+	case SecurityTypeTrustedLaunch, SecurityTypeConfidentialVM:
+		if def.HyperVGeneration != HyperVGenV2 {
+			return fmt.Errorf("security type %s requires hyper v generation %s", def.SecurityType, HyperVGenV2)
+		}
+	default:
+		return fmt.Errorf("unknown security type %v", def.SecurityType)
+	}
+	switch armcompute.Architecture(def.Architecture) {
+	case "", armcompute.ArchitectureX64, armcompute.ArchitectureArm64:
+	default:
+		return fmt.Errorf("unknown architecture %v", def.Architecture)
+	}
+	return nil
+}
+
+// validateIdentifier checks that the definition can be created, which
+// requires the Publisher, Offer and SKU.
+func (def *GalleryImageDefinition) validateIdentifier() error {
+	if def.Publisher == "" || def.Offer == "" || def.SKU == "" {
+		return fmt.Errorf("gallery image definition %s does not exist: %w", def.Name, ErrGalleryImageIdentifierRequired)
+	}
+	return nil
+}
+
+func (def *GalleryImageDefinition) hyperVGeneration() armcompute.HyperVGeneration {
+	if def.HyperVGeneration == HyperVGenV2 {
+		return armcompute.HyperVGenerationV2
+	}
+	return armcompute.HyperVGenerationV1
+}
+
+func (def *GalleryImageDefinition) securityType() SecurityType {
+	if def.SecurityType == "" {
+		return SecurityTypeStandard
+	}
+	return def.SecurityType
+}
+
+// GalleryTargetRegion is a region a gallery image version is replicated to.
+type GalleryTargetRegion struct {
+	Name string
+	// ReplicaCount is the number of replicas in the region, the
+	// ReplicaCount of the version is used if zero.
+	ReplicaCount int32
+}
+
+// GalleryImageVersion describes a version of a gallery image definition.
+type GalleryImageVersion struct {
+	// Version in the MAJOR.MINOR.PATCH format, e.g. "9.6.20250101".
+	Version string
+	// TargetRegions the version is replicated to, the location of
+	// the gallery is always included.
+	TargetRegions []GalleryTargetRegion
+	// ReplicaCount is the default number of replicas per region,
+	// defaults to 1.
+	ReplicaCount int32
+	// ExcludeFromLatest prevents VMs that are created from the latest
+	// version of the definition from using this version.
+	ExcludeFromLatest bool
+}
+
+var galleryVersionRegex = regexp.MustCompile(`^\d+\.\d+\.\d+$`)
+
+func (v *GalleryImageVersion) validate() error {
+	if !galleryVersionRegex.MatchString(v.Version) {
+		return fmt.Errorf("gallery image version %q is not in the MAJOR.MINOR.PATCH format", v.Version)
+	}
+	if v.ReplicaCount < 0 {
+		return fmt.Errorf("replica count must not be negative")
+	}
+	for _, region := range v.TargetRegions {
+		if region.Name == "" || region.ReplicaCount < 0 {
+			return fmt.Errorf("invalid target region %+v", region)
+		}
+	}
+	return nil
+}
+
+// targetRegions returns the target regions of the version including the
+// given location of the gallery.
+func (v *GalleryImageVersion) targetRegions(location string) []*armcompute.TargetRegion {
+	replicaCount := v.ReplicaCount
+	if replicaCount == 0 {
+		replicaCount = 1
+	}
+	regions := v.TargetRegions
+	hasLocation := false
+	for _, region := range regions {
+		if normalizeLocation(region.Name) == normalizeLocation(location) {
+			hasLocation = true
+		}
+	}
+	if !hasLocation {
+		regions = append([]GalleryTargetRegion{{Name: location}}, regions...)
+	}
+
+	var targetRegions []*armcompute.TargetRegion
+	for _, region := range regions {
+		count := region.ReplicaCount
+		if count == 0 {
+			count = replicaCount
+		}
+		targetRegions = append(targetRegions, &armcompute.TargetRegion{
+			Name:                 common.ToPtr(region.Name),
+			RegionalReplicaCount: common.ToPtr(count),
+		})
+	}
+	return targetRegions
+}
+
+// normalizeLocation turns display names of locations like "West Europe"
+// into their names like "westeurope"
+func normalizeLocation(location string) string {
+	return strings.ToLower(strings.ReplaceAll(location, " ", ""))
+}
+
+func isNotFound(err error) bool {
+	var respErr *azcore.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusNotFound
+}
+
+// EnsureGalleryImageDefinition creates the image definition in the given
+// gallery if it does not exist yet, which requires the Publisher, Offer and
+// SKU of def (see ErrGalleryImageIdentifierRequired). An existing definition
+// is checked to match the HyperVGeneration and SecurityType of def.
+// The location is optional and if not provided, it is determined
+// from the resource group.
+func (ac Client) EnsureGalleryImageDefinition(ctx context.Context, resourceGroup, location string, def *GalleryImageDefinition) error {
+	if err := def.validate(); err != nil {
+		return err
+	}
+	c := ac.compFact.NewGalleryImagesClient()
+
+	existing, err := c.Get(ctx, resourceGroup, def.Gallery, def.Name, nil)
+	if err == nil {
+		return checkGalleryImageDefinition(&existing.GalleryImage, def)
+	}
+	if !isNotFound(err) {
+		return fmt.Errorf("retrieving gallery image definition failed: %w", err)
+	}
+	if err := def.validateIdentifier(); err != nil {
+		return err
+	}
+
+	if location == "" {
+		location, err = ac.GetResourceGroupLocation(ctx, resourceGroup)
+		if err != nil {
+			return fmt.Errorf("retrieving resource group location failed: %w", err)
+		}
+	}
+
+	properties := &armcompute.GalleryImageProperties{
+		Identifier: &armcompute.GalleryImageIdentifier{
+			Publisher: common.ToPtr(def.Publisher),
+			Offer:     common.ToPtr(def.Offer),
+			SKU:       common.ToPtr(def.SKU),
+		},
+		OSType:           common.ToPtr(armcompute.OperatingSystemTypesLinux),
+		OSState:          common.ToPtr(armcompute.OperatingSystemStateTypesGeneralized),
+		HyperVGeneration: common.ToPtr(def.hyperVGeneration()),
+	}
+	if def.Architecture != "" {
+		properties.Architecture = common.ToPtr(armcompute.Architecture(def.Architecture))
+	}
+	if securityType := def.securityType(); securityType != SecurityTypeStandard {
+		properties.Features = []*armcompute.GalleryImageFeature{
+			{
+				Name:  common.ToPtr(galleryFeatureSecurityType),
+				Value: common.ToPtr(string(securityType)),
+			},
+		}
+	}
+
+	poller, err := c.BeginCreateOrUpdate(ctx, resourceGroup, def.Gallery, def.Name, armcompute.GalleryImage{
+		Location:   &location,
+		Properties: properties,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("sending the create gallery image definition request failed: %w", err)
+	}
+
+	_, err = poller.PollUntilDone(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("create gallery image definition request failed: %w", err)
+	}
+
+	return nil
+}
+
+// checkGalleryImageDefinition returns an error if the existing image
+// definition cannot hold versions of images described by def
+func checkGalleryImageDefinition(existing *armcompute.GalleryImage, def *GalleryImageDefinition) error {
+	if existing.Properties == nil {
+		return nil
+	}
+	if gen := existing.Properties.HyperVGeneration; gen != nil && *gen != def.hyperVGeneration() {
+		return fmt.Errorf("gallery image definition %s has hyper v generation %s, not %s", def.Name, *gen, def.hyperVGeneration())
+	}
+	securityType := SecurityTypeStandard
+	for _, feature := range existing.Properties.Features {
+		if feature.Name != nil && *feature.Name == galleryFeatureSecurityType && feature.Value != nil {
+			securityType = SecurityType(*feature.Value)
+		}
+	}
+	if securityType != def.securityType() {
+		return fmt.Errorf("gallery image definition %s has security type %s, not %s", def.Name, securityType, def.securityType())
+	}
+	return nil
+}
+
+// CreateGalleryImageVersion creates a version of the gallery image
+// definition from the given blob and waits until it is replicated to all
+// target regions. The ID of the image version is returned.
+// The location is optional and if not provided, it is determined
+// from the resource group.
+func (ac Client) CreateGalleryImageVersion(ctx context.Context, resourceGroup, storageAccount, storageContainer, blobName, location string, def *GalleryImageDefinition, version *GalleryImageVersion) (string, error) {
+	if err := def.validate(); err != nil {
+		return "", err
+	}
+	if err := version.validate(); err != nil {
+		return "", err
+	}
+
+	var err error
+	if location == "" {
+		location, err = ac.GetResourceGroupLocation(ctx, resourceGroup)
+		if err != nil {
+			return "", fmt.Errorf("retrieving resource group location failed: %w", err)
+		}
+	}
+
+	account, err := ac.storFact.NewAccountsClient().GetProperties(ctx, resourceGroup, storageAccount, nil)
+	if err != nil {
+		return "", fmt.Errorf("retrieving storage account failed: %w", err)
+	}
+	blobURI := fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s", storageAccount, storageContainer, blobName)
+
+	c := ac.compFact.NewGalleryImageVersionsClient()
+	poller, err := c.BeginCreateOrUpdate(ctx, resourceGroup, def.Gallery, def.Name, version.Version, armcompute.GalleryImageVersion{
+		Location: &location,
+		Properties: &armcompute.GalleryImageVersionProperties{
+			PublishingProfile: &armcompute.GalleryImageVersionPublishingProfile{
+				TargetRegions:     version.targetRegions(location),
+				ExcludeFromLatest: common.ToPtr(version.ExcludeFromLatest),
+			},
+			StorageProfile: &armcompute.GalleryImageVersionStorageProfile{
+				OSDiskImage: &armcompute.GalleryOSDiskImage{
+					Source: &armcompute.GalleryDiskImageSource{
+						StorageAccountID: account.ID,
+						URI:              &blobURI,
+					},
+				},
+			},
+		},
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("sending the create gallery image version request failed: %w", err)
+	}
+
+	res, err := poller.PollUntilDone(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("create gallery image version request failed: %w", err)
+	}
+	if res.ID == nil {
+		return "", errors.New("azure returned a gallery image version without an ID")
+	}
+
+	return *res.ID, nil
+}
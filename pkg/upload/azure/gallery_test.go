@@ -0,0 +1,86 @@
+package azure
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/compute/armcompute/v5"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/osbuild/images/internal/common"
+)
+
+func TestGalleryImageVersionTargetRegions(t *testing.T) {
+	v := &GalleryImageVersion{
+		Version:      "1.0.0",
+		ReplicaCount: 2,
+		TargetRegions: []GalleryTargetRegion{
+			{Name: "eastus", ReplicaCount: 5},
+			{Name: "northeurope"},
+		},
+	}
+	assert.Equal(t, []*armcompute.TargetRegion{
+		{Name: common.ToPtr("westeurope"), RegionalReplicaCount: common.ToPtr(int32(2))},
+		{Name: common.ToPtr("eastus"), RegionalReplicaCount: common.ToPtr(int32(5))},
+		{Name: common.ToPtr("northeurope"), RegionalReplicaCount: common.ToPtr(int32(2))},
+	}, v.targetRegions("westeurope"))
+
+	// the location is not added twice
+	assert.Equal(t, []*armcompute.TargetRegion{
+		{Name: common.ToPtr("eastus"), RegionalReplicaCount: common.ToPtr(int32(5))},
+		{Name: common.ToPtr("northeurope"), RegionalReplicaCount: common.ToPtr(int32(2))},
+	}, v.targetRegions("North Europe"))
+
+	v = &GalleryImageVersion{Version: "1.0.0"}
+	assert.Equal(t, []*armcompute.TargetRegion{
+		{Name: common.ToPtr("westeurope"), RegionalReplicaCount: common.ToPtr(int32(1))},
+	}, v.targetRegions("westeurope"))
+}
+
+func TestCheckGalleryImageDefinition(t *testing.T) {
+	existing := &armcompute.GalleryImage{
+		Properties: &armcompute.GalleryImageProperties{
+			HyperVGeneration: common.ToPtr(armcompute.HyperVGenerationV2),
+			Features: []*armcompute.GalleryImageFeature{
+				{Name: common.ToPtr("SecurityType"), Value: common.ToPtr("ConfidentialVM")},
+			},
+		},
+	}
+	assert.NoError(t, checkGalleryImageDefinition(existing, &GalleryImageDefinition{
+		Name:             "def",
+		HyperVGeneration: HyperVGenV2,
+		SecurityType:     SecurityTypeConfidentialVM,
+	}))
+	assert.EqualError(t, checkGalleryImageDefinition(existing, &GalleryImageDefinition{
+		Name:             "def",
+		HyperVGeneration: HyperVGenV2,
+		SecurityType:     SecurityTypeTrustedLaunch,
+	}), "gallery image definition def has security type ConfidentialVM, not TrustedLaunch")
+	assert.EqualError(t, checkGalleryImageDefinition(existing, &GalleryImageDefinition{
+		Name: "def",
+	}), "gallery image definition def has hyper v generation V2, not V1")
+}
+
+func TestGalleryImageDefinitionIdentifier(t *testing.T) {
+	def := &GalleryImageDefinition{
+		Gallery:   "gallery",
+		Name:      "def",
+		Publisher: "osbuild",
+		Offer:     "rhel",
+		SKU:       "9.6-gen2",
+	}
+	assert.NoError(t, def.validate())
+	assert.NoError(t, def.validateIdentifier())
+
+	// the identifier is only required to create the definition
+	def.Offer = ""
+	assert.NoError(t, def.validate())
+	err := def.validateIdentifier()
+	assert.EqualError(t, err, "gallery image definition def does not exist: publisher, offer and SKU are required to create a gallery image definition")
+	assert.True(t, errors.Is(err, ErrGalleryImageIdentifierRequired))
+
+	for _, sku := range []string{"9.6 gen2", "9.6.", "rhel/9"} {
+		def.SKU = sku
+		assert.ErrorContains(t, def.validate(), "invalid gallery image SKU")
+	}
+}
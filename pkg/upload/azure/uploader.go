@@ -0,0 +1,336 @@
+package azure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/osbuild/images/pkg/cloud"
+)
+
+// DefaultStorageContainer is the storage container the image blob is
+// uploaded to if no container is given in the UploaderOptions.
+const DefaultStorageContainer = "imagebuilder"
+
+type azureUploader struct {
+	client azureClient
+
+	resourceGroup  string
+	storageAccount string
+	container      string
+	imageName      string
+	location       string
+	hyperVGen      HyperVGenerationType
+	threads        int
+	gallery        *GalleryOptions
+
+	progress *cloud.ProgressReporter
+}
+
+type UploaderOptions struct {
+	// Container is the storage container to upload the image
+	// blob to, it is created if it does not exist. Defaults to
+	// DefaultStorageContainer.
+	Container string
+	// Location of the image, if empty the location of the
+	// resource group is used.
+	Location string
+	// HyperVGeneration of the image, defaults to HyperVGenV1.
+	HyperVGeneration HyperVGenerationType
+	// Threads is the number of parallel page uploads, defaults to
+	// DefaultUploadThreads.
+	Threads int
+	// Gallery publishes the image as a version of an Azure Compute
+	// Gallery image definition instead of creating a managed image.
+	Gallery *GalleryOptions
+	// Progress receives the structured progress of the upload in
+	// addition to the free-form text written to the status writer.
+	Progress cloud.ProgressFunc
+}
+
+// GalleryOptions describe where an image is published in an Azure Compute
+// Gallery.
+type GalleryOptions struct {
+	// Definition is the image definition, it is created if it does
+	// not exist. Its HyperVGeneration defaults to the one of the
+	// UploaderOptions.
+	Definition GalleryImageDefinition
+	// Version is the image version that is created.
+	Version GalleryImageVersion
+}
+
+// testing support
+type azureClient interface {
+	GetResourceGroupLocation(ctx context.Context, resourceGroup string) (string, error)
+	GetStorageAccountKey(ctx context.Context, resourceGroup string, storageAccount string) (string, error)
+	RegisterImage(ctx context.Context, resourceGroup, storageAccount, storageContainer, blobName, imageName, location string, hyperVGen HyperVGenerationType) error
+	EnsureGalleryImageDefinition(ctx context.Context, resourceGroup, location string, def *GalleryImageDefinition) error
+	CreateGalleryImageVersion(ctx context.Context, resourceGroup, storageAccount, storageContainer, blobName, location string, def *GalleryImageDefinition, version *GalleryImageVersion) (string, error)
+}
+
+type azureStorageClient interface {
+	CreateStorageContainerIfNotExist(ctx context.Context, storageAccount, name string) error
+	UploadPageBlobFromReader(metadata BlobMetadata, r io.Reader, size int64, threads int) error
+	UploadPageBlobAt(metadata BlobMetadata, r io.ReaderAt, size int64, threads int, resume bool) (string, error)
+	DeleteBlob(ctx context.Context, metadata BlobMetadata) error
+}
+
+var newAzureClient = func(credentials Credentials, tenantID, subscriptionID string) (azureClient, error) {
+	return NewClient(credentials, tenantID, subscriptionID)
+}
+
+var newAzureStorageClient = func(storageAccount, storageAccessKey string) (azureStorageClient, error) {
+	return NewStorageClient(storageAccount, storageAccessKey)
+}
+
+// NewUploader returns a cloud.Uploader that uploads the image as a page
+// blob into the given storage account and creates a managed image named
+// imageName from it in the given resource group, or publishes it into a
+// gallery if UploaderOptions.Gallery is set. The storage account must
+// already exist in the resource group.
+func NewUploader(credentials Credentials, tenantID, subscriptionID, resourceGroup, storageAccount, imageName string, opts *UploaderOptions) (cloud.Uploader, error) {
+	if opts == nil {
+		opts = &UploaderOptions{}
+	}
+	hyperVGen := opts.HyperVGeneration
+	switch hyperVGen {
+	case "":
+		hyperVGen = HyperVGenV1
+	case HyperVGenV1, HyperVGenV2:
+	default:
+		return nil, fmt.Errorf("unknown hyper v generation type %v", hyperVGen)
+	}
+	container := opts.Container
+	if container == "" {
+		container = DefaultStorageContainer
+	}
+	threads := opts.Threads
+	if threads == 0 {
+		threads = DefaultUploadThreads
+	}
+	var gallery *GalleryOptions
+	if opts.Gallery != nil {
+		gallery = &GalleryOptions{
+			Definition: opts.Gallery.Definition,
+			Version:    opts.Gallery.Version,
+		}
+		if gallery.Definition.HyperVGeneration == "" {
+			gallery.Definition.HyperVGeneration = hyperVGen
+		}
+		if err := gallery.Definition.validate(); err != nil {
+			return nil, err
+		}
+		if err := gallery.Version.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	client, err := newAzureClient(credentials, tenantID, subscriptionID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &azureUploader{
+		client:         client,
+		resourceGroup:  resourceGroup,
+		storageAccount: storageAccount,
+		container:      container,
+		imageName:      imageName,
+		location:       opts.Location,
+		hyperVGen:      hyperVGen,
+		threads:        threads,
+		gallery:        gallery,
+		progress:       cloud.NewProgressReporter(opts.Progress),
+	}, nil
+}
+
+var _ cloud.ResumableUploader = &azureUploader{}
+
+func (au *azureUploader) Check(status io.Writer) error {
+	ctx := context.Background()
+
+	fmt.Fprintf(status, "Checking Azure resource group access...\n")
+	if _, err := au.client.GetResourceGroupLocation(ctx, au.resourceGroup); err != nil {
+		return fmt.Errorf("retrieving Azure resource group '%s' failed: %w", au.resourceGroup, err)
+	}
+
+	fmt.Fprintf(status, "Checking Azure storage account access...\n")
+	if _, err := au.storageAccountKey(ctx); err != nil {
+		return err
+	}
+	fmt.Fprintf(status, "Upload conditions met.\n")
+	return nil
+}
+
+func (au *azureUploader) storageAccountKey(ctx context.Context) (string, error) {
+	key, err := au.client.GetStorageAccountKey(ctx, au.resourceGroup, au.storageAccount)
+	if err != nil {
+		return "", fmt.Errorf("retrieving the key of Azure storage account '%s' failed: %w", au.storageAccount, err)
+	}
+	return key, nil
+}
+
+func (au *azureUploader) UploadAndRegister(r io.Reader, status io.Writer) (err error) {
+	ctx := context.Background()
+
+	size, err := readerSize(r)
+	if err != nil {
+		return err
+	}
+	// the progress of images of unknown size is reported without a total
+	progressTotal := max(size, 0)
+
+	storageClient, metadata, err := au.prepareStorage(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			err = errors.Join(err, deleteBlob(ctx, storageClient, metadata, status))
+		}
+	}()
+	fmt.Fprintf(status, "Uploading %s to %s/%s/%s\n", au.imageName, metadata.StorageAccount, metadata.ContainerName, metadata.BlobName)
+	if err := storageClient.UploadPageBlobFromReader(metadata, au.progress.Reader(r, progressTotal), size, au.threads); err != nil {
+		return err
+	}
+
+	return au.register(ctx, metadata, status)
+}
+
+// deleteBlob deletes the (partially) uploaded image blob after a failure.
+func deleteBlob(ctx context.Context, storageClient azureStorageClient, metadata BlobMetadata, status io.Writer) error {
+	if err := storageClient.DeleteBlob(ctx, metadata); err != nil {
+		return err
+	}
+	fmt.Fprintf(status, "Deleted blob %s/%s/%s\n", metadata.StorageAccount, metadata.ContainerName, metadata.BlobName)
+	return nil
+}
+
+// UploadAndRegisterAt uploads the image into a page blob that can be
+// resumed. The state passed to the StateCallback only contains the blob
+// name as page blobs need no upload session. If a StateCallback is set,
+// the blob of a failed upload is kept so that the upload can be resumed.
+func (au *azureUploader) UploadAndRegisterAt(r io.ReaderAt, size int64, opts *cloud.UploadAtOptions, status io.Writer) (res *cloud.UploadResult, err error) {
+	ctx := context.Background()
+
+	if opts == nil {
+		opts = &cloud.UploadAtOptions{}
+	}
+	storageClient, metadata, err := au.prepareStorage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	resume := opts.Resume != nil
+	if resume {
+		if opts.Resume.Object != metadata.BlobName {
+			return nil, fmt.Errorf("cannot resume the upload of blob %q as blob %q", opts.Resume.Object, metadata.BlobName)
+		}
+		fmt.Fprintf(status, "Resuming upload of %s to %s/%s/%s\n", au.imageName, metadata.StorageAccount, metadata.ContainerName, metadata.BlobName)
+	} else {
+		fmt.Fprintf(status, "Uploading %s to %s/%s/%s\n", au.imageName, metadata.StorageAccount, metadata.ContainerName, metadata.BlobName)
+	}
+	resumable := opts.StateCallback != nil
+	if resumable {
+		opts.StateCallback(cloud.UploadState{Object: metadata.BlobName})
+	}
+	uploaded := false
+	defer func() {
+		if err != nil && (uploaded || !resumable) {
+			err = errors.Join(err, deleteBlob(ctx, storageClient, metadata, status))
+		}
+	}()
+	sha256sum, err := storageClient.UploadPageBlobAt(metadata, au.progress.ReaderAt(r, size), size, au.threads, resume)
+	if err != nil {
+		return nil, err
+	}
+	uploaded = true
+	fmt.Fprintf(status, "Blob uploaded (sha256:%s)\n", sha256sum)
+
+	if err := au.register(ctx, metadata, status); err != nil {
+		return nil, err
+	}
+	return &cloud.UploadResult{SHA256: sha256sum}, nil
+}
+
+// prepareStorage returns a storage client for the storage account and
+// the metadata of the image blob, the storage container is created if
+// needed.
+func (au *azureUploader) prepareStorage(ctx context.Context) (azureStorageClient, BlobMetadata, error) {
+	key, err := au.storageAccountKey(ctx)
+	if err != nil {
+		return nil, BlobMetadata{}, err
+	}
+	storageClient, err := newAzureStorageClient(au.storageAccount, key)
+	if err != nil {
+		return nil, BlobMetadata{}, err
+	}
+	if err := storageClient.CreateStorageContainerIfNotExist(ctx, au.storageAccount, au.container); err != nil {
+		return nil, BlobMetadata{}, err
+	}
+
+	return storageClient, BlobMetadata{
+		StorageAccount: au.storageAccount,
+		ContainerName:  au.container,
+		BlobName:       EnsureVHDExtension(au.imageName),
+	}, nil
+}
+
+func (au *azureUploader) register(ctx context.Context, metadata BlobMetadata, status io.Writer) error {
+	if au.gallery != nil {
+		return au.publish(ctx, metadata, status)
+	}
+
+	fmt.Fprintf(status, "Registering image %s\n", au.imageName)
+	au.progress.Report(cloud.UploadPhaseRegister, 0, 1)
+	err := au.client.RegisterImage(ctx, au.resourceGroup, metadata.StorageAccount, metadata.ContainerName, metadata.BlobName, au.imageName, au.location, au.hyperVGen)
+	if err != nil {
+		return err
+	}
+	au.progress.Report(cloud.UploadPhaseRegister, 1, 1)
+	fmt.Fprintf(status, "Image registered: %s\n", au.imageName)
+
+	return nil
+}
+
+// publish creates a version of the gallery image definition from the
+// uploaded blob, the definition is created if needed.
+func (au *azureUploader) publish(ctx context.Context, metadata BlobMetadata, status io.Writer) error {
+	def := &au.gallery.Definition
+	version := &au.gallery.Version
+
+	fmt.Fprintf(status, "Ensuring gallery image definition %s/%s\n", def.Gallery, def.Name)
+	au.progress.Report(cloud.UploadPhaseRegister, 0, 1)
+	if err := au.client.EnsureGalleryImageDefinition(ctx, au.resourceGroup, au.location, def); err != nil {
+		return err
+	}
+	fmt.Fprintf(status, "Publishing image version %s/%s/%s\n", def.Gallery, def.Name, version.Version)
+	id, err := au.client.CreateGalleryImageVersion(ctx, au.resourceGroup, metadata.StorageAccount, metadata.ContainerName, metadata.BlobName, au.location, def, version)
+	if err != nil {
+		return err
+	}
+	au.progress.Report(cloud.UploadPhaseRegister, 1, 1)
+	fmt.Fprintf(status, "Image version published: %s\n", id)
+
+	return nil
+}
+
+// readerSize returns the size of the data of the given reader, page
+// blobs are created with their final size before uploading if it is
+// known. It returns -1 if the size cannot be determined, the page blob is
+// then resized once the whole reader is uploaded.
+func readerSize(r io.Reader) (int64, error) {
+	switch v := r.(type) {
+	case interface{ Stat() (os.FileInfo, error) }:
+		st, err := v.Stat()
+		if err != nil {
+			return 0, fmt.Errorf("cannot stat the image: %w", err)
+		}
+		return st.Size(), nil
+	case interface{ Len() int }:
+		return int64(v.Len()), nil
+	default:
+		return -1, nil
+	}
+}
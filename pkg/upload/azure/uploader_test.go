@@ -0,0 +1,389 @@
+package azure_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/osbuild/images/pkg/cloud"
+	"github.com/osbuild/images/pkg/upload/azure"
+)
+
+type fakeAzureClient struct {
+	resourceGroupErr error
+
+	storageAccountKeyErr error
+
+	registerErr       error
+	registerLocation  string
+	registerHyperVGen azure.HyperVGenerationType
+	registerCalls     int
+
+	galleryDefinition  *azure.GalleryImageDefinition
+	galleryVersion     *azure.GalleryImageVersion
+	galleryLocation    string
+	galleryVersionErr  error
+	galleryVersionBlob string
+
+	storage fakeAzureStorageClient
+}
+
+func (fa *fakeAzureClient) GetResourceGroupLocation(ctx context.Context, resourceGroup string) (string, error) {
+	return "westeurope", fa.resourceGroupErr
+}
+
+func (fa *fakeAzureClient) GetStorageAccountKey(ctx context.Context, resourceGroup string, storageAccount string) (string, error) {
+	return "key", fa.storageAccountKeyErr
+}
+
+func (fa *fakeAzureClient) RegisterImage(ctx context.Context, resourceGroup, storageAccount, storageContainer, blobName, imageName, location string, hyperVGen azure.HyperVGenerationType) error {
+	fa.registerCalls++
+	fa.registerLocation = location
+	fa.registerHyperVGen = hyperVGen
+	return fa.registerErr
+}
+
+func (fa *fakeAzureClient) EnsureGalleryImageDefinition(ctx context.Context, resourceGroup, location string, def *azure.GalleryImageDefinition) error {
+	fa.galleryDefinition = def
+	fa.galleryLocation = location
+	return nil
+}
+
+func (fa *fakeAzureClient) CreateGalleryImageVersion(ctx context.Context, resourceGroup, storageAccount, storageContainer, blobName, location string, def *azure.GalleryImageDefinition, version *azure.GalleryImageVersion) (string, error) {
+	fa.galleryVersion = version
+	fa.galleryVersionBlob = fmt.Sprintf("%s/%s/%s", storageAccount, storageContainer, blobName)
+	if fa.galleryVersionErr != nil {
+		return "", fa.galleryVersionErr
+	}
+	return fmt.Sprintf("/subscriptions/sub/resourceGroups/%s/providers/Microsoft.Compute/galleries/%s/images/%s/versions/%s", resourceGroup, def.Gallery, def.Name, version.Version), nil
+}
+
+type fakeAzureStorageClient struct {
+	container string
+
+	uploadMetadata azure.BlobMetadata
+	uploadSize     int64
+	uploaded       []byte
+	uploadErr      error
+	uploadResumes  []bool
+
+	deleteCalls int
+	deleteErr   error
+}
+
+func (fs *fakeAzureStorageClient) CreateStorageContainerIfNotExist(ctx context.Context, storageAccount, name string) error {
+	fs.container = name
+	return nil
+}
+
+func (fs *fakeAzureStorageClient) UploadPageBlobFromReader(metadata azure.BlobMetadata, r io.Reader, size int64, threads int) error {
+	if fs.uploadErr != nil {
+		return fs.uploadErr
+	}
+	fs.uploadMetadata = metadata
+	fs.uploadSize = size
+	b, err := io.ReadAll(r)
+	fs.uploaded = b
+	return err
+}
+
+func (fs *fakeAzureStorageClient) UploadPageBlobAt(metadata azure.BlobMetadata, r io.ReaderAt, size int64, threads int, resume bool) (string, error) {
+	fs.uploadResumes = append(fs.uploadResumes, resume)
+	if fs.uploadErr != nil {
+		return "", fs.uploadErr
+	}
+	fs.uploadMetadata = metadata
+	fs.uploadSize = size
+	b, err := io.ReadAll(io.NewSectionReader(r, 0, size))
+	fs.uploaded = b
+	return "sha256sum", err
+}
+
+func (fs *fakeAzureStorageClient) DeleteBlob(ctx context.Context, metadata azure.BlobMetadata) error {
+	fs.deleteCalls++
+	return fs.deleteErr
+}
+
+func mockAzureClient(t *testing.T, fa *fakeAzureClient) {
+	restore := azure.MockNewAzureClient(func(azure.Credentials, string, string) (azure.AzureClient, error) {
+		return fa, nil
+	})
+	t.Cleanup(restore)
+	restore = azure.MockNewAzureStorageClient(func(storageAccount, key string) (azure.AzureStorageClient, error) {
+		assert.Equal(t, "key", key)
+		return &fa.storage, nil
+	})
+	t.Cleanup(restore)
+}
+
+func TestUploaderCheckHappy(t *testing.T) {
+	fa := &fakeAzureClient{}
+	mockAzureClient(t, fa)
+
+	uploader, err := azure.NewUploader(azure.NewCredentials("id", "secret"), "tenant", "subscription", "group", "account", "image", nil)
+	require.NoError(t, err)
+	var statusLog bytes.Buffer
+	err = uploader.Check(&statusLog)
+	assert.NoError(t, err)
+	expectedStatusLog := `Checking Azure resource group access...
+Checking Azure storage account access...
+Upload conditions met.
+`
+	assert.Equal(t, expectedStatusLog, statusLog.String())
+}
+
+func TestUploaderCheckStorageAccountError(t *testing.T) {
+	fa := &fakeAzureClient{
+		storageAccountKeyErr: fmt.Errorf("fake-key-err"),
+	}
+	mockAzureClient(t, fa)
+
+	uploader, err := azure.NewUploader(azure.NewCredentials("id", "secret"), "tenant", "subscription", "group", "account", "image", nil)
+	require.NoError(t, err)
+	err = uploader.Check(io.Discard)
+	assert.EqualError(t, err, "retrieving the key of Azure storage account 'account' failed: fake-key-err")
+}
+
+func TestNewUploaderBadHyperVGen(t *testing.T) {
+	_, err := azure.NewUploader(azure.NewCredentials("id", "secret"), "tenant", "subscription", "group", "account", "image", &azure.UploaderOptions{
+		HyperVGeneration: "V3",
+	})
+	assert.EqualError(t, err, "unknown hyper v generation type V3")
+}
+
+func TestUploaderUploadHappy(t *testing.T) {
+	fa := &fakeAzureClient{}
+	mockAzureClient(t, fa)
+
+	uploader, err := azure.NewUploader(azure.NewCredentials("id", "secret"), "tenant", "subscription", "group", "account", "image", &azure.UploaderOptions{
+		HyperVGeneration: azure.HyperVGenV2,
+	})
+	require.NoError(t, err)
+	var uploadLog bytes.Buffer
+	err = uploader.UploadAndRegister(bytes.NewReader([]byte("fake-azure-image")), &uploadLog)
+	require.NoError(t, err)
+	assert.Equal(t, azure.DefaultStorageContainer, fa.storage.container)
+	assert.Equal(t, azure.BlobMetadata{
+		StorageAccount: "account",
+		ContainerName:  azure.DefaultStorageContainer,
+		BlobName:       "image.vhd",
+	}, fa.storage.uploadMetadata)
+	assert.Equal(t, int64(16), fa.storage.uploadSize)
+	assert.Equal(t, []byte("fake-azure-image"), fa.storage.uploaded)
+	assert.Equal(t, 1, fa.registerCalls)
+	assert.Equal(t, azure.HyperVGenV2, fa.registerHyperVGen)
+	assert.Equal(t, 0, fa.storage.deleteCalls)
+	expectedUploadLog := `Uploading image to account/imagebuilder/image.vhd
+Registering image image
+Image registered: image
+`
+	assert.Equal(t, expectedUploadLog, uploadLog.String())
+}
+
+func TestUploaderUploadButRegisterError(t *testing.T) {
+	fa := &fakeAzureClient{
+		registerErr: fmt.Errorf("fake-register-err"),
+	}
+	fa.storage.deleteErr = fmt.Errorf("fake-delete-err")
+	mockAzureClient(t, fa)
+
+	uploader, err := azure.NewUploader(azure.NewCredentials("id", "secret"), "tenant", "subscription", "group", "account", "image", nil)
+	require.NoError(t, err)
+	var uploadLog bytes.Buffer
+	err = uploader.UploadAndRegister(bytes.NewReader([]byte("fake-azure-image")), &uploadLog)
+	assert.EqualError(t, err, "fake-register-err\nfake-delete-err")
+	assert.Equal(t, azure.HyperVGenV1, fa.registerHyperVGen)
+	assert.Equal(t, 1, fa.storage.deleteCalls)
+	// the blob is only reported as deleted if it was
+	assert.NotContains(t, uploadLog.String(), "Deleted blob")
+}
+
+func TestUploaderUploadError(t *testing.T) {
+	fa := &fakeAzureClient{}
+	fa.storage.uploadErr = fmt.Errorf("fake-upload-err")
+	mockAzureClient(t, fa)
+
+	uploader, err := azure.NewUploader(azure.NewCredentials("id", "secret"), "tenant", "subscription", "group", "account", "image", nil)
+	require.NoError(t, err)
+	var uploadLog bytes.Buffer
+	err = uploader.UploadAndRegister(bytes.NewReader([]byte("fake-azure-image")), &uploadLog)
+	assert.EqualError(t, err, "fake-upload-err")
+	// the partially uploaded blob is deleted
+	assert.Equal(t, 1, fa.storage.deleteCalls)
+	assert.Equal(t, 0, fa.registerCalls)
+	expectedUploadLog := `Uploading image to account/imagebuilder/image.vhd
+Deleted blob account/imagebuilder/image.vhd
+`
+	assert.Equal(t, expectedUploadLog, uploadLog.String())
+
+	// uploads that cannot be resumed are deleted too
+	resumable, ok := uploader.(cloud.ResumableUploader)
+	require.True(t, ok)
+	fakeImage := bytes.NewReader([]byte("fake-azure-image"))
+	_, err = resumable.UploadAndRegisterAt(fakeImage, fakeImage.Size(), nil, io.Discard)
+	assert.EqualError(t, err, "fake-upload-err")
+	assert.Equal(t, 2, fa.storage.deleteCalls)
+}
+
+func TestUploaderUploadUnknownSize(t *testing.T) {
+	fa := &fakeAzureClient{}
+	mockAzureClient(t, fa)
+
+	uploader, err := azure.NewUploader(azure.NewCredentials("id", "secret"), "tenant", "subscription", "group", "account", "image", nil)
+	require.NoError(t, err)
+	err = uploader.UploadAndRegister(io.MultiReader(strings.NewReader("fake-azure-image")), io.Discard)
+	require.NoError(t, err)
+	assert.Equal(t, int64(-1), fa.storage.uploadSize)
+	assert.Equal(t, []byte("fake-azure-image"), fa.storage.uploaded)
+}
+
+func TestUploaderUploadAtResume(t *testing.T) {
+	fa := &fakeAzureClient{}
+	fa.storage.uploadErr = fmt.Errorf("fake-upload-err")
+	mockAzureClient(t, fa)
+
+	uploader, err := azure.NewUploader(azure.NewCredentials("id", "secret"), "tenant", "subscription", "group", "account", "image", nil)
+	require.NoError(t, err)
+	resumable, ok := uploader.(cloud.ResumableUploader)
+	require.True(t, ok)
+
+	var state cloud.UploadState
+	opts := &cloud.UploadAtOptions{
+		StateCallback: func(s cloud.UploadState) {
+			state = s
+		},
+	}
+	fakeImage := bytes.NewReader([]byte("fake-azure-image"))
+	_, err = resumable.UploadAndRegisterAt(fakeImage, fakeImage.Size(), opts, io.Discard)
+	assert.EqualError(t, err, "fake-upload-err")
+	// failed uploads are kept so that they can be resumed
+	assert.Equal(t, 0, fa.storage.deleteCalls)
+	assert.Equal(t, cloud.UploadState{Object: "image.vhd"}, state)
+
+	fa.storage.uploadErr = nil
+	opts.Resume = &state
+	var uploadLog bytes.Buffer
+	res, err := resumable.UploadAndRegisterAt(fakeImage, fakeImage.Size(), opts, &uploadLog)
+	require.NoError(t, err)
+	assert.Equal(t, &cloud.UploadResult{SHA256: "sha256sum"}, res)
+	assert.Equal(t, []bool{false, true}, fa.storage.uploadResumes)
+	assert.Equal(t, []byte("fake-azure-image"), fa.storage.uploaded)
+	assert.Equal(t, 1, fa.registerCalls)
+	expectedUploadLog := `Resuming upload of image to account/imagebuilder/image.vhd
+Blob uploaded (sha256:sha256sum)
+Registering image image
+Image registered: image
+`
+	assert.Equal(t, expectedUploadLog, uploadLog.String())
+
+	opts.Resume = &cloud.UploadState{Object: "other.vhd"}
+	_, err = resumable.UploadAndRegisterAt(fakeImage, fakeImage.Size(), opts, io.Discard)
+	assert.EqualError(t, err, `cannot resume the upload of blob "other.vhd" as blob "image.vhd"`)
+}
+
+func testGalleryOptions() *azure.GalleryOptions {
+	return &azure.GalleryOptions{
+		Definition: azure.GalleryImageDefinition{
+			Gallery:      "gallery",
+			Name:         "rhel-9",
+			Publisher:    "publisher",
+			Offer:        "rhel",
+			SKU:          "9",
+			SecurityType: azure.SecurityTypeTrustedLaunch,
+		},
+		Version: azure.GalleryImageVersion{
+			Version: "9.6.1",
+			TargetRegions: []azure.GalleryTargetRegion{
+				{Name: "eastus", ReplicaCount: 3},
+			},
+		},
+	}
+}
+
+func TestUploaderUploadGallery(t *testing.T) {
+	fa := &fakeAzureClient{}
+	mockAzureClient(t, fa)
+
+	uploader, err := azure.NewUploader(azure.NewCredentials("id", "secret"), "tenant", "subscription", "group", "account", "image", &azure.UploaderOptions{
+		Location:         "westeurope",
+		HyperVGeneration: azure.HyperVGenV2,
+		Gallery:          testGalleryOptions(),
+	})
+	require.NoError(t, err)
+	var uploadLog bytes.Buffer
+	err = uploader.UploadAndRegister(bytes.NewReader([]byte("fake-azure-image")), &uploadLog)
+	require.NoError(t, err)
+	assert.Equal(t, 0, fa.registerCalls)
+	require.NotNil(t, fa.galleryDefinition)
+	assert.Equal(t, azure.HyperVGenV2, fa.galleryDefinition.HyperVGeneration)
+	assert.Equal(t, azure.SecurityTypeTrustedLaunch, fa.galleryDefinition.SecurityType)
+	assert.Equal(t, "westeurope", fa.galleryLocation)
+	assert.Equal(t, &testGalleryOptions().Version, fa.galleryVersion)
+	assert.Equal(t, "account/imagebuilder/image.vhd", fa.galleryVersionBlob)
+	expectedUploadLog := `Uploading image to account/imagebuilder/image.vhd
+Ensuring gallery image definition gallery/rhel-9
+Publishing image version gallery/rhel-9/9.6.1
+Image version published: /subscriptions/sub/resourceGroups/group/providers/Microsoft.Compute/galleries/gallery/images/rhel-9/versions/9.6.1
+`
+	assert.Equal(t, expectedUploadLog, uploadLog.String())
+}
+
+func TestUploaderUploadGalleryVersionError(t *testing.T) {
+	fa := &fakeAzureClient{
+		galleryVersionErr: fmt.Errorf("fake-version-err"),
+	}
+	mockAzureClient(t, fa)
+
+	uploader, err := azure.NewUploader(azure.NewCredentials("id", "secret"), "tenant", "subscription", "group", "account", "image", &azure.UploaderOptions{
+		HyperVGeneration: azure.HyperVGenV2,
+		Gallery:          testGalleryOptions(),
+	})
+	require.NoError(t, err)
+	err = uploader.UploadAndRegister(bytes.NewReader([]byte("fake-azure-image")), io.Discard)
+	assert.EqualError(t, err, "fake-version-err")
+	assert.Equal(t, 1, fa.storage.deleteCalls)
+}
+
+func TestNewUploaderGalleryErrors(t *testing.T) {
+	mockAzureClient(t, &fakeAzureClient{})
+
+	for _, tc := range []struct {
+		modify      func(*azure.UploaderOptions)
+		expectedErr string
+	}{
+		{
+			func(opts *azure.UploaderOptions) { opts.HyperVGeneration = azure.HyperVGenV1 },
+			"security type TrustedLaunch requires hyper v generation V2",
+		},
+		{
+			func(opts *azure.UploaderOptions) { opts.Gallery.Definition.SecurityType = "Quantum" },
+			"unknown security type Quantum",
+		},
+		{
+			func(opts *azure.UploaderOptions) { opts.Gallery.Definition.Gallery = "" },
+			"gallery and image definition name must be set",
+		},
+		{
+			func(opts *azure.UploaderOptions) { opts.Gallery.Version.Version = "9.6" },
+			`gallery image version "9.6" is not in the MAJOR.MINOR.PATCH format`,
+		},
+		{
+			func(opts *azure.UploaderOptions) { opts.Gallery.Definition.Architecture = "riscv64" },
+			"unknown architecture riscv64",
+		},
+	} {
+		opts := &azure.UploaderOptions{
+			HyperVGeneration: azure.HyperVGenV2,
+			Gallery:          testGalleryOptions(),
+		}
+		tc.modify(opts)
+		_, err := azure.NewUploader(azure.NewCredentials("id", "secret"), "tenant", "subscription", "group", "account", "image", opts)
+		assert.EqualError(t, err, tc.expectedErr)
+	}
+}
@@ -3,6 +3,7 @@ package oci
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -89,6 +90,49 @@ func (c Client) uploadToBucket(objectName string, bucketName string, namespace s
 	return nil
 }
 
+// uploadStreamToBucket uploads the data of the given reader into an
+// objectName under the bucketName in the namespace.
+func (c Client) uploadStreamToBucket(objectName string, bucketName string, namespace string, r io.Reader) error {
+	req := transfer.UploadStreamRequest{
+		UploadRequest: transfer.UploadRequest{
+			NamespaceName:       common.String(namespace),
+			BucketName:          common.String(bucketName),
+			ObjectName:          common.String(objectName),
+			ObjectStorageClient: &c.storageClient,
+		},
+		StreamReader: r,
+	}
+
+	uploadManager := transfer.NewUploadManager()
+	if _, err := uploadManager.UploadStream(context.Background(), req); err != nil {
+		return fmt.Errorf("failed to upload the stream to object %s:  %w", objectName, err)
+	}
+	return nil
+}
+
+// checkCompartment checks that the compartment exists and is accessible.
+func (c Client) checkCompartment(compartmentID string) error {
+	_, err := c.identityClient.GetCompartment(context.Background(), identity.GetCompartmentRequest{
+		CompartmentId: common.String(compartmentID),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get compartment '%s': %w", compartmentID, err)
+	}
+	return nil
+}
+
+// checkBucket checks that the bucket exists in the namespace and is accessible.
+func (c Client) checkBucket(bucketName, namespace string) error {
+	_, err := c.storageClient.GetBucket(context.Background(), objectstorage.GetBucketRequest{
+		NamespaceName: common.String(namespace),
+		BucketName:    common.String(bucketName),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get bucket '%s' in namespace '%s': %w", bucketName, namespace, err)
+	}
+	return nil
+}
+
 // Create creates an image from the storageObjectName stored in the bucketName.
 // The result is an image ID or an error if the operation failed.
 func (c Client) createImage(objectName, bucketName, namespace, compartmentID, imageName string) (string, error) {
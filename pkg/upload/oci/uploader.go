@@ -0,0 +1,111 @@
+package oci
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+
+	"github.com/osbuild/images/pkg/cloud"
+)
+
+type ociUploader struct {
+	client ociAPI
+
+	bucketName    string
+	namespace     string
+	compartmentID string
+	imageName     string
+
+	progress *cloud.ProgressReporter
+}
+
+type UploaderOptions struct {
+	// ClientParams to create the client with, if nil the default
+	// configuration is used, see NewClient()
+	ClientParams *ClientParams
+	// Progress receives the structured progress of the upload in
+	// addition to the free-form text written to the status writer.
+	Progress cloud.ProgressFunc
+}
+
+// testing support
+type ociAPI interface {
+	checkCompartment(compartmentID string) error
+	checkBucket(bucketName, namespace string) error
+	uploadStreamToBucket(objectName string, bucketName string, namespace string, r io.Reader) error
+	createImage(objectName, bucketName, namespace, compartmentID, imageName string) (string, error)
+	deleteObjectFromBucket(name string, bucket string, namespace string) error
+}
+
+var newOciClient = func(clientParams *ClientParams) (ociAPI, error) {
+	return NewClient(clientParams)
+}
+
+// NewUploader returns a cloud.Uploader that uploads the image into the
+// given bucket and creates a custom image named imageName from it in
+// the given compartment.
+func NewUploader(bucketName, namespace, compartmentID, imageName string, opts *UploaderOptions) (cloud.Uploader, error) {
+	if opts == nil {
+		opts = &UploaderOptions{}
+	}
+	client, err := newOciClient(opts.ClientParams)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ociUploader{
+		client:        client,
+		bucketName:    bucketName,
+		namespace:     namespace,
+		compartmentID: compartmentID,
+		imageName:     imageName,
+		progress:      cloud.NewProgressReporter(opts.Progress),
+	}, nil
+}
+
+var _ cloud.Uploader = &ociUploader{}
+
+func (ou *ociUploader) Check(status io.Writer) error {
+	fmt.Fprintf(status, "Checking OCI compartment access...\n")
+	if err := ou.client.checkCompartment(ou.compartmentID); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(status, "Checking OCI bucket access...\n")
+	if err := ou.client.checkBucket(ou.bucketName, ou.namespace); err != nil {
+		return err
+	}
+	fmt.Fprintf(status, "Upload conditions met.\n")
+	return nil
+}
+
+func (ou *ociUploader) UploadAndRegister(r io.Reader, status io.Writer) (err error) {
+	objectName := fmt.Sprintf("%s-%s", uuid.New().String(), ou.imageName)
+	fmt.Fprintf(status, "Uploading %s to %s/%s\n", ou.imageName, ou.bucketName, objectName)
+
+	// clean up the object even if we fail
+	defer func() {
+		fmt.Fprintf(status, "Deleting object %s/%s\n", ou.bucketName, objectName)
+		err = errors.Join(err, ou.client.deleteObjectFromBucket(objectName, ou.bucketName, ou.namespace))
+	}()
+	if err := ou.client.uploadStreamToBucket(objectName, ou.bucketName, ou.namespace, ou.progress.Reader(r, 0)); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(status, "Creating image %s\n", ou.imageName)
+	ou.progress.Report(cloud.UploadPhaseImport, 0, 1)
+	imageID, err := ou.client.createImage(objectName, ou.bucketName, ou.namespace, ou.compartmentID, ou.imageName)
+	if err != nil {
+		return fmt.Errorf("failed to create a custom image using object '%s' bucket '%s' in namespace '%s': %w",
+			objectName,
+			ou.bucketName,
+			ou.namespace,
+			err)
+	}
+	ou.progress.Report(cloud.UploadPhaseImport, 1, 1)
+	fmt.Fprintf(status, "Image created: %s\n", imageID)
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package oci
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeOciClient struct {
+	compartmentErr error
+	bucketErr      error
+
+	uploaded  []byte
+	uploadErr error
+
+	createErr   error
+	createCalls int
+
+	deleteErr   error
+	deleteCalls int
+}
+
+func (fo *fakeOciClient) checkCompartment(compartmentID string) error {
+	return fo.compartmentErr
+}
+
+func (fo *fakeOciClient) checkBucket(bucketName, namespace string) error {
+	return fo.bucketErr
+}
+
+func (fo *fakeOciClient) uploadStreamToBucket(objectName string, bucketName string, namespace string, r io.Reader) error {
+	if fo.uploadErr != nil {
+		return fo.uploadErr
+	}
+	b, err := io.ReadAll(r)
+	fo.uploaded = b
+	return err
+}
+
+func (fo *fakeOciClient) createImage(objectName, bucketName, namespace, compartmentID, imageName string) (string, error) {
+	fo.createCalls++
+	return "image-id", fo.createErr
+}
+
+func (fo *fakeOciClient) deleteObjectFromBucket(name string, bucket string, namespace string) error {
+	fo.deleteCalls++
+	return fo.deleteErr
+}
+
+func mockOciClient(t *testing.T, fo *fakeOciClient) {
+	saved := newOciClient
+	newOciClient = func(*ClientParams) (ociAPI, error) {
+		return fo, nil
+	}
+	t.Cleanup(func() {
+		newOciClient = saved
+	})
+}
+
+type repeatReader struct{}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0x1
+	}
+	return len(p), nil
+}
+
+func TestUploaderCheckHappy(t *testing.T) {
+	mockOciClient(t, &fakeOciClient{})
+
+	uploader, err := NewUploader("bucket", "namespace", "compartment", "image", nil)
+	require.NoError(t, err)
+	var statusLog bytes.Buffer
+	err = uploader.Check(&statusLog)
+	assert.NoError(t, err)
+	expectedStatusLog := `Checking OCI compartment access...
+Checking OCI bucket access...
+Upload conditions met.
+`
+	assert.Equal(t, expectedStatusLog, statusLog.String())
+}
+
+func TestUploaderCheckBucketError(t *testing.T) {
+	mockOciClient(t, &fakeOciClient{bucketErr: fmt.Errorf("fake-bucket-err")})
+
+	uploader, err := NewUploader("bucket", "namespace", "compartment", "image", nil)
+	require.NoError(t, err)
+	err = uploader.Check(io.Discard)
+	assert.EqualError(t, err, "fake-bucket-err")
+}
+
+func TestUploaderUploadHappy(t *testing.T) {
+	uuid.SetRand(&repeatReader{})
+	defer uuid.SetRand(nil)
+
+	fo := &fakeOciClient{}
+	mockOciClient(t, fo)
+
+	uploader, err := NewUploader("bucket", "namespace", "compartment", "image", nil)
+	require.NoError(t, err)
+	var uploadLog bytes.Buffer
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-oci-image"), &uploadLog)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("fake-oci-image"), fo.uploaded)
+	assert.Equal(t, 1, fo.createCalls)
+	assert.Equal(t, 1, fo.deleteCalls)
+	expectedUploadLog := `Uploading image to bucket/01010101-0101-4101-8101-010101010101-image
+Creating image image
+Image created: image-id
+Deleting object bucket/01010101-0101-4101-8101-010101010101-image
+`
+	assert.Equal(t, expectedUploadLog, uploadLog.String())
+}
+
+func TestUploaderUploadErrorStillDeletes(t *testing.T) {
+	fo := &fakeOciClient{
+		uploadErr: fmt.Errorf("fake-upload-err"),
+		deleteErr: fmt.Errorf("fake-delete-err"),
+	}
+	mockOciClient(t, fo)
+
+	uploader, err := NewUploader("bucket", "namespace", "compartment", "image", nil)
+	require.NoError(t, err)
+	err = uploader.UploadAndRegister(bytes.NewBufferString("fake-oci-image"), io.Discard)
+	assert.EqualError(t, err, "fake-upload-err\nfake-delete-err")
+	assert.Equal(t, 0, fo.createCalls)
+	assert.Equal(t, 1, fo.deleteCalls)
+}